@@ -1,23 +1,233 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/cache"
 	"go-manage-mysql/internal/database"
+	"go-manage-mysql/internal/encryption"
+	"go-manage-mysql/internal/federation"
+	"go-manage-mysql/internal/health"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/logging"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/privacy"
+	"go-manage-mysql/internal/ratelimit"
+	"go-manage-mysql/internal/repository"
 	"go-manage-mysql/internal/router"
-	"log"
+	"go-manage-mysql/internal/server"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gorm.io/gorm"
 )
 
 func main() {
+	if err := config.LoadEnv(); err != nil {
+		fatal("error loading .env", err)
+	}
+
+	args := os.Args[1:]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		printConfig(args[2:])
+		return
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	config.SetCurrent(cfg)
+	slog.SetDefault(logging.New(cfg.Log, os.Stderr))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		fatal("error setting up tracing", err)
+	}
+
+	// retries until the database is reachable, a signal aborts the wait
+	conn, err := database.InitDatabase(ctx)
+	if err != nil {
+		fatal("error initializing database", err)
+	}
+	startupFailed := func(msg string, err error) {
+		database.Close(conn)
+		fatal(msg, err)
+	}
 
-	config.LoadEnv()
+	// the bootstrap admin is encrypted like every other user
+	var cipher repository.FieldCipher
+	if cfg.Encryption.Enabled() {
+		keyring, err := encryption.Load(ctx, cfg.Encryption, repository.NewDataKeyRepository(conn))
+		if err != nil {
+			startupFailed("error loading encryption keys", err)
+		}
+		cipher = keyring
+	}
+
+	if cfg.Bootstrap.Enabled {
+		if err := bootstrapAdmin(ctx, conn, cfg.Bootstrap, cipher); err != nil {
+			startupFailed("error bootstrapping admin", err)
+		}
+	}
 
-	conn, err := database.InitDatabase()
+	cluster, err := database.OpenCluster(ctx, conn)
 	if err != nil {
-		log.Fatal(err)
+		startupFailed("error opening read replicas", err)
+	}
+	cluster.Actor = middleware.Username
+	startupFailed = func(msg string, err error) {
+		cluster.Close()
+		fatal(msg, err)
 	}
 
-	router := router.SetupRouter(conn)
-	if err := router.Run(config.Port); err != nil {
-		log.Fatal("error starting server. Error: %w", err)
+	if err := instrument(conn, cfg.Database.Name); err != nil {
+		startupFailed("error instrumenting database", err)
+	}
+	for addr, replica := range cluster.Replicas() {
+		if err := instrument(replica, cfg.Database.Name+"@"+addr); err != nil {
+			startupFailed("error instrumenting replica", err)
+		}
+	}
+
+	userCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		startupFailed("error creating cache", err)
 	}
+
+	checks := health.NewRegistry(cfg.Health.CheckTimeout)
+	checks.Register("database", database.PingCheck(conn))
+	checks.Register("migrations", database.MigrationsCheck(conn))
+
+	deps := router.Dependencies{DB: conn, DBRouter: cluster, Cache: userCache, Health: checks, Passwords: password.NewHasher(cfg.Password), Cipher: cipher}
+	deps.Jobs = jobs.NewManager(repository.NewJobRepository(conn), router.UserServices(deps), cfg.Jobs)
+	deps.Privacy = privacy.NewService(repository.NewPrivacyRepository(conn), router.UserServices(deps), cfg.Privacy)
+	if cfg.OIDC.Enabled() {
+		key, err := oidc.LoadKey(cfg.OIDC.SigningKeyFile)
+		if err != nil {
+			startupFailed("error loading openid connect signing key", err)
+		}
+		deps.OIDC = oidc.NewProvider(repository.NewOAuthRepository(conn), router.UserServices(deps), key, cfg.OIDC)
+	}
+	if cfg.Federation.Enabled() {
+		providers, err := federation.LoadProviders(cfg.Federation.ProvidersFile)
+		if err != nil {
+			startupFailed("error loading identity providers", err)
+		}
+		deps.Federation = federation.NewService(providers, repository.NewIdentityRepository(conn), router.UserServices(deps), cfg.Federation)
+	}
+
+	// with several instances buckets are shared through the cache server
+	var limitStore ratelimit.Store = ratelimit.NewMemory()
+	var limitClient *cache.RESP
+	if cfg.RateLimit.Store == cache.BackendRedis {
+		limitClient = cache.NewRESP(cache.RESPOptions{
+			Addr:     cfg.Cache.RedisAddr,
+			Password: cfg.Cache.RedisPassword,
+			DB:       cfg.Cache.RedisDB,
+			Timeout:  cfg.Cache.Timeout,
+			PoolSize: cfg.Cache.PoolSize,
+		})
+		limitStore = ratelimit.NewRedis(limitClient)
+	}
+	deps.RateLimit, err = ratelimit.New(cfg.RateLimit, cfg.Server.BasePath, limitStore)
+	if err != nil {
+		startupFailed("error creating rate limiter", err)
+	}
+
+	srv, err := server.New(cfg.Server, router.SetupRouter(deps))
+	if err != nil {
+		startupFailed("error creating server", err)
+	}
+	if len(cfg.Database.Replicas) > 0 {
+		srv.Go("replica-health", cluster.Watch)
+	}
+	if cfg.Jobs.Workers > 0 {
+		// jobs interrupted by the last shutdown are resumed right away
+		srv.Go("jobs", deps.Jobs.Run)
+	}
+	// erasures past their grace period are carried out right away
+	srv.Go("erasures", deps.Privacy.Run)
+	checks.Register("workers", srv.WorkersCheck)
+	srv.OnShutdownStart(checks.SetShuttingDown)
+	srv.OnShutdown("tracing", shutdownTracing)
+	srv.OnShutdown("database", func(ctx context.Context) error {
+		return cluster.Close()
+	})
+	if userCache != nil {
+		srv.OnShutdown("cache", func(ctx context.Context) error {
+			return userCache.Close()
+		})
+	}
+
+	if limitClient != nil {
+		srv.OnShutdown("rate-limit", func(ctx context.Context) error {
+			return limitClient.Close()
+		})
+	}
+
+	slog.Info("server listening", "addr", cfg.Server.Addr, "tls", cfg.Server.TLSEnabled())
+	if err := srv.Run(ctx); err != nil {
+		fatal("server stopped with errors", err)
+	}
+	slog.Info("server stopped")
+}
+
+// printConfig shows the effective configuration, then any validation errors.
+func printConfig(args []string) {
+	cfg, err := config.Load(args)
+	if printErr := cfg.Print(os.Stdout); printErr != nil {
+		fatal("error printing configuration", printErr)
+	}
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+}
+
+// bootstrapAdmin creates the first admin. A generated password goes to stderr
+// only, never to the logs.
+func bootstrapAdmin(ctx context.Context, conn *gorm.DB, cfg config.BootstrapConfig, cipher repository.FieldCipher) error {
+	result, err := database.Bootstrap(ctx, conn, cfg, cipher, false)
+	if err != nil || !result.Changed() {
+		return err
+	}
+
+	if result.Rotated {
+		slog.Warn("legacy admin still had the default password, it was replaced", "username", result.Username)
+	} else {
+		slog.Info("initial admin created", "username", result.Username)
+	}
+	if result.Password != "" {
+		fmt.Fprintf(os.Stderr, "\n  admin %q has the one-time password: %s\n  it must be changed on first login\n\n", result.Username, result.Password)
+	}
+	return nil
+}
+
+// instrument adds metrics and tracing to db, name labels its pool stats.
+func instrument(db *gorm.DB, name string) error {
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return fmt.Errorf("error registering metrics plugin: %w", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return fmt.Errorf("error registering tracing plugin: %w", err)
+	}
+	if err := metrics.RegisterDBStats(db, name); err != nil {
+		return fmt.Errorf("error registering database metrics: %w", err)
+	}
+	return nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -3,16 +3,79 @@ package config
 //db queries
 
 const (
-	ExistsDB = "SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?"
-	CreateDB = "CREATE DATABASE IF NOT EXISTS %s"
+	CreateDB = "CREATE DATABASE IF NOT EXISTS %s CHARACTER SET %s COLLATE %s"
+
+	GetLock     = "SELECT GET_LOCK(?, ?)"
+	ReleaseLock = "SELECT RELEASE_LOCK(?)"
 )
 
 // db test queries
 
 const (
-	SearchTestQuery    = "SELECT \\* FROM `users`"
-	SaveTestQuery      = "INSERT INTO `users`"
-	UpdateTestQuery    = "UPDATE `users` SET"
-	DeleteTestQuery    = "DELETE FROM `users`"
-	ChangePwdTestQuery = "UPDATE `users` SET"
+	SearchTestQuery          = "SELECT \\* FROM `users`"
+	SaveTestQuery            = "INSERT INTO `users`"
+	UpdateTestQuery          = "UPDATE `users` SET"
+	DeleteTestQuery          = "DELETE FROM `users`"
+	ChangePwdTestQuery       = "UPDATE `users` SET"
+	ListTestQuery            = "SELECT \\* FROM `users` ORDER BY username"
+	DisableTestQuery         = "UPDATE `users` SET `disabled`"
+	LockTestQuery            = "SELECT \\* FROM `users` .* FOR UPDATE"
+	SearchByIDTestQuery      = "SELECT \\* FROM `users` WHERE id = \\?"
+	FindTakenTestQuery       = "SELECT \\* FROM `users` WHERE username IN .* OR email IN .* OR phone IN"
+	FindTakenIndexTestQuery  = "SELECT \\* FROM `users` WHERE .* OR email_index IN .* OR phone_index IN"
+	PlaintextTakenTestQuery  = "SELECT `username`,`email`,`phone` FROM `users` WHERE email IN .* OR phone IN"
+	ReencryptTestQuery       = "SELECT \\* FROM `users` WHERE id > \\? ORDER BY id LIMIT \\? FOR UPDATE"
+	ReencryptUserTestQuery   = "UPDATE `users` SET `name`=\\?,`surname`=\\?,`phone`=\\?,`email`=\\?,`email_index`=\\?,`phone_index`=\\? WHERE id = \\?"
+	ReplaceTestQuery         = "UPDATE `users` SET .*`password`=.*`role`="
+	ExportTestQuery          = "SELECT \\* FROM `users` .*ORDER BY `users`.`id` LIMIT"
+	CountTestQuery           = "SELECT count\\(\\*\\) FROM `users`"
+	DisableManyTestQuery     = "UPDATE `users` SET `disabled`=.* WHERE username IN .* AND disabled ="
+	ExpirePasswordsTestQuery = "UPDATE `users` SET `must_change_password`=.* WHERE username IN .* AND must_change_password ="
+	RehashPwdTestQuery       = "UPDATE `users` SET `password`=\\? WHERE username = \\? AND password = \\?"
+
+	CreateJobTestQuery       = "INSERT INTO `jobs`"
+	GetJobTestQuery          = "SELECT \\* FROM `jobs` WHERE id = \\? LIMIT"
+	ClaimJobTestQuery        = "SELECT \\* FROM `jobs` WHERE .* ORDER BY created_at LIMIT \\? FOR UPDATE SKIP LOCKED"
+	LockJobTestQuery         = "SELECT \\* FROM `jobs` WHERE id = \\? LIMIT \\? FOR UPDATE"
+	UpdateJobTestQuery       = "UPDATE `jobs` SET"
+	CancelRequestedTestQuery = "SELECT `cancel_requested` FROM `jobs`"
+
+	GetClientTestQuery        = "SELECT \\* FROM `oauth_clients` WHERE id = \\?"
+	DeleteClientTestQuery     = "DELETE FROM `oauth_clients` WHERE id = \\?"
+	RevokeClientTestQuery     = "UPDATE `oauth_tokens` SET `revoked_at`=\\? WHERE client_id = \\? AND revoked_at IS NULL"
+	LockCodeTestQuery         = "SELECT \\* FROM `oauth_codes` WHERE hash = \\? LIMIT \\? FOR UPDATE"
+	UseCodeTestQuery          = "UPDATE `oauth_codes` SET `used_at`"
+	LockRefreshTokenTestQuery = "SELECT \\* FROM `oauth_tokens` WHERE hash = \\? AND kind = \\? LIMIT \\? FOR UPDATE"
+	RevokeTokenTestQuery      = "UPDATE `oauth_tokens` SET `revoked_at`"
+
+	FindIdentityTestQuery   = "SELECT \\* FROM `federated_identities` WHERE issuer = \\? AND subject = \\? LIMIT \\?"
+	DeleteIdentityTestQuery = "DELETE FROM `federated_identities` WHERE id = \\?"
+
+	CreateAPIKeyTestQuery = "INSERT INTO `api_keys`"
+	GetAPIKeyTestQuery    = "SELECT \\* FROM `api_keys` WHERE prefix = \\? LIMIT \\?"
+	ListAPIKeysTestQuery  = "SELECT \\* FROM `api_keys`"
+	RevokeAPIKeyTestQuery = "UPDATE `api_keys` SET `revoked_at`=\\? WHERE id = \\? AND revoked_at IS NULL"
+	TouchAPIKeyTestQuery  = "UPDATE `api_keys` SET `last_used_at`=\\? WHERE id = \\?"
+
+	CreateSessionTestQuery    = "INSERT INTO `sessions`"
+	GetSessionTestQuery       = "SELECT \\* FROM `sessions` WHERE id = \\? LIMIT \\?"
+	ListSessionsTestQuery     = "SELECT \\* FROM `sessions` WHERE revoked_at IS NULL AND expires_at > \\?"
+	EndSessionTestQuery       = "UPDATE `sessions` SET `revoked_at`=\\? WHERE id = \\? AND revoked_at IS NULL"
+	EndOtherSessionsTestQuery = "UPDATE `sessions` SET `revoked_at`=\\? WHERE username = \\? AND revoked_at IS NULL AND id <> \\?"
+	EndUserSessionsTestQuery  = "UPDATE `sessions` SET `revoked_at`=\\? WHERE username IN \\(\\?.*\\) AND revoked_at IS NULL"
+	TouchSessionTestQuery     = "UPDATE `sessions` SET `last_seen_at`=\\? WHERE id = \\?"
+
+	ListDataKeysTestQuery     = "SELECT \\* FROM `data_keys` ORDER BY created_at, id"
+	RewrapDataKeyTestQuery    = "UPDATE `data_keys` SET `master_key_id`=\\?,`wrapped`=\\? WHERE id = \\?"
+	RecordIndexCheckTestQuery = "UPDATE `data_keys` SET `index_check`=\\? WHERE index_check = \\?"
+
+	CreateErasureTestQuery   = "INSERT INTO `erasure_requests`"
+	PendingErasureTestQuery  = "SELECT \\* FROM `erasure_requests` WHERE user_id = \\? AND state = \\? LIMIT \\?"
+	CancelErasureTestQuery   = "UPDATE `erasure_requests` SET `cancelled_at`=\\?,`state`=\\? WHERE id = \\? AND state = \\?"
+	DueErasuresTestQuery     = "SELECT \\* FROM `erasure_requests` WHERE state = \\? AND scheduled_at <= \\? ORDER BY scheduled_at LIMIT \\?"
+	LockErasureTestQuery     = "SELECT \\* FROM `erasure_requests` WHERE id = \\? AND state = \\? LIMIT \\? FOR UPDATE"
+	CompleteErasureTestQuery = "UPDATE `erasure_requests` SET `username`=\\?,`requested_by`=\\?,`state`=\\?,`completed_at`=\\?,`receipt`=\\? WHERE `id` = \\?"
+	ScrubJobsTestQuery       = "SELECT `id`,`params`,`result` FROM `jobs` WHERE state IN \\(\\?,\\?,\\?\\) AND \\(JSON_SEARCH\\(params, 'one', \\?\\) IS NOT NULL OR JSON_SEARCH\\(result, 'one', \\?\\) IS NOT NULL\\)"
+	ScrubJobParamsTestQuery  = "UPDATE `jobs` SET `params`=\\? WHERE id IN \\(\\?,\\?\\)"
+	ScrubJobResultTestQuery  = "UPDATE `jobs` SET `result`=\\? WHERE id IN \\(\\?\\)"
 )
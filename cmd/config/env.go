@@ -1,68 +1,43 @@
 package config
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
-// environment variables set
-func LoadEnv() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
+func loadDotEnv() error {
+	return godotenv.Load()
 }
 
 func GetUser() string {
-	return os.Getenv("DB_USER")
+	return Current().Database.User
 }
 
 func GetPassword() string {
-	return os.Getenv("DB_PASSWORD")
+	return Current().Database.Password
 }
 
 func GetHost() string {
-	return os.Getenv("DB_HOST")
-}
-
-func GetDBPort() string {
-	return os.Getenv("DB_PORT")
+	return Current().Database.Host
 }
 
 func GetDBName() string {
-	return os.Getenv("DB_NAME")
+	return Current().Database.Name
 }
 
 func GetToken() string {
-	return os.Getenv("TOKEN")
+	return Current().Auth.TokenSecret
 }
 
-func GetTokenValidTime() int {
-	time, _ := strconv.Atoi(os.Getenv("TOKEN_VALID_TIME"))
-	return time
+func GetTokenValidTime() time.Duration {
+	return Current().Auth.TokenValidTime
 }
 
 func GetDsn() string {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-	)
-	return dsn
+	return Current().Database.ServerDSN()
 }
 
 func GetDBDsn() string {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
-	return dsn
+	return Current().Database.DSN()
 }
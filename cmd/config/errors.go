@@ -10,6 +10,56 @@ var (
 	ErrNoNewData         = errors.New("no new data to update")
 	ErrPwdMatching       = errors.New("passwords doesnt match")
 	ErrRecordNotFound    = errors.New("record not found")
+	ErrUserDisabled      = errors.New("user is disabled")
+	ErrInvalidRole       = errors.New("role must be user or admin")
+	ErrUsernameChange    = errors.New("username cannot be changed")
+	ErrVersionMismatch   = errors.New("user was modified since it was read")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobFinished       = errors.New("job already finished")
+	ErrUnknownJobType    = errors.New("unknown job type")
+	ErrInvalidJobParams  = errors.New("invalid job params")
+	ErrClientNotFound    = errors.New("oauth client not found")
+	ErrPasswordChange    = errors.New("password change required")
+	ErrInvalidClient     = errors.New("client name and at least one absolute redirect uri without fragment are required")
+	ErrUnknownProvider   = errors.New("unknown identity provider")
+	ErrLoginState        = errors.New("login state is missing, expired or does not match")
+	ErrLoginRejected     = errors.New("the identity provider did not authenticate the user")
+	ErrInvalidIDToken    = errors.New("invalid id token")
+	ErrProviderFailed    = errors.New("identity provider could not be reached")
+	ErrIdentityNotLinked = errors.New("no user is linked to this identity")
+	ErrDomainNotAllowed  = errors.New("email domain is not allowed to sign up")
+	ErrMissingClaims     = errors.New("the identity provider did not release the claims needed to create the user")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrInvalidAPIKey     = errors.New("invalid api key")
+	ErrAPIKeyExpired     = errors.New("api key expired")
+	ErrInvalidScope      = errors.New("unknown api key scope")
+	ErrInvalidKeyRequest = errors.New("api key name and at least one scope are required")
+	ErrInvalidExpiry     = errors.New("api key expiry must be in the future and within the maximum lifetime")
+	ErrMissingToken      = errors.New("required token")
+	ErrTokenFormat       = errors.New("invalid token format")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrSessionEnded      = errors.New("session has ended, log in again")
+	ErrUnknownHash       = errors.New("unsupported password hash format")
+	ErrEncryptionOff     = errors.New("personal data encryption is not enabled")
+	ErrInvalidMasterKey  = errors.New("master keys must be id:key pairs with unique ids and base64 256-bit keys")
+	ErrInvalidIndexKey   = errors.New("index key must be a base64 256-bit key")
+	ErrIndexKeyMismatch  = errors.New("index key differs from the one the stored data is indexed with")
+	ErrUnknownMasterKey  = errors.New("data key is wrapped by an unknown master key")
+	ErrUnknownDataKey    = errors.New("value is encrypted with an unknown data key")
+	ErrDecrypting        = errors.New("encrypted value could not be decrypted")
+	ErrErasureNotFound   = errors.New("erasure request not found")
+	ErrErasurePending    = errors.New("an erasure of this user is already pending")
+	ErrLastAdmin         = errors.New("the last admin cannot be erased")
+	ErrTooManyRequests   = errors.New("too many requests, retry later")
+)
+
+// repository errors
+var (
+	ErrNoRowsAffected = errors.New("no rows affected")
+	ErrJobLost        = errors.New("job is no longer owned by this worker")
+	ErrCodeUsed       = errors.New("authorization code already used")
+	ErrTokenRevoked   = errors.New("token already revoked")
 )
 
 // handler errors
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileEnv  = "CONFIG_FILE"
+	configFileFlag = "config"
+	secretFileEnv  = "_FILE"
+	redacted       = "******"
+)
+
+// value sources, from lowest to highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+type FieldError struct {
+	Key string
+	Msg string
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+var (
+	currentMu sync.RWMutex
+	current   *Config
+)
+
+// SetCurrent makes cfg the configuration returned by Current.
+func SetCurrent(cfg *Config) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = cfg
+}
+
+// Current returns the loaded configuration, falling back to defaults and
+// environment variables when Load has not been run (tests, tooling). The
+// fallback is built once and kept until SetCurrent replaces it.
+func Current() *Config {
+	currentMu.RLock()
+	cfg := current
+	currentMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		current = &Config{sources: map[string]string{}}
+		for _, f := range fieldsOf(current) {
+			_ = f.set(f.def, SourceDefault)
+		}
+		_ = applyEnv(current)
+	}
+	return current
+}
+
+// Load builds the configuration from defaults, the config file, environment
+// variables and command line flags (in increasing precedence) and validates it.
+// The returned config is usable for printing even when an error is reported.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := LoadArgs(args)
+	return cfg, err
+}
+
+// LoadArgs is Load for commands that take their own arguments after the
+// configuration flags. The arguments left after flag parsing are returned.
+func LoadArgs(args []string) (*Config, []string, error) {
+	cfg := &Config{sources: map[string]string{}}
+	fields := fieldsOf(cfg)
+
+	var errs []error
+	for _, f := range fields {
+		if err := f.set(f.def, SourceDefault); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String(configFileFlag, os.Getenv(configFileEnv), "path to a yaml or toml config file")
+	flagValues := map[string]*string{}
+	for _, f := range fields {
+		flagValues[f.flag] = fs.String(f.flag, "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *configFile != "" {
+		errs = append(errs, applyFile(cfg, *configFile))
+	}
+
+	errs = append(errs, applyEnv(cfg))
+
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flag == fl.Name {
+				errs = append(errs, f.set(*flagValues[fl.Name], SourceFlag))
+			}
+		}
+	})
+
+	errs = append(errs, cfg.Validate())
+
+	return cfg, fs.Args(), errors.Join(errs...)
+}
+
+// LoadEnv loads a .env file when present. Missing files are not an error so
+// containers can rely on the real environment.
+func LoadEnv() error {
+	if err := loadDotEnv(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error loading .env file: %w", err)
+	}
+	return nil
+}
+
+// Print writes the effective configuration with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tENV")
+	for _, f := range fieldsOf(c) {
+		value := f.format()
+		if f.secret && value != "" {
+			value = redacted
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.key, value, c.Source(f.key), f.env)
+	}
+	return tw.Flush()
+}
+
+// Source tells where the effective value of a key came from.
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+func applyFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", raw, values)
+
+	byKey := map[string]field{}
+	for _, f := range fieldsOf(cfg) {
+		byKey[f.key] = f
+	}
+
+	var errs []error
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f, ok := byKey[key]
+		if !ok {
+			errs = append(errs, &FieldError{Key: key, Msg: "unknown setting in " + path})
+			continue
+		}
+		errs = append(errs, f.set(values[key], SourceFile))
+	}
+	return errors.Join(errs...)
+}
+
+func applyEnv(cfg *Config) error {
+	var errs []error
+	for _, f := range fieldsOf(cfg) {
+		if f.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(f.env); ok {
+			errs = append(errs, f.set(value, SourceEnv))
+		}
+		if !f.secret {
+			continue
+		}
+		if path, ok := os.LookupEnv(f.env + secretFileEnv); ok && path != "" {
+			secret, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, &FieldError{Key: f.key, Msg: fmt.Sprintf("error reading %s: %v", f.env+secretFileEnv, err)})
+				continue
+			}
+			errs = append(errs, f.set(strings.TrimRight(string(secret), "\r\n"), SourceEnv))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func flatten(prefix string, in map[string]interface{}, out map[string]string) {
+	for key, value := range in {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+type field struct {
+	key    string
+	env    string
+	flag   string
+	usage  string
+	def    string
+	unit   string
+	secret bool
+	value  reflect.Value
+	cfg    *Config
+}
+
+func fieldsOf(cfg *Config) []field {
+	var fields []field
+	collectFields(cfg, "", reflect.ValueOf(cfg).Elem(), &fields)
+	return fields
+}
+
+func collectFields(cfg *Config, prefix string, v reflect.Value, out *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := sf.Tag.Lookup("key")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+			collectFields(cfg, key, v.Field(i), out)
+			continue
+		}
+		*out = append(*out, field{
+			key:    key,
+			env:    sf.Tag.Get("env"),
+			flag:   strings.NewReplacer(".", "-", "_", "-").Replace(key),
+			usage:  sf.Tag.Get("usage"),
+			def:    sf.Tag.Get("default"),
+			unit:   sf.Tag.Get("unit"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+			cfg:    cfg,
+		})
+	}
+}
+
+func (f field) set(raw, source string) error {
+	raw = strings.TrimSpace(raw)
+	if err := setValue(f.value, raw, f.unit); err != nil {
+		return &FieldError{Key: f.key, Msg: fmt.Sprintf("invalid value %q from %s: %v", raw, source, err)}
+	}
+	f.cfg.sources[f.key] = source
+	return nil
+}
+
+func (f field) format() string {
+	switch v := f.value.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+func setValue(v reflect.Value, raw, unit string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			scale, ok := durationUnits[unit]
+			if !ok {
+				scale = time.Second
+			}
+			v.SetInt(n * int64(scale))
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		if raw == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		if raw == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
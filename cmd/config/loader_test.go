@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func requiredEnv(t *testing.T) {
+	t.Setenv("DB_USER", "root")
+	t.Setenv("DB_NAME", "users")
+	t.Setenv("TOKEN", "jwt-signing-key")
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	requiredEnv(t)
+	file := writeFile(t, "config.yaml", "server:\n  addr: \":9000\"\n  base_path: /from-file\ndatabase:\n  host: file-host\n  port: 3307\n")
+	t.Setenv("DB_HOST", "env-host")
+
+	cfg, err := Load([]string{"-config", file, "-database-host", "flag-host", "-auth-token-valid-time", "30m"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr)
+	assert.Equal(t, SourceFile, cfg.Source("server.addr"))
+	assert.Equal(t, "flag-host", cfg.Database.Host)
+	assert.Equal(t, SourceFlag, cfg.Source("database.host"))
+	assert.Equal(t, 3307, cfg.Database.Port)
+	assert.Equal(t, "root", cfg.Database.User)
+	assert.Equal(t, SourceEnv, cfg.Source("database.user"))
+	assert.Equal(t, 30*time.Minute, cfg.Auth.TokenValidTime)
+	assert.Equal(t, "/api/go-manage", Current().Server.BasePath)
+}
+
+func TestLoadToml(t *testing.T) {
+	requiredEnv(t)
+	file := writeFile(t, "config.toml", "[database]\nhost = \"toml-host\"\nport = 3310\n")
+
+	cfg, err := Load([]string{"-config", file})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "toml-host", cfg.Database.Host)
+	assert.Equal(t, 3310, cfg.Database.Port)
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "password", "s3cr3t\n"))
+
+	cfg, err := Load(nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", cfg.Database.Password)
+}
+
+func TestLoadTokenValidTimeHours(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("TOKEN_VALID_TIME", "2")
+
+	cfg, err := Load(nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, cfg.Auth.TokenValidTime)
+}
+
+func TestLoadArgsRemaining(t *testing.T) {
+	requiredEnv(t)
+
+	cfg, rest, err := LoadArgs([]string{"-database-host", "flag-host", "users", "list", "-output", "json"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "flag-host", cfg.Database.Host)
+	assert.Equal(t, []string{"users", "list", "-output", "json"}, rest)
+}
+
+func TestDatabaseNameValidation(t *testing.T) {
+	requiredEnv(t)
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"users", true},
+		{"go-manage_2", true},
+		{"users; DROP DATABASE mysql", false},
+		{"a`b", false},
+		{"../etc", false},
+		{strings.Repeat("a", 65), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_NAME", tt.name)
+
+			_, err := Load(nil)
+
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "database.name")
+			}
+		})
+	}
+}
+
+func TestOIDCIssuerValidation(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("OIDC_SIGNING_KEY_FILE", "/run/secrets/oidc.pem")
+
+	tests := []struct {
+		issuer string
+		valid  bool
+	}{
+		{"https://id.example.com/api/go-manage", true},
+		{"http://localhost:8080/api/go-manage", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://id.example.com", false},
+		{"https://id.example.com/", false},
+		{"https://id.example.com?tenant=1", false},
+		{"id.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.issuer, func(t *testing.T) {
+			t.Setenv("OIDC_ISSUER", tt.issuer)
+
+			_, err := Load(nil)
+
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "oidc.issuer")
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	requiredEnv(t)
+
+	t.Setenv("RATE_LIMIT_POLICIES", "post /login 10/1m,* /admin/* 100/1s burst=20 key=user,GET * 1/1h key=api_key")
+	cfg, err := Load(nil)
+	assert.NoError(t, err)
+	policies, err := cfg.RateLimit.ParsePolicies()
+	assert.NoError(t, err)
+	assert.Equal(t, []RatePolicy{
+		{Method: "POST", Route: "/login", Tokens: 10, Period: time.Minute, Burst: 10, Key: RateKeyIP},
+		{Method: "*", Route: "/admin/*", Tokens: 100, Period: time.Second, Burst: 20, Key: RateKeyUser},
+		{Method: "GET", Route: "*", Tokens: 1, Period: time.Hour, Burst: 1, Key: RateKeyAPIKey},
+	}, policies)
+	assert.True(t, policies[1].Matches("DELETE", "/admin/sessions/:id"))
+	assert.False(t, policies[0].Matches("POST", "/login/providers"))
+
+	for _, policy := range []string{
+		"POST /login",
+		"POST login 10/1m",
+		"POST /login 0/1m",
+		"POST /login 10/soon",
+		"POST /login 10/1m burst=-1",
+		"POST /login 10/1m key=session",
+		"POST /login 10/1m window=1m",
+	} {
+		t.Setenv("RATE_LIMIT_POLICIES", policy)
+		_, err := Load(nil)
+		assert.ErrorContains(t, err, "rate_limit.policies", policy)
+	}
+}
+
+func TestTrustedProxiesValidation(t *testing.T) {
+	requiredEnv(t)
+
+	t.Setenv("SERVER_TRUSTED_PROXIES", "10.0.0.0/8,192.168.1.10,::1")
+	_, err := Load(nil)
+	assert.NoError(t, err)
+
+	t.Setenv("SERVER_TRUSTED_PROXIES", "proxy.internal")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "server.trusted_proxies")
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	t.Setenv("TOKEN_VALID_TIME", "abc")
+	t.Setenv("DB_PORT", "99999")
+	file := writeFile(t, "config.yaml", "database:\n  unknown: 1\n")
+
+	_, err := Load([]string{"-config", file})
+
+	assert.Error(t, err)
+	for _, key := range []string{"auth.token_valid_time", "database.port", "database.user", "database.name", "auth.token_secret", "database.unknown"} {
+		assert.Contains(t, err.Error(), key)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	cfg, err := Load(nil)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, cfg.Print(&out))
+
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "jwt-signing-key")
+	assert.Contains(t, out.String(), redacted)
+	assert.Contains(t, out.String(), "database.host")
+}
+
+func TestCurrentLoadsOnce(t *testing.T) {
+	SetCurrent(nil)
+	t.Cleanup(func() { SetCurrent(nil) })
+	t.Setenv("SERVER_ADDR", ":9000")
+
+	cfg := Current()
+	t.Setenv("SERVER_ADDR", ":9001")
+
+	assert.Same(t, cfg, Current())
+	assert.Equal(t, ":9000", Current().Server.Addr)
+}
+
+func TestLoadEnvMissingFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	assert.NoError(t, LoadEnv())
+}
+
+func TestDatabaseDSN(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("DB_PASSWORD", "p@ss/word")
+
+	cfg, err := Load([]string{"-database-connect-timeout", "3s"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "root:p@ss/word@tcp(localhost:3306)/users?collation=utf8mb4_unicode_ci&parseTime=true&timeout=3s", cfg.Database.DSN())
+	assert.Equal(t, "root:p@ss/word@tcp(localhost:3306)/?collation=utf8mb4_unicode_ci&parseTime=true&timeout=3s", cfg.Database.ServerDSN())
+}
+
+func TestDatabaseReplicas(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("DB_REPLICAS", "replica-1,replica-2:3307")
+
+	cfg, err := Load(nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"replica-1", "replica-2:3307"}, cfg.Database.Replicas)
+	assert.Equal(t, "root@tcp(replica-1:3306)/users?collation=utf8mb4_unicode_ci&parseTime=true&timeout=5s", cfg.Database.ReplicaDSN("replica-1"))
+	assert.Equal(t, "root@tcp(replica-2:3307)/users?collation=utf8mb4_unicode_ci&parseTime=true&timeout=5s", cfg.Database.ReplicaDSN("replica-2:3307"))
+
+	t.Setenv("DB_REPLICAS", "replica-1,:3307")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "database.replicas")
+}
@@ -3,18 +3,71 @@ package config
 // messages from responses
 const (
 	//success messages
-	CreatedUserMessage = "user created successfully"
-	SearchUserMessage  = "user found successfully"
-	UpdateUserMessage  = "user updated successfully"
-	DeleteUserMessage  = "user deleted successfully"
-	ChangePwdMessage   = "password changed successfully"
+	CreatedUserMessage    = "user created successfully"
+	SearchUserMessage     = "user found successfully"
+	UpdateUserMessage     = "user updated successfully"
+	DeleteUserMessage     = "user deleted successfully"
+	ChangePwdMessage      = "password changed successfully"
+	DisableUserMessage    = "user disabled successfully"
+	EnableUserMessage     = "user enabled successfully"
+	ImportUsersMessage    = "import finished"
+	DryRunMessage         = "dry run finished, nothing was written"
+	ExportUsersMessage    = "%d users exported to %s"
+	SubmitJobMessage      = "job queued"
+	SearchJobMessage      = "job found successfully"
+	CancelJobMessage      = "job cancelled"
+	CancellingJobMessage  = "job cancellation requested, it stops after the current batch"
+	RegisterClientMessage = "client registered, the secret is only shown once"
+	ListClientsMessage    = "clients found successfully"
+	DeleteClientMessage   = "client deleted, its tokens are revoked"
+	ListProvidersMessage  = "identity providers found successfully"
+	CreateKeyMessage      = "api key created, the key is only shown once"
+	ListKeysMessage       = "api keys found successfully"
+	RevokeKeyMessage      = "api key revoked"
+	ListSessionsMessage   = "sessions found successfully"
+	EndSessionMessage     = "session ended"
+	EndSessionsMessage    = "every other session ended"
+	RequestErasureMessage = "erasure requested, it can be cancelled until it is scheduled"
+	ErasedMessage         = "user data erased"
+	FindErasureMessage    = "erasure request found successfully"
+	ListErasuresMessage   = "erasure requests found successfully"
+	CancelErasureMessage  = "erasure request cancelled"
+
+	BootstrapAdminMessage   = "admin bootstrapped, the password must be changed on first login"
+	BootstrapSkippedMessage = "an admin already exists, nothing to do"
+	PasswordChangeMessage   = "password change required"
 
 	//error messages
 
-	ErrCreatingUser  = "error creating user"
-	ErrSearchingUser = "error searching user"
-	ErrUpdatingUser  = "error updating user data"
-	ErrDeletingUser  = "error deleting user data"
-	ErrChangingPwd   = "error changing user password"
-	ErrLoginUser     = "error login user"
+	ErrCreatingUser      = "error creating user"
+	ErrSearchingUser     = "error searching user"
+	ErrUpdatingUser      = "error updating user data"
+	ErrDeletingUser      = "error deleting user data"
+	ErrChangingPwd       = "error changing user password"
+	ErrLoginUser         = "error login user"
+	ErrListingUsers      = "error listing users"
+	ErrDisablingUser     = "error changing user status"
+	ErrImportingUser     = "error importing users"
+	ErrExportingUser     = "error exporting users"
+	ErrSubmittingJob     = "error submitting job"
+	ErrSearchingJob      = "error searching job"
+	ErrCancellingJob     = "error cancelling job"
+	ErrRegisteringClient = "error registering client"
+	ErrListingClients    = "error listing clients"
+	ErrDeletingClient    = "error deleting client"
+	ErrFederatedLogin    = "error logging in with identity provider"
+	ErrCreatingKey       = "error creating api key"
+	ErrListingKeys       = "error listing api keys"
+	ErrRevokingKey       = "error revoking api key"
+	ErrAuthenticating    = "error authenticating request"
+	ErrStartingSession   = "error starting session"
+	ErrListingSessions   = "error listing sessions"
+	ErrEndingSession     = "error ending session"
+	ErrRotatingKey       = "error rotating data key"
+	ErrReencrypting      = "error re-encrypting users"
+	ErrExportingData     = "error exporting user data"
+	ErrRequestingErasure = "error requesting erasure"
+	ErrSearchingErasure  = "error searching erasure requests"
+	ErrCancellingErasure = "error cancelling erasure request"
+	ErrErasingUser       = "error erasing user data"
 )
@@ -0,0 +1,572 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gustyaguero21/go-core/pkg/validator"
+)
+
+// Config holds every setting of the service. Each field declares its file key,
+// environment variable and default; flags are derived from the key.
+type Config struct {
+	Server     ServerConfig     `key:"server"`
+	Database   DatabaseConfig   `key:"database"`
+	Auth       AuthConfig       `key:"auth"`
+	Health     HealthConfig     `key:"health"`
+	Tracing    TracingConfig    `key:"tracing"`
+	Log        LogConfig        `key:"log"`
+	Bootstrap  BootstrapConfig  `key:"bootstrap"`
+	Cache      CacheConfig      `key:"cache"`
+	Bulk       BulkConfig       `key:"bulk"`
+	Jobs       JobsConfig       `key:"jobs"`
+	SCIM       SCIMConfig       `key:"scim"`
+	OIDC       OIDCConfig       `key:"oidc"`
+	Federation FederationConfig `key:"federation"`
+	APIKeys    APIKeysConfig    `key:"api_keys"`
+	Password   PasswordConfig   `key:"password"`
+	Encryption EncryptionConfig `key:"encryption"`
+	Privacy    PrivacyConfig    `key:"privacy"`
+	RateLimit  RateLimitConfig  `key:"rate_limit"`
+
+	sources map[string]string
+}
+
+type ServerConfig struct {
+	Addr     string `key:"addr" env:"SERVER_ADDR" default:":8080" usage:"address the http server listens on"`
+	BasePath string `key:"base_path" env:"BASE_PATH" default:"/api/go-manage" usage:"prefix of the user api routes"`
+
+	ReadTimeout       time.Duration `key:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s" usage:"maximum duration for reading a whole request"`
+	ReadHeaderTimeout time.Duration `key:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"5s" usage:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `key:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s" usage:"maximum duration before timing out writes of the response"`
+	IdleTimeout       time.Duration `key:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"120s" usage:"maximum time to wait for the next request on keep-alive connections"`
+	MaxHeaderBytes    int           `key:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" default:"1048576" usage:"maximum size of request headers"`
+	ShutdownTimeout   time.Duration `key:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"20s" usage:"time allowed to drain in-flight requests on shutdown"`
+	CloseTimeout      time.Duration `key:"close_timeout" env:"SERVER_CLOSE_TIMEOUT" default:"5s" usage:"time allowed to close the database, cache and tracing once drained"`
+
+	TLSCertFile       string        `key:"tls_cert_file" env:"SERVER_TLS_CERT_FILE" usage:"pem certificate, enables https together with tls_key_file"`
+	TLSKeyFile        string        `key:"tls_key_file" env:"SERVER_TLS_KEY_FILE" usage:"pem private key"`
+	TLSReloadInterval time.Duration `key:"tls_reload_interval" env:"SERVER_TLS_RELOAD_INTERVAL" default:"1m" usage:"how often certificate files are checked for changes"`
+
+	TrustedProxies []string `key:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES" usage:"ips or cidrs of the reverse proxies whose X-Forwarded-For is trusted for the client ip, none when empty"`
+}
+
+// TLSEnabled reports whether the server should serve https.
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" || s.TLSKeyFile != ""
+}
+
+type DatabaseConfig struct {
+	User     string `key:"user" env:"DB_USER" usage:"database user"`
+	Password string `key:"password" env:"DB_PASSWORD" secret:"true" usage:"database password"`
+	Host     string `key:"host" env:"DB_HOST" default:"localhost" usage:"database host"`
+	Port     int    `key:"port" env:"DB_PORT" default:"3306" usage:"database port"`
+	Name     string `key:"name" env:"DB_NAME" usage:"database schema name"`
+
+	AutoCreate bool   `key:"auto_create" env:"DB_AUTO_CREATE" default:"true" usage:"create the schema on startup when it does not exist"`
+	Charset    string `key:"charset" env:"DB_CHARSET" default:"utf8mb4" usage:"character set of a created schema"`
+	Collation  string `key:"collation" env:"DB_COLLATION" default:"utf8mb4_unicode_ci" usage:"collation of a created schema and of the connection"`
+
+	ConnectTimeout  time.Duration `key:"connect_timeout" env:"DB_CONNECT_TIMEOUT" default:"5s" usage:"dial timeout of a single connection attempt"`
+	StartupTimeout  time.Duration `key:"startup_timeout" env:"DB_STARTUP_TIMEOUT" default:"1m" usage:"how long startup keeps retrying until the database is reachable"`
+	RetryBackoff    time.Duration `key:"retry_backoff" env:"DB_RETRY_BACKOFF" default:"200ms" usage:"initial delay between retries, doubled on every attempt"`
+	RetryMaxBackoff time.Duration `key:"retry_max_backoff" env:"DB_RETRY_MAX_BACKOFF" default:"5s" usage:"maximum delay between retries"`
+	QueryRetries    int           `key:"query_retries" env:"DB_QUERY_RETRIES" default:"2" usage:"extra attempts for reads failing with a transient error"`
+
+	MaxOpenConns    int           `key:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25" usage:"maximum number of open connections"`
+	MaxIdleConns    int           `key:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10" usage:"maximum number of idle connections kept in the pool"`
+	ConnMaxLifetime time.Duration `key:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m" usage:"connections are recycled after this long"`
+	ConnMaxIdleTime time.Duration `key:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m" usage:"idle connections are closed after this long"`
+
+	Replicas             []string      `key:"replicas" env:"DB_REPLICAS" usage:"read replicas as host:port separated by commas, reached with the same credentials"`
+	ReplicaStickiness    time.Duration `key:"replica_stickiness" env:"DB_REPLICA_STICKINESS" default:"5s" usage:"reads of a user go to the primary for this long after a write"`
+	ReplicaCheckInterval time.Duration `key:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL" default:"5s" usage:"how often replica health is checked"`
+}
+
+type AuthConfig struct {
+	TokenSecret    string        `key:"token_secret" env:"TOKEN" secret:"true" usage:"secret used to sign JWTs"`
+	TokenValidTime time.Duration `key:"token_valid_time" env:"TOKEN_VALID_TIME" default:"1h" unit:"h" usage:"lifetime of issued JWTs (plain numbers are hours)"`
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `key:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s" usage:"timeout of each readiness check"`
+}
+
+type TracingConfig struct {
+	Exporter    string   `key:"exporter" env:"TRACING_EXPORTER" default:"none" usage:"span exporter: none, otlp, stdout or file"`
+	Endpoint    string   `key:"endpoint" env:"TRACING_ENDPOINT" default:"localhost:4318" usage:"otlp/http collector host:port"`
+	Insecure    bool     `key:"insecure" env:"TRACING_INSECURE" usage:"send otlp spans over plain http"`
+	Headers     []string `key:"headers" env:"TRACING_HEADERS" secret:"true" usage:"extra otlp headers as key=value pairs separated by commas"`
+	FilePath    string   `key:"file_path" env:"TRACING_FILE_PATH" default:"traces.jsonl" usage:"destination of the file exporter"`
+	SampleRatio float64  `key:"sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1" usage:"fraction of new traces that are sampled"`
+	ServiceName string   `key:"service_name" env:"TRACING_SERVICE_NAME" default:"go-manage-mysql" usage:"service.name resource attribute"`
+}
+
+type LogConfig struct {
+	Level              string        `key:"level" env:"LOG_LEVEL" default:"info" usage:"minimum level: debug, info, warn or error"`
+	Format             string        `key:"format" env:"LOG_FORMAT" default:"json" usage:"output format: json or text"`
+	SlowQueryThreshold time.Duration `key:"slow_query_threshold" env:"LOG_SLOW_QUERY_THRESHOLD" default:"200ms" usage:"queries slower than this are logged as warnings"`
+}
+
+type BootstrapConfig struct {
+	Enabled       bool          `key:"enabled" env:"BOOTSTRAP_ENABLED" default:"true" usage:"create the initial admin on startup when no admin exists"`
+	AdminUsername string        `key:"admin_username" env:"BOOTSTRAP_ADMIN_USERNAME" default:"admin" usage:"username of the initial admin"`
+	AdminPassword string        `key:"admin_password" env:"BOOTSTRAP_ADMIN_PASSWORD" secret:"true" usage:"initial admin password; a one-time password is generated and printed when empty"`
+	AdminName     string        `key:"admin_name" env:"BOOTSTRAP_ADMIN_NAME" default:"Admin" usage:"name of the initial admin"`
+	AdminSurname  string        `key:"admin_surname" env:"BOOTSTRAP_ADMIN_SURNAME" default:"Admin" usage:"surname of the initial admin"`
+	AdminEmail    string        `key:"admin_email" env:"BOOTSTRAP_ADMIN_EMAIL" default:"admin@localhost.localdomain" usage:"email of the initial admin"`
+	AdminPhone    string        `key:"admin_phone" env:"BOOTSTRAP_ADMIN_PHONE" default:"0000000000" usage:"phone of the initial admin"`
+	LockTimeout   time.Duration `key:"lock_timeout" env:"BOOTSTRAP_LOCK_TIMEOUT" default:"30s" usage:"how long to wait for another instance running the bootstrap"`
+}
+
+type CacheConfig struct {
+	Backend     string        `key:"backend" env:"CACHE_BACKEND" default:"memory" usage:"user lookup cache: none, memory or redis"`
+	TTL         time.Duration `key:"ttl" env:"CACHE_TTL" default:"10s" usage:"how long a found user is cached"`
+	NegativeTTL time.Duration `key:"negative_ttl" env:"CACHE_NEGATIVE_TTL" default:"2s" usage:"how long a missing username is cached, 0 disables it"`
+	Size        int           `key:"size" env:"CACHE_SIZE" default:"10000" usage:"entries kept by the memory backend"`
+
+	RedisAddr     string        `key:"redis_addr" env:"CACHE_REDIS_ADDR" default:"localhost:6379" usage:"host:port of the redis backend"`
+	RedisPassword string        `key:"redis_password" env:"CACHE_REDIS_PASSWORD" secret:"true" usage:"password of the redis backend"`
+	RedisDB       int           `key:"redis_db" env:"CACHE_REDIS_DB" usage:"database number of the redis backend"`
+	Timeout       time.Duration `key:"timeout" env:"CACHE_TIMEOUT" default:"100ms" usage:"timeout of each redis call, the database is used when it expires"`
+	PoolSize      int           `key:"pool_size" env:"CACHE_POOL_SIZE" default:"10" usage:"idle redis connections kept open"`
+}
+
+type BulkConfig struct {
+	BatchSize      int   `key:"batch_size" env:"BULK_BATCH_SIZE" default:"500" usage:"users written per insert statement and transaction, and read per export query"`
+	MaxImportBytes int64 `key:"max_import_bytes" env:"BULK_MAX_IMPORT_BYTES" default:"33554432" usage:"largest import body accepted by the api"`
+	HashWorkers    int   `key:"hash_workers" env:"BULK_HASH_WORKERS" default:"4" usage:"plaintext passwords of an import hashed in parallel"`
+}
+
+type JobsConfig struct {
+	Workers           int           `key:"workers" env:"JOBS_WORKERS" default:"2" usage:"jobs run at the same time by this instance, 0 only queues them for other instances"`
+	PollInterval      time.Duration `key:"poll_interval" env:"JOBS_POLL_INTERVAL" default:"2s" usage:"how often idle workers look for queued jobs"`
+	HeartbeatInterval time.Duration `key:"heartbeat_interval" env:"JOBS_HEARTBEAT_INTERVAL" default:"10s" usage:"how often a running job is marked as alive"`
+	StaleAfter        time.Duration `key:"stale_after" env:"JOBS_STALE_AFTER" default:"1m" usage:"a running job without heartbeat for this long was interrupted and is resumed"`
+}
+
+type SCIMConfig struct {
+	Token      string `key:"token" env:"SCIM_TOKEN" secret:"true" usage:"bearer token the identity provider provisions users with, scim is off when empty"`
+	MaxResults int    `key:"max_results" env:"SCIM_MAX_RESULTS" default:"100" usage:"largest page of users returned by a listing"`
+}
+
+// Enabled reports whether the scim endpoints accept requests.
+func (s SCIMConfig) Enabled() bool {
+	return s.Token != ""
+}
+
+type OIDCConfig struct {
+	Issuer          string        `key:"issuer" env:"OIDC_ISSUER" usage:"public url of the api including the base path, enables the openid connect provider when set"`
+	SigningKeyFile  string        `key:"signing_key_file" env:"OIDC_SIGNING_KEY_FILE" usage:"pem rsa private key signing the id tokens"`
+	CodeTTL         time.Duration `key:"code_ttl" env:"OIDC_CODE_TTL" default:"1m" usage:"lifetime of authorization codes"`
+	AccessTokenTTL  time.Duration `key:"access_token_ttl" env:"OIDC_ACCESS_TOKEN_TTL" default:"1h" usage:"lifetime of access and id tokens"`
+	RefreshTokenTTL time.Duration `key:"refresh_token_ttl" env:"OIDC_REFRESH_TOKEN_TTL" default:"720h" usage:"lifetime of refresh tokens, issued with the offline_access scope"`
+}
+
+// Enabled reports whether the api acts as an openid connect provider.
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+type FederationConfig struct {
+	ProvidersFile string        `key:"providers_file" env:"FEDERATION_PROVIDERS_FILE" usage:"yaml file listing the openid connect providers users can log in with, enables federated login when set"`
+	PublicURL     string        `key:"public_url" env:"FEDERATION_PUBLIC_URL" usage:"public url of the api including the base path, the callback urls registered at the providers are built from it"`
+	StateTTL      time.Duration `key:"state_ttl" env:"FEDERATION_STATE_TTL" default:"10m" usage:"time a user has to log in at the provider"`
+	HTTPTimeout   time.Duration `key:"http_timeout" env:"FEDERATION_HTTP_TIMEOUT" default:"10s" usage:"timeout of the calls to the providers"`
+}
+
+// Enabled reports whether users can log in with external providers.
+func (f FederationConfig) Enabled() bool {
+	return f.ProvidersFile != ""
+}
+
+type APIKeysConfig struct {
+	DefaultTTL time.Duration `key:"default_ttl" env:"API_KEYS_DEFAULT_TTL" default:"2160h" usage:"lifetime of api keys created without an expiry, 0 for keys that never expire"`
+	MaxTTL     time.Duration `key:"max_ttl" env:"API_KEYS_MAX_TTL" default:"8760h" usage:"longest lifetime an api key can be created with, 0 for no limit"`
+}
+
+// PasswordConfig chooses how new password hashes are computed. Hashes of
+// every supported algorithm are verified, the ones not matching these
+// settings are replaced at the next successful login.
+type PasswordConfig struct {
+	Algorithm string `key:"algorithm" env:"PASSWORD_ALGORITHM" default:"bcrypt" usage:"algorithm of new password hashes: bcrypt, argon2id or scrypt"`
+
+	BcryptCost int `key:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST" default:"10" usage:"bcrypt cost, each step doubles the work"`
+
+	Argon2Memory      int `key:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY" default:"65536" usage:"argon2id memory in KiB"`
+	Argon2Iterations  int `key:"argon2_iterations" env:"PASSWORD_ARGON2_ITERATIONS" default:"3" usage:"argon2id passes over the memory"`
+	Argon2Parallelism int `key:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM" default:"2" usage:"argon2id lanes"`
+
+	ScryptN int `key:"scrypt_n" env:"PASSWORD_SCRYPT_N" default:"32768" usage:"scrypt cpu and memory cost, a power of two"`
+	ScryptR int `key:"scrypt_r" env:"PASSWORD_SCRYPT_R" default:"8" usage:"scrypt block size"`
+	ScryptP int `key:"scrypt_p" env:"PASSWORD_SCRYPT_P" default:"1" usage:"scrypt parallelization"`
+
+	MaxConcurrent int `key:"max_concurrent" env:"PASSWORD_MAX_CONCURRENT" default:"0" usage:"hashes computed at once, others wait; 0 for the number of cpus"`
+}
+
+// ceilings of the password hash settings, configured or found in a stored or
+// imported hash. A login never costs more than 1 GiB of memory.
+const (
+	MaxArgon2Memory     = 1 << 20
+	MaxArgon2Iterations = 64
+	// MaxScryptMemory bounds n*r, scrypt takes 128 bytes for each
+	MaxScryptMemory = 1 << 23
+	MaxScryptP      = 16
+)
+
+// EncryptionConfig holds the keys personal data is encrypted with. Each
+// master key is an id and a base64 256-bit key joined by a colon.
+type EncryptionConfig struct {
+	MasterKeys []string      `key:"master_keys" env:"ENCRYPTION_MASTER_KEYS" secret:"true" usage:"id:key master keys separated by commas, the first wraps new data keys; personal data is encrypted when set"`
+	IndexKey   string        `key:"index_key" env:"ENCRYPTION_INDEX_KEY" secret:"true" usage:"base64 256-bit key of the blind indexes email and phone are looked up with, it cannot be rotated"`
+	KeyRefresh time.Duration `key:"key_refresh" env:"ENCRYPTION_KEY_REFRESH" default:"1m" usage:"how often the data keys are reloaded, so a rotation reaches every instance"`
+}
+
+// Enabled reports whether personal data is encrypted at rest.
+func (e EncryptionConfig) Enabled() bool {
+	return len(e.MasterKeys) > 0
+}
+
+// PrivacyConfig controls how requests to erase the data of a user are
+// carried out.
+type PrivacyConfig struct {
+	ErasureGracePeriod time.Duration `key:"erasure_grace_period" env:"PRIVACY_ERASURE_GRACE_PERIOD" default:"720h" usage:"time an erasure request can still be cancelled before the data of the user is erased"`
+	SweepInterval      time.Duration `key:"sweep_interval" env:"PRIVACY_SWEEP_INTERVAL" default:"1m" usage:"how often erasure requests past their grace period are carried out"`
+}
+
+// rate limit keys
+const (
+	RateKeyIP     = "ip"
+	RateKeyUser   = "user"
+	RateKeyAPIKey = "api_key"
+)
+
+// RateLimitConfig declares token bucket policies limiting how often clients
+// can call the routes they match. A policy reads
+//
+//	METHOD ROUTE TOKENS/PERIOD [burst=N] [key=ip|user|api_key]
+//
+// where METHOD and ROUTE may be *, and a ROUTE, written as registered under
+// the base path, may end in * to match a prefix. The first matching policy
+// of each key kind applies.
+type RateLimitConfig struct {
+	Enabled  bool     `key:"enabled" env:"RATE_LIMIT_ENABLED" default:"true" usage:"whether the rate limit policies are enforced"`
+	Policies []string `key:"policies" env:"RATE_LIMIT_POLICIES" default:"POST /login 10/1m burst=10,POST /create 5/1m burst=5" usage:"policies separated by commas, see the configuration example"`
+	Store    string   `key:"store" env:"RATE_LIMIT_STORE" default:"memory" usage:"where buckets are kept: memory, per instance, or redis, shared by every instance through the cache.redis_* settings"`
+}
+
+// RatePolicy is a parsed rate limit policy. The bucket holds Burst tokens
+// and gets Tokens back every Period.
+type RatePolicy struct {
+	Method string
+	Route  string
+	Tokens int
+	Period time.Duration
+	Burst  int
+	Key    string
+}
+
+// String is the policy as it was declared, less its options.
+func (p RatePolicy) String() string {
+	return p.Method + " " + p.Route
+}
+
+// Matches reports whether the policy applies to a request for the route
+// registered as route, relative to the base path.
+func (p RatePolicy) Matches(method, route string) bool {
+	if p.Method != "*" && p.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(p.Route, "*"); ok {
+		return strings.HasPrefix(route, prefix)
+	}
+	return p.Route == route
+}
+
+// ParsePolicies returns the declared policies in order.
+func (r RateLimitConfig) ParsePolicies() ([]RatePolicy, error) {
+	policies := make([]RatePolicy, 0, len(r.Policies))
+	for _, raw := range r.Policies {
+		policy, err := parsePolicy(raw)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", raw, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func parsePolicy(raw string) (RatePolicy, error) {
+	fields := strings.Fields(raw)
+	if len(fields) < 3 {
+		return RatePolicy{}, errors.New("must be METHOD ROUTE TOKENS/PERIOD [burst=N] [key=ip|user|api_key]")
+	}
+	policy := RatePolicy{Method: strings.ToUpper(fields[0]), Route: fields[1], Key: RateKeyIP}
+	if policy.Route != "*" && !strings.HasPrefix(policy.Route, "/") {
+		return RatePolicy{}, errors.New("route must start with '/' or be *")
+	}
+
+	tokens, period, ok := strings.Cut(fields[2], "/")
+	n, tokensErr := strconv.Atoi(tokens)
+	d, periodErr := time.ParseDuration(period)
+	if !ok || tokensErr != nil || periodErr != nil || n <= 0 || d <= 0 {
+		return RatePolicy{}, errors.New("rate must be positive tokens per positive duration, such as 10/1m")
+	}
+	policy.Tokens, policy.Period, policy.Burst = n, d, n
+
+	for _, option := range fields[3:] {
+		name, value, _ := strings.Cut(option, "=")
+		switch name {
+		case "burst":
+			burst, err := strconv.Atoi(value)
+			if err != nil || burst <= 0 {
+				return RatePolicy{}, errors.New("burst must be a positive number")
+			}
+			policy.Burst = burst
+		case "key":
+			switch value {
+			case RateKeyIP, RateKeyUser, RateKeyAPIKey:
+				policy.Key = value
+			default:
+				return RatePolicy{}, fmt.Errorf("key must be ip, user or api_key, got %q", value)
+			}
+		default:
+			return RatePolicy{}, fmt.Errorf("unknown option %q", option)
+		}
+	}
+	return policy, nil
+}
+
+// ServerDSN points to the database server without selecting a schema.
+func (d DatabaseConfig) ServerDSN() string {
+	return d.mysqlConfig("").FormatDSN()
+}
+
+// DSN points to the configured schema.
+func (d DatabaseConfig) DSN() string {
+	return d.mysqlConfig(d.Name).FormatDSN()
+}
+
+// ReplicaDSN points to the configured schema on the replica at addr. The
+// port defaults to the primary one.
+func (d DatabaseConfig) ReplicaDSN(addr string) string {
+	cfg := d.mysqlConfig(d.Name)
+	cfg.Addr = d.replicaAddr(addr)
+	return cfg.FormatDSN()
+}
+
+func (d DatabaseConfig) replicaAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(d.Port))
+}
+
+func (d DatabaseConfig) mysqlConfig(schema string) *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = d.User
+	cfg.Passwd = d.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	cfg.DBName = schema
+	cfg.ParseTime = true
+	cfg.Timeout = d.ConnectTimeout
+	cfg.Collation = d.Collation
+	return cfg
+}
+
+var (
+	// schema names are quoted when used, but kept to a set that is also a
+	// valid directory name on every platform
+	identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_$-]{1,64}$`)
+	charsetPattern    = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+)
+
+// ValidIdentifier reports whether name can be used as a schema name.
+func ValidIdentifier(name string) bool {
+	return identifierPattern.MatchString(name)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, &FieldError{Key: key, Msg: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	_, port, splitErr := net.SplitHostPort(c.Server.Addr)
+	check(splitErr == nil && port != "", "server.addr", "must be host:port, got %q", c.Server.Addr)
+	check(strings.HasPrefix(c.Server.BasePath, "/"), "server.base_path", "must start with '/', got %q", c.Server.BasePath)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.read_header_timeout", "must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes", "must be positive, got %d", c.Server.MaxHeaderBytes)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	check(c.Server.CloseTimeout > 0, "server.close_timeout", "must be positive, got %s", c.Server.CloseTimeout)
+	if c.Server.TLSEnabled() {
+		check(c.Server.TLSCertFile != "" && c.Server.TLSKeyFile != "", "server.tls_cert_file", "tls_cert_file and tls_key_file must be set together")
+		check(c.Server.TLSReloadInterval > 0, "server.tls_reload_interval", "must be positive, got %s", c.Server.TLSReloadInterval)
+	}
+
+	check(c.Database.User != "", "database.user", "is required")
+	check(c.Database.Host != "", "database.host", "is required")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+	check(c.Database.Name != "", "database.name", "is required")
+	check(c.Database.Name == "" || ValidIdentifier(c.Database.Name), "database.name", "must be 1 to 64 letters, digits, '_', '$' or '-', got %q", c.Database.Name)
+	check(charsetPattern.MatchString(c.Database.Charset), "database.charset", "must be a character set name, got %q", c.Database.Charset)
+	check(charsetPattern.MatchString(c.Database.Collation) && strings.HasPrefix(c.Database.Collation, c.Database.Charset+"_"), "database.collation", "must be a collation of charset %q, got %q", c.Database.Charset, c.Database.Collation)
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout", "must not be negative")
+	check(c.Database.StartupTimeout > 0, "database.startup_timeout", "must be positive, got %s", c.Database.StartupTimeout)
+	check(c.Database.RetryBackoff > 0, "database.retry_backoff", "must be positive, got %s", c.Database.RetryBackoff)
+	check(c.Database.RetryMaxBackoff >= c.Database.RetryBackoff, "database.retry_max_backoff", "must not be lower than retry_backoff")
+	check(c.Database.QueryRetries >= 0, "database.query_retries", "must not be negative, got %d", c.Database.QueryRetries)
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns", "must be positive, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns", "must be between 0 and max_open_conns, got %d", c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "must not be negative")
+	for _, replica := range c.Database.Replicas {
+		host, _, err := net.SplitHostPort(c.Database.replicaAddr(replica))
+		check(err == nil && host != "", "database.replicas", "entries must be host or host:port, got %q", replica)
+	}
+	check(c.Database.ReplicaStickiness >= 0, "database.replica_stickiness", "must not be negative")
+	check(c.Database.ReplicaCheckInterval > 0, "database.replica_check_interval", "must be positive, got %s", c.Database.ReplicaCheckInterval)
+
+	check(c.Auth.TokenSecret != "", "auth.token_secret", "is required")
+	check(c.Auth.TokenValidTime > 0, "auth.token_valid_time", "must be positive, got %s", c.Auth.TokenValidTime)
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout", "file":
+	default:
+		check(false, "tracing.exporter", "must be one of none, otlp, stdout, file, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.Exporter != "otlp" || c.Tracing.Endpoint != "", "tracing.endpoint", "is required by the otlp exporter")
+	check(c.Tracing.Exporter != "file" || c.Tracing.FilePath != "", "tracing.file_path", "is required by the file exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	for _, header := range c.Tracing.Headers {
+		check(strings.Contains(header, "="), "tracing.headers", "entries must be key=value")
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format", "must be json or text, got %q", c.Log.Format)
+	check(c.Log.SlowQueryThreshold >= 0, "log.slow_query_threshold", "must not be negative")
+
+	check(c.Health.CheckTimeout > 0, "health.check_timeout", "must be positive, got %s", c.Health.CheckTimeout)
+
+	check(c.Bootstrap.AdminUsername != "", "bootstrap.admin_username", "is required")
+	check(c.Bootstrap.AdminPassword == "" || validator.ValidatePassword(c.Bootstrap.AdminPassword), "bootstrap.admin_password", "must be up to 16 letters and digits with upper, lower and digit characters")
+	check(validator.ValidateEmail(c.Bootstrap.AdminEmail), "bootstrap.admin_email", "must be a valid email, got %q", c.Bootstrap.AdminEmail)
+	check(c.Bootstrap.AdminPhone != "", "bootstrap.admin_phone", "is required")
+	check(c.Bootstrap.LockTimeout > 0, "bootstrap.lock_timeout", "must be positive, got %s", c.Bootstrap.LockTimeout)
+
+	switch c.Cache.Backend {
+	case "none", "memory", "redis":
+	default:
+		check(false, "cache.backend", "must be one of none, memory, redis, got %q", c.Cache.Backend)
+	}
+	check(c.Cache.TTL > 0, "cache.ttl", "must be positive, got %s", c.Cache.TTL)
+	check(c.Cache.NegativeTTL >= 0, "cache.negative_ttl", "must not be negative")
+	check(c.Cache.Backend != "memory" || c.Cache.Size > 0, "cache.size", "must be positive, got %d", c.Cache.Size)
+	if c.Cache.Backend == "redis" {
+		_, port, err := net.SplitHostPort(c.Cache.RedisAddr)
+		check(err == nil && port != "", "cache.redis_addr", "must be host:port, got %q", c.Cache.RedisAddr)
+		check(c.Cache.RedisDB >= 0, "cache.redis_db", "must not be negative, got %d", c.Cache.RedisDB)
+		check(c.Cache.Timeout > 0, "cache.timeout", "must be positive, got %s", c.Cache.Timeout)
+		check(c.Cache.PoolSize >= 0, "cache.pool_size", "must not be negative, got %d", c.Cache.PoolSize)
+	}
+
+	check(c.Bulk.BatchSize > 0, "bulk.batch_size", "must be positive, got %d", c.Bulk.BatchSize)
+	check(c.Bulk.MaxImportBytes > 0, "bulk.max_import_bytes", "must be positive, got %d", c.Bulk.MaxImportBytes)
+	check(c.Bulk.HashWorkers > 0, "bulk.hash_workers", "must be positive, got %d", c.Bulk.HashWorkers)
+
+	check(c.Jobs.Workers >= 0, "jobs.workers", "must not be negative, got %d", c.Jobs.Workers)
+	check(c.Jobs.PollInterval > 0, "jobs.poll_interval", "must be positive, got %s", c.Jobs.PollInterval)
+	check(c.Jobs.HeartbeatInterval > 0, "jobs.heartbeat_interval", "must be positive, got %s", c.Jobs.HeartbeatInterval)
+	check(c.Jobs.StaleAfter > c.Jobs.HeartbeatInterval, "jobs.stale_after", "must be longer than heartbeat_interval")
+
+	check(!c.SCIM.Enabled() || len(c.SCIM.Token) >= 32, "scim.token", "must be at least 32 characters")
+	check(c.SCIM.MaxResults > 0, "scim.max_results", "must be positive, got %d", c.SCIM.MaxResults)
+
+	if c.OIDC.Enabled() {
+		check(validIssuer(c.OIDC.Issuer), "oidc.issuer", "must be an https url without query, fragment or trailing slash, got %q", c.OIDC.Issuer)
+		check(c.OIDC.SigningKeyFile != "", "oidc.signing_key_file", "is required when oidc.issuer is set")
+	}
+	check(c.OIDC.CodeTTL > 0 && c.OIDC.CodeTTL <= 10*time.Minute, "oidc.code_ttl", "must be between 0 and 10m, got %s", c.OIDC.CodeTTL)
+	check(c.OIDC.AccessTokenTTL > 0, "oidc.access_token_ttl", "must be positive, got %s", c.OIDC.AccessTokenTTL)
+	check(c.OIDC.RefreshTokenTTL > 0, "oidc.refresh_token_ttl", "must be positive, got %s", c.OIDC.RefreshTokenTTL)
+
+	if c.Federation.Enabled() {
+		check(validIssuer(c.Federation.PublicURL), "federation.public_url", "must be an https url without query, fragment or trailing slash, got %q", c.Federation.PublicURL)
+	}
+	check(c.Federation.StateTTL > 0, "federation.state_ttl", "must be positive, got %s", c.Federation.StateTTL)
+	check(c.Federation.HTTPTimeout > 0, "federation.http_timeout", "must be positive, got %s", c.Federation.HTTPTimeout)
+
+	check(c.APIKeys.MaxTTL >= 0, "api_keys.max_ttl", "must not be negative, got %s", c.APIKeys.MaxTTL)
+	check(c.APIKeys.DefaultTTL >= 0, "api_keys.default_ttl", "must not be negative, got %s", c.APIKeys.DefaultTTL)
+	if c.APIKeys.MaxTTL > 0 {
+		check(c.APIKeys.DefaultTTL > 0 && c.APIKeys.DefaultTTL <= c.APIKeys.MaxTTL, "api_keys.default_ttl", "must be between 0 and api_keys.max_ttl (%s), got %s", c.APIKeys.MaxTTL, c.APIKeys.DefaultTTL)
+	}
+
+	pwd := c.Password
+	switch pwd.Algorithm {
+	case "bcrypt", "argon2id", "scrypt":
+	default:
+		check(false, "password.algorithm", "must be one of bcrypt, argon2id, scrypt, got %q", pwd.Algorithm)
+	}
+	check(pwd.BcryptCost >= 4 && pwd.BcryptCost <= 31, "password.bcrypt_cost", "must be between 4 and 31, got %d", pwd.BcryptCost)
+	check(pwd.Argon2Parallelism >= 1 && pwd.Argon2Parallelism <= 255, "password.argon2_parallelism", "must be between 1 and 255, got %d", pwd.Argon2Parallelism)
+	check(pwd.Argon2Memory >= 8*pwd.Argon2Parallelism && pwd.Argon2Memory <= MaxArgon2Memory, "password.argon2_memory", "must be between 8 KiB per lane and 1 GiB, got %d", pwd.Argon2Memory)
+	check(pwd.Argon2Iterations >= 1 && pwd.Argon2Iterations <= MaxArgon2Iterations, "password.argon2_iterations", "must be between 1 and %d, got %d", MaxArgon2Iterations, pwd.Argon2Iterations)
+	check(pwd.ScryptN > 1 && pwd.ScryptN&(pwd.ScryptN-1) == 0, "password.scrypt_n", "must be a power of two above 1, got %d", pwd.ScryptN)
+	check(pwd.ScryptR >= 1 && pwd.ScryptP >= 1 && pwd.ScryptP <= MaxScryptP, "password.scrypt_r", "scrypt_r must be positive and scrypt_p between 1 and %d, got %d and %d", MaxScryptP, pwd.ScryptR, pwd.ScryptP)
+	check(pwd.ScryptN <= MaxScryptMemory/max(pwd.ScryptR, 1), "password.scrypt_n", "scrypt_n times scrypt_r must not exceed %d (1 GiB), got %d and %d", MaxScryptMemory, pwd.ScryptN, pwd.ScryptR)
+	check(pwd.MaxConcurrent >= 0, "password.max_concurrent", "must not be negative, got %d", pwd.MaxConcurrent)
+
+	if c.Encryption.Enabled() {
+		check(c.Encryption.IndexKey != "", "encryption.index_key", "is required when encryption.master_keys is set")
+	}
+	check(c.Encryption.KeyRefresh > 0, "encryption.key_refresh", "must be positive, got %s", c.Encryption.KeyRefresh)
+
+	check(c.Privacy.ErasureGracePeriod >= 0, "privacy.erasure_grace_period", "must not be negative, got %s", c.Privacy.ErasureGracePeriod)
+	check(c.Privacy.SweepInterval > 0, "privacy.sweep_interval", "must be positive, got %s", c.Privacy.SweepInterval)
+
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies", "must be ips or cidrs, got %q", proxy)
+	}
+	_, policiesErr := c.RateLimit.ParsePolicies()
+	check(policiesErr == nil, "rate_limit.policies", "%v", policiesErr)
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "redis", "rate_limit.store", "must be memory or redis, got %q", c.RateLimit.Store)
+
+	return errors.Join(errs...)
+}
+
+// validIssuer follows OpenID Connect Discovery, plain http is only accepted
+// for local development. Public urls of the api follow the same rules.
+func validIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(u.Path, "/") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || net.ParseIP(host).IsLoopback()
+	}
+	return false
+}
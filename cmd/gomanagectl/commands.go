@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/database"
+	"go-manage-mysql/internal/models"
+	passwords "go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/utils/validator"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type app struct {
+	db      *gorm.DB
+	service services.UserServices
+	// cached is set when the API shares a cache with this tool
+	cached *repository.CachedRepository
+	// cipher is set when personal data is encrypted
+	cipher repository.FieldCipher
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	group   string
+	name    string
+	args    string
+	summary string
+	run     func(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error)
+	flags   func(fs *flag.FlagSet)
+}
+
+var commands = []command{
+	{"users", "create", "", "create a user (a password is generated when omitted)", createUser, createFlags},
+	{"users", "find", "<username>", "show a user", findUser, nil},
+	{"users", "list", "", "list users ordered by username", listUsers, listFlags},
+	{"users", "update", "<username>", "replace name, surname, phone and email", updateUser, userFlags},
+	{"users", "disable", "<username>", "block a user from logging in", setDisabled(true), nil},
+	{"users", "enable", "<username>", "allow a disabled user to log in again", setDisabled(false), nil},
+	{"users", "delete", "<username>", "delete a user", deleteUser, nil},
+	{"users", "reset-password", "<username>", "set a new password (generated when omitted)", resetPassword, passwordFlag},
+	{"users", "import", "<file|->", "create or update users from a csv or ndjson file", importUsers, importFlags},
+	{"users", "export", "", "write users without password hashes as csv or ndjson", exportUsers, exportFlags},
+	{"admin", "rotate-password", "", "set a new password for the configured admin", rotateAdmin, passwordFlag},
+	{"admin", "bootstrap", "", "create the initial admin, or recover it with -reset", bootstrapAdmin, bootstrapFlags},
+	{"db", "migrate", "", "apply pending migrations", migrate, nil},
+	{"db", "schema-version", "", "print the applied and expected schema versions", schemaVersion, nil},
+}
+
+func lookup(args []string) *command {
+	if len(args) < 2 {
+		return nil
+	}
+	for i := range commands {
+		if commands[i].group == args[0] && commands[i].name == args[1] {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gomanagectl [config flags] <group> <command> [-output table|json|csv] [flags] [args]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-28s %s\n", strings.TrimSpace(c.group+" "+c.name+" "+c.args), c.summary)
+	}
+}
+
+// execute runs the command named by args and maps its error to an exit code.
+func (a *app) execute(ctx context.Context, args []string) int {
+	cmd := lookup(args)
+	if cmd == nil {
+		usage(a.stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.group+" "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	format := fs.String("output", formatTable, "output format: table, json or csv")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	if err := fs.Parse(args[2:]); err != nil {
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		fmt.Fprintf(a.stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+
+	out, err := cmd.run(a, ctx, fs, fs.Args())
+	if err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return exitCode(err)
+	}
+
+	if err := out.write(a.stdout, *format); err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, config.ErrUserNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return exitNotFound
+	case errors.Is(err, config.ErrUserAlreadyExists):
+		return exitConflict
+	default:
+		return exitFailure
+	}
+}
+
+func userFlags(fs *flag.FlagSet) {
+	fs.String("name", "", "first name")
+	fs.String("surname", "", "last name")
+	fs.String("phone", "", "phone number")
+	fs.String("email", "", "email address")
+}
+
+func createFlags(fs *flag.FlagSet) {
+	userFlags(fs)
+	fs.String("username", "", "username")
+	passwordFlag(fs)
+}
+
+func passwordFlag(fs *flag.FlagSet) {
+	fs.String("password", "", "password; a random one is generated and printed when empty")
+}
+
+func listFlags(fs *flag.FlagSet) {
+	fs.Int("offset", 0, "number of users to skip")
+	fs.Int("limit", 100, "maximum number of users to return")
+}
+
+func importFlags(fs *flag.FlagSet) {
+	fs.String("format", "", "csv or ndjson; taken from the file extension when empty")
+	fs.String("mode", services.ImportInsert, "insert rejects existing usernames, upsert overwrites them")
+	fs.Bool("dry-run", false, "validate and check conflicts without writing")
+	fs.Int("batch-size", 0, "users written per transaction; bulk.batch_size when 0")
+}
+
+func exportFlags(fs *flag.FlagSet) {
+	fs.String("format", bulk.FormatCSV, "csv or ndjson")
+	fs.String("file", "-", "destination file, - writes to stdout")
+	fs.String("role", "", "only users with this role")
+	fs.String("disabled", "", "only disabled (true) or enabled (false) users")
+	fs.String("username-prefix", "", "only usernames starting with this prefix")
+}
+
+func flagValue(fs *flag.FlagSet, name string) string {
+	if f := fs.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+func flagInt(fs *flag.FlagSet, name string) int {
+	v, _ := strconv.Atoi(flagValue(fs, name))
+	return v
+}
+
+// username returns the single positional argument.
+func username(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", fmt.Errorf("%w: expected exactly one username", errUsage)
+	}
+	return args[0], nil
+}
+
+// password returns the -password flag or a freshly generated one.
+func password(fs *flag.FlagSet) (pwd string, generated bool, err error) {
+	if pwd = flagValue(fs, "password"); pwd != "" {
+		return pwd, false, nil
+	}
+	pwd, err = passwords.Generate()
+	return pwd, true, err
+}
+
+func validate(user models.User, fields []string) error {
+	if err := validator.ValidateData(user, fields); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+func createUser(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if len(args) != 0 {
+		return output{}, fmt.Errorf("%w: unexpected arguments %v", errUsage, args)
+	}
+
+	pwd, generated, err := password(fs)
+	if err != nil {
+		return output{}, err
+	}
+
+	user := models.User{
+		Name:     flagValue(fs, "name"),
+		Surname:  flagValue(fs, "surname"),
+		Username: flagValue(fs, "username"),
+		Phone:    flagValue(fs, "phone"),
+		Email:    flagValue(fs, "email"),
+		Password: pwd,
+	}
+	if err := validate(user, config.Create_ValidateFields); err != nil {
+		return output{}, err
+	}
+
+	created, err := a.service.CreateUser(ctx, user)
+	if err != nil {
+		return output{}, err
+	}
+
+	out := usersOutput(created)
+	if generated {
+		out = credentialsOutput(created.Username, pwd)
+	}
+	return out, nil
+}
+
+func findUser(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	name, err := username(args)
+	if err != nil {
+		return output{}, err
+	}
+
+	user, err := a.service.SearchUser(ctx, name)
+	if err != nil {
+		return output{}, err
+	}
+	return usersOutput(user), nil
+}
+
+func listUsers(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	offset, limit := flagInt(fs, "offset"), flagInt(fs, "limit")
+	if offset < 0 || limit <= 0 {
+		return output{}, fmt.Errorf("%w: offset must be >= 0 and limit > 0", errUsage)
+	}
+
+	users, err := a.service.ListUsers(ctx, offset, limit)
+	if err != nil {
+		return output{}, err
+	}
+	return usersOutput(users...), nil
+}
+
+func updateUser(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	name, err := username(args)
+	if err != nil {
+		return output{}, err
+	}
+
+	update := models.User{
+		Name:    flagValue(fs, "name"),
+		Surname: flagValue(fs, "surname"),
+		Phone:   flagValue(fs, "phone"),
+		Email:   flagValue(fs, "email"),
+	}
+	if err := validate(update, config.Update_ValidateFields); err != nil {
+		return output{}, err
+	}
+
+	if err := a.service.UpdateUser(ctx, name, update); err != nil {
+		return output{}, err
+	}
+	return messageOutput(config.UpdateUserMessage), nil
+}
+
+func setDisabled(disabled bool) func(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	return func(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+		name, err := username(args)
+		if err != nil {
+			return output{}, err
+		}
+
+		if err := a.service.SetUserDisabled(ctx, name, disabled); err != nil {
+			return output{}, err
+		}
+		if disabled {
+			return messageOutput(config.DisableUserMessage), nil
+		}
+		return messageOutput(config.EnableUserMessage), nil
+	}
+}
+
+func deleteUser(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	name, err := username(args)
+	if err != nil {
+		return output{}, err
+	}
+
+	if err := a.service.DeleteUser(ctx, name); err != nil {
+		return output{}, err
+	}
+	return messageOutput(config.DeleteUserMessage), nil
+}
+
+func resetPassword(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	name, err := username(args)
+	if err != nil {
+		return output{}, err
+	}
+	return a.changePassword(ctx, fs, name)
+}
+
+func rotateAdmin(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if len(args) != 0 {
+		return output{}, fmt.Errorf("%w: unexpected arguments %v", errUsage, args)
+	}
+	return a.changePassword(ctx, fs, config.Current().Bootstrap.AdminUsername)
+}
+
+func bootstrapFlags(fs *flag.FlagSet) {
+	fs.Bool("reset", false, "re-enable the configured admin and give it a new password even if admins exist")
+}
+
+func bootstrapAdmin(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if len(args) != 0 {
+		return output{}, fmt.Errorf("%w: unexpected arguments %v", errUsage, args)
+	}
+
+	result, err := database.Bootstrap(ctx, a.db, config.Current().Bootstrap, a.cipher, flagValue(fs, "reset") == "true")
+	if err != nil {
+		return output{}, err
+	}
+	if result.Changed() && a.cached != nil {
+		a.cached.Invalidate(ctx, result.Username)
+	}
+
+	switch {
+	case result.Password != "":
+		return credentialsOutput(result.Username, result.Password), nil
+	case result.Changed():
+		return messageOutput(config.BootstrapAdminMessage), nil
+	default:
+		return messageOutput(config.BootstrapSkippedMessage), nil
+	}
+}
+
+func (a *app) changePassword(ctx context.Context, fs *flag.FlagSet, name string) (output, error) {
+	pwd, generated, err := password(fs)
+	if err != nil {
+		return output{}, err
+	}
+	if err := validate(models.User{Username: name, Password: pwd}, config.ChangePwd_ValidateFields); err != nil {
+		return output{}, err
+	}
+
+	if err := a.service.ChangeUserPwd(ctx, name, pwd); err != nil {
+		return output{}, err
+	}
+	if generated {
+		return credentialsOutput(name, pwd), nil
+	}
+	return messageOutput(config.ChangePwdMessage), nil
+}
+
+func importUsers(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if len(args) != 1 || args[0] == "" {
+		return output{}, fmt.Errorf("%w: expected exactly one file, - reads stdin", errUsage)
+	}
+	path := args[0]
+
+	format := flagValue(fs, "format")
+	if format == "" {
+		format = bulk.FormatOf(path)
+	}
+	if _, ok := bulk.ContentTypes[format]; !ok {
+		return output{}, fmt.Errorf("%w: %v, set -format", errUsage, bulk.ErrUnknownFormat)
+	}
+
+	var input io.Reader = a.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return output{}, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	reader, err := bulk.NewReader(format, input)
+	if err != nil {
+		return output{}, fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	cfg := config.Current().Bulk
+	batchSize := flagInt(fs, "batch-size")
+	if batchSize <= 0 {
+		batchSize = cfg.BatchSize
+	}
+	report, err := a.service.ImportUsers(ctx, reader, services.ImportOptions{
+		Mode:        flagValue(fs, "mode"),
+		DryRun:      flagValue(fs, "dry-run") == "true",
+		BatchSize:   batchSize,
+		HashWorkers: cfg.HashWorkers,
+	})
+	if err != nil {
+		return output{}, err
+	}
+	return importOutput(report), nil
+}
+
+func exportUsers(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if len(args) != 0 {
+		return output{}, fmt.Errorf("%w: unexpected arguments %v", errUsage, args)
+	}
+
+	filter := repository.UserFilter{Role: flagValue(fs, "role"), UsernamePrefix: flagValue(fs, "username-prefix")}
+	if raw := flagValue(fs, "disabled"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return output{}, fmt.Errorf("%w: -disabled must be true or false", errUsage)
+		}
+		filter.Disabled = &disabled
+	}
+
+	path := flagValue(fs, "file")
+	var destination io.Writer = a.stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return output{}, err
+		}
+		defer file.Close()
+		destination = file
+	}
+
+	writer, err := bulk.NewWriter(flagValue(fs, "format"), destination)
+	if err != nil {
+		return output{}, fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	count := 0
+	err = a.service.ExportUsers(ctx, filter, config.Current().Bulk.BatchSize, func(users []models.User) error {
+		for _, user := range users {
+			if err := writer.Write(user); err != nil {
+				return err
+			}
+		}
+		count += len(users)
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return output{}, err
+	}
+
+	if path == "-" {
+		// the users already are the output
+		return output{}, nil
+	}
+	return messageOutput(fmt.Sprintf(config.ExportUsersMessage, count, path)), nil
+}
+
+func migrate(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	if err := database.Migrate(a.db.WithContext(ctx)); err != nil {
+		return output{}, err
+	}
+	return schemaVersion(a, ctx, fs, args)
+}
+
+func schemaVersion(a *app, ctx context.Context, fs *flag.FlagSet, args []string) (output, error) {
+	version, err := database.SchemaVersion(a.db.WithContext(ctx))
+	if err != nil {
+		return output{}, err
+	}
+	latest := database.LatestSchemaVersion()
+
+	return output{
+		headers: []string{"version", "latest", "up_to_date"},
+		rows:    [][]string{{strconv.Itoa(version), strconv.Itoa(latest), strconv.FormatBool(version >= latest)}},
+		value: map[string]interface{}{
+			"version":    version,
+			"latest":     latest,
+			"up_to_date": version >= latest,
+		},
+	}, nil
+}
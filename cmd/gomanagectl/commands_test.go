@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func testApp(t *testing.T) (*app, sqlmock.Sqlmock, *bytes.Buffer, *bytes.Buffer) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	var stdout, stderr bytes.Buffer
+	return &app{
+		db:      gormDB,
+		service: services.NewUserServices(repository.NewUserRepository(gormDB)),
+		stdout:  &stdout,
+		stderr:  &stderr,
+	}, mock, &stdout, &stderr
+}
+
+func TestExecute(t *testing.T) {
+	importFile := filepath.Join(t.TempDir(), "users.ndjson")
+	lines := `{"username":"johndoe","name":"John","surname":"Doe","email":"john@example.com","phone":"111","password":"Password1234"}` + "\n" +
+		`{"username":"janedoe","name":"Jane","surname":"Doe","email":"jane@example","phone":"222","password":"Password1234"}` + "\n"
+	if err := os.WriteFile(importFile, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name         string
+		Args         []string
+		ExpectedCode int
+		MockAct      func(mock sqlmock.Sqlmock)
+		Check        func(t *testing.T, stdout, stderr string)
+	}{
+		{
+			Name:         "Unknown Command",
+			Args:         []string{"users", "explode"},
+			ExpectedCode: exitUsage,
+			MockAct:      func(mock sqlmock.Sqlmock) {},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Contains(t, stderr, "usage: gomanagectl")
+			},
+		},
+		{
+			Name:         "Missing Username",
+			Args:         []string{"users", "find"},
+			ExpectedCode: exitUsage,
+			MockAct:      func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			Name:         "Unknown Format",
+			Args:         []string{"users", "list", "-output", "xml"},
+			ExpectedCode: exitUsage,
+			MockAct:      func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			Name:         "List Json",
+			Args:         []string{"users", "list", "-output", "json", "-limit", "10"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.ListTestQuery).
+					WithArgs(10).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role"}).
+						AddRow("1", "admin", "hash", "admin").
+						AddRow("2", "johndoe", "hash", "user"))
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				var users []map[string]interface{}
+				assert.NoError(t, json.Unmarshal([]byte(stdout), &users))
+				assert.Len(t, users, 2)
+				assert.Equal(t, "johndoe", users[1]["username"])
+				assert.NotContains(t, stdout, "hash")
+			},
+		},
+		{
+			Name:         "Find Csv",
+			Args:         []string{"users", "find", "-output", "csv", "johndoe"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow("2", "johndoe", "johndoe@example.com"))
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				assert.Equal(t, "id,username,name,surname,email,phone,role,disabled,must_change_password", lines[0])
+				assert.Equal(t, "2,johndoe,,,johndoe@example.com,,,false,false", lines[1])
+			},
+		},
+		{
+			Name:         "Find Not Found",
+			Args:         []string{"users", "find", "ghost"},
+			ExpectedCode: exitNotFound,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("ghost", 1).
+					WillReturnError(gorm.ErrRecordNotFound)
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Contains(t, stderr, config.ErrUserNotFound.Error())
+			},
+		},
+		{
+			Name:         "Disable Table",
+			Args:         []string{"users", "disable", "johndoe"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Equal(t, "MESSAGE\n"+config.DisableUserMessage+"\n", stdout)
+			},
+		},
+		{
+			Name:         "Create Conflict",
+			Args:         []string{"users", "create", "-name", "John", "-surname", "Doe", "-username", "johndoe", "-phone", "123", "-email", "johndoe@example.com"},
+			ExpectedCode: exitConflict,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe' for key 'users.username'"})
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Rotate Admin Generates Password",
+			Args:         []string{"admin", "rotate-password", "-output", "json"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.ChangePwdTestQuery).
+					WithArgs(false, sqlmock.AnyArg(), "admin").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				var creds map[string]string
+				assert.NoError(t, json.Unmarshal([]byte(stdout), &creds))
+				assert.Equal(t, "admin", creds["username"])
+				assert.Len(t, creds["password"], 16)
+			},
+		},
+		{
+			Name:         "Import Dry Run",
+			Args:         []string{"users", "import", "-output", "csv", "-dry-run", importFile},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.FindTakenTestQuery).
+					WithArgs("johndoe", "john@example.com", "111").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Equal(t, "row,username,result,field,error\n1,johndoe,created,,\n2,janedoe,invalid,,invalid email address\n", stdout)
+			},
+		},
+		{
+			Name:         "Import Unknown Format",
+			Args:         []string{"users", "import", "users.xml"},
+			ExpectedCode: exitUsage,
+			MockAct:      func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			Name:         "Export",
+			Args:         []string{"users", "export", "-format", "ndjson", "-disabled", "true"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.ExportTestQuery).
+					WithArgs(true, 500).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "disabled"}).AddRow("1", "johndoe", "hash", "user", true))
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Equal(t, `{"id":"1","username":"johndoe","name":"","surname":"","email":"","phone":"","role":"user","disabled":true,"must_change_password":false}`+"\n", stdout)
+			},
+		},
+		{
+			Name:         "Schema Version",
+			Args:         []string{"db", "schema-version", "-output", "json"},
+			ExpectedCode: exitOK,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) FROM `schema_migrations`").
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+			},
+			Check: func(t *testing.T, stdout, stderr string) {
+				assert.Contains(t, stdout, `"version": 1`)
+				assert.Contains(t, stdout, `"up_to_date": false`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			a, mock, stdout, stderr := testApp(t)
+			tt.MockAct(mock)
+
+			code := a.execute(context.Background(), tt.Args)
+
+			assert.Equal(t, tt.ExpectedCode, code, stderr.String())
+			if tt.Check != nil {
+				tt.Check(t, stdout.String(), stderr.String())
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// gomanagectl runs administrative user and database operations directly
+// against the database, without going through the API.
+//
+//	gomanagectl [config flags] <group> <command> [flags] [username]
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/cache"
+	"go-manage-mysql/internal/database"
+	"go-manage-mysql/internal/encryption"
+	"go-manage-mysql/internal/logging"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exit codes
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitConflict = 4
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if err := config.LoadEnv(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	cfg, rest, err := config.LoadArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return exitUsage
+	}
+	config.SetCurrent(cfg)
+
+	// keep stdout clean for the command output
+	cfg.Log.Level = "warn"
+	slog.SetDefault(logging.New(cfg.Log, stderr))
+
+	if len(rest) < 2 || lookup(rest) == nil {
+		usage(stderr)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.Open(ctx)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer database.Close(db)
+
+	a := &app{db: db, stdin: os.Stdin, stdout: stdout, stderr: stderr}
+	users := repository.NewUserRepository(db)
+	if cfg.Encryption.Enabled() {
+		keyring, err := encryption.Load(ctx, cfg.Encryption, repository.NewDataKeyRepository(db))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		users.Cipher, a.cipher = keyring, keyring
+	}
+	var repo repository.UserRepository = users
+	// a memory cache lives in the API process, only a shared one needs invalidating
+	if cfg.Cache.Backend == cache.BackendRedis {
+		c, err := cache.New(cfg.Cache)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		defer c.Close()
+		a.cached = repository.NewCachedRepository(repo, c, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+		a.cached.Cipher = users.Cipher
+		repo = a.cached
+	}
+	service := services.NewUserServices(repo)
+	service.Sessions = repository.NewSessionRepository(db)
+	a.service = service
+	return a.execute(ctx, rest)
+}
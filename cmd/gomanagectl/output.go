@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/services"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func validFormat(format string) bool {
+	return format == formatTable || format == formatJSON || format == formatCSV
+}
+
+// output is what a command prints: rows for table and csv, value for json.
+type output struct {
+	headers []string
+	rows    [][]string
+	value   interface{}
+}
+
+// userView is a user without its password hash.
+type userView struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Surname  string `json:"surname"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+
+	MustChangePassword bool `json:"must_change_password"`
+}
+
+func usersOutput(users ...models.User) output {
+	out := output{headers: []string{"id", "username", "name", "surname", "email", "phone", "role", "disabled", "must_change_password"}}
+	views := make([]userView, 0, len(users))
+	for _, u := range users {
+		views = append(views, userView{u.ID, u.Username, u.Name, u.Surname, u.Email, u.Phone, u.Role, u.Disabled, u.MustChangePassword})
+		out.rows = append(out.rows, []string{u.ID, u.Username, u.Name, u.Surname, u.Email, u.Phone, u.Role, strconv.FormatBool(u.Disabled), strconv.FormatBool(u.MustChangePassword)})
+	}
+	out.value = views
+	if len(views) == 1 {
+		out.value = views[0]
+	}
+	return out
+}
+
+// importOutput lists the result of every row, json also has the totals.
+func importOutput(report services.ImportReport) output {
+	out := output{headers: []string{"row", "username", "result", "field", "error"}, value: report}
+	for _, row := range report.Rows {
+		out.rows = append(out.rows, []string{strconv.Itoa(row.Row), row.Username, row.Result, row.Field, row.Error})
+	}
+	return out
+}
+
+func messageOutput(message string) output {
+	return output{
+		headers: []string{"message"},
+		rows:    [][]string{{message}},
+		value:   map[string]string{"message": message},
+	}
+}
+
+// credentialsOutput shows a generated password once.
+func credentialsOutput(username, password string) output {
+	return output{
+		headers: []string{"username", "password"},
+		rows:    [][]string{{username, password}},
+		value:   map[string]string{"username": username, "password": password},
+	}
+}
+
+func (o output) write(w io.Writer, format string) error {
+	// commands streaming their own output return an empty one
+	if o.headers == nil && o.value == nil {
+		return nil
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(o.value)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(o.headers); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(o.rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(o.headers, "\t")))
+		for _, row := range o.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
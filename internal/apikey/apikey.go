@@ -0,0 +1,252 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"gorm.io/gorm"
+)
+
+// Header carries the api key of a request.
+const Header = "X-API-Key"
+
+// keyPrefix starts every key, it tells them apart from other secrets in
+// logs and secret scanners
+const keyPrefix = "gmk_"
+
+// touchInterval limits how often a key in use records its last use
+const touchInterval = time.Minute
+
+// scopes
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeJobs       = "jobs"
+	ScopeClients    = "oauth:clients"
+	ScopeHealth     = "health"
+)
+
+// Scopes lists the scopes a key can be created with.
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeJobs, ScopeClients, ScopeHealth}
+
+// Request describes the key to create.
+type Request struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt defaults to api_keys.default_ttl from now
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Service creates and checks api keys. Keys act as their owner, so a key
+// stops working along with a disabled or deleted owner.
+type Service struct {
+	repo  repository.APIKeyRepository
+	users services.UserServices
+	cfg   config.APIKeysConfig
+	now   func() time.Time
+}
+
+var _ middleware.Authenticator = (*Service)(nil)
+
+func NewService(repo repository.APIKeyRepository, users services.UserServices, cfg config.APIKeysConfig) *Service {
+	return &Service{repo: repo, users: users, cfg: cfg, now: time.Now}
+}
+
+// Create issues a key for username and returns it along with the only copy
+// of its secret.
+func (s *Service) Create(ctx context.Context, username string, req Request, createdBy string) (key models.APIKey, secret string, err error) {
+	ctx, span := tracing.Start(ctx, "apikey.Create")
+	defer func() { tracing.End(span, err) }()
+
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, config.ErrInvalidKeyRequest)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, config.ErrInvalidScope)
+		}
+	}
+	now := s.now().UTC()
+	expiresAt, expiryErr := s.expiry(now, req.ExpiresAt)
+	if expiryErr != nil {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, expiryErr)
+	}
+
+	owner, searchErr := s.users.SearchUser(ctx, username)
+	if searchErr != nil {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, searchErr)
+	}
+
+	prefix, randErr := random(6, hex.EncodeToString)
+	if randErr != nil {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, randErr)
+	}
+	secret, randErr = random(32, base64.RawURLEncoding.EncodeToString)
+	if randErr != nil {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, randErr)
+	}
+
+	key = models.APIKey{
+		ID:         uuid.NewString(),
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     keyPrefix + prefix,
+		SecretHash: hash(secret),
+		UserID:     owner.ID,
+		Username:   owner.Username,
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		CreatedBy:  createdBy,
+		CreatedAt:  now,
+		ExpiresAt:  expiresAt,
+	}
+	if createErr := s.repo.CreateAPIKey(ctx, key); createErr != nil {
+		return models.APIKey{}, "", apperror.AppError(config.ErrCreatingKey, createErr)
+	}
+	return key, key.Prefix + "_" + secret, nil
+}
+
+// expiry applies the default lifetime and checks the maximum one.
+func (s *Service) expiry(now time.Time, requested *time.Time) (*time.Time, error) {
+	if requested == nil {
+		if s.cfg.DefaultTTL == 0 {
+			return nil, nil
+		}
+		expiresAt := now.Add(s.cfg.DefaultTTL)
+		return &expiresAt, nil
+	}
+	expiresAt := requested.UTC()
+	if !expiresAt.After(now) || (s.cfg.MaxTTL > 0 && expiresAt.After(now.Add(s.cfg.MaxTTL))) {
+		return nil, config.ErrInvalidExpiry
+	}
+	return &expiresAt, nil
+}
+
+// List returns the keys of username, or every key when it is empty.
+func (s *Service) List(ctx context.Context, username string) (keys []models.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "apikey.List")
+	defer func() { tracing.End(span, err) }()
+
+	keys, listErr := s.repo.ListAPIKeys(ctx, username)
+	if listErr != nil {
+		return nil, apperror.AppError(config.ErrListingKeys, listErr)
+	}
+	return keys, nil
+}
+
+// Revoke revokes the key with id among the keys of username, or among every
+// key when it is empty.
+func (s *Service) Revoke(ctx context.Context, id, username string) (err error) {
+	ctx, span := tracing.Start(ctx, "apikey.Revoke")
+	defer func() { tracing.End(span, err) }()
+
+	if revokeErr := s.repo.RevokeAPIKey(ctx, id, username); revokeErr != nil {
+		if errors.Is(revokeErr, config.ErrNoRowsAffected) {
+			return apperror.AppError(config.ErrRevokingKey, config.ErrAPIKeyNotFound)
+		}
+		return apperror.AppError(config.ErrRevokingKey, revokeErr)
+	}
+	return nil
+}
+
+// Authenticate accepts requests carrying a valid key in the api key header.
+func (s *Service) Authenticate(ctx *gin.Context) (principal middleware.Principal, ok bool, err error) {
+	presented := ctx.GetHeader(Header)
+	if presented == "" {
+		return middleware.Principal{}, false, nil
+	}
+
+	spanCtx, span := tracing.Start(ctx, "apikey.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	key, checkErr := s.check(spanCtx, presented)
+	if checkErr != nil {
+		return middleware.Principal{}, false, checkErr
+	}
+
+	owner, searchErr := s.users.SearchUserByID(spanCtx, key.UserID)
+	if searchErr != nil {
+		if errors.Is(searchErr, config.ErrUserNotFound) {
+			return middleware.Principal{}, false, config.ErrInvalidAPIKey
+		}
+		return middleware.Principal{}, false, searchErr
+	}
+	if owner.Disabled {
+		return middleware.Principal{}, false, config.ErrUserDisabled
+	}
+
+	now := s.now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		// a failed write only loses the last use, the request goes on
+		if touchErr := s.repo.TouchAPIKey(spanCtx, key.ID, now); touchErr != nil {
+			slog.WarnContext(ctx, "error recording api key use", "key", key.Prefix, "error", touchErr)
+		}
+	}
+
+	// an owner with a pending password change is held back like with a token
+	return middleware.Principal{
+		Username:       owner.Username,
+		Role:           owner.Role,
+		PasswordChange: owner.MustChangePassword,
+		Scopes:         key.Scopes,
+		KeyID:          key.ID,
+	}, true, nil
+}
+
+// check finds the key presented and verifies its secret and lifetime.
+func (s *Service) check(ctx context.Context, presented string) (models.APIKey, error) {
+	rest, ok := strings.CutPrefix(presented, keyPrefix)
+	if !ok {
+		return models.APIKey{}, config.ErrInvalidAPIKey
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return models.APIKey{}, config.ErrInvalidAPIKey
+	}
+
+	key, getErr := s.repo.GetAPIKeyByPrefix(ctx, keyPrefix+prefix)
+	if getErr != nil {
+		if errors.Is(getErr, gorm.ErrRecordNotFound) {
+			return models.APIKey{}, config.ErrInvalidAPIKey
+		}
+		return models.APIKey{}, getErr
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(key.SecretHash)) != 1 || key.RevokedAt != nil {
+		return models.APIKey{}, config.ErrInvalidAPIKey
+	}
+	if key.ExpiresAt != nil && !s.now().Before(*key.ExpiresAt) {
+		return models.APIKey{}, config.ErrAPIKeyExpired
+	}
+	return key, nil
+}
+
+// hash is enough for secrets of 256 random bits, they cannot be guessed
+// from it the way passwords can.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func random(size int, encode func([]byte) string) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
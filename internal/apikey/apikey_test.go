@@ -0,0 +1,221 @@
+package apikey
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeRepo struct {
+	keys    map[string]models.APIKey
+	touched int
+}
+
+func (r *fakeRepo) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *fakeRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) ListAPIKeys(ctx context.Context, username string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	for _, key := range r.keys {
+		if username == "" || key.Username == username {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeRepo) RevokeAPIKey(ctx context.Context, id, username string) error {
+	key, ok := r.keys[id]
+	if !ok || key.RevokedAt != nil || (username != "" && key.Username != username) {
+		return config.ErrNoRowsAffected
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	r.keys[id] = key
+	return nil
+}
+
+func (r *fakeRepo) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	key := r.keys[id]
+	key.LastUsedAt = &at
+	r.keys[id] = key
+	r.touched++
+	return nil
+}
+
+type fakeUsers struct {
+	services.UserServices
+	user models.User
+}
+
+func (u *fakeUsers) SearchUser(ctx context.Context, username string) (models.User, error) {
+	if username != u.user.Username {
+		return models.User{}, config.ErrUserNotFound
+	}
+	return u.user, nil
+}
+
+func (u *fakeUsers) SearchUserByID(ctx context.Context, id string) (models.User, error) {
+	if id != u.user.ID {
+		return models.User{}, config.ErrUserNotFound
+	}
+	return u.user, nil
+}
+
+func testService() (*Service, *fakeRepo, *fakeUsers) {
+	repo := &fakeRepo{keys: map[string]models.APIKey{}}
+	users := &fakeUsers{user: models.User{ID: "1", Username: "svc-reports", Role: models.RoleAdmin}}
+	return NewService(repo, users, config.APIKeysConfig{DefaultTTL: 24 * time.Hour, MaxTTL: 48 * time.Hour}), repo, users
+}
+
+// authenticate runs the service as the only authenticator of a request.
+func authenticate(s *Service, key string) (middleware.Principal, bool, error) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if key != "" {
+		ctx.Request.Header.Set(Header, key)
+	}
+	return s.Authenticate(ctx)
+}
+
+func TestCreate(t *testing.T) {
+	s, _, _ := testService()
+	past := time.Now().Add(-time.Hour)
+	tooLate := time.Now().Add(72 * time.Hour)
+
+	test := []struct {
+		Name        string
+		Username    string
+		Request     Request
+		ExpectedErr error
+	}{
+		{Name: "Created", Username: "svc-reports", Request: Request{Name: "reports", Scopes: []string{ScopeUsersRead, ScopeJobs, ScopeUsersRead}}},
+		{Name: "Missing Name", Username: "svc-reports", Request: Request{Scopes: []string{ScopeUsersRead}}, ExpectedErr: config.ErrInvalidKeyRequest},
+		{Name: "Missing Scopes", Username: "svc-reports", Request: Request{Name: "reports"}, ExpectedErr: config.ErrInvalidKeyRequest},
+		{Name: "Unknown Scope", Username: "svc-reports", Request: Request{Name: "reports", Scopes: []string{"admin"}}, ExpectedErr: config.ErrInvalidScope},
+		{Name: "Expired", Username: "svc-reports", Request: Request{Name: "reports", Scopes: []string{ScopeJobs}, ExpiresAt: &past}, ExpectedErr: config.ErrInvalidExpiry},
+		{Name: "Beyond Max TTL", Username: "svc-reports", Request: Request{Name: "reports", Scopes: []string{ScopeJobs}, ExpiresAt: &tooLate}, ExpectedErr: config.ErrInvalidExpiry},
+		{Name: "Unknown User", Username: "nobody", Request: Request{Name: "reports", Scopes: []string{ScopeJobs}}, ExpectedErr: config.ErrUserNotFound},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			key, secret, err := s.Create(context.Background(), tt.Username, tt.Request, "admin")
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			if tt.ExpectedErr != nil {
+				return
+			}
+			assert.True(t, strings.HasPrefix(secret, key.Prefix+"_"))
+			assert.NotContains(t, key.SecretHash, strings.TrimPrefix(secret, key.Prefix+"_"))
+			assert.Equal(t, []string{ScopeJobs, ScopeUsersRead}, key.Scopes)
+			assert.Equal(t, "1", key.UserID)
+			assert.WithinDuration(t, time.Now().Add(24*time.Hour), *key.ExpiresAt, time.Minute)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, repo, users := testService()
+	key, secret, err := s.Create(context.Background(), "svc-reports", Request{Name: "reports", Scopes: []string{ScopeUsersRead}}, "admin")
+	assert.NoError(t, err)
+
+	principal, ok, err := authenticate(s, secret)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, middleware.Principal{Username: "svc-reports", Role: models.RoleAdmin, Scopes: []string{ScopeUsersRead}, KeyID: key.ID}, principal)
+
+	// the last use is only written once a minute
+	users.user.MustChangePassword = true
+	principal, _, err = authenticate(s, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.touched)
+	assert.True(t, principal.PasswordChange)
+	users.user.MustChangePassword = false
+
+	_, ok, err = authenticate(s, "")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	test := []struct {
+		Name        string
+		Key         string
+		Act         func()
+		ExpectedErr error
+	}{
+		{Name: "Malformed", Key: "Bearer abc", ExpectedErr: config.ErrInvalidAPIKey},
+		{Name: "Unknown Prefix", Key: "gmk_000000000000_" + strings.Repeat("a", 43), ExpectedErr: config.ErrInvalidAPIKey},
+		{Name: "Wrong Secret", Key: key.Prefix + "_" + strings.Repeat("a", 43), ExpectedErr: config.ErrInvalidAPIKey},
+		{
+			Name:        "Disabled Owner",
+			Key:         secret,
+			Act:         func() { users.user.Disabled = true },
+			ExpectedErr: config.ErrUserDisabled,
+		},
+		{
+			Name: "Expired",
+			Key:  secret,
+			Act: func() {
+				users.user.Disabled = false
+				s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+			},
+			ExpectedErr: config.ErrAPIKeyExpired,
+		},
+		{
+			Name: "Revoked",
+			Key:  secret,
+			Act: func() {
+				s.now = time.Now
+				assert.NoError(t, s.Revoke(context.Background(), key.ID, "svc-reports"))
+			},
+			ExpectedErr: config.ErrInvalidAPIKey,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			if tt.Act != nil {
+				tt.Act()
+			}
+
+			_, ok, err := authenticate(s, tt.Key)
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s, _, _ := testService()
+	key, _, err := s.Create(context.Background(), "svc-reports", Request{Name: "reports", Scopes: []string{ScopeJobs}}, "admin")
+	assert.NoError(t, err)
+
+	// other users cannot see the key
+	assert.ErrorIs(t, s.Revoke(context.Background(), key.ID, "johndoe"), config.ErrAPIKeyNotFound)
+	assert.NoError(t, s.Revoke(context.Background(), key.ID, ""))
+	assert.ErrorIs(t, s.Revoke(context.Background(), key.ID, ""), config.ErrAPIKeyNotFound)
+}
@@ -0,0 +1,304 @@
+// Package bulk reads users to import and writes exported users as CSV or
+// NDJSON, one user per row.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-manage-mysql/internal/models"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ContentTypes maps each format to the media type it is served with.
+var ContentTypes = map[string]string{
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// maxLine bounds a single NDJSON line.
+const maxLine = 1 << 20
+
+// Columns are the exported fields, in order. Imports also accept password.
+var Columns = []string{"id", "username", "name", "surname", "email", "phone", "role", "disabled", "must_change_password"}
+
+var ErrUnknownFormat = errors.New("unknown format, expected csv or ndjson")
+
+// FormatOf guesses the format from a content type or file name.
+func FormatOf(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".csv"), strings.HasPrefix(name, "text/csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"),
+		strings.Contains(name, "ndjson"), strings.HasPrefix(name, "application/jsonl"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// Record is one decoded row. Err is set when the row itself is malformed,
+// the rest of the input can still be read.
+type Record struct {
+	// Row is the line the record starts on
+	Row  int
+	User models.User
+	Err  error
+}
+
+// Reader returns records until io.EOF. Any other error means the input
+// cannot be read further.
+type Reader interface {
+	Read() (Record, error)
+}
+
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+		return &ndjsonReader{scanner: scanner}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv header is missing")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !importable(column) {
+			return nil, fmt.Errorf("unknown csv column %q", column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("duplicated csv column %q", column)
+		}
+		seen[column] = true
+		header[i] = column
+	}
+	// every row must have as many fields as the header
+	reader.FieldsPerRecord = len(header)
+	return &csvReader{reader: reader, columns: header}, nil
+}
+
+func (c *csvReader) Read() (Record, error) {
+	fields, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Record{Row: parseErr.StartLine, Err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	record := Record{Row: line}
+	for i, value := range fields {
+		if err := setField(&record.User, c.columns[i], value); err != nil {
+			record.Err = err
+			break
+		}
+	}
+	return record, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// importRow is an NDJSON line, exported lines are accepted as they are.
+type importRow struct {
+	ID                 string `json:"id"`
+	Username           string `json:"username"`
+	Name               string `json:"name"`
+	Surname            string `json:"surname"`
+	Email              string `json:"email"`
+	Phone              string `json:"phone"`
+	Password           string `json:"password,omitempty"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+func (n *ndjsonReader) Read() (Record, error) {
+	for n.scanner.Scan() {
+		n.line++
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row importRow
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			return Record{Row: n.line, Err: fmt.Errorf("invalid json: %w", err)}, nil
+		}
+		return Record{Row: n.line, User: models.User{
+			Username:           row.Username,
+			Name:               row.Name,
+			Surname:            row.Surname,
+			Email:              row.Email,
+			Phone:              row.Phone,
+			Password:           row.Password,
+			Role:               row.Role,
+			Disabled:           row.Disabled,
+			MustChangePassword: row.MustChangePassword,
+		}}, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return Record{}, fmt.Errorf("line %d: %w", n.line+1, err)
+	}
+	return Record{}, io.EOF
+}
+
+func importable(column string) bool {
+	if column == "password" {
+		return true
+	}
+	for _, c := range Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// setField fills column of user from a csv value. The id is ignored, ids are
+// never taken from an import.
+func setField(user *models.User, column, value string) error {
+	value = strings.TrimSpace(value)
+	switch column {
+	case "username":
+		user.Username = value
+	case "name":
+		user.Name = value
+	case "surname":
+		user.Surname = value
+	case "email":
+		user.Email = value
+	case "phone":
+		user.Phone = value
+	case "password":
+		user.Password = value
+	case "role":
+		user.Role = value
+	case "disabled", "must_change_password":
+		b := false
+		if value != "" {
+			var err error
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s must be true or false, got %q", column, value)
+			}
+		}
+		if column == "disabled" {
+			user.Disabled = b
+		} else {
+			user.MustChangePassword = b
+		}
+	}
+	return nil
+}
+
+// Writer writes users without their password hash. Flush must be called
+// once the last user is written.
+type Writer interface {
+	Write(user models.User) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) Write(user models.User) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.writer.Write([]string{
+		user.ID, user.Username, user.Name, user.Surname, user.Email, user.Phone, user.Role,
+		strconv.FormatBool(user.Disabled), strconv.FormatBool(user.MustChangePassword),
+	})
+}
+
+// Flush also writes the header of an empty export.
+func (c *csvWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.writer.Write(Columns)
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(user models.User) error {
+	return n.encoder.Encode(importRow{
+		ID:                 user.ID,
+		Username:           user.Username,
+		Name:               user.Name,
+		Surname:            user.Surname,
+		Email:              user.Email,
+		Phone:              user.Phone,
+		Role:               user.Role,
+		Disabled:           user.Disabled,
+		MustChangePassword: user.MustChangePassword,
+	})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buffered.Flush()
+}
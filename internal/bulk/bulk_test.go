@@ -0,0 +1,163 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go-manage-mysql/internal/models"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, reader Reader) []Record {
+	var records []Record
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestReader(t *testing.T) {
+	test := []struct {
+		Name     string
+		Format   string
+		Input    string
+		Expected []Record
+	}{
+		{
+			Name:   "CSV",
+			Format: FormatCSV,
+			Input: "\ufeffUsername,name,surname,email,phone,password,role,disabled\n" +
+				"johndoe,John,Doe,john@example.com,123,Password1234,admin,true\n" +
+				"janedoe, Jane ,Doe,jane@example.com,456,Password1234,,\n",
+			Expected: []Record{
+				{Row: 2, User: models.User{Username: "johndoe", Name: "John", Surname: "Doe", Email: "john@example.com", Phone: "123", Password: "Password1234", Role: "admin", Disabled: true}},
+				{Row: 3, User: models.User{Username: "janedoe", Name: "Jane", Surname: "Doe", Email: "jane@example.com", Phone: "456", Password: "Password1234"}},
+			},
+		},
+		{
+			Name:   "CSV Bad Rows",
+			Format: FormatCSV,
+			Input:  "username,disabled\njohndoe,maybe\njanedoe\nbob,false\n",
+			Expected: []Record{
+				{Row: 2, User: models.User{Username: "johndoe"}, Err: errors.New(`disabled must be true or false, got "maybe"`)},
+				{Row: 3, Err: errors.New("wrong number of fields")},
+				{Row: 4, User: models.User{Username: "bob"}},
+			},
+		},
+		{
+			Name:   "NDJSON",
+			Format: FormatNDJSON,
+			Input: `{"id":"ignored","username":"johndoe","email":"john@example.com","disabled":true}` + "\n\n" +
+				`{"username":` + "\n" +
+				`{"username":"janedoe","nickname":"jd"}` + "\n",
+			Expected: []Record{
+				{Row: 1, User: models.User{Username: "johndoe", Email: "john@example.com", Disabled: true}},
+				{Row: 3, Err: errors.New("invalid json: unexpected EOF")},
+				{Row: 4, Err: errors.New(`invalid json: json: unknown field "nickname"`)},
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			reader, err := NewReader(tt.Format, strings.NewReader(tt.Input))
+			assert.NoError(t, err)
+
+			records := readAll(t, reader)
+			assert.Len(t, records, len(tt.Expected))
+			for i := range records {
+				assert.Equal(t, tt.Expected[i].Row, records[i].Row)
+				if tt.Expected[i].Err != nil {
+					assert.EqualError(t, records[i].Err, tt.Expected[i].Err.Error())
+					continue
+				}
+				assert.NoError(t, records[i].Err)
+				assert.Equal(t, tt.Expected[i].User, records[i].User)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	test := []struct {
+		Name   string
+		Format string
+		Input  string
+		Err    string
+	}{
+		{Name: "Unknown Format", Format: "xml", Err: ErrUnknownFormat.Error()},
+		{Name: "Missing Header", Format: FormatCSV, Input: "", Err: "csv header is missing"},
+		{Name: "Unknown Column", Format: FormatCSV, Input: "username,nickname\n", Err: `unknown csv column "nickname"`},
+		{Name: "Duplicated Column", Format: FormatCSV, Input: "username,USERNAME\n", Err: `duplicated csv column "username"`},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewReader(tt.Format, strings.NewReader(tt.Input))
+			assert.EqualError(t, err, tt.Err)
+		})
+	}
+
+	t.Run("Line Too Long", func(t *testing.T) {
+		reader, _ := NewReader(FormatNDJSON, strings.NewReader(strings.Repeat("x", maxLine+1)))
+		_, err := reader.Read()
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+	})
+}
+
+func TestWriter(t *testing.T) {
+	users := []models.User{
+		{ID: "1", Username: "johndoe", Name: "John", Surname: "Doe", Email: "john@example.com", Phone: "123", Password: "hash", Role: "user"},
+		{ID: "2", Username: "janedoe", Name: "Jane, Q.", Surname: "Doe", Email: "jane@example.com", Phone: "456", Password: "hash", Role: "admin", Disabled: true},
+	}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(format, &buf)
+			assert.NoError(t, err)
+			for _, user := range users {
+				assert.NoError(t, writer.Write(user))
+			}
+			assert.NoError(t, writer.Flush())
+			assert.NotContains(t, buf.String(), "hash")
+
+			// an export can be imported back, without ids and passwords
+			reader, err := NewReader(format, &buf)
+			assert.NoError(t, err)
+			records := readAll(t, reader)
+			assert.Len(t, records, len(users))
+			for i, record := range records {
+				assert.NoError(t, record.Err)
+				expected := users[i]
+				expected.ID, expected.Password = "", ""
+				assert.Equal(t, expected, record.User)
+			}
+		})
+	}
+
+	t.Run("Empty CSV Has Header", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, _ := NewWriter(FormatCSV, &buf)
+		assert.NoError(t, writer.Flush())
+		assert.Equal(t, strings.Join(Columns, ",")+"\n", buf.String())
+	})
+}
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, FormatCSV, FormatOf("text/csv; charset=utf-8"))
+	assert.Equal(t, FormatCSV, FormatOf("users.CSV"))
+	assert.Equal(t, FormatNDJSON, FormatOf("application/x-ndjson"))
+	assert.Equal(t, FormatNDJSON, FormatOf("users.jsonl"))
+	assert.Equal(t, "", FormatOf("application/json"))
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"time"
+)
+
+// backends
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Cache stores opaque values for a limited time.
+type Cache interface {
+	// Get reports whether key was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// New builds the configured backend, nil when caching is disabled.
+func New(cfg config.CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case BackendNone:
+		return nil, nil
+	case BackendMemory:
+		return NewLRU(cfg.Size), nil
+	case BackendRedis:
+		return NewRESP(RESPOptions{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			Timeout:  cfg.Timeout,
+			PoolSize: cfg.PoolSize,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
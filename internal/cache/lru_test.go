@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Evicts Least Recently Used", func(t *testing.T) {
+		c := NewLRU(2)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		assert.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+		_, _, _ = c.Get(ctx, "a")
+		assert.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+		_, found, _ := c.Get(ctx, "b")
+		assert.False(t, found)
+		value, found, _ := c.Get(ctx, "a")
+		assert.True(t, found)
+		assert.Equal(t, []byte("1"), value)
+		assert.Equal(t, 2, c.Len())
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		c := NewLRU(2)
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Second))
+
+		_, found, _ := c.Get(ctx, "a")
+		assert.True(t, found)
+
+		now = now.Add(time.Second)
+		_, found, _ = c.Get(ctx, "a")
+		assert.False(t, found)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("Overwrite And Delete", func(t *testing.T) {
+		c := NewLRU(2)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+		assert.NoError(t, c.Set(ctx, "a", []byte("2"), time.Minute))
+		value, _, _ := c.Get(ctx, "a")
+		assert.Equal(t, []byte("2"), value)
+
+		assert.NoError(t, c.Delete(ctx, "a", "missing"))
+		_, found, _ := c.Get(ctx, "a")
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RESPOptions configure a RESP client.
+type RESPOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration
+	PoolSize int
+}
+
+// RESP talks the Redis protocol to any server that speaks it: Redis, Valkey,
+// KeyDB or a local stand-in. Only GET, SET with PX, DEL, PING and EVAL are
+// used.
+type RESP struct {
+	opts RESPOptions
+	idle chan *respConn
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// ErrServer is a error reply of the server.
+type ErrServer string
+
+func (e ErrServer) Error() string {
+	return "cache server: " + string(e)
+}
+
+var errNil = errors.New("nil reply")
+
+func NewRESP(opts RESPOptions) *RESP {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	return &RESP{
+		opts: opts,
+		idle: make(chan *respConn, opts.PoolSize),
+		dial: dialer.DialContext,
+	}
+}
+
+func (c *RESP) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if errors.Is(err, errNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected GET reply %v", reply)
+	}
+	return value, true, nil
+}
+
+func (c *RESP) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (c *RESP) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.do(ctx, "DEL", keys...)
+	return err
+}
+
+// Eval runs a Lua script on the server and returns its reply.
+func (c *RESP) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	params := append([]string{script, strconv.Itoa(len(keys))}, keys...)
+	return c.do(ctx, "EVAL", append(params, args...)...)
+}
+
+// Ping verifies the server answers, usable as a readiness check.
+func (c *RESP) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+func (c *RESP) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RESP) do(ctx context.Context, command string, args ...string) (interface{}, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.roundTrip(ctx, c.opts.Timeout, append([]string{command}, args...))
+	var serverErr ErrServer
+	if err != nil && !errors.Is(err, errNil) && !errors.As(err, &serverErr) {
+		// the stream may be out of sync, never reuse it
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+func (c *RESP) get(ctx context.Context) (*respConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := c.dial(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to cache: %w", err)
+	}
+	conn := &respConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.opts.Password != "" {
+		if _, err := conn.roundTrip(ctx, c.opts.Timeout, []string{"AUTH", c.opts.Password}); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("error authenticating to cache: %w", err)
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := conn.roundTrip(ctx, c.opts.Timeout, []string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("error selecting cache database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *RESP) put(conn *respConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+func (conn *respConn) roundTrip(ctx context.Context, timeout time.Duration, args []string) (interface{}, error) {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if err := conn.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.conn.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+	return readReply(conn.reader)
+}
+
+// encodeCommand writes args as an array of bulk strings.
+func encodeCommand(args []string) []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, ErrServer(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %w", err)
+		}
+		if size < 0 {
+			return nil, errNil
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	case '*':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length: %w", err)
+		}
+		if size < 0 {
+			return nil, errNil
+		}
+		values := make([]interface{}, size)
+		for i := range values {
+			values[i], err = readReply(r)
+			if err != nil && !errors.Is(err, errNil) {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("malformed reply line")
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// standIn is a tiny server speaking enough of the Redis protocol for RESP.
+type standIn struct {
+	listener net.Listener
+	password string
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	conns   int
+}
+
+func newStandIn(t *testing.T, password string) *standIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &standIn{listener: listener, password: password, values: map[string]string{}, expires: map[string]time.Time{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *standIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authed := s.password == ""
+
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		s.mu.Lock()
+		var out string
+		switch command := strings.ToUpper(args[0]); {
+		case command == "AUTH":
+			authed = args[1] == s.password
+			out = "+OK\r\n"
+			if !authed {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case command == "PING":
+			out = "+PONG\r\n"
+		case command == "GET":
+			value, ok := s.values[args[1]]
+			if expires, set := s.expires[args[1]]; set && !time.Now().Before(expires) {
+				ok = false
+			}
+			out = "$-1\r\n"
+			if ok {
+				out = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+		case command == "SET":
+			s.values[args[1]] = args[2]
+			var ms int
+			fmt.Sscan(args[4], &ms)
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			out = "+OK\r\n"
+		case command == "DEL":
+			for _, key := range args[1:] {
+				delete(s.values, key)
+			}
+			out = fmt.Sprintf(":%d\r\n", len(args)-1)
+		case command == "EVAL":
+			// echoes the number of keys and the first one
+			out = fmt.Sprintf("*2\r\n:%s\r\n$%d\r\n%s\r\n", args[2], len(args[3]), args[3])
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRESP(t *testing.T) {
+	ctx := context.Background()
+	server := newStandIn(t, "secret")
+	c := NewRESP(RESPOptions{Addr: server.listener.Addr().String(), Password: "secret", Timeout: time.Second, PoolSize: 2})
+	defer c.Close()
+
+	assert.NoError(t, c.Ping(ctx))
+
+	_, found, err := c.Get(ctx, "user")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, c.Set(ctx, "user", []byte("with\r\nnewline"), time.Minute))
+	value, found, err := c.Get(ctx, "user")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("with\r\nnewline"), value)
+
+	assert.NoError(t, c.Delete(ctx, "user"))
+	_, found, _ = c.Get(ctx, "user")
+	assert.False(t, found)
+
+	assert.NoError(t, c.Set(ctx, "short", []byte("1"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, found, _ = c.Get(ctx, "short")
+	assert.False(t, found)
+
+	reply, err := c.Eval(ctx, "return {#KEYS, KEYS[1]}", []string{"bucket"}, "10")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), []byte("bucket")}, reply)
+
+	// every call reused the authenticated connection
+	server.mu.Lock()
+	assert.Equal(t, 1, server.conns)
+	server.mu.Unlock()
+}
+
+func TestRESPErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		server := newStandIn(t, "secret")
+		c := NewRESP(RESPOptions{Addr: server.listener.Addr().String(), Password: "wrong", Timeout: time.Second})
+		err := c.Ping(ctx)
+		assert.ErrorContains(t, err, "WRONGPASS")
+	})
+
+	t.Run("Server Down", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := listener.Addr().String()
+		listener.Close()
+
+		c := NewRESP(RESPOptions{Addr: addr, Timeout: 100 * time.Millisecond})
+		_, _, err = c.Get(ctx, "user")
+		assert.ErrorContains(t, err, "error connecting to cache")
+	})
+
+	t.Run("Unresponsive Server", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(time.Second)
+			}
+		}()
+
+		c := NewRESP(RESPOptions{Addr: listener.Addr().String(), Timeout: 50 * time.Millisecond})
+		start := time.Now()
+		_, _, err = c.Get(ctx, "user")
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	pwd "go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/repository"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// bootstrapLock is the MySQL named lock serializing migrations and bootstraps
+// across instances.
+const bootstrapLock = "go-manage-mysql:bootstrap"
+
+var ErrBootstrapUsernameTaken = errors.New("bootstrap admin username belongs to a non-admin user")
+
+// BootstrapResult describes what Bootstrap did. Password is only set when it
+// was generated, so it can be shown once to the operator.
+type BootstrapResult struct {
+	Username string
+	Password string
+	Created  bool
+	Reset    bool
+	// Rotated is set when the admin seeded by the first releases still had
+	// the well known password
+	Rotated bool
+}
+
+// Changed reports whether the admin account was created, reset or rotated.
+func (r BootstrapResult) Changed() bool {
+	return r.Created || r.Reset || r.Rotated
+}
+
+// Bootstrap creates the initial admin when no admin exists. With reset it
+// also recovers an existing installation: the configured admin is re-enabled
+// and gets a new password. Either way the admin must change the password on
+// first login. An admin seeded by the first releases that still has the well
+// known password gets a new one too. Concurrent callers are serialized with a database lock, so
+// several instances starting together create a single admin. With a cipher
+// the personal data of the admin is encrypted like any other user's.
+func Bootstrap(ctx context.Context, db *gorm.DB, cfg config.BootstrapConfig, cipher repository.FieldCipher, reset bool) (BootstrapResult, error) {
+	result := BootstrapResult{Username: cfg.AdminUsername}
+
+	err := db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// the named lock belongs to this connection, and every query below
+		// must start from a clean statement on it
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		if err := acquireLock(conn, bootstrapLock, cfg.LockTimeout); err != nil {
+			return err
+		}
+		defer releaseLock(conn, bootstrapLock)
+
+		var admins int64
+		if err := conn.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			return fmt.Errorf("error counting admins. Error: %w", err)
+		}
+		var existing models.User
+		if admins > 0 && !reset {
+			if err := conn.Where("username = ? AND role = ?", legacyAdminUsername, models.RoleAdmin).Limit(1).Find(&existing).Error; err != nil {
+				return fmt.Errorf("error searching legacy admin. Error: %w", err)
+			}
+			if existing.ID == "" || !isLegacyAdmin(existing.Username, existing.Password) {
+				return nil
+			}
+			result.Username = existing.Username
+		} else {
+			if err := conn.Where("username = ?", cfg.AdminUsername).Limit(1).Find(&existing).Error; err != nil {
+				return fmt.Errorf("error searching bootstrap admin. Error: %w", err)
+			}
+			if existing.ID != "" && existing.Role != models.RoleAdmin && !reset {
+				return ErrBootstrapUsernameTaken
+			}
+		}
+
+		password, generated := cfg.AdminPassword, false
+		if password == "" {
+			var genErr error
+			if password, genErr = pwd.Generate(); genErr != nil {
+				return fmt.Errorf("error generating admin password. Error: %w", genErr)
+			}
+			generated = true
+		}
+
+		hash, hashErr := pwd.NewHasher(config.Current().Password).Hash(ctx, password)
+		if hashErr != nil {
+			return hashErr
+		}
+
+		switch {
+		case existing.ID != "" && !reset && admins > 0:
+			// the legacy admin keeps its state, only the password goes
+			updates := map[string]interface{}{"password": hash, "must_change_password": true}
+			if err := conn.Model(&models.User{}).Where("id = ?", existing.ID).Updates(updates).Error; err != nil {
+				return fmt.Errorf("error rotating legacy admin password. Error: %w", err)
+			}
+			result.Rotated = true
+		case existing.ID != "":
+			updates := map[string]interface{}{
+				"password":             hash,
+				"role":                 models.RoleAdmin,
+				"disabled":             false,
+				"must_change_password": true,
+			}
+			if err := conn.Model(&models.User{}).Where("id = ?", existing.ID).Updates(updates).Error; err != nil {
+				return fmt.Errorf("error resetting bootstrap admin. Error: %w", err)
+			}
+			result.Reset = true
+		default:
+			admin := models.User{
+				ID:                 uuid.NewString(),
+				Name:               cfg.AdminName,
+				Surname:            cfg.AdminSurname,
+				Username:           cfg.AdminUsername,
+				Phone:              cfg.AdminPhone,
+				Email:              cfg.AdminEmail,
+				Password:           hash,
+				Role:               models.RoleAdmin,
+				MustChangePassword: true,
+			}
+			if err := repository.Seal(ctx, cipher, &admin); err != nil {
+				return fmt.Errorf("error encrypting bootstrap admin. Error: %w", err)
+			}
+			if err := conn.Create(&admin).Error; err != nil {
+				return fmt.Errorf("error creating bootstrap admin. Error: %w", err)
+			}
+			result.Created = true
+		}
+
+		if generated {
+			result.Password = password
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// acquireLock waits up to timeout for the named lock. GET_LOCK takes whole
+// seconds, so the timeout is rounded up rather than down to no wait at all.
+func acquireLock(conn *gorm.DB, name string, timeout time.Duration) error {
+	var acquired *int
+	if err := conn.Raw(config.GetLock, name, int(math.Ceil(timeout.Seconds()))).Scan(&acquired).Error; err != nil {
+		return fmt.Errorf("error acquiring lock %s. Error: %w", name, err)
+	}
+	if acquired == nil || *acquired != 1 {
+		return fmt.Errorf("timed out waiting for lock %s", name)
+	}
+	return nil
+}
+
+func releaseLock(conn *gorm.DB, name string) {
+	conn.Exec(config.ReleaseLock, name)
+}
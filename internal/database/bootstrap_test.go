@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	countAdminsQuery = "SELECT count\\(\\*\\) FROM `users` WHERE role = \\?"
+	findAdminQuery   = "SELECT \\* FROM `users` WHERE username = \\? LIMIT \\?"
+	findLegacyQuery  = "SELECT \\* FROM `users` WHERE username = \\? AND role = \\? LIMIT \\?"
+)
+
+func bootstrapConfig(password string) config.BootstrapConfig {
+	return config.BootstrapConfig{
+		AdminUsername: "admin",
+		AdminPassword: password,
+		AdminName:     "Admin",
+		AdminSurname:  "Admin",
+		AdminEmail:    "admin@localhost.localdomain",
+		AdminPhone:    "0000000000",
+		LockTimeout:   5 * time.Second,
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	legacyHash, _ := bcrypt.GenerateFromPassword([]byte(legacyAdminPassword), bcrypt.MinCost)
+	chosenHash, _ := bcrypt.GenerateFromPassword([]byte("Password1234"), bcrypt.MinCost)
+
+	tests := []struct {
+		Name        string
+		Config      config.BootstrapConfig
+		Reset       bool
+		ExpectedErr string
+		MockAct     func(mock sqlmock.Sqlmock)
+		Check       func(t *testing.T, result BootstrapResult)
+	}{
+		{
+			Name:   "Creates Admin With Generated Password",
+			Config: bootstrapConfig(""),
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectQuery(countAdminsQuery).
+					WithArgs(models.RoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(findAdminQuery).
+					WithArgs("admin", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WithArgs(sqlmock.AnyArg(), "Admin", "Admin", "admin", "0000000000", "admin@localhost.localdomain", sqlmock.AnyArg(), models.RoleAdmin, false, true, nil, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(regexp.QuoteMeta(config.ReleaseLock)).
+					WithArgs(bootstrapLock).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			Check: func(t *testing.T, result BootstrapResult) {
+				assert.True(t, result.Created)
+				assert.Len(t, result.Password, 16)
+			},
+		},
+		{
+			Name:   "Skips When Admin Exists",
+			Config: bootstrapConfig(""),
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectQuery(countAdminsQuery).
+					WithArgs(models.RoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(findLegacyQuery).
+					WithArgs("admin", models.RoleAdmin, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "password"}).AddRow("1", "admin", models.RoleAdmin, string(chosenHash)))
+				mock.ExpectExec(regexp.QuoteMeta(config.ReleaseLock)).
+					WithArgs(bootstrapLock).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			Check: func(t *testing.T, result BootstrapResult) {
+				assert.False(t, result.Changed())
+				assert.Empty(t, result.Password)
+			},
+		},
+		{
+			Name:   "Rotates Legacy Admin Password",
+			Config: bootstrapConfig(""),
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectQuery(countAdminsQuery).
+					WithArgs(models.RoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(findLegacyQuery).
+					WithArgs("admin", models.RoleAdmin, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "password"}).AddRow("1", "admin", models.RoleAdmin, string(legacyHash)))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `users` SET `must_change_password`=\\?,`password`=\\? WHERE id = \\?").
+					WithArgs(true, sqlmock.AnyArg(), "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(regexp.QuoteMeta(config.ReleaseLock)).
+					WithArgs(bootstrapLock).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			Check: func(t *testing.T, result BootstrapResult) {
+				assert.True(t, result.Rotated)
+				assert.Equal(t, "admin", result.Username)
+				assert.Len(t, result.Password, 16)
+			},
+		},
+		{
+			Name:        "Username Taken By Regular User",
+			Config:      bootstrapConfig("Password1234"),
+			ExpectedErr: ErrBootstrapUsernameTaken.Error(),
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectQuery(countAdminsQuery).
+					WithArgs(models.RoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(findAdminQuery).
+					WithArgs("admin", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow("7", models.RoleUser))
+				mock.ExpectExec(regexp.QuoteMeta(config.ReleaseLock)).
+					WithArgs(bootstrapLock).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			Name:   "Reset Recovers Existing Admin",
+			Config: bootstrapConfig("Password1234"),
+			Reset:  true,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectQuery(countAdminsQuery).
+					WithArgs(models.RoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(findAdminQuery).
+					WithArgs("admin", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "role", "disabled"}).AddRow("1", models.RoleAdmin, true))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `users` SET `disabled`=\\?,`must_change_password`=\\?,`password`=\\?,`role`=\\? WHERE id = \\?").
+					WithArgs(false, true, sqlmock.AnyArg(), models.RoleAdmin, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(regexp.QuoteMeta(config.ReleaseLock)).
+					WithArgs(bootstrapLock).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			Check: func(t *testing.T, result BootstrapResult) {
+				assert.True(t, result.Reset)
+				assert.Empty(t, result.Password)
+			},
+		},
+		{
+			Name: "Rounds Lock Timeout Up",
+			Config: func() config.BootstrapConfig {
+				cfg := bootstrapConfig("")
+				cfg.LockTimeout = 500 * time.Millisecond
+				return cfg
+			}(),
+			ExpectedErr: "timed out waiting for lock " + bootstrapLock,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+			},
+		},
+		{
+			Name:        "Lock Timeout",
+			Config:      bootstrapConfig(""),
+			ExpectedErr: "timed out waiting for lock " + bootstrapLock,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(config.GetLock)).
+					WithArgs(bootstrapLock, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+			if gormErr != nil {
+				t.Fatal(gormErr)
+			}
+
+			tt.MockAct(mock)
+
+			result, bootstrapErr := Bootstrap(context.Background(), gormDB, tt.Config, nil, tt.Reset)
+
+			if tt.ExpectedErr != "" {
+				assert.EqualError(t, bootstrapErr, tt.ExpectedErr)
+			} else {
+				assert.NoError(t, bootstrapErr)
+				tt.Check(t, result)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
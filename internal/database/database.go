@@ -1,100 +1,162 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-manage-mysql/cmd/config"
-	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/logging"
+	"log/slog"
+	"strings"
 
-	"github.com/google/uuid"
-	"github.com/gustyaguero21/go-core/pkg/encrypter"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-func InitDatabase() (*gorm.DB, error) {
-	db, err := gorm.Open(mysql.Open(config.GetDsn()), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error opening database. Error: %w", err)
-	}
-
-	if check := checkExistsDB(db, config.GetDBName()); check != nil {
-		fmt.Println("DATABASE NOT FOUND. CREATING....")
-		if createErr := createDatabase(db, config.GetDBName()); createErr != nil {
-			return nil, createErr
-		}
+// mysql errors
+const (
+	unknownDatabase = 1049
+	dbAccessDenied  = 1044
+	commandDenied   = 1142
+	specialDenied   = 1227
+)
 
-		db, err = gorm.Open(mysql.Open(config.GetDBDsn()), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Silent),
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error reconnecting to database. Error: %w", err)
-		}
+var (
+	ErrDatabaseMissing = errors.New("database does not exist and database.auto_create is disabled")
+	ErrCreatePrivilege = errors.New("database user lacks the CREATE privilege; create the database manually, grant CREATE or set database.auto_create=false")
+	ErrAccessDenied    = errors.New("database user has no privileges on the configured database")
+)
 
-		if err := db.AutoMigrate(models.User{}); err != nil {
-			return nil, fmt.Errorf("error migrating user. Error: %w", err)
-		}
-		if err := defaultAdminUser(db); err != nil {
-			return nil, err
-		}
+// InitDatabase connects to the configured schema, creating it when missing,
+// and applies pending migrations.
+func InitDatabase(ctx context.Context) (*gorm.DB, error) {
+	cfg := config.Current().Database
 
-	} else {
-		fmt.Println("DATABASE FOUND. CONNECTING....")
-		db, err = gorm.Open(mysql.Open(config.GetDBDsn()), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Silent),
-		})
-		if err := db.AutoMigrate(models.User{}); err != nil {
-			return nil, fmt.Errorf("error migrating user. Error: %w", err)
+	db, err := Open(ctx)
+	if isMySQLError(err, unknownDatabase) {
+		if !cfg.AutoCreate {
+			return nil, fmt.Errorf("%w: %s", ErrDatabaseMissing, cfg.Name)
 		}
-		if err != nil {
-			return nil, fmt.Errorf("error opening database. Error: %w", err)
+		slog.InfoContext(ctx, "database not found, creating", "database", config.GetDBName())
+		if createErr := createDatabase(ctx, cfg); createErr != nil {
+			return nil, createErr
 		}
+		db, err = Open(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	if err := Migrate(db.WithContext(ctx)); err != nil {
+		Close(db)
+		return nil, err
 	}
 
 	return db, nil
 }
 
-func checkExistsDB(db *gorm.DB, dbName string) error {
-	var exists string
-	err := db.Raw(config.ExistsDB, dbName).Scan(&exists).Error
+// Open connects to the configured schema without creating or migrating it,
+// retrying while the server is unreachable. The pool is sized from config.
+func Open(ctx context.Context) (*gorm.DB, error) {
+	cfg := config.Current().Database
+
+	db, err := connect(ctx, cfg, func() (*gorm.DB, error) {
+		return gorm.Open(mysql.Open(cfg.DSN()), gormConfig())
+	})
+	if isMySQLError(err, dbAccessDenied) {
+		return nil, fmt.Errorf("%w (user %q, database %q). Error: %v", ErrAccessDenied, cfg.User, cfg.Name, err)
+	}
 	if err != nil {
-		return fmt.Errorf("error checking database existence: %w", err)
+		return nil, fmt.Errorf("error opening database. Error: %w", err)
 	}
 
-	if exists == "" {
-		return fmt.Errorf("database not found")
+	if err := configure(db, cfg); err != nil {
+		Close(db)
+		return nil, err
 	}
 
-	return nil
+	slog.InfoContext(ctx, "connected to database", "database", cfg.Name, "host", cfg.Host)
+	return db, nil
 }
-func createDatabase(db *gorm.DB, dbName string) error {
-	query := fmt.Sprintf(config.CreateDB, dbName)
 
-	if err := db.Exec(query).Error; err != nil {
-		return fmt.Errorf("error creating database %s: %w", dbName, err)
+func configure(db *gorm.DB, cfg config.DatabaseConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("error getting database pool: %w", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	fmt.Println("DATABASE CREATED SUCCESSFULLY")
-	return nil
+	return db.Use(RetryPlugin{Retries: cfg.QueryRetries, Backoff: cfg.RetryBackoff, MaxBackoff: cfg.RetryMaxBackoff})
 }
 
-func defaultAdminUser(db *gorm.DB) error {
+func gormConfig() *gorm.Config {
+	return &gorm.Config{
+		Logger: logging.NewGormLogger(slog.Default(), config.Current().Log.SlowQueryThreshold),
+	}
+}
 
-	hash, hashErr := encrypter.PasswordEncrypter("DefaultPassword")
-	if hashErr != nil {
-		return hashErr
+func isMySQLError(err error, numbers ...uint16) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
 	}
+	for _, number := range numbers {
+		if mysqlErr.Number == number {
+			return true
+		}
+	}
+	return false
+}
 
-	result := db.Create(models.User{
-		ID:       uuid.NewString(),
-		Username: "admin",
-		Password: string(hash),
+// createDatabase uses a short lived server level connection.
+func createDatabase(ctx context.Context, cfg config.DatabaseConfig) error {
+	server, err := connect(ctx, cfg, func() (*gorm.DB, error) {
+		return gorm.Open(mysql.Open(cfg.ServerDSN()), gormConfig())
 	})
-	if result.Error != nil {
-		return result.Error
+	if err != nil {
+		return fmt.Errorf("error connecting to database server. Error: %w", err)
+	}
+	defer Close(server)
+
+	return createSchema(ctx, server, cfg)
+}
+
+func createSchema(ctx context.Context, server *gorm.DB, cfg config.DatabaseConfig) error {
+	if !config.ValidIdentifier(cfg.Name) {
+		return fmt.Errorf("invalid database name %q", cfg.Name)
 	}
+
+	if err := server.WithContext(ctx).Exec(createDatabaseQuery(server, cfg)).Error; err != nil {
+		if isMySQLError(err, dbAccessDenied, commandDenied, specialDenied) {
+			return fmt.Errorf("%w (user %q, database %q). Error: %v", ErrCreatePrivilege, cfg.User, cfg.Name, err)
+		}
+		return fmt.Errorf("error creating database %s: %w", cfg.Name, err)
+	}
+
+	slog.InfoContext(ctx, "database created", "database", cfg.Name)
 	return nil
 }
+
+// createDatabaseQuery quotes the schema name with the dialect of db. Charset
+// and collation are validated as plain words by the configuration.
+func createDatabaseQuery(db *gorm.DB, cfg config.DatabaseConfig) string {
+	var name strings.Builder
+	db.Dialector.QuoteTo(&name, cfg.Name)
+	return fmt.Sprintf(config.CreateDB, name.String(), cfg.Charset, cfg.Collation)
+}
+
+// Close releases the connection pool behind db.
+func Close(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("error getting database pool: %w", err)
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestCreateSchema(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Database    string
+		ExpectedErr error
+		ErrContains string
+		MockAct     func(mock sqlmock.Sqlmock)
+	}{
+		{
+			Name:     "Quotes Name With Dash",
+			Database: "go-manage",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("CREATE DATABASE IF NOT EXISTS `go-manage` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			Name:        "Rejects Injection",
+			Database:    "users; DROP DATABASE mysql",
+			ErrContains: "invalid database name",
+			MockAct:     func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			Name:        "Missing Privilege",
+			Database:    "users",
+			ExpectedErr: ErrCreatePrivilege,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("CREATE DATABASE").
+					WillReturnError(&mysqldriver.MySQLError{Number: 1044, Message: "Access denied for user 'app'@'%' to database 'users'"})
+			},
+		},
+		{
+			Name:        "Other Error",
+			Database:    "users",
+			ErrContains: "error creating database users",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("CREATE DATABASE").
+					WillReturnError(config.ErrDbError)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+
+			gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+			if gormErr != nil {
+				t.Fatal(gormErr)
+			}
+
+			tt.MockAct(mock)
+
+			createErr := createSchema(context.Background(), gormDB, config.DatabaseConfig{
+				User:      "app",
+				Name:      tt.Database,
+				Charset:   "utf8mb4",
+				Collation: "utf8mb4_unicode_ci",
+			})
+
+			switch {
+			case tt.ExpectedErr != nil:
+				assert.ErrorIs(t, createErr, tt.ExpectedErr)
+			case tt.ErrContains != "":
+				assert.ErrorContains(t, createErr, tt.ErrContains)
+			default:
+				assert.NoError(t, createErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// the first releases seeded this admin, with this password, on every install
+const (
+	legacyAdminUsername = "admin"
+	legacyAdminPassword = "DefaultPassword"
+)
+
+// isLegacyAdmin reports whether a user is the seeded admin still holding the
+// well known password.
+func isLegacyAdmin(username, hash string) bool {
+	return username == legacyAdminUsername && bcrypt.CompareHashAndPassword([]byte(hash), []byte(legacyAdminPassword)) == nil
+}
+
+// migrations are applied in order and never edited once released. They work
+// on the snapshots of schema.go, never on the models.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create users table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&usersV1{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "grant admin role to the default admin user",
+		Up: func(tx *gorm.DB) error {
+			// only the row seeded by the first releases, a user who signed up
+			// as admin since is left alone
+			var seeded []usersV1
+			if err := tx.Where("username = ?", legacyAdminUsername).Find(&seeded).Error; err != nil {
+				return err
+			}
+			for _, user := range seeded {
+				if !isLegacyAdmin(user.Username, user.Password) {
+					continue
+				}
+				if err := tx.Model(&usersV1{}).Where("id = ?", user.ID).Update("role", "admin").Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add disabled flag to users",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&usersV3{}, "Disabled") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&usersV3{}, "Disabled")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add forced password change flag to users",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&usersV4{}, "MustChangePassword") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&usersV4{}, "MustChangePassword")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create jobs table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&jobsV5{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create oauth clients, codes and tokens tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&oauthClientsV6{}, &oauthCodesV6{}, &oauthTokensV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create federated identities table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&federatedIdentitiesV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create api keys table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&apiKeysV8{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create sessions table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&sessionsV9{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create data keys table and widen personal data for encryption",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&dataKeysV10{}, &usersV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create erasure requests table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&erasureRequestsV11{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add index key check to data keys",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&dataKeysV12{}, "IndexCheck") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&dataKeysV12{}, "IndexCheck")
+		},
+	},
+}
+
+// LatestSchemaVersion is the version the code expects the database to be at.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate applies every pending migration. Instances starting together take
+// turns through the bootstrap lock, and each migration is recorded in the
+// transaction applying it. MySQL commits schema changes at once, so every
+// migration must also be safe to run again after a failure.
+func Migrate(db *gorm.DB) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		if err := acquireLock(conn, bootstrapLock, config.Current().Bootstrap.LockTimeout); err != nil {
+			return err
+		}
+		defer releaseLock(conn, bootstrapLock)
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("error creating schema migrations table. Error: %w", err)
+		}
+
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return fmt.Errorf("error applying migration %d (%s). Error: %w", m.Version, m.Name, err)
+				}
+				record := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+				if err := tx.Create(&record).Error; err != nil {
+					return fmt.Errorf("error recording migration %d. Error: %w", m.Version, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SchemaVersion returns the highest applied migration version.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	if err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("error reading schema version. Error: %w", err)
+	}
+	return version, nil
+}
+
+func appliedVersions(db *gorm.DB) (map[int]bool, error) {
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("error reading applied migrations. Error: %w", err)
+	}
+	applied := map[int]bool{}
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+// MigrationsCheck fails while the schema is behind the code.
+func MigrationsCheck(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		version, err := SchemaVersion(db.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if version < LatestSchemaVersion() {
+			return fmt.Errorf("schema at version %d, expected %d", version, LatestSchemaVersion())
+		}
+		return nil
+	}
+}
+
+// PingCheck verifies the database answers.
+func PingCheck(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
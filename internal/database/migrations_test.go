@@ -0,0 +1,102 @@
+package database
+
+import (
+	"go-manage-mysql/internal/models"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// columns maps every column of v to its gorm settings, serializers aside
+// since they do not change the schema.
+func columns(t *testing.T, v interface{}) (string, map[string]map[string]string) {
+	parsed, err := schema.Parse(v, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]map[string]string{}
+	for _, field := range parsed.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		settings := map[string]string{}
+		for key, value := range field.TagSettings {
+			if key != "SERIALIZER" {
+				settings[key] = value
+			}
+		}
+		out[field.DBName] = settings
+	}
+	return parsed.Table, out
+}
+
+func TestSnapshotsMatchModels(t *testing.T) {
+	// the latest snapshot of every table
+	latest := []struct {
+		Snapshot interface{}
+		Model    interface{}
+	}{
+		{usersV10{}, models.User{}},
+		{jobsV5{}, models.Job{}},
+		{oauthClientsV6{}, models.OAuthClient{}},
+		{oauthCodesV6{}, models.OAuthCode{}},
+		{oauthTokensV6{}, models.OAuthToken{}},
+		{federatedIdentitiesV7{}, models.FederatedIdentity{}},
+		{apiKeysV8{}, models.APIKey{}},
+		{sessionsV9{}, models.Session{}},
+		{dataKeysV12{}, models.DataKey{}},
+		{erasureRequestsV11{}, models.ErasureRequest{}},
+	}
+
+	for _, tt := range latest {
+		snapshotTable, snapshot := columns(t, tt.Snapshot)
+		modelTable, model := columns(t, tt.Model)
+		assert.Equal(t, modelTable, snapshotTable)
+		assert.Equal(t, model, snapshot, "%s changed without a migration", modelTable)
+	}
+}
+
+func TestPromoteLegacyAdmin(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte(legacyAdminPassword), bcrypt.MinCost)
+	chosen, _ := bcrypt.GenerateFromPassword([]byte("Password1234"), bcrypt.MinCost)
+
+	tests := []struct {
+		Name     string
+		Hash     []byte
+		Promoted bool
+	}{
+		{Name: "Seeded Admin", Hash: legacy, Promoted: true},
+		{Name: "User Named Admin", Hash: chosen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			gormDB, _ := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+
+			mock.ExpectQuery("SELECT \\* FROM `users` WHERE username = \\?").
+				WithArgs("admin").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow("1", "admin", string(tt.Hash)))
+			if tt.Promoted {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `users` SET `role`=\\? WHERE id = \\?").
+					WithArgs("admin", "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			assert.NoError(t, migrations[1].Up(gormDB))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
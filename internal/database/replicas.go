@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// routing targets
+const (
+	targetPrimary = "primary"
+	targetReplica = "replica"
+)
+
+// routing reasons
+const (
+	reasonWrite    = "write"
+	reasonRead     = "read"
+	reasonSticky   = "sticky"
+	reasonFallback = "no_healthy_replica"
+)
+
+// Cluster sends writes to the primary and spreads reads over the healthy
+// replicas. Reads of a user written a moment ago stay on the primary so
+// replication lag never hides a write from whoever made it.
+type Cluster struct {
+	primary  *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64
+
+	stickiness time.Duration
+	interval   time.Duration
+	mu         sync.Mutex
+	sticky     map[string]time.Time
+	now        func() time.Time
+
+	// Actor names who is making the request, its writes are sticky too.
+	Actor func(ctx context.Context) string
+}
+
+type replica struct {
+	addr    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// NewCluster routes over primary and the given replicas. Replicas start
+// unhealthy until Check reaches them.
+func NewCluster(primary *gorm.DB, replicas map[string]*gorm.DB, cfg config.DatabaseConfig) *Cluster {
+	c := &Cluster{
+		primary:    primary,
+		stickiness: cfg.ReplicaStickiness,
+		interval:   cfg.ReplicaCheckInterval,
+		sticky:     map[string]time.Time{},
+		now:        time.Now,
+	}
+	for _, addr := range cfg.Replicas {
+		db, ok := replicas[addr]
+		if !ok {
+			continue
+		}
+		r := &replica{addr: addr, db: db}
+		c.replicas = append(c.replicas, r)
+		metrics.DBReplicaUp.WithLabelValues(addr).Set(0)
+		// a read failing on a dropped connection takes the replica out
+		// right away instead of waiting for the next check
+		_ = db.Callback().Query().After("gorm:query").Register("replicas:health", func(tx *gorm.DB) {
+			if IsTransient(tx.Error) {
+				c.markDown(r, tx.Error)
+			}
+		})
+	}
+	return c
+}
+
+// OpenCluster connects to the configured replicas. A replica that is down is
+// not an error, it just gets no reads until it comes back.
+func OpenCluster(ctx context.Context, primary *gorm.DB) (*Cluster, error) {
+	cfg := config.Current().Database
+
+	replicas := map[string]*gorm.DB{}
+	for _, addr := range cfg.Replicas {
+		// no version query and no ping, both need the replica to be up
+		db, err := gorm.Open(mysql.New(mysql.Config{DSN: cfg.ReplicaDSN(addr), SkipInitializeWithVersion: true}), replicaGormConfig())
+		if err == nil {
+			err = configure(db, cfg)
+		}
+		if err != nil {
+			for _, opened := range replicas {
+				Close(opened)
+			}
+			return nil, fmt.Errorf("error opening replica %s: %w", addr, err)
+		}
+		replicas[addr] = db
+	}
+
+	c := NewCluster(primary, replicas, cfg)
+	c.Check(ctx)
+	return c, nil
+}
+
+func replicaGormConfig() *gorm.Config {
+	cfg := gormConfig()
+	cfg.DisableAutomaticPing = true
+	return cfg
+}
+
+// Primary is the connection every write goes to.
+func (c *Cluster) Primary() *gorm.DB {
+	return c.primary
+}
+
+// Replicas returns every replica connection by address, healthy or not.
+func (c *Cluster) Replicas() map[string]*gorm.DB {
+	replicas := make(map[string]*gorm.DB, len(c.replicas))
+	for _, r := range c.replicas {
+		replicas[r.addr] = r.db
+	}
+	return replicas
+}
+
+// Reader picks the connection for a read about the given users.
+func (c *Cluster) Reader(ctx context.Context, users ...string) *gorm.DB {
+	if len(c.replicas) == 0 {
+		return c.route(ctx, c.primary, targetPrimary, reasonRead)
+	}
+	if c.isSticky(append(users, c.actor(ctx))...) {
+		return c.route(ctx, c.primary, targetPrimary, reasonSticky)
+	}
+
+	start := c.next.Add(1)
+	for i := range c.replicas {
+		r := c.replicas[(start+uint64(i))%uint64(len(c.replicas))]
+		if r.healthy.Load() {
+			return c.route(ctx, r.db, targetReplica, reasonRead)
+		}
+	}
+	return c.route(ctx, c.primary, targetPrimary, reasonFallback)
+}
+
+// Writer returns the primary and keeps reads about the given users, and about
+// the caller, on it for the stickiness window.
+func (c *Cluster) Writer(ctx context.Context, users ...string) *gorm.DB {
+	if len(c.replicas) > 0 && c.stickiness > 0 {
+		until := c.now().Add(c.stickiness)
+		c.mu.Lock()
+		for _, user := range append(users, c.actor(ctx)) {
+			if user != "" {
+				c.sticky[user] = until
+			}
+		}
+		c.mu.Unlock()
+	}
+	return c.route(ctx, c.primary, targetPrimary, reasonWrite)
+}
+
+func (c *Cluster) route(ctx context.Context, db *gorm.DB, target, reason string) *gorm.DB {
+	metrics.DBRouting.WithLabelValues(target, reason).Inc()
+	return db.WithContext(ctx)
+}
+
+func (c *Cluster) actor(ctx context.Context) string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor(ctx)
+}
+
+func (c *Cluster) isSticky(users ...string) bool {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, user := range users {
+		if until, ok := c.sticky[user]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets stickiness that already expired.
+func (c *Cluster) prune() {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for user, until := range c.sticky {
+		if !now.Before(until) {
+			delete(c.sticky, user)
+		}
+	}
+}
+
+// Check pings every replica and updates its health.
+func (c *Cluster) Check(ctx context.Context) {
+	for _, r := range c.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, c.interval)
+		err := PingCheck(r.db)(pingCtx)
+		cancel()
+		if err != nil {
+			c.markDown(r, err)
+			continue
+		}
+		if !r.healthy.Swap(true) {
+			slog.InfoContext(ctx, "replica is healthy", "replica", r.addr)
+		}
+		metrics.DBReplicaUp.WithLabelValues(r.addr).Set(1)
+	}
+}
+
+func (c *Cluster) markDown(r *replica, err error) {
+	if r.healthy.Swap(false) {
+		slog.Warn("replica is unhealthy, reads fall back", "replica", r.addr, "error", err)
+	}
+	metrics.DBReplicaUp.WithLabelValues(r.addr).Set(0)
+}
+
+// Watch checks the replicas until ctx is cancelled.
+func (c *Cluster) Watch(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+			c.prune()
+		}
+	}
+}
+
+// Close releases the primary and every replica.
+func (c *Cluster) Close() error {
+	errs := []error{Close(c.primary)}
+	for _, r := range c.replicas {
+		errs = append(errs, Close(r.db))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type actorKey struct{}
+
+func mockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func newTestCluster(t *testing.T, replicas ...string) (*Cluster, map[string]sqlmock.Sqlmock) {
+	primary, _ := mockDB(t)
+	dbs := map[string]*gorm.DB{}
+	mocks := map[string]sqlmock.Sqlmock{}
+	for _, addr := range replicas {
+		dbs[addr], mocks[addr] = mockDB(t)
+	}
+
+	c := NewCluster(primary, dbs, config.DatabaseConfig{
+		Replicas:             replicas,
+		ReplicaStickiness:    5 * time.Second,
+		ReplicaCheckInterval: time.Second,
+	})
+	c.Actor = func(ctx context.Context) string {
+		actor, _ := ctx.Value(actorKey{}).(string)
+		return actor
+	}
+	return c, mocks
+}
+
+func healthy(c *Cluster, mocks map[string]sqlmock.Sqlmock) {
+	for _, mock := range mocks {
+		mock.ExpectPing()
+	}
+	c.Check(context.Background())
+}
+
+func isPrimary(c *Cluster, db *gorm.DB) bool {
+	return db.Statement.ConnPool == c.Primary().Statement.ConnPool
+}
+
+func TestClusterRouting(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("No Replicas", func(t *testing.T) {
+		c, _ := newTestCluster(t)
+		assert.True(t, isPrimary(c, c.Reader(ctx, "johndoe")))
+		assert.True(t, isPrimary(c, c.Writer(ctx, "johndoe")))
+	})
+
+	t.Run("Replicas Start Unhealthy", func(t *testing.T) {
+		c, _ := newTestCluster(t, "replica-1:3306")
+		assert.True(t, isPrimary(c, c.Reader(ctx, "johndoe")))
+	})
+
+	t.Run("Reads Go To Healthy Replicas", func(t *testing.T) {
+		c, mocks := newTestCluster(t, "replica-1:3306", "replica-2:3306")
+		healthy(c, mocks)
+
+		seen := map[gorm.ConnPool]bool{}
+		for range 4 {
+			db := c.Reader(ctx, "johndoe")
+			assert.False(t, isPrimary(c, db))
+			seen[db.Statement.ConnPool] = true
+		}
+		assert.Len(t, seen, 2)
+		assert.True(t, isPrimary(c, c.Writer(ctx, "johndoe")))
+	})
+
+	t.Run("Failed Ping Falls Back", func(t *testing.T) {
+		c, mocks := newTestCluster(t, "replica-1:3306")
+		healthy(c, mocks)
+		assert.False(t, isPrimary(c, c.Reader(ctx)))
+
+		mocks["replica-1:3306"].ExpectPing().WillReturnError(mysqldriver.ErrInvalidConn)
+		c.Check(ctx)
+		assert.True(t, isPrimary(c, c.Reader(ctx)))
+
+		healthy(c, mocks)
+		assert.False(t, isPrimary(c, c.Reader(ctx)))
+	})
+
+	t.Run("Transient Read Error Takes Replica Out", func(t *testing.T) {
+		c, mocks := newTestCluster(t, "replica-1:3306")
+		healthy(c, mocks)
+
+		mocks["replica-1:3306"].ExpectQuery(config.SearchTestQuery).WillReturnError(mysqldriver.ErrInvalidConn)
+		var user models.User
+		err := c.Reader(ctx, "johndoe").Where("username=?", "johndoe").First(&user).Error
+		assert.Error(t, err)
+
+		assert.True(t, isPrimary(c, c.Reader(ctx, "johndoe")))
+	})
+}
+
+func TestClusterStickiness(t *testing.T) {
+	c, mocks := newTestCluster(t, "replica-1:3306")
+	healthy(c, mocks)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	admin := context.WithValue(context.Background(), actorKey{}, "admin")
+	c.Writer(admin, "johndoe")
+
+	// the written user and the writer read from the primary
+	assert.True(t, isPrimary(c, c.Reader(context.Background(), "johndoe")))
+	assert.True(t, isPrimary(c, c.Reader(admin, "janedoe")))
+	// everyone else keeps using the replica
+	assert.False(t, isPrimary(c, c.Reader(context.Background(), "janedoe")))
+
+	now = now.Add(5 * time.Second)
+	assert.False(t, isPrimary(c, c.Reader(context.Background(), "johndoe")))
+	assert.False(t, isPrimary(c, c.Reader(admin, "janedoe")))
+
+	c.prune()
+	assert.Empty(t, c.sticky)
+}
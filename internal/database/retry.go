@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// mysql server errors worth another attempt
+var transientCodes = map[uint16]bool{
+	1040: true, // too many connections
+	1053: true, // server shutdown in progress
+	1205: true, // lock wait timeout
+	1213: true, // deadlock
+}
+
+// IsTransient reports whether err is likely to go away on its own: network
+// failures, dropped connections, deadlocks and lock timeouts.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientCodes[mysqlErr.Number]
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// backoff returns the delay before retry number attempt (starting at 0):
+// exponential growth capped at max, with jitter so instances don't retry in
+// lockstep.
+func backoff(attempt int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// connect calls open until it succeeds, fails with a permanent error or the
+// startup timeout expires.
+func connect(ctx context.Context, cfg config.DatabaseConfig, open func() (*gorm.DB, error)) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.StartupTimeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		db, err := open()
+		if err == nil {
+			return db, nil
+		}
+		if db != nil {
+			Close(db)
+		}
+		if !IsTransient(err) {
+			return nil, err
+		}
+
+		delay := backoff(attempt, cfg.RetryBackoff, cfg.RetryMaxBackoff)
+		slog.WarnContext(ctx, "database not reachable, retrying", "attempt", attempt+1, "retry_in", delay, "error", err)
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return nil, fmt.Errorf("database not reachable after %d attempts. Error: %w", attempt+1, err)
+		}
+	}
+}
+
+// RetryPlugin runs reads again when they fail with a transient error. Writes
+// are never retried since they may have been applied, and neither is
+// anything inside a transaction, which the server rolls back as a whole.
+type RetryPlugin struct {
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (RetryPlugin) Name() string {
+	return "retry"
+}
+
+func (p RetryPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Replace("gorm:query", p.retry("query", callbacks.Query)); err != nil {
+		return err
+	}
+	return db.Callback().Row().Replace("gorm:row", p.retry("row", callbacks.RowQuery))
+}
+
+func (p RetryPlugin) retry(operation string, query func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		for attempt := 0; ; attempt++ {
+			query(db)
+
+			if db.Error == nil || attempt >= p.Retries || !IsTransient(db.Error) {
+				return
+			}
+			if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+				return
+			}
+
+			ctx := db.Statement.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			delay := backoff(attempt, p.Backoff, p.MaxBackoff)
+			slog.WarnContext(ctx, "transient query error, retrying", "operation", operation, "attempt", attempt+1, "retry_in", delay, "error", db.Error)
+			if sleep(ctx, delay) != nil {
+				return
+			}
+
+			metrics.DBQueryRetries.WithLabelValues(operation).Inc()
+			db.Error = nil
+			db.RowsAffected = 0
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func retryConfig() config.DatabaseConfig {
+	return config.DatabaseConfig{
+		StartupTimeout:  time.Second,
+		RetryBackoff:    time.Millisecond,
+		RetryMaxBackoff: 4 * time.Millisecond,
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Err      error
+		Expected bool
+	}{
+		{"Nil", nil, false},
+		{"Deadlock", &mysqldriver.MySQLError{Number: 1213}, true},
+		{"Lock Wait Timeout", fmt.Errorf("wrapped: %w", &mysqldriver.MySQLError{Number: 1205}), true},
+		{"Duplicate Key", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"Access Denied", &mysqldriver.MySQLError{Number: 1045}, false},
+		{"Bad Conn", driver.ErrBadConn, true},
+		{"Invalid Conn", mysqldriver.ErrInvalidConn, true},
+		{"Connection Refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"Connection Reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"Record Not Found", gorm.ErrRecordNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, IsTransient(tt.Err))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		delay := backoff(attempt, 100*time.Millisecond, time.Second)
+		assert.GreaterOrEqual(t, delay, expected*time.Millisecond/2)
+		assert.LessOrEqual(t, delay, expected*time.Millisecond)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		Name          string
+		Results       []error
+		ExpectedCalls int
+		ExpectedErr   error
+	}{
+		{"Succeeds After Retries", []error{refused, refused, nil}, 3, nil},
+		{"Permanent Error", []error{&mysqldriver.MySQLError{Number: 1045}}, 1, &mysqldriver.MySQLError{Number: 1045}},
+		{"Gives Up At Deadline", nil, -1, refused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			cfg := retryConfig()
+			if tt.Results == nil {
+				cfg.StartupTimeout = 20 * time.Millisecond
+			}
+
+			calls := 0
+			db, err := connect(context.Background(), cfg, func() (*gorm.DB, error) {
+				calls++
+				if tt.Results == nil {
+					return nil, refused
+				}
+				if result := tt.Results[calls-1]; result != nil {
+					return nil, result
+				}
+				return &gorm.DB{}, nil
+			})
+
+			if tt.ExpectedErr != nil {
+				assert.ErrorIs(t, err, tt.ExpectedErr)
+				assert.Nil(t, db)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, db)
+			}
+			if tt.ExpectedCalls > 0 {
+				assert.Equal(t, tt.ExpectedCalls, calls)
+			} else {
+				assert.Greater(t, calls, 1)
+			}
+		})
+	}
+}
+
+func TestRetryPlugin(t *testing.T) {
+	deadlock := &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found"}
+
+	tests := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func(mock sqlmock.Sqlmock)
+		Act         func(db *gorm.DB) error
+	}{
+		{
+			Name: "Read Retried",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WillReturnError(deadlock)
+				mock.ExpectQuery(config.SearchTestQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "johndoe"))
+			},
+			Act: func(db *gorm.DB) error {
+				var user models.User
+				err := db.Where("username = ?", "johndoe").First(&user).Error
+				if err == nil && user.Username != "johndoe" {
+					return errors.New("user not scanned")
+				}
+				return err
+			},
+		},
+		{
+			Name:        "Retries Exhausted",
+			ExpectedErr: deadlock,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				for i := 0; i < 3; i++ {
+					mock.ExpectQuery(config.SearchTestQuery).WillReturnError(deadlock)
+				}
+			},
+			Act: func(db *gorm.DB) error {
+				var users []models.User
+				return db.Find(&users).Error
+			},
+		},
+		{
+			Name:        "Permanent Error Not Retried",
+			ExpectedErr: config.ErrDbError,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WillReturnError(config.ErrDbError)
+			},
+			Act: func(db *gorm.DB) error {
+				var users []models.User
+				return db.Find(&users).Error
+			},
+		},
+		{
+			Name:        "Write Not Retried",
+			ExpectedErr: deadlock,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteTestQuery).WillReturnError(deadlock)
+				mock.ExpectRollback()
+			},
+			Act: func(db *gorm.DB) error {
+				return db.Where("username = ?", "johndoe").Delete(&models.User{}).Error
+			},
+		},
+		{
+			Name:        "Transaction Not Retried",
+			ExpectedErr: deadlock,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchTestQuery).WillReturnError(deadlock)
+				mock.ExpectRollback()
+			},
+			Act: func(db *gorm.DB) error {
+				return db.Transaction(func(tx *gorm.DB) error {
+					var users []models.User
+					return tx.Find(&users).Error
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+
+			gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+			if gormErr != nil {
+				t.Fatal(gormErr)
+			}
+			assert.NoError(t, gormDB.Use(RetryPlugin{Retries: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+
+			tt.MockAct(mock)
+
+			actErr := tt.Act(gormDB)
+
+			if tt.ExpectedErr != nil {
+				assert.ErrorIs(t, actErr, tt.ExpectedErr)
+			} else {
+				assert.NoError(t, actErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The tables as each migration created or changed them. Migrations use these
+// snapshots instead of the models so that changing a model never changes
+// what a released migration does; a model change needs a new migration and,
+// when it alters a table, a new snapshot.
+
+type usersV1 struct {
+	ID       string `gorm:"primaryKey;type:varchar(36);not null;unique"`
+	Name     string `gorm:"type:varchar(255);not null"`
+	Surname  string `gorm:"type:varchar(255);not null"`
+	Username string `gorm:"type:varchar(255);not null;unique"`
+	Phone    string `gorm:"type:varchar(255);not null;unique"`
+	Email    string `gorm:"type:varchar(255);not null;unique"`
+	Password string `gorm:"type:varchar(255);not null"`
+	Role     string `gorm:"type:varchar(32);not null;default:user"`
+}
+
+func (usersV1) TableName() string { return "users" }
+
+type usersV3 struct {
+	Disabled bool `gorm:"not null;default:false"`
+}
+
+func (usersV3) TableName() string { return "users" }
+
+type usersV4 struct {
+	MustChangePassword bool `gorm:"not null;default:false"`
+}
+
+func (usersV4) TableName() string { return "users" }
+
+type usersV10 struct {
+	ID                 string  `gorm:"primaryKey;type:varchar(36);not null;unique"`
+	Name               string  `gorm:"type:varchar(512);not null"`
+	Surname            string  `gorm:"type:varchar(512);not null"`
+	Username           string  `gorm:"type:varchar(255);not null;unique"`
+	Phone              string  `gorm:"type:varchar(512);not null;unique"`
+	Email              string  `gorm:"type:varchar(512);not null;unique"`
+	Password           string  `gorm:"type:varchar(255);not null"`
+	Role               string  `gorm:"type:varchar(32);not null;default:user"`
+	Disabled           bool    `gorm:"not null;default:false"`
+	MustChangePassword bool    `gorm:"not null;default:false"`
+	EmailIndex         *string `gorm:"type:char(64);unique"`
+	PhoneIndex         *string `gorm:"type:char(64);unique"`
+}
+
+func (usersV10) TableName() string { return "users" }
+
+type jobsV5 struct {
+	ID              string          `gorm:"primaryKey;type:varchar(36);not null"`
+	Type            string          `gorm:"type:varchar(32);not null"`
+	State           string          `gorm:"type:varchar(16);not null;index:idx_jobs_state_created,priority:1"`
+	Params          json.RawMessage `gorm:"type:json;not null"`
+	Total           int             `gorm:"not null;default:0"`
+	Processed       int             `gorm:"not null;default:0"`
+	Progress        int             `gorm:"not null;default:0"`
+	Result          json.RawMessage `gorm:"type:json"`
+	Error           string          `gorm:"type:text"`
+	CreatedBy       string          `gorm:"type:varchar(255);not null"`
+	Cursor          string          `gorm:"type:varchar(255);not null;default:''"`
+	Owner           string          `gorm:"type:varchar(64);not null;default:''"`
+	HeartbeatAt     *time.Time
+	CancelRequested bool      `gorm:"not null;default:false"`
+	CreatedAt       time.Time `gorm:"not null;index:idx_jobs_state_created,priority:2"`
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+}
+
+func (jobsV5) TableName() string { return "jobs" }
+
+type oauthClientsV6 struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36);not null"`
+	Name         string    `gorm:"type:varchar(255);not null"`
+	SecretHash   string    `gorm:"type:varchar(64);not null;default:''"`
+	RedirectURIs []string  `gorm:"type:json;not null;serializer:json"`
+	Public       bool      `gorm:"not null;default:false"`
+	CreatedBy    string    `gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+func (oauthClientsV6) TableName() string { return "oauth_clients" }
+
+type oauthCodesV6 struct {
+	Hash          string    `gorm:"primaryKey;type:varchar(64);not null"`
+	GrantID       string    `gorm:"type:varchar(36);not null"`
+	ClientID      string    `gorm:"type:varchar(36);not null"`
+	UserID        string    `gorm:"type:varchar(36);not null"`
+	RedirectURI   string    `gorm:"type:text;not null"`
+	Scope         string    `gorm:"type:varchar(255);not null"`
+	Nonce         string    `gorm:"type:varchar(255);not null;default:''"`
+	CodeChallenge string    `gorm:"type:varchar(128);not null"`
+	AuthTime      time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+}
+
+func (oauthCodesV6) TableName() string { return "oauth_codes" }
+
+type oauthTokensV6 struct {
+	Hash      string    `gorm:"primaryKey;type:varchar(64);not null"`
+	Kind      string    `gorm:"type:varchar(16);not null"`
+	GrantID   string    `gorm:"type:varchar(36);not null;index"`
+	ClientID  string    `gorm:"type:varchar(36);not null;index"`
+	UserID    string    `gorm:"type:varchar(36);not null"`
+	Scope     string    `gorm:"type:varchar(255);not null"`
+	AuthTime  time.Time `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+}
+
+func (oauthTokensV6) TableName() string { return "oauth_tokens" }
+
+type federatedIdentitiesV7 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Provider    string    `gorm:"type:varchar(64);not null"`
+	UserID      string    `gorm:"type:varchar(36);not null;index"`
+	Email       string    `gorm:"type:varchar(255);not null;default:''"`
+	CreatedAt   time.Time `gorm:"not null"`
+	LastLoginAt time.Time `gorm:"not null"`
+}
+
+func (federatedIdentitiesV7) TableName() string { return "federated_identities" }
+
+type apiKeysV8 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36);not null"`
+	Name       string    `gorm:"type:varchar(255);not null"`
+	Prefix     string    `gorm:"type:varchar(32);not null;uniqueIndex"`
+	SecretHash string    `gorm:"type:varchar(64);not null"`
+	UserID     string    `gorm:"type:varchar(36);not null;index"`
+	Username   string    `gorm:"type:varchar(255);not null;index"`
+	Scopes     []string  `gorm:"type:json;not null;serializer:json"`
+	CreatedBy  string    `gorm:"type:varchar(255);not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (apiKeysV8) TableName() string { return "api_keys" }
+
+type sessionsV9 struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36);not null"`
+	UserID     string    `gorm:"type:varchar(36);not null;index"`
+	Username   string    `gorm:"type:varchar(255);not null;index"`
+	UserAgent  string    `gorm:"type:varchar(255);not null"`
+	IP         string    `gorm:"type:varchar(45);not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	RevokedAt  *time.Time
+}
+
+func (sessionsV9) TableName() string { return "sessions" }
+
+type dataKeysV10 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null"`
+	MasterKeyID string    `gorm:"type:varchar(64);not null"`
+	Wrapped     []byte    `gorm:"type:varbinary(255);not null"`
+	CreatedAt   time.Time `gorm:"not null;index"`
+}
+
+func (dataKeysV10) TableName() string { return "data_keys" }
+
+type erasureRequestsV11 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null"`
+	UserID      string    `gorm:"type:varchar(36);not null;index"`
+	Username    string    `gorm:"type:varchar(255);not null"`
+	RequestedBy string    `gorm:"type:varchar(255);not null"`
+	State       string    `gorm:"type:varchar(16);not null;index:idx_erasures_state_scheduled,priority:1"`
+	RequestedAt time.Time `gorm:"not null"`
+	ScheduledAt time.Time `gorm:"not null;index:idx_erasures_state_scheduled,priority:2"`
+	CancelledAt *time.Time
+	CompletedAt *time.Time
+	Receipt     json.RawMessage `gorm:"type:json"`
+}
+
+func (erasureRequestsV11) TableName() string { return "erasure_requests" }
+
+type dataKeysV12 struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null"`
+	MasterKeyID string    `gorm:"type:varchar(64);not null"`
+	Wrapped     []byte    `gorm:"type:varbinary(255);not null"`
+	IndexCheck  string    `gorm:"type:char(64);not null;default:''"`
+	CreatedAt   time.Time `gorm:"not null;index"`
+}
+
+func (dataKeysV12) TableName() string { return "data_keys" }
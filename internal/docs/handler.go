@@ -0,0 +1,22 @@
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+func SpecHandler(basePath string) gin.HandlerFunc {
+	doc := Spec(basePath)
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, doc)
+	}
+}
+
+func UIHandler(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", uiPage)
+}
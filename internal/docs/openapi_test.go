@@ -0,0 +1,43 @@
+package docs
+
+import (
+	"go-manage-mysql/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(models.UserResponse{})
+
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, "string", schema.Properties["message"].Type)
+	assert.Equal(t, "integer", schema.Properties["status"].Type)
+	assert.Contains(t, schema.Required, "message")
+	assert.NotContains(t, schema.Required, "data")
+}
+
+func TestPasswordWriteOnly(t *testing.T) {
+	schemas := Spec("/api").Components.Schemas
+
+	assert.True(t, schemas["User"].Properties["password"].WriteOnly)
+	assert.True(t, schemas["SCIMUser"].Properties["password"].WriteOnly)
+}
+
+func TestGinPath(t *testing.T) {
+	test := []struct {
+		Name     string
+		Path     string
+		Expected string
+	}{
+		{Name: "Static", Path: "/api/go-manage/login", Expected: "/api/go-manage/login"},
+		{Name: "Param", Path: "/jobs/:id", Expected: "/jobs/{id}"},
+		{Name: "Wildcard", Path: "/files/*path", Expected: "/files/{path}"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, GinPath(tt.Path))
+		})
+	}
+}
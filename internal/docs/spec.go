@@ -0,0 +1,1242 @@
+package docs
+
+import (
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/apikey"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/health"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/privacy"
+	"go-manage-mysql/internal/ratelimit"
+	"go-manage-mysql/internal/scim"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/utils/web"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	SpecPath          = "/openapi.json"
+	UIPath            = "/docs"
+	LivenessPath      = "/healthz"
+	ReadinessPath     = "/readyz"
+	HealthDetailsPath = "/health/details"
+	MetricsPath       = "/metrics"
+
+	bearerAuth = "bearerAuth"
+	scimAuth   = "scimToken"
+	clientAuth = "oauthClient"
+	tokenAuth  = "oauthToken"
+	apiKeyAuth = "apiKey"
+)
+
+// Spec builds the OpenAPI document for every route served by the api.
+func Spec(basePath string) *Document {
+	doc := &Document{
+		OpenAPI: OpenAPIVersion,
+		Info: Info{
+			Title:       "Go Manage MySQL",
+			Description: "User management api with JWT authentication backed by MySQL.",
+			Version:     "1.0.0",
+		},
+		Servers: []Server{{URL: "/"}},
+		Tags: []Tag{
+			{Name: "auth", Description: "Authentication"},
+			{Name: "users", Description: "User management"},
+			{Name: "bulk", Description: "User import and export"},
+			{Name: "jobs", Description: "Asynchronous bulk operations"},
+			{Name: "sessions", Description: "Login sessions of users"},
+			{Name: "apikeys", Description: "Api keys for integrations"},
+			{Name: "privacy", Description: "Export and erasure of personal data"},
+			{Name: "scim", Description: "SCIM 2.0 provisioning for identity providers"},
+			{Name: "oidc", Description: "OpenID Connect provider for other applications"},
+			{Name: "docs", Description: "Api documentation"},
+			{Name: "health", Description: "Liveness and readiness probes"},
+			{Name: "metrics", Description: "Prometheus metrics"},
+		},
+		Paths: map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"User":                  userSchema(),
+				"UserResponse":          SchemaOf(models.UserResponse{}),
+				"Error":                 SchemaOf(web.Error{}),
+				"HealthReport":          SchemaOf(health.Report{}),
+				"ImportReport":          SchemaOf(services.ImportReport{}),
+				"Job":                   jobSchema(),
+				"SCIMUser":              scimUserSchema(),
+				"SCIMListResponse":      SchemaOf(scim.ListResponse{}),
+				"SCIMPatchRequest":      scimPatchSchema(),
+				"SCIMError":             SchemaOf(scim.Error{}),
+				"ServiceProviderConfig": SchemaOf(scim.ServiceProviderConfig{}),
+				"OAuthClient":           SchemaOf(models.OAuthClient{}),
+				"APIKey":                SchemaOf(models.APIKey{}),
+				"ErasureRequest":        SchemaOf(models.ErasureRequest{}),
+				"OAuthError":            oauthErrorSchema(),
+				"UserInfo":              userInfoSchema(),
+				"CreateUserRequest":     userRequest(config.Create_ValidateFields, config.Create_ValidateFields),
+				"UpdateUserRequest":     userRequest(config.Update_ValidateFields, config.Update_ValidateFields),
+				"ChangePasswordRequest": userRequest(config.ChangePwd_ValidateFields, config.ChangePwd_ValidateFields),
+				"LoginRequest":          userRequest([]string{"username", "password"}, []string{"username", "password"}),
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerAuth: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "Token returned by the login endpoint, it stops working when its session ends.",
+				},
+				scimAuth: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "SCIM token of the api (scim.token), user JWTs are not accepted.",
+				},
+				clientAuth: {
+					Type:        "http",
+					Scheme:      "basic",
+					Description: "Client id and secret of a registered client, also accepted as client_id and client_secret form fields.",
+				},
+				tokenAuth: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Access token issued by the token endpoint.",
+				},
+				apiKeyAuth: {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        apikey.Header,
+					Description: "Api key acting as its owner, limited to the routes its scopes allow.",
+				},
+			},
+		},
+	}
+
+	userOperations(doc, basePath)
+	federationOperations(doc, basePath)
+	sessionOperations(doc, basePath)
+	apiKeyOperations(doc, basePath)
+	privacyOperations(doc, basePath)
+	bulkOperations(doc, basePath)
+	jobOperations(doc, basePath)
+	scimOperations(doc, basePath+scim.Prefix)
+	oidcOperations(doc, basePath)
+	healthOperations(doc)
+	metricsOperations(doc)
+	docsOperations(doc)
+
+	return doc
+}
+
+func userOperations(doc *Document, basePath string) {
+	usernameQuery := Parameter{
+		Name:        "username",
+		In:          "query",
+		Description: "Username of the target user.",
+		Required:    true,
+		Schema:      &Schema{Type: "string"},
+	}
+
+	doc.add(http.MethodPost, basePath+"/login", limited(&Operation{
+		OperationID: "loginUser",
+		Summary:     "Authenticate a user and issue a JWT",
+		Description: "Every login starts a session the token is bound to. Users holding a one-time password get a token that only allows changing the password.",
+		Tags:        []string{"auth"},
+		RequestBody: jsonBody(ref("LoginRequest")),
+		Responses: responses(
+			ok(http.StatusOK, "Token issued", envelope(&Schema{Type: "string", Description: "Signed JWT."})),
+			failure(http.StatusBadRequest, "Invalid body or missing fields"),
+			failure(http.StatusUnauthorized, "Invalid credentials"),
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusInternalServerError, "Token could not be generated"),
+		),
+	}))
+
+	doc.add(http.MethodPost, basePath+"/create", limited(&Operation{
+		OperationID: "createUser",
+		Summary:     "Register a new user",
+		Tags:        []string{"users"},
+		RequestBody: jsonBody(ref("CreateUserRequest")),
+		Responses: responses(
+			ok(http.StatusCreated, "User created", envelope(ref("User"))),
+			failure(http.StatusBadRequest, "Invalid body or validation error"),
+			failure(http.StatusConflict, "Username, email or phone already taken"),
+			failure(http.StatusInternalServerError, "User could not be created"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/search", scoped(apikey.ScopeUsersRead, active(&Operation{
+		OperationID: "searchUser",
+		Summary:     "Find a user by username",
+		Tags:        []string{"users"},
+		Parameters:  []Parameter{usernameQuery},
+		Responses: responses(
+			ok(http.StatusOK, "User found", envelope(ref("User"))),
+			failure(http.StatusBadRequest, "Missing username"),
+			failure(http.StatusInternalServerError, "User could not be found"),
+		),
+	})))
+
+	doc.add(http.MethodPatch, basePath+"/update", scoped(apikey.ScopeUsersWrite, active(&Operation{
+		OperationID: "updateUser",
+		Summary:     "Update the profile of a user",
+		Tags:        []string{"users"},
+		Parameters:  []Parameter{usernameQuery},
+		RequestBody: jsonBody(ref("UpdateUserRequest")),
+		Responses: responses(
+			ok(http.StatusOK, "User updated", envelope(nil)),
+			failure(http.StatusBadRequest, "Missing username, invalid body or validation error"),
+			failure(http.StatusConflict, "Email or phone already taken"),
+			failure(http.StatusInternalServerError, "User could not be updated"),
+		),
+	})))
+
+	doc.add(http.MethodDelete, basePath+"/delete", scoped(apikey.ScopeUsersWrite, active(&Operation{
+		OperationID: "deleteUser",
+		Summary:     "Delete a user",
+		Tags:        []string{"users"},
+		Parameters:  []Parameter{usernameQuery},
+		Responses: responses(
+			ok(http.StatusOK, "User deleted", envelope(nil)),
+			failure(http.StatusBadRequest, "Missing username"),
+			failure(http.StatusInternalServerError, "User could not be deleted"),
+		),
+	})))
+
+	doc.add(http.MethodPatch, basePath+"/change-password", protected(&Operation{
+		OperationID: "changePassword",
+		Summary:     "Change the password of a user",
+		Description: "Tokens issued for a one-time password can only change their own password.",
+		Tags:        []string{"users"},
+		RequestBody: jsonBody(ref("ChangePasswordRequest")),
+		Responses: responses(
+			ok(http.StatusOK, "Password changed", envelope(nil)),
+			failure(http.StatusBadRequest, "Invalid body or validation error"),
+			failure(http.StatusForbidden, "One-time password token used for another user, or api key used"),
+			failure(http.StatusInternalServerError, "Password could not be changed"),
+		),
+	}))
+}
+
+func federationOperations(doc *Document, basePath string) {
+	provider := Parameter{Name: "provider", In: "path", Required: true, Description: "Name of the provider in the providers file.", Schema: &Schema{Type: "string"}}
+	disabled := failure(http.StatusNotFound, "Federated login not enabled or unknown provider")
+
+	doc.add(http.MethodGet, basePath+"/login/providers", &Operation{
+		OperationID: "listIdentityProviders",
+		Summary:     "Identity providers users can log in with",
+		Tags:        []string{"auth"},
+		Responses: responses(
+			ok(http.StatusOK, "Provider names", envelope(&Schema{Type: "array", Items: &Schema{Type: "string"}})),
+			failure(http.StatusNotFound, "Federated login not enabled"),
+		),
+	})
+
+	doc.add(http.MethodGet, basePath+"/login/{provider}", &Operation{
+		OperationID: "beginFederatedLogin",
+		Summary:     "Send the user to an identity provider",
+		Description: "The state of the login is kept in a cookie scoped to the callback.",
+		Tags:        []string{"auth"},
+		Parameters:  []Parameter{provider},
+		Responses: responses(
+			statusResponse{status: http.StatusFound, response: &Response{Description: "Redirect to the provider"}},
+			disabled,
+			failure(http.StatusBadGateway, "Provider could not be reached"),
+		),
+	})
+
+	doc.add(http.MethodGet, basePath+"/login/{provider}/callback", &Operation{
+		OperationID: "completeFederatedLogin",
+		Summary:     "Finish a login at an identity provider and issue a JWT",
+		Description: "Identities are linked by issuer and subject. Unknown identities are linked by verified email or provisioned as the provider allows.",
+		Tags:        []string{"auth"},
+		Parameters: []Parameter{
+			provider,
+			{Name: "code", In: "query", Schema: &Schema{Type: "string"}},
+			{Name: "state", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+			{Name: "error", In: "query", Schema: &Schema{Type: "string"}},
+		},
+		Responses: responses(
+			ok(http.StatusOK, "Token issued", envelope(&Schema{Type: "string", Description: "Signed JWT."})),
+			failure(http.StatusUnauthorized, "Login state, answer or id token rejected"),
+			failure(http.StatusForbidden, "Identity not linked and not allowed to sign up, or user disabled"),
+			disabled,
+			failure(http.StatusConflict, "Username, email or phone of the new user already taken"),
+			failure(http.StatusInternalServerError, "Login could not be completed"),
+			failure(http.StatusBadGateway, "Provider could not be reached"),
+		),
+	})
+}
+
+func sessionOperations(doc *Document, basePath string) {
+	session := SchemaOf(models.Session{})
+	session.Properties["current"] = &Schema{Type: "boolean", Description: "The session the request comes from."}
+	session.Required = append(session.Required, "current")
+	sessions := envelope(&Schema{Type: "array", Items: session})
+	id := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	keyOnly := "Api keys cannot call it."
+
+	doc.add(http.MethodGet, basePath+"/me/sessions", active(&Operation{
+		OperationID: "listOwnSessions",
+		Summary:     "Active sessions of the caller",
+		Description: keyOnly,
+		Tags:        []string{"sessions"},
+		Responses: responses(
+			ok(http.StatusOK, "Sessions found", sessions),
+			failure(http.StatusInternalServerError, "Sessions could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/me/sessions", active(&Operation{
+		OperationID: "endOtherSessions",
+		Summary:     "Sign the caller out everywhere else",
+		Description: "Ends every session of the caller but the one the request comes from. " + keyOnly,
+		Tags:        []string{"sessions"},
+		Responses: responses(
+			ok(http.StatusOK, "Other sessions ended", envelope(&Schema{Type: "object", Properties: map[string]*Schema{
+				"ended": {Type: "integer", Description: "Number of sessions ended."},
+			}, Required: []string{"ended"}})),
+			failure(http.StatusInternalServerError, "Sessions could not be ended"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/me/sessions/{id}", active(&Operation{
+		OperationID: "endOwnSession",
+		Summary:     "End a session of the caller",
+		Description: "Its tokens stop working at once, ending the current session logs the caller out. " + keyOnly,
+		Tags:        []string{"sessions"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Session ended", envelope(nil)),
+			failure(http.StatusNotFound, "No active session of the caller with this id"),
+			failure(http.StatusInternalServerError, "Session could not be ended"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/admin/sessions", admin(&Operation{
+		OperationID: "listSessions",
+		Summary:     "Active sessions of every user",
+		Description: keyOnly,
+		Tags:        []string{"sessions"},
+		Parameters:  []Parameter{{Name: "username", In: "query", Description: "Only the sessions of this user.", Schema: &Schema{Type: "string"}}},
+		Responses: responses(
+			ok(http.StatusOK, "Sessions found", sessions),
+			failure(http.StatusInternalServerError, "Sessions could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/admin/sessions/{id}", admin(&Operation{
+		OperationID: "endSession",
+		Summary:     "End any session",
+		Description: keyOnly,
+		Tags:        []string{"sessions"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Session ended", envelope(nil)),
+			failure(http.StatusNotFound, "No active session with this id"),
+			failure(http.StatusInternalServerError, "Session could not be ended"),
+		),
+	}))
+}
+
+func privacyOperations(doc *Document, basePath string) {
+	erasure := envelope(ref("ErasureRequest"))
+	id := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	keyOnly := "Api keys cannot call it."
+	files := "profile.json, sessions.json, api_keys.json, identities.json, consents.json and audit.json"
+
+	doc.add(http.MethodGet, basePath+"/me/export", active(&Operation{
+		OperationID: "exportOwnData",
+		Summary:     "Download the data kept about the caller",
+		Description: "A zip archive with " + files + ". Password hashes and secrets are left out. " + keyOnly,
+		Tags:        []string{"privacy"},
+		Responses: responses(
+			statusResponse{status: http.StatusOK, response: &Response{
+				Description: "Archive of the caller's data",
+				Content: map[string]MediaType{
+					privacy.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+				},
+			}},
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusInternalServerError, "Data could not be exported"),
+		),
+	}))
+
+	doc.add(http.MethodPost, basePath+"/me/erasure", active(&Operation{
+		OperationID: "requestOwnErasure",
+		Summary:     "Ask for the caller's data to be erased",
+		Description: "The erasure is carried out once privacy.erasure_grace_period is over and can be cancelled until then. " + keyOnly,
+		Tags:        []string{"privacy"},
+		Responses: responses(
+			ok(http.StatusAccepted, "Erasure scheduled", erasure),
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusConflict, "An erasure is already pending, or the caller is the last admin"),
+			failure(http.StatusInternalServerError, "Erasure could not be requested"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/me/erasure", active(&Operation{
+		OperationID: "findOwnErasure",
+		Summary:     "Pending erasure of the caller",
+		Description: keyOnly,
+		Tags:        []string{"privacy"},
+		Responses: responses(
+			ok(http.StatusOK, "Erasure found", erasure),
+			failure(http.StatusNotFound, "No erasure of the caller is pending"),
+			failure(http.StatusInternalServerError, "Erasure could not be read"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/me/erasure", active(&Operation{
+		OperationID: "cancelOwnErasure",
+		Summary:     "Cancel the pending erasure of the caller",
+		Description: keyOnly,
+		Tags:        []string{"privacy"},
+		Responses: responses(
+			ok(http.StatusOK, "Erasure cancelled", envelope(nil)),
+			failure(http.StatusNotFound, "No erasure of the caller is pending"),
+			failure(http.StatusInternalServerError, "Erasure could not be cancelled"),
+		),
+	}))
+
+	doc.add(http.MethodPost, basePath+"/admin/erasures", admin(&Operation{
+		OperationID: "requestErasure",
+		Summary:     "Erase the data of any user",
+		Description: "Without immediate the erasure waits for the grace period like the user's own requests. " + keyOnly,
+		Tags:        []string{"privacy"},
+		RequestBody: jsonBody(&Schema{Type: "object", Properties: map[string]*Schema{
+			"username":  {Type: "string"},
+			"immediate": {Type: "boolean", Description: "Erase right away, skipping the grace period."},
+		}, Required: []string{"username"}}),
+		Responses: responses(
+			ok(http.StatusOK, "User erased, the request holds the receipt", erasure),
+			ok(http.StatusAccepted, "Erasure scheduled", erasure),
+			failure(http.StatusBadRequest, "Invalid body"),
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusConflict, "An erasure of the user is already pending, or the user is the last admin"),
+			failure(http.StatusInternalServerError, "Erasure could not be requested or carried out"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/admin/erasures", admin(&Operation{
+		OperationID: "listErasures",
+		Summary:     "Erasure requests, the newest first",
+		Description: keyOnly,
+		Tags:        []string{"privacy"},
+		Parameters:  []Parameter{{Name: "state", In: "query", Description: "Only the requests in this state.", Schema: &Schema{Type: "string", Enum: privacy.States}}},
+		Responses: responses(
+			ok(http.StatusOK, "Erasures found", envelope(&Schema{Type: "array", Items: ref("ErasureRequest")})),
+			failure(http.StatusBadRequest, "Invalid query params"),
+			failure(http.StatusInternalServerError, "Erasures could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/admin/erasures/{id}", admin(&Operation{
+		OperationID: "findErasure",
+		Summary:     "An erasure request and, once completed, its receipt",
+		Description: keyOnly,
+		Tags:        []string{"privacy"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Erasure found", erasure),
+			failure(http.StatusNotFound, "Erasure not found"),
+			failure(http.StatusInternalServerError, "Erasure could not be read"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/admin/erasures/{id}", admin(&Operation{
+		OperationID: "cancelErasure",
+		Summary:     "Cancel a pending erasure",
+		Description: keyOnly,
+		Tags:        []string{"privacy"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Erasure cancelled", envelope(nil)),
+			failure(http.StatusNotFound, "No pending erasure with this id"),
+			failure(http.StatusInternalServerError, "Erasure could not be cancelled"),
+		),
+	}))
+}
+
+func apiKeyOperations(doc *Document, basePath string) {
+	request := &Schema{Type: "object", Properties: map[string]*Schema{
+		"name":       {Type: "string"},
+		"scopes":     {Type: "array", Items: &Schema{Type: "string", Enum: apikey.Scopes}},
+		"expires_at": {Type: "string", Format: "date-time", Description: "Defaults to api_keys.default_ttl from now, at most api_keys.max_ttl."},
+	}, Required: []string{"name", "scopes"}}
+	adminRequest := &Schema{Type: "object", Properties: map[string]*Schema{"username": {Type: "string", Description: "Owner of the key."}}, Required: []string{"username", "name", "scopes"}}
+	for name, prop := range request.Properties {
+		adminRequest.Properties[name] = prop
+	}
+	created := SchemaOf(models.APIKey{})
+	created.Properties["key"] = &Schema{Type: "string", Description: "The key, only shown here."}
+	created.Required = append(created.Required, "key")
+	id := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	keyOnly := "Api keys cannot call it."
+
+	doc.add(http.MethodPost, basePath+"/me/api-keys", active(&Operation{
+		OperationID: "createOwnAPIKey",
+		Summary:     "Create an api key acting as the caller",
+		Description: "The key is sent in the " + apikey.Header + " header. " + keyOnly,
+		Tags:        []string{"apikeys"},
+		RequestBody: jsonBody(request),
+		Responses: responses(
+			ok(http.StatusCreated, "Key created", envelope(created)),
+			failure(http.StatusBadRequest, "Invalid body, unknown scope or expiry out of range"),
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusInternalServerError, "Key could not be created"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/me/api-keys", active(&Operation{
+		OperationID: "listOwnAPIKeys",
+		Summary:     "Api keys of the caller, revoked ones included",
+		Description: keyOnly,
+		Tags:        []string{"apikeys"},
+		Responses: responses(
+			ok(http.StatusOK, "Keys found", envelope(&Schema{Type: "array", Items: ref("APIKey")})),
+			failure(http.StatusInternalServerError, "Keys could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/me/api-keys/{id}", active(&Operation{
+		OperationID: "revokeOwnAPIKey",
+		Summary:     "Revoke an api key of the caller",
+		Description: keyOnly,
+		Tags:        []string{"apikeys"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Key revoked", envelope(nil)),
+			failure(http.StatusNotFound, "No active key of the caller with this id"),
+			failure(http.StatusInternalServerError, "Key could not be revoked"),
+		),
+	}))
+
+	doc.add(http.MethodPost, basePath+"/admin/api-keys", admin(&Operation{
+		OperationID: "createAPIKey",
+		Summary:     "Create an api key for any user, such as a service account",
+		Description: keyOnly,
+		Tags:        []string{"apikeys"},
+		RequestBody: jsonBody(adminRequest),
+		Responses: responses(
+			ok(http.StatusCreated, "Key created", envelope(created)),
+			failure(http.StatusBadRequest, "Invalid body, unknown scope or expiry out of range"),
+			failure(http.StatusNotFound, "User not found"),
+			failure(http.StatusInternalServerError, "Key could not be created"),
+		),
+	}))
+
+	doc.add(http.MethodGet, basePath+"/admin/api-keys", admin(&Operation{
+		OperationID: "listAPIKeys",
+		Summary:     "Api keys of every user",
+		Description: keyOnly,
+		Tags:        []string{"apikeys"},
+		Parameters:  []Parameter{{Name: "username", In: "query", Description: "Only the keys of this user.", Schema: &Schema{Type: "string"}}},
+		Responses: responses(
+			ok(http.StatusOK, "Keys found", envelope(&Schema{Type: "array", Items: ref("APIKey")})),
+			failure(http.StatusInternalServerError, "Keys could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodDelete, basePath+"/admin/api-keys/{id}", admin(&Operation{
+		OperationID: "revokeAPIKey",
+		Summary:     "Revoke any api key",
+		Description: keyOnly,
+		Tags:        []string{"apikeys"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Key revoked", envelope(nil)),
+			failure(http.StatusNotFound, "No active key with this id"),
+			failure(http.StatusInternalServerError, "Key could not be revoked"),
+		),
+	}))
+}
+
+func bulkOperations(doc *Document, basePath string) {
+	format := func(description string) Parameter {
+		return Parameter{Name: "format", In: "query", Description: description, Schema: &Schema{Type: "string", Enum: []string{bulk.FormatCSV, bulk.FormatNDJSON}}}
+	}
+	importBody := &RequestBody{
+		Description: "One user per row with " + strings.Join(append([]string{"password"}, bulk.Columns...), ", ") +
+			". The password may be plaintext or a bcrypt, argon2id or scrypt hash, id is ignored.",
+		Required: true,
+		Content: map[string]MediaType{
+			bulk.ContentTypes[bulk.FormatCSV]:    {Schema: &Schema{Type: "string"}},
+			bulk.ContentTypes[bulk.FormatNDJSON]: {Schema: &Schema{Type: "string"}},
+		},
+	}
+
+	doc.add(http.MethodPost, basePath+"/admin/users/import", scoped(apikey.ScopeUsersWrite, admin(&Operation{
+		OperationID: "importUsers",
+		Summary:     "Create or update users from a CSV or NDJSON file",
+		Description: "Rows are validated one by one and written in batches, each batch in its own transaction. " +
+			"The report lists the result of every row.",
+		Tags: []string{"bulk"},
+		Parameters: []Parameter{
+			format("Format of the body, taken from the content type when omitted."),
+			{Name: "mode", In: "query", Description: "insert rejects existing usernames, upsert overwrites them.", Schema: &Schema{Type: "string", Enum: []string{services.ImportInsert, services.ImportUpsert}}},
+			{Name: "dry_run", In: "query", Description: "Validate and check conflicts without writing.", Schema: &Schema{Type: "boolean"}},
+		},
+		RequestBody: importBody,
+		Responses: responses(
+			ok(http.StatusOK, "Import report", envelope(ref("ImportReport"))),
+			failure(http.StatusBadRequest, "Invalid query params or unreadable file"),
+			failure(http.StatusRequestEntityTooLarge, "File larger than the import limit"),
+		),
+	})))
+
+	exported := &Schema{Type: "string", Description: "Users without their password hash: " + strings.Join(bulk.Columns, ", ") + "."}
+	doc.add(http.MethodGet, basePath+"/admin/users/export", scoped(apikey.ScopeUsersRead, admin(&Operation{
+		OperationID: "exportUsers",
+		Summary:     "Stream users as CSV or NDJSON",
+		Tags:        []string{"bulk"},
+		Parameters: []Parameter{
+			format("Defaults to csv."),
+			{Name: "role", In: "query", Description: "Only users with this role.", Schema: &Schema{Type: "string", Enum: []string{models.RoleUser, models.RoleAdmin}}},
+			{Name: "disabled", In: "query", Description: "Only disabled or only enabled users.", Schema: &Schema{Type: "boolean"}},
+			{Name: "username_prefix", In: "query", Description: "Only usernames starting with this prefix.", Schema: &Schema{Type: "string"}},
+		},
+		Responses: responses(
+			statusResponse{status: http.StatusOK, response: &Response{
+				Description: "Matching users",
+				Content: map[string]MediaType{
+					bulk.ContentTypes[bulk.FormatCSV]:    {Schema: exported},
+					bulk.ContentTypes[bulk.FormatNDJSON]: {Schema: exported},
+				},
+			}},
+			failure(http.StatusBadRequest, "Invalid query params"),
+			failure(http.StatusInternalServerError, "Users could not be read"),
+		),
+	})))
+}
+
+func jobOperations(doc *Document, basePath string) {
+	request := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"type": {Type: "string", Enum: jobs.Types},
+			"params": {
+				Description: "import takes a file, disable and reset_password take a selection of users, reencrypt may rotate the data key first.",
+				OneOf:       []*Schema{SchemaOf(jobs.ImportParams{}), SchemaOf(jobs.Selection{}), SchemaOf(jobs.ReencryptParams{})},
+			},
+		},
+		Required: []string{"type", "params"},
+	}
+	doc.add(http.MethodPost, basePath+"/jobs", scoped(apikey.ScopeJobs, admin(&Operation{
+		OperationID: "submitJob",
+		Summary:     "Queue an import, a mass disable, a mass password reset or a re-encryption",
+		Description: "The job runs in the background, in batches. Its progress and partial result are kept " +
+			"and a job interrupted by a restart carries on where it stopped. A reencrypt job encrypts the personal " +
+			"data of every user with the current data key and fails when encryption is not enabled.",
+		Tags:        []string{"jobs"},
+		RequestBody: jsonBody(request),
+		Responses: responses(
+			ok(http.StatusAccepted, "Job queued", envelope(ref("Job"))),
+			failure(http.StatusBadRequest, "Invalid body, unknown type or invalid params"),
+			failure(http.StatusRequestEntityTooLarge, "Body larger than the import limit"),
+			failure(http.StatusInternalServerError, "Job could not be queued"),
+		),
+	})))
+
+	id := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	doc.add(http.MethodGet, basePath+"/jobs/{id}", scoped(apikey.ScopeJobs, admin(&Operation{
+		OperationID: "getJob",
+		Summary:     "State, progress and partial result of a job",
+		Tags:        []string{"jobs"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Job found", envelope(ref("Job"))),
+			failure(http.StatusNotFound, "Job not found"),
+			failure(http.StatusInternalServerError, "Job could not be read"),
+		),
+	})))
+
+	doc.add(http.MethodDelete, basePath+"/jobs/{id}", scoped(apikey.ScopeJobs, admin(&Operation{
+		OperationID: "cancelJob",
+		Summary:     "Cancel a job",
+		Description: "A queued job is cancelled at once, a running one stops after its current batch.",
+		Tags:        []string{"jobs"},
+		Parameters:  []Parameter{id},
+		Responses: responses(
+			ok(http.StatusOK, "Job cancelled or cancellation requested", envelope(ref("Job"))),
+			failure(http.StatusNotFound, "Job not found"),
+			failure(http.StatusConflict, "Job already finished"),
+			failure(http.StatusInternalServerError, "Job could not be cancelled"),
+		),
+	})))
+}
+
+// jobSchema describes models.Job, whose result depends on the job type.
+func jobSchema() *Schema {
+	schema := SchemaOf(models.Job{})
+	schema.Properties["state"].Enum = []string{models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed, models.JobCancelled}
+	schema.Properties["progress"].Description = "Percentage of the work done."
+	schema.Properties["result"] = &Schema{
+		Description: "Partial while the job runs: an import report for import, re-encrypted and unchanged counts for reencrypt, changed and skipped counts otherwise.",
+		OneOf:       []*Schema{ref("ImportReport"), SchemaOf(jobs.SelectionResult{}), SchemaOf(jobs.ReencryptResult{})},
+	}
+	return schema
+}
+
+func scimOperations(doc *Document, prefix string) {
+	id := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+	ifMatch := Parameter{Name: "If-Match", In: "header", Description: "Version the change applies to, from meta.version or the ETag.", Schema: &Schema{Type: "string"}}
+	etag := map[string]Header{"ETag": {Description: "Version of the user.", Schema: &Schema{Type: "string"}}}
+	user := func(status int, description string) statusResponse {
+		r := scimOK(status, description, ref("SCIMUser"))
+		r.response.Headers = etag
+		return r
+	}
+
+	doc.add(http.MethodGet, prefix+"/ServiceProviderConfig", scimSecured(&Operation{
+		OperationID: "scimServiceProviderConfig",
+		Summary:     "SCIM features supported by the api",
+		Tags:        []string{"scim"},
+		Responses: responses(
+			scimOK(http.StatusOK, "Supported features", ref("ServiceProviderConfig")),
+		),
+	}))
+
+	doc.add(http.MethodGet, prefix+"/Users", scimSecured(&Operation{
+		OperationID: "scimListUsers",
+		Summary:     "List users, one page at a time",
+		Tags:        []string{"scim"},
+		Parameters: []Parameter{
+			{Name: "filter", In: "query", Description: `Only userName eq "value" is supported.`, Schema: &Schema{Type: "string"}},
+			{Name: "startIndex", In: "query", Description: "1-based index of the first user, in username order.", Schema: &Schema{Type: "integer"}},
+			{Name: "count", In: "query", Description: "Users per page, capped by scim.max_results.", Schema: &Schema{Type: "integer"}},
+		},
+		Responses: responses(
+			scimOK(http.StatusOK, "Page of users", ref("SCIMListResponse")),
+			scimFailure(http.StatusBadRequest, "Unsupported filter or invalid paging"),
+			scimFailure(http.StatusInternalServerError, "Users could not be listed"),
+		),
+	}))
+
+	doc.add(http.MethodPost, prefix+"/Users", scimSecured(&Operation{
+		OperationID: "scimCreateUser",
+		Summary:     "Provision a user",
+		Description: "A user sent without password gets a random one nobody knows.",
+		Tags:        []string{"scim"},
+		RequestBody: scimBody(ref("SCIMUser")),
+		Responses: responses(
+			user(http.StatusCreated, "User created"),
+			scimFailure(http.StatusBadRequest, "Invalid body or validation error"),
+			scimFailure(http.StatusConflict, "Username, email or phone already taken"),
+			scimFailure(http.StatusInternalServerError, "User could not be created"),
+		),
+	}))
+
+	doc.add(http.MethodGet, prefix+"/Users/{id}", scimSecured(&Operation{
+		OperationID: "scimGetUser",
+		Summary:     "Find a user by id",
+		Tags:        []string{"scim"},
+		Parameters: []Parameter{id, {
+			Name: "If-None-Match", In: "header", Description: "Version already held by the client.", Schema: &Schema{Type: "string"},
+		}},
+		Responses: responses(
+			user(http.StatusOK, "User found"),
+			statusResponse{status: http.StatusNotModified, response: &Response{Description: "The client holds the current version"}},
+			scimFailure(http.StatusNotFound, "User not found"),
+			scimFailure(http.StatusInternalServerError, "User could not be found"),
+		),
+	}))
+
+	modifyFailures := []statusResponse{
+		scimFailure(http.StatusBadRequest, "Invalid body, unsupported path, validation error or username change"),
+		scimFailure(http.StatusNotFound, "User not found"),
+		scimFailure(http.StatusConflict, "Email or phone already taken"),
+		scimFailure(http.StatusPreconditionFailed, "If-Match does not match the current version"),
+		scimFailure(http.StatusInternalServerError, "User could not be updated"),
+	}
+
+	doc.add(http.MethodPut, prefix+"/Users/{id}", scimSecured(&Operation{
+		OperationID: "scimReplaceUser",
+		Summary:     "Replace a user",
+		Description: "The username cannot change and the password is kept when none is sent.",
+		Tags:        []string{"scim"},
+		Parameters:  []Parameter{id, ifMatch},
+		RequestBody: scimBody(ref("SCIMUser")),
+		Responses:   responses(append([]statusResponse{user(http.StatusOK, "User replaced")}, modifyFailures...)...),
+	}))
+
+	doc.add(http.MethodPatch, prefix+"/Users/{id}", scimSecured(&Operation{
+		OperationID: "scimPatchUser",
+		Summary:     "Add, replace or remove attributes of a user",
+		Description: "Attributes of the core schema the api does not keep, and extension attributes, are accepted and ignored.",
+		Tags:        []string{"scim"},
+		Parameters:  []Parameter{id, ifMatch},
+		RequestBody: scimBody(ref("SCIMPatchRequest")),
+		Responses:   responses(append([]statusResponse{user(http.StatusOK, "User patched")}, modifyFailures...)...),
+	}))
+
+	doc.add(http.MethodDelete, prefix+"/Users/{id}", scimSecured(&Operation{
+		OperationID: "scimDeleteUser",
+		Summary:     "Deprovision a user",
+		Tags:        []string{"scim"},
+		Parameters:  []Parameter{id, ifMatch},
+		Responses: responses(
+			statusResponse{status: http.StatusNoContent, response: &Response{Description: "User deleted"}},
+			scimFailure(http.StatusNotFound, "User not found"),
+			scimFailure(http.StatusPreconditionFailed, "If-Match does not match the current version"),
+			scimFailure(http.StatusInternalServerError, "User could not be deleted"),
+		),
+	}))
+}
+
+func userSchema() *Schema {
+	schema := SchemaOf(models.User{})
+	schema.Properties["password"].WriteOnly = true
+	return schema
+}
+
+func scimUserSchema() *Schema {
+	schema := SchemaOf(scim.User{})
+	schema.Properties["password"].Description = "Write only, never returned."
+	schema.Properties["password"].WriteOnly = true
+	schema.Properties["emails"].Description = "A single email is kept, the primary one or else the first."
+	schema.Properties["phoneNumbers"].Description = "A single phone is kept, the primary one or else the first."
+	return schema
+}
+
+func scimPatchSchema() *Schema {
+	schema := SchemaOf(scim.PatchRequest{})
+	operation := schema.Properties["Operations"].Items
+	operation.Properties["op"].Enum = []string{"add", "replace", "remove"}
+	operation.Properties["value"] = &Schema{Description: "Value of the attribute at path, or an object of attributes without path."}
+	return schema
+}
+
+func scimOK(status int, description string, schema *Schema) statusResponse {
+	return statusResponse{status: status, response: &Response{
+		Description: description,
+		Content:     map[string]MediaType{scim.ContentType: {Schema: schema}},
+	}}
+}
+
+func scimFailure(status int, description string) statusResponse {
+	return scimOK(status, description, ref("SCIMError"))
+}
+
+func scimSecured(op *Operation) *Operation {
+	op.Security = []SecurityRequirement{{scimAuth: {}}}
+	op.Responses[strconv.Itoa(http.StatusUnauthorized)] = scimFailure(http.StatusUnauthorized, "Missing or invalid SCIM token, or SCIM disabled").response
+	return op
+}
+
+func scimBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{scim.ContentType: {Schema: schema}, "application/json": {Schema: schema}},
+	}
+}
+
+func oidcOperations(doc *Document, basePath string) {
+	prefix := basePath + oidc.Prefix
+	disabled := failure(http.StatusNotFound, "OpenID Connect provider not enabled")
+
+	doc.add(http.MethodGet, basePath+oidc.DiscoveryPath, &Operation{
+		OperationID: "oidcDiscovery",
+		Summary:     "OpenID Connect discovery metadata",
+		Tags:        []string{"oidc"},
+		Responses: responses(
+			ok(http.StatusOK, "Provider metadata", SchemaOf(oidc.Metadata{})),
+			disabled,
+		),
+	})
+
+	doc.add(http.MethodGet, prefix+"/jwks", &Operation{
+		OperationID: "oidcKeySet",
+		Summary:     "Public key signing the ID tokens",
+		Tags:        []string{"oidc"},
+		Responses: responses(
+			ok(http.StatusOK, "JSON Web Key Set", SchemaOf(oidc.KeySet{})),
+			disabled,
+		),
+	})
+
+	authorizeParams := []Parameter{
+		{Name: "response_type", In: "query", Required: true, Schema: &Schema{Type: "string", Enum: []string{"code"}}},
+		{Name: "client_id", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "redirect_uri", In: "query", Required: true, Description: "One of the redirect uris of the client.", Schema: &Schema{Type: "string"}},
+		{Name: "scope", In: "query", Required: true, Description: "Must include openid.", Schema: &Schema{Type: "string"}},
+		{Name: "state", In: "query", Schema: &Schema{Type: "string"}},
+		{Name: "nonce", In: "query", Schema: &Schema{Type: "string"}},
+		{Name: "code_challenge", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "code_challenge_method", In: "query", Required: true, Schema: &Schema{Type: "string", Enum: []string{"S256"}}},
+	}
+	page := func(status int, description string) statusResponse {
+		return statusResponse{status: status, response: &Response{
+			Description: description,
+			Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+		}}
+	}
+	redirect := func(status int, description string) statusResponse {
+		return statusResponse{status: status, response: &Response{Description: description}}
+	}
+
+	doc.add(http.MethodGet, prefix+"/authorize", &Operation{
+		OperationID: "oidcAuthorize",
+		Summary:     "Sign in and consent page of the authorization code flow",
+		Description: "PKCE with S256 is required. Errors are sent back to the redirect uri once the client and the uri are known.",
+		Tags:        []string{"oidc"},
+		Parameters:  authorizeParams,
+		Responses: responses(
+			page(http.StatusOK, "Sign in and consent page"),
+			redirect(http.StatusFound, "Error sent back to the client"),
+			page(http.StatusBadRequest, "Unknown client or redirect uri"),
+			disabled,
+		),
+	})
+
+	authorizeForm := &Schema{Type: "object", Properties: map[string]*Schema{
+		"username": {Type: "string"},
+		"password": {Type: "string"},
+		"decision": {Type: "string", Enum: []string{"allow", "deny"}},
+	}, Required: []string{"decision"}}
+	for _, param := range authorizeParams {
+		authorizeForm.Properties[param.Name] = param.Schema
+	}
+	doc.add(http.MethodPost, prefix+"/authorize", &Operation{
+		OperationID: "oidcApprove",
+		Summary:     "Sign in and grant or deny the authorization",
+		Description: "Posted by the page with the parameters of the authorization request.",
+		Tags:        []string{"oidc"},
+		RequestBody: formBody(authorizeForm),
+		Responses: responses(
+			redirect(http.StatusSeeOther, "Code or error sent back to the client"),
+			page(http.StatusBadRequest, "Unknown client or redirect uri"),
+			page(http.StatusUnauthorized, "Invalid credentials"),
+			page(http.StatusForbidden, "User disabled or password change required"),
+			disabled,
+		),
+	})
+
+	tokenForm := &Schema{Type: "object", Properties: map[string]*Schema{
+		"grant_type":    {Type: "string", Enum: []string{oidc.GrantAuthorizationCode, oidc.GrantRefreshToken}},
+		"code":          {Type: "string"},
+		"redirect_uri":  {Type: "string"},
+		"code_verifier": {Type: "string"},
+		"refresh_token": {Type: "string"},
+		"scope":         {Type: "string", Description: "Narrows the scope on refresh."},
+		"client_id":     {Type: "string"},
+		"client_secret": {Type: "string"},
+	}, Required: []string{"grant_type"}}
+	doc.add(http.MethodPost, prefix+"/token", clientSecured(&Operation{
+		OperationID: "oidcToken",
+		Summary:     "Exchange a code or a refresh token",
+		Description: "Refresh tokens are rotated, presenting a used one revokes every token of the grant.",
+		Tags:        []string{"oidc"},
+		RequestBody: formBody(tokenForm),
+		Responses: responses(
+			ok(http.StatusOK, "Tokens issued", SchemaOf(oidc.TokenResponse{})),
+			ok(http.StatusBadRequest, "Invalid, expired or used code or refresh token", ref("OAuthError")),
+			disabled,
+		),
+	}))
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		doc.add(method, prefix+"/userinfo", &Operation{
+			OperationID: "oidcUserInfo" + method[:1] + strings.ToLower(method[1:]),
+			Summary:     "Claims of the user an access token belongs to",
+			Description: "The claims returned depend on the granted scopes.",
+			Tags:        []string{"oidc"},
+			Security:    []SecurityRequirement{{tokenAuth: {}}},
+			Responses: responses(
+				ok(http.StatusOK, "User claims", ref("UserInfo")),
+				ok(http.StatusUnauthorized, "Missing, invalid, expired or revoked access token", ref("OAuthError")),
+				disabled,
+			),
+		})
+	}
+
+	tokenForm = &Schema{Type: "object", Properties: map[string]*Schema{
+		"token":           {Type: "string"},
+		"token_type_hint": {Type: "string", Enum: []string{"access_token", "refresh_token"}},
+		"client_id":       {Type: "string"},
+		"client_secret":   {Type: "string"},
+	}, Required: []string{"token"}}
+	doc.add(http.MethodPost, prefix+"/introspect", clientSecured(&Operation{
+		OperationID: "oidcIntrospect",
+		Summary:     "Describe a token issued to the calling client",
+		Description: "Only confidential clients can introspect. Tokens of other clients are reported inactive.",
+		Tags:        []string{"oidc"},
+		RequestBody: formBody(tokenForm),
+		Responses: responses(
+			ok(http.StatusOK, "Token description", SchemaOf(oidc.Introspection{})),
+			ok(http.StatusBadRequest, "Missing token", ref("OAuthError")),
+			disabled,
+		),
+	}))
+
+	doc.add(http.MethodPost, prefix+"/revoke", clientSecured(&Operation{
+		OperationID: "oidcRevoke",
+		Summary:     "Revoke a token and every token of its grant",
+		Description: "Unknown tokens are accepted, as RFC 7009 asks.",
+		Tags:        []string{"oidc"},
+		RequestBody: formBody(tokenForm),
+		Responses: responses(
+			statusResponse{status: http.StatusOK, response: &Response{Description: "Token revoked"}},
+			ok(http.StatusBadRequest, "Missing token", ref("OAuthError")),
+			disabled,
+		),
+	}))
+
+	clientRequest := &Schema{Type: "object", Properties: map[string]*Schema{
+		"name":          {Type: "string"},
+		"redirect_uris": arrayOf(&Schema{Type: "string", Description: "https, http on a loopback address or a private-use scheme, without fragment."}),
+		"public":        {Type: "boolean", Description: "Public clients, such as single page or native apps, get no secret."},
+	}, Required: []string{"name", "redirect_uris"}}
+	registered := SchemaOf(models.OAuthClient{})
+	registered.Properties["client_secret"] = &Schema{Type: "string", Description: "Only returned here, for confidential clients."}
+
+	doc.add(http.MethodPost, basePath+"/admin/oauth/clients", scoped(apikey.ScopeClients, admin(&Operation{
+		OperationID: "registerOAuthClient",
+		Summary:     "Register a client of the OpenID Connect provider",
+		Tags:        []string{"oidc"},
+		RequestBody: jsonBody(clientRequest),
+		Responses: responses(
+			ok(http.StatusCreated, "Client registered", envelope(registered)),
+			failure(http.StatusBadRequest, "Invalid body, name or redirect uris"),
+			disabled,
+			failure(http.StatusInternalServerError, "Client could not be registered"),
+		),
+	})))
+
+	doc.add(http.MethodGet, basePath+"/admin/oauth/clients", scoped(apikey.ScopeClients, admin(&Operation{
+		OperationID: "listOAuthClients",
+		Summary:     "List the clients of the OpenID Connect provider",
+		Tags:        []string{"oidc"},
+		Responses: responses(
+			ok(http.StatusOK, "Registered clients", envelope(arrayOf(ref("OAuthClient")))),
+			disabled,
+			failure(http.StatusInternalServerError, "Clients could not be listed"),
+		),
+	})))
+
+	doc.add(http.MethodDelete, basePath+"/admin/oauth/clients/{id}", scoped(apikey.ScopeClients, admin(&Operation{
+		OperationID: "deleteOAuthClient",
+		Summary:     "Delete a client and revoke its tokens",
+		Tags:        []string{"oidc"},
+		Parameters:  []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}},
+		Responses: responses(
+			ok(http.StatusOK, "Client deleted", envelope(nil)),
+			failure(http.StatusNotFound, "Client not found or provider not enabled"),
+			failure(http.StatusInternalServerError, "Client could not be deleted"),
+		),
+	})))
+}
+
+func oauthErrorSchema() *Schema {
+	schema := SchemaOf(oidc.Error{})
+	schema.Required = []string{"error"}
+	return schema
+}
+
+func userInfoSchema() *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}, Required: []string{"sub"}}
+	for _, claim := range []string{"sub", "name", "given_name", "family_name", "preferred_username", "email", "phone_number"} {
+		schema.Properties[claim] = &Schema{Type: "string"}
+	}
+	schema.Properties["email_verified"] = &Schema{Type: "boolean"}
+	schema.Properties["phone_number_verified"] = &Schema{Type: "boolean"}
+	return schema
+}
+
+// clientSecured marks operations authenticated with the client credentials.
+func clientSecured(op *Operation) *Operation {
+	op.Security = []SecurityRequirement{{clientAuth: {}}}
+	op.Responses[strconv.Itoa(http.StatusUnauthorized)] = ok(http.StatusUnauthorized, "Unknown client or invalid credentials", ref("OAuthError")).response
+	return op
+}
+
+func formBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{"application/x-www-form-urlencoded": {Schema: schema}},
+	}
+}
+
+func healthOperations(doc *Document) {
+	doc.add(http.MethodGet, LivenessPath, &Operation{
+		OperationID: "liveness",
+		Summary:     "Process is alive",
+		Tags:        []string{"health"},
+		Responses: responses(
+			ok(http.StatusOK, "Process is serving requests", ref("HealthReport")),
+		),
+	})
+
+	doc.add(http.MethodGet, ReadinessPath, &Operation{
+		OperationID: "readiness",
+		Summary:     "Dependencies are ready to serve traffic",
+		Description: "Fails when any dependency check fails or the server is shutting down.",
+		Tags:        []string{"health"},
+		Responses: responses(
+			ok(http.StatusOK, "Ready", ref("HealthReport")),
+			ok(http.StatusServiceUnavailable, "Not ready", ref("HealthReport")),
+		),
+	})
+
+	doc.add(http.MethodGet, HealthDetailsPath, scoped(apikey.ScopeHealth, admin(&Operation{
+		OperationID: "healthDetails",
+		Summary:     "Status, latency and last error of every dependency check",
+		Tags:        []string{"health"},
+		Responses: responses(
+			ok(http.StatusOK, "Every check is up", ref("HealthReport")),
+			ok(http.StatusServiceUnavailable, "At least one check is down", ref("HealthReport")),
+		),
+	})))
+}
+
+func metricsOperations(doc *Document) {
+	doc.add(http.MethodGet, MetricsPath, &Operation{
+		OperationID: "metrics",
+		Summary:     "Prometheus metrics in text exposition format",
+		Tags:        []string{"metrics"},
+		Responses: map[string]*Response{
+			strconv.Itoa(http.StatusOK): {
+				Description: "Metrics for http, database, auth and business events",
+				Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+			},
+		},
+	})
+}
+
+func docsOperations(doc *Document) {
+	doc.add(http.MethodGet, SpecPath, &Operation{
+		OperationID: "getOpenAPISpec",
+		Summary:     "OpenAPI document describing this api",
+		Tags:        []string{"docs"},
+		Responses: responses(
+			ok(http.StatusOK, "OpenAPI 3.1 document", &Schema{Type: "object"}),
+		),
+	})
+
+	doc.add(http.MethodGet, UIPath, &Operation{
+		OperationID: "getDocsUI",
+		Summary:     "Interactive api documentation",
+		Tags:        []string{"docs"},
+		Responses: map[string]*Response{
+			strconv.Itoa(http.StatusOK): {
+				Description: "Html page rendering the OpenAPI document",
+				Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+			},
+		},
+	})
+}
+
+// GinPath converts a gin route path (":id", "*path") into its OpenAPI form ("{id}", "{path}").
+func GinPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type statusResponse struct {
+	status   int
+	response *Response
+}
+
+func responses(list ...statusResponse) map[string]*Response {
+	out := map[string]*Response{}
+	for _, r := range list {
+		out[strconv.Itoa(r.status)] = r.response
+	}
+	return out
+}
+
+func ok(status int, description string, schema *Schema) statusResponse {
+	return statusResponse{status: status, response: &Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: schema}},
+	}}
+}
+
+func failure(status int, description string) statusResponse {
+	return ok(status, description, ref("Error"))
+}
+
+func protected(op *Operation) *Operation {
+	op.Security = []SecurityRequirement{{bearerAuth: {}}}
+	op.Responses[strconv.Itoa(http.StatusUnauthorized)] = failure(http.StatusUnauthorized, "Missing or invalid token, or ended session").response
+	return op
+}
+
+// active marks operations closed to tokens with a pending password change.
+func active(op *Operation) *Operation {
+	protected(op)
+	op.Responses[strconv.Itoa(http.StatusForbidden)] = failure(http.StatusForbidden, "Password change required").response
+	return op
+}
+
+func admin(op *Operation) *Operation {
+	protected(op)
+	op.Responses[strconv.Itoa(http.StatusForbidden)] = failure(http.StatusForbidden, "Token does not belong to an admin or a password change is required").response
+	return op
+}
+
+// limited marks operations the default rate limit policies cover, the
+// configured policies may limit any other.
+func limited(op *Operation) *Operation {
+	integer := &Schema{Type: "integer"}
+	r := failure(http.StatusTooManyRequests, "Rate limit exceeded").response
+	r.Headers = map[string]Header{
+		ratelimit.RetryAfterHeader: {Description: "Seconds until a request is allowed again.", Schema: integer},
+		ratelimit.LimitHeader:      {Description: "Requests allowed at once.", Schema: integer},
+		ratelimit.RemainingHeader:  {Description: "Requests left right now.", Schema: integer},
+		ratelimit.ResetHeader:      {Description: "Seconds until the limit is fully restored.", Schema: integer},
+		ratelimit.PolicyHeader:     {Description: "Requests restored per window, such as 10;w=60.", Schema: &Schema{Type: "string"}},
+	}
+	op.Responses[strconv.Itoa(http.StatusTooManyRequests)] = r
+	return op
+}
+
+// scoped marks operations api keys holding scope can call.
+func scoped(scope string, op *Operation) *Operation {
+	op.Security = append(op.Security, SecurityRequirement{apiKeyAuth: {}})
+	forbidden := strconv.Itoa(http.StatusForbidden)
+	op.Responses[forbidden] = failure(http.StatusForbidden, op.Responses[forbidden].Description+", or api key without the "+scope+" scope").response
+	return op
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// envelope describes the models.UserResponse wrapper around a payload.
+func envelope(data *Schema) *Schema {
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"message": {Type: "string"},
+			"status":  {Type: "integer"},
+		},
+		Required: []string{"message", "status"},
+	}
+	if data != nil {
+		schema.Properties["data"] = data
+		schema.Required = append(schema.Required, "data")
+	}
+	return schema
+}
+
+// userRequest narrows the user schema to the given fields.
+func userRequest(fields, required []string) *Schema {
+	user := SchemaOf(models.User{})
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}, Required: required}
+	for _, field := range fields {
+		if prop, ok := user.Properties[field]; ok {
+			schema.Properties[field] = prop
+		}
+	}
+	return schema
+}
@@ -0,0 +1,254 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryKeys keeps data keys in memory, in creation order.
+type memoryKeys struct {
+	mu   sync.Mutex
+	keys []models.DataKey
+}
+
+func (m *memoryKeys) CreateDataKey(ctx context.Context, key models.DataKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *memoryKeys) ListDataKeys(ctx context.Context) ([]models.DataKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.DataKey(nil), m.keys...), nil
+}
+
+func (m *memoryKeys) RewrapDataKey(ctx context.Context, key models.DataKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		if m.keys[i].ID == key.ID {
+			m.keys[i] = key
+		}
+	}
+	return nil
+}
+
+func (m *memoryKeys) RecordIndexCheck(ctx context.Context, check string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		if m.keys[i].IndexCheck == "" {
+			m.keys[i].IndexCheck = check
+		}
+	}
+	return nil
+}
+
+func masterKey(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), keySize)))
+}
+
+func testKeyring(t *testing.T, repo *memoryKeys, masterKeys ...string) *Keyring {
+	kms, err := NewLocalKMS(masterKeys)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	k, err := NewKeyring(context.Background(), repo, kms, []byte(strings.Repeat("i", keySize)), time.Hour)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return k
+}
+
+func TestNewLocalKMS(t *testing.T) {
+	test := []struct {
+		Name    string
+		Entries []string
+		Valid   bool
+	}{
+		{Name: "Valid", Entries: []string{masterKey("new", 'n'), " " + masterKey("old", 'o')}, Valid: true},
+		{Name: "Empty", Entries: nil},
+		{Name: "Missing Id", Entries: []string{masterKey("", 'n')}},
+		{Name: "Invalid Id", Entries: []string{masterKey("a key", 'n')}},
+		{Name: "Short Key", Entries: []string{"new:" + base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{Name: "Not Base64", Entries: []string{"new:not base64"}},
+		{Name: "Duplicate Id", Entries: []string{masterKey("new", 'n'), masterKey("new", 'o')}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			kms, err := NewLocalKMS(tt.Entries)
+			if tt.Valid {
+				assert.NoError(t, err)
+				assert.Equal(t, "new", kms.KeyID())
+			} else {
+				assert.ErrorIs(t, err, config.ErrInvalidMasterKey)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	k := testKeyring(t, &memoryKeys{}, masterKey("master", 'm'))
+
+	sealed, err := k.Encrypt(ctx, "email", "john@example.com")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, prefix+k.current+":"), sealed)
+	assert.NotContains(t, sealed, "john")
+	assert.False(t, k.Stale(ctx, sealed))
+
+	again, err := k.Encrypt(ctx, "email", "john@example.com")
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := k.Decrypt(ctx, "email", sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "john@example.com", opened)
+
+	// a value moved to another column does not decrypt
+	_, err = k.Decrypt(ctx, "name", sealed)
+	assert.ErrorIs(t, err, config.ErrDecrypting)
+
+	_, err = k.Decrypt(ctx, "email", sealed[:len(sealed)-4])
+	assert.ErrorIs(t, err, config.ErrDecrypting)
+
+	_, err = k.Decrypt(ctx, "email", prefix+"missing:"+strings.Split(sealed, ":")[3])
+	assert.ErrorIs(t, err, config.ErrUnknownDataKey)
+
+	// values written before encryption was enabled are read as they are
+	opened, err = k.Decrypt(ctx, "email", "john@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "john@example.com", opened)
+	assert.True(t, k.Stale(ctx, "john@example.com"))
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := testKeyring(t, &memoryKeys{}, masterKey("master", 'm'))
+
+	index := k.BlindIndex("email", "John@Example.com")
+	assert.Len(t, index, 64)
+	assert.Equal(t, index, k.BlindIndex("email", "john@example.com"))
+	assert.NotEqual(t, index, k.BlindIndex("email", "jane@example.com"))
+	assert.NotEqual(t, k.BlindIndex("phone", "123456"), k.BlindIndex("email", "123456"))
+
+	other, err := NewKeyring(context.Background(), &memoryKeys{}, k.kms, []byte(strings.Repeat("j", keySize)), time.Hour)
+	assert.NoError(t, err)
+	assert.NotEqual(t, index, other.BlindIndex("email", "john@example.com"))
+}
+
+func TestIndexKeyCheck(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryKeys{}
+	k := testKeyring(t, repo, masterKey("master", 'm'))
+	assert.Equal(t, k.indexCheck(), repo.keys[0].IndexCheck)
+
+	// another index key would find none of the stored indexes
+	_, err := NewKeyring(ctx, repo, k.kms, []byte(strings.Repeat("j", keySize)), time.Hour)
+	assert.ErrorIs(t, err, config.ErrIndexKeyMismatch)
+
+	// keys stored before the checks get the one of the first key loaded
+	repo.keys[0].IndexCheck = ""
+	testKeyring(t, repo, masterKey("master", 'm'))
+	assert.Equal(t, k.indexCheck(), repo.keys[0].IndexCheck)
+	_, err = NewKeyring(ctx, repo, k.kms, []byte(strings.Repeat("j", keySize)), time.Hour)
+	assert.ErrorIs(t, err, config.ErrIndexKeyMismatch)
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryKeys{}
+	k := testKeyring(t, repo, masterKey("master", 'm'))
+	// another instance sharing the database
+	peer := testKeyring(t, repo, masterKey("master", 'm'))
+	assert.Len(t, repo.keys, 1)
+
+	old, err := k.Encrypt(ctx, "name", "John")
+	assert.NoError(t, err)
+	assert.NoError(t, k.Rotate(ctx))
+	assert.Len(t, repo.keys, 2)
+	assert.True(t, k.Stale(ctx, old))
+
+	rotated, err := k.Encrypt(ctx, "name", "John")
+	assert.NoError(t, err)
+	assert.False(t, k.Stale(ctx, rotated))
+	for _, value := range []string{old, rotated} {
+		opened, err := k.Decrypt(ctx, "name", value)
+		assert.NoError(t, err)
+		assert.Equal(t, "John", opened)
+	}
+
+	// the peer loads the new key the first time it meets it
+	opened, err := peer.Decrypt(ctx, "name", rotated)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", opened)
+	assert.False(t, peer.Stale(ctx, rotated))
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryKeys{}
+	k := testKeyring(t, repo, masterKey("master", 'm'))
+	peer := testKeyring(t, repo, masterKey("master", 'm'))
+	now := time.Now()
+	peer.now = func() time.Time { return now }
+	assert.NoError(t, k.Rotate(ctx))
+
+	// the peer keeps encrypting with the key it knows until the refresh
+	sealed, err := peer.Encrypt(ctx, "name", "John")
+	assert.NoError(t, err)
+	assert.True(t, k.Stale(ctx, sealed))
+
+	now = now.Add(2 * time.Hour)
+	sealed, err = peer.Encrypt(ctx, "name", "John")
+	assert.NoError(t, err)
+	assert.False(t, k.Stale(ctx, sealed))
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryKeys{}
+	k := testKeyring(t, repo, masterKey("old", 'o'))
+	sealed, err := k.Encrypt(ctx, "phone", "123456")
+	assert.NoError(t, err)
+
+	// a new master key in front wraps the data keys again when loaded
+	rotated := testKeyring(t, repo, masterKey("new", 'n'), masterKey("old", 'o'))
+	assert.Equal(t, "new", repo.keys[0].MasterKeyID)
+	opened, err := rotated.Decrypt(ctx, "phone", sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", opened)
+
+	// after which the old one can go
+	retired := testKeyring(t, repo, masterKey("new", 'n'))
+	opened, err = retired.Decrypt(ctx, "phone", sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", opened)
+
+	// without the master key of a data key nothing loads
+	kms, err := NewLocalKMS([]string{masterKey("other", 'x')})
+	assert.NoError(t, err)
+	_, err = NewKeyring(ctx, repo, kms, []byte(strings.Repeat("i", keySize)), time.Hour)
+	assert.ErrorIs(t, err, config.ErrUnknownMasterKey)
+}
+
+func TestLoad(t *testing.T) {
+	cfg := config.EncryptionConfig{MasterKeys: []string{masterKey("master", 'm')}, IndexKey: "short", KeyRefresh: time.Minute}
+	_, err := Load(context.Background(), cfg, &memoryKeys{})
+	assert.ErrorIs(t, err, config.ErrInvalidIndexKey)
+
+	cfg.IndexKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", keySize)))
+	k, err := Load(context.Background(), cfg, &memoryKeys{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, k.current)
+}
@@ -0,0 +1,295 @@
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+// prefix marks encrypted values, the data key id and the base64 nonce and
+// ciphertext follow: enc:v1:<key id>:<sealed>
+const prefix = "enc:v1:"
+
+// Keyring encrypts personal data with AES-GCM data keys, the newest one for
+// new values and any of them to decrypt. Data keys are stored wrapped by the
+// KMS and reloaded every refresh, so a rotation reaches every instance.
+type Keyring struct {
+	repo    repository.DataKeyRepository
+	kms     KMS
+	index   []byte
+	refresh time.Duration
+	now     func() time.Time
+	group   singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]cipher.AEAD
+	current   string
+	currentAt time.Time
+	loaded    time.Time
+}
+
+var _ repository.FieldCipher = (*Keyring)(nil)
+
+// Load opens the keyring with the master and index keys of cfg.
+func Load(ctx context.Context, cfg config.EncryptionConfig, repo repository.DataKeyRepository) (*Keyring, error) {
+	kms, err := NewLocalKMS(cfg.MasterKeys)
+	if err != nil {
+		return nil, err
+	}
+	index, err := decodeKey(cfg.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", config.ErrInvalidIndexKey, err)
+	}
+	return NewKeyring(ctx, repo, kms, index, cfg.KeyRefresh)
+}
+
+// NewKeyring loads the data keys, creating the first one when there is none.
+// indexKey computes the blind indexes and cannot change once data is stored,
+// a key other than the one the data keys were stored with is refused.
+func NewKeyring(ctx context.Context, repo repository.DataKeyRepository, kms KMS, indexKey []byte, refresh time.Duration) (*Keyring, error) {
+	k := &Keyring{repo: repo, kms: kms, index: indexKey, refresh: refresh, now: time.Now, keys: map[string]cipher.AEAD{}}
+	if err := k.checkIndexKey(ctx); err != nil {
+		return nil, err
+	}
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	if k.current == "" {
+		if err := k.Rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Rotate creates a data key and makes it the current one. Values encrypted
+// with older keys still decrypt until they are encrypted again.
+func (k *Keyring) Rotate(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "encryption.Rotate")
+	defer func() { tracing.End(span, err) }()
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	masterKeyID, wrapped, err := k.kms.Wrap(ctx, dataKey)
+	if err != nil {
+		return err
+	}
+	key := models.DataKey{ID: uuid.NewString(), MasterKeyID: masterKeyID, Wrapped: wrapped, IndexCheck: k.indexCheck(), CreatedAt: k.now().UTC()}
+	if err := k.repo.CreateDataKey(ctx, key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[key.ID] = aead
+	k.current, k.currentAt = key.ID, key.CreatedAt
+	return nil
+}
+
+func (k *Keyring) Encrypt(ctx context.Context, field, value string) (string, error) {
+	id, aead := k.currentKey(ctx)
+	sealed, err := seal(aead, []byte(value), []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return prefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Decrypt(ctx context.Context, field, value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", config.ErrDecrypting
+	}
+	aead, err := k.key(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", config.ErrDecrypting
+	}
+	plaintext, err := unseal(aead, sealed, []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex is a keyed hash of value, equal values of a field get equal
+// indexes. Emails are compared regardless of case, like the database does.
+func (k *Keyring) BlindIndex(field, value string) string {
+	if field == "email" {
+		value = strings.ToLower(value)
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkIndexKey compares the index key with the one recorded on the data
+// keys, and records it on the keys stored before checks were.
+func (k *Keyring) checkIndexKey(ctx context.Context) error {
+	stored, err := k.repo.ListDataKeys(ctx)
+	if err != nil {
+		return err
+	}
+	check := k.indexCheck()
+	unchecked := false
+	for _, key := range stored {
+		if key.IndexCheck == "" {
+			unchecked = true
+			continue
+		}
+		if !hmac.Equal([]byte(key.IndexCheck), []byte(check)) {
+			return config.ErrIndexKeyMismatch
+		}
+	}
+	if unchecked {
+		return k.repo.RecordIndexCheck(ctx, check)
+	}
+	return nil
+}
+
+// indexCheck identifies the index key without revealing it.
+func (k *Keyring) indexCheck() string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte("index key check"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k *Keyring) Stale(ctx context.Context, value string) bool {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return true
+	}
+	id, _, _ := strings.Cut(rest, ":")
+	current, _ := k.currentKey(ctx)
+	return id != current
+}
+
+// currentKey returns the key new values are encrypted with, reloading the
+// keys first when they are due.
+func (k *Keyring) currentKey(ctx context.Context) (string, cipher.AEAD) {
+	k.mu.RLock()
+	due := k.now().Sub(k.loaded) >= k.refresh
+	k.mu.RUnlock()
+	if due {
+		if err := k.reload(ctx); err != nil {
+			// the keys in memory still work, the next call tries again
+			slog.WarnContext(ctx, "error reloading data keys", "error", err)
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current]
+}
+
+// key returns the data key with id, reloading the keys once when another
+// instance created it since the last load.
+func (k *Keyring) key(ctx context.Context, id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	aead, ok := k.keys[id]
+	k.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if aead, ok = k.keys[id]; !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrUnknownDataKey, id)
+	}
+	return aead, nil
+}
+
+// reload unwraps the data keys not loaded yet. Keys wrapped by an older
+// master key are wrapped again by the current one, so it can be retired.
+// Concurrent callers share a single load.
+func (k *Keyring) reload(ctx context.Context) error {
+	_, err, _ := k.group.Do("reload", func() (interface{}, error) {
+		stored, err := k.repo.ListDataKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		k.mu.RLock()
+		keys := maps.Clone(k.keys)
+		k.mu.RUnlock()
+		var newest models.DataKey
+		for _, key := range stored {
+			newest = key
+			if _, ok := keys[key.ID]; ok {
+				continue
+			}
+			dataKey, err := k.kms.Unwrap(ctx, key.MasterKeyID, key.Wrapped)
+			if err != nil {
+				return nil, fmt.Errorf("data key %s: %w", key.ID, err)
+			}
+			if keys[key.ID], err = newAEAD(dataKey); err != nil {
+				return nil, err
+			}
+			if key.MasterKeyID != k.kms.KeyID() {
+				k.rewrap(ctx, key, dataKey)
+			}
+		}
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// a rotation may have happened while the keys were read
+		for id, aead := range k.keys {
+			keys[id] = aead
+		}
+		k.keys, k.loaded = keys, k.now()
+		if newest.ID != "" && newest.CreatedAt.After(k.currentAt) {
+			k.current, k.currentAt = newest.ID, newest.CreatedAt
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// rewrap only logs failures, the key is still usable and another load tries
+// again.
+func (k *Keyring) rewrap(ctx context.Context, key models.DataKey, dataKey []byte) {
+	masterKeyID, wrapped, err := k.kms.Wrap(ctx, dataKey)
+	if err == nil {
+		key.MasterKeyID, key.Wrapped = masterKeyID, wrapped
+		err = k.repo.RewrapDataKey(ctx, key)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "error wrapping data key with the current master key", "data_key", key.ID, "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"regexp"
+	"strings"
+)
+
+// keySize is the size of every key, AES-256
+const keySize = 32
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// KMS keeps the master keys data keys are wrapped with, they never leave
+// it. LocalKMS reads them from the configuration, a cloud key service can
+// take its place.
+type KMS interface {
+	// Wrap encrypts dataKey with the current master key and names it.
+	Wrap(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// KeyID names the current master key. Data keys wrapped by another one
+	// are wrapped again when loaded.
+	KeyID() string
+}
+
+// LocalKMS wraps data keys with AES-GCM master keys held in memory.
+type LocalKMS struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+var _ KMS = (*LocalKMS)(nil)
+
+// NewLocalKMS reads master keys written as id:key, with base64 keys. The
+// first one is current, the others only unwrap data keys until they are
+// wrapped again.
+func NewLocalKMS(entries []string) (*LocalKMS, error) {
+	if len(entries) == 0 {
+		return nil, config.ErrInvalidMasterKey
+	}
+	kms := &LocalKMS{keys: map[string]cipher.AEAD{}}
+	for _, entry := range entries {
+		id, encoded, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		key, err := decodeKey(encoded)
+		if err != nil || !keyIDPattern.MatchString(id) || kms.keys[id] != nil {
+			return nil, fmt.Errorf("%w: master key %q", config.ErrInvalidMasterKey, id)
+		}
+		if kms.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+		if kms.current == "" {
+			kms.current = id
+		}
+	}
+	return kms, nil
+}
+
+func (k *LocalKMS) KeyID() string {
+	return k.current
+}
+
+func (k *LocalKMS) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	return k.current, wrapped, err
+}
+
+func (k *LocalKMS) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrUnknownMasterKey, keyID)
+	}
+	return unseal(aead, wrapped, []byte(keyID))
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a random nonce it puts in front.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func unseal(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, config.ErrDecrypting
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, config.ErrDecrypting
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,163 @@
+package federation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StateCookie holds the state of a login in progress until the provider
+// sends the user back.
+const StateCookie = "federation_state"
+
+// ProviderConfig is an entry of the providers file.
+type ProviderConfig struct {
+	// Name identifies the provider in the login urls
+	Name             string   `yaml:"name"`
+	Issuer           string   `yaml:"issuer"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret"`
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	Scopes           []string `yaml:"scopes"`
+	// LinkByEmail links an unknown identity to the user holding its email,
+	// when the provider verified it
+	LinkByEmail bool `yaml:"link_by_email"`
+	// Provision creates a user for an identity nobody is linked to
+	Provision bool `yaml:"provision"`
+	// AllowedDomains, when set, limits provisioning to verified emails of
+	// these domains
+	AllowedDomains []string `yaml:"allowed_domains"`
+}
+
+// allows reports whether a user may be provisioned with email.
+func (c ProviderConfig) allows(email string, verified bool) bool {
+	if len(c.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	return verified && at >= 0 && slices.Contains(c.AllowedDomains, strings.ToLower(email[at+1:]))
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// LoadProviders reads the providers file, reporting every problem at once.
+func LoadProviders(path string) ([]ProviderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading providers file: %w", err)
+	}
+
+	var file struct {
+		Providers []ProviderConfig `yaml:"providers"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing providers file: %w", err)
+	}
+	if len(file.Providers) == 0 {
+		return nil, errors.New("providers file lists no provider")
+	}
+
+	var errs []error
+	check := func(ok bool, at, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{at}, args...)...))
+		}
+	}
+	seen := map[string]bool{}
+	for i := range file.Providers {
+		p := &file.Providers[i]
+		at := fmt.Sprintf("providers[%d]", i)
+
+		check(namePattern.MatchString(p.Name), at+".name", "must be lowercase letters, digits, - or _, got %q", p.Name)
+		check(!seen[p.Name], at+".name", "%q is listed twice", p.Name)
+		seen[p.Name] = true
+		check(validIssuer(p.Issuer), at+".issuer", "must be an https url, got %q", p.Issuer)
+		check(p.ClientID != "", at+".client_id", "is required")
+		check(p.ClientSecret == "" || p.ClientSecretFile == "", at+".client_secret_file", "cannot be set along with client_secret")
+		if p.ClientSecretFile != "" {
+			secret, readErr := os.ReadFile(p.ClientSecretFile)
+			check(readErr == nil, at+".client_secret_file", "%v", readErr)
+			p.ClientSecret = strings.TrimSpace(string(secret))
+		}
+
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		check(slices.Contains(p.Scopes, "openid"), at+".scopes", "must include openid")
+		for j, domain := range p.AllowedDomains {
+			p.AllowedDomains[j] = strings.ToLower(domain)
+		}
+		check(len(p.AllowedDomains) == 0 || p.Provision, at+".allowed_domains", "only applies when provision is true")
+	}
+	return file.Providers, errors.Join(errs...)
+}
+
+// validIssuer accepts https urls, and http ones on a loopback address for
+// local development.
+func validIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || net.ParseIP(host).IsLoopback()
+	}
+	return false
+}
+
+// Claims are the claims of an id token the api reads.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	PreferredUsername string   `json:"preferred_username"`
+	PhoneNumber       string   `json:"phone_number"`
+}
+
+// Valid lets the jwt parser accept the claims, Provider.verify checks them
+// with some leeway for clock skew.
+func (Claims) Valid() error {
+	return nil
+}
+
+// audience is a single string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
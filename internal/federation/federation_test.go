@@ -0,0 +1,483 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/services"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const testClientID = "go-manage"
+
+// mockProvider is a local openid connect provider. It approves every
+// authorization request and signs id tokens with claims on top of the
+// defaults.
+type mockProvider struct {
+	*httptest.Server
+	t *testing.T
+
+	mu         sync.Mutex
+	key        *rsa.PrivateKey
+	kid        string
+	claims     jwt.MapClaims
+	pending    map[string]url.Values
+	keyFetches int
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	m := &mockProvider{t: t, key: newKey(t), kid: "key-1", pending: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.keyFetches++
+		pub := m.key.PublicKey
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": m.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// approve plays the user signing in at the provider and returns the code
+// sent back to the callback.
+func (m *mockProvider) approve(authURL string) string {
+	u, err := url.Parse(authURL)
+	if !assert.NoError(m.t, err) {
+		m.t.FailNow()
+	}
+	query := u.Query()
+	assert.Equal(m.t, testClientID, query.Get("client_id"))
+	assert.Equal(m.t, "S256", query.Get("code_challenge_method"))
+
+	code := "code-" + query.Get("state")
+	m.mu.Lock()
+	m.pending[code] = query
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != "secret" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	auth, found := m.pending[r.PostFormValue("code")]
+	delete(m.pending, r.PostFormValue("code"))
+	if !found || auth.Get("redirect_uri") != r.PostFormValue("redirect_uri") ||
+		challenge(r.PostFormValue("code_verifier")) != auth.Get("code_challenge") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.URL,
+		"sub":   "external-1",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": auth.Get("nonce"),
+	}
+	for name, value := range m.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+type fakeIdentities struct {
+	identities map[string]models.FederatedIdentity
+}
+
+func (f *fakeIdentities) FindIdentity(ctx context.Context, issuer, subject string) (models.FederatedIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return models.FederatedIdentity{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeIdentities) CreateIdentity(ctx context.Context, identity models.FederatedIdentity) error {
+	f.identities[identity.ID] = identity
+	return nil
+}
+
+func (f *fakeIdentities) TouchIdentity(ctx context.Context, id string, at time.Time) error {
+	identity := f.identities[id]
+	identity.LastLoginAt = at
+	f.identities[id] = identity
+	return nil
+}
+
+func (f *fakeIdentities) DeleteIdentity(ctx context.Context, id string) error {
+	if _, ok := f.identities[id]; !ok {
+		return config.ErrNoRowsAffected
+	}
+	delete(f.identities, id)
+	return nil
+}
+
+// fakeUsers keeps users by id.
+type fakeUsers struct {
+	services.UserServices
+	users map[string]models.User
+}
+
+func (u *fakeUsers) SearchUserByID(ctx context.Context, id string) (models.User, error) {
+	user, ok := u.users[id]
+	if !ok {
+		return models.User{}, config.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (u *fakeUsers) SearchUserByEmail(ctx context.Context, email string) (models.User, error) {
+	for _, user := range u.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return models.User{}, config.ErrUserNotFound
+}
+
+func (u *fakeUsers) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	user.ID = "new-" + user.Username
+	user.Role = models.RoleUser
+	u.users[user.ID] = user
+	return user, nil
+}
+
+func testService(t *testing.T, m *mockProvider, cfg ProviderConfig) (*Service, *fakeIdentities, *fakeUsers) {
+	cfg.Name = "mock"
+	cfg.Issuer = m.URL
+	cfg.ClientID = testClientID
+	cfg.ClientSecret = "secret"
+	cfg.Scopes = []string{"openid", "email", "profile"}
+
+	identities := &fakeIdentities{identities: map[string]models.FederatedIdentity{}}
+	users := &fakeUsers{users: map[string]models.User{
+		"1": {ID: "1", Name: "John", Surname: "Doe", Username: "johndoe", Email: "john@example.com", Phone: "123456"},
+		"2": {ID: "2", Name: "Root", Surname: "Admin", Username: "root", Email: "root@example.com", Phone: "654321", Role: models.RoleAdmin},
+	}}
+	fedCfg := config.FederationConfig{PublicURL: "https://api.example.com/api/v1", StateTTL: time.Minute, HTTPTimeout: 5 * time.Second}
+	return NewService([]ProviderConfig{cfg}, identities, users, fedCfg), identities, users
+}
+
+// login runs the whole redirect flow against the mock provider.
+func login(t *testing.T, s *Service, m *mockProvider) (models.User, error) {
+	ctx := context.Background()
+	authURL, state, err := s.Begin(ctx, "mock")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.True(t, strings.HasPrefix(authURL, m.URL+"/authorize?"))
+
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, "https://api.example.com/api/v1/login/mock/callback", u.Query().Get("redirect_uri"))
+	code := m.approve(authURL)
+	return s.Complete(ctx, "mock", Callback{Code: code, State: u.Query().Get("state")}, state)
+}
+
+func TestLoginExistingIdentity(t *testing.T) {
+	m := newMockProvider(t)
+	s, identities, _ := testService(t, m, ProviderConfig{})
+	identities.identities["link-1"] = models.FederatedIdentity{ID: "link-1", Issuer: m.URL, Subject: "external-1", UserID: "1"}
+
+	user, err := login(t, s, m)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "johndoe", user.Username)
+	assert.False(t, identities.identities["link-1"].LastLoginAt.IsZero())
+}
+
+func TestLoginLinksAndProvisions(t *testing.T) {
+	test := []struct {
+		Name             string
+		Provider         ProviderConfig
+		Claims           jwt.MapClaims
+		ExpectedUsername string
+		ExpectedErr      error
+	}{
+		{
+			Name:             "Links Verified Email",
+			Provider:         ProviderConfig{LinkByEmail: true},
+			Claims:           jwt.MapClaims{"email": "JOHN@example.com", "email_verified": true},
+			ExpectedUsername: "johndoe",
+		},
+		{
+			Name:        "Unverified Email Is Not Linked",
+			Provider:    ProviderConfig{LinkByEmail: true},
+			Claims:      jwt.MapClaims{"email": "john@example.com", "email_verified": false},
+			ExpectedErr: config.ErrIdentityNotLinked,
+		},
+		{
+			Name:        "Admin Email Is Not Linked",
+			Provider:    ProviderConfig{LinkByEmail: true, Provision: true},
+			Claims:      jwt.MapClaims{"email": "root@example.com", "email_verified": true},
+			ExpectedErr: config.ErrIdentityNotLinked,
+		},
+		{
+			Name:     "Provisions",
+			Provider: ProviderConfig{Provision: true, AllowedDomains: []string{"example.org"}},
+			Claims: jwt.MapClaims{
+				"email": "jane@example.org", "email_verified": true, "name": "Jane Roe",
+				"phone_number": "+5491100000000",
+			},
+			ExpectedUsername: "jane",
+		},
+		{
+			Name:     "Domain Not Allowed",
+			Provider: ProviderConfig{Provision: true, AllowedDomains: []string{"example.org"}},
+			Claims: jwt.MapClaims{
+				"email": "jane@example.net", "email_verified": true, "name": "Jane Roe",
+				"phone_number": "+5491100000000",
+			},
+			ExpectedErr: config.ErrDomainNotAllowed,
+		},
+		{
+			Name:        "Missing Claims",
+			Provider:    ProviderConfig{Provision: true},
+			Claims:      jwt.MapClaims{"email": "jane@example.org", "email_verified": true, "name": "Jane Roe"},
+			ExpectedErr: config.ErrMissingClaims,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = tt.Claims
+			s, identities, _ := testService(t, m, tt.Provider)
+
+			user, err := login(t, s, m)
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			assert.Equal(t, tt.ExpectedUsername, user.Username)
+			if tt.ExpectedErr == nil {
+				// the next login finds the identity
+				identity, findErr := identities.FindIdentity(context.Background(), m.URL, "external-1")
+				assert.NoError(t, findErr)
+				assert.Equal(t, user.ID, identity.UserID)
+				assert.Equal(t, "mock", identity.Provider)
+			} else {
+				assert.Empty(t, identities.identities)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsIDToken(t *testing.T) {
+	test := []struct {
+		Name   string
+		Claims jwt.MapClaims
+	}{
+		{Name: "Wrong Nonce", Claims: jwt.MapClaims{"nonce": "replayed"}},
+		{Name: "Wrong Audience", Claims: jwt.MapClaims{"aud": "other-client"}},
+		{Name: "Foreign Authorized Party", Claims: jwt.MapClaims{"aud": []string{testClientID, "other-client"}, "azp": "other-client"}},
+		{Name: "Wrong Issuer", Claims: jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{Name: "Expired", Claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{Name: "Issued In The Future", Claims: jwt.MapClaims{"iat": time.Now().Add(time.Hour).Unix()}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = tt.Claims
+			s, identities, _ := testService(t, m, ProviderConfig{})
+			identities.identities["link-1"] = models.FederatedIdentity{ID: "link-1", Issuer: m.URL, Subject: "external-1", UserID: "1"}
+
+			_, err := login(t, s, m)
+
+			assert.ErrorIs(t, err, config.ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestLoginKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	s, identities, _ := testService(t, m, ProviderConfig{})
+	identities.identities["link-1"] = models.FederatedIdentity{ID: "link-1", Issuer: m.URL, Subject: "external-1", UserID: "1"}
+
+	_, err := login(t, s, m)
+	assert.NoError(t, err)
+
+	// a key signing under a known id is not trusted
+	m.key = newKey(t)
+	_, err = login(t, s, m)
+	assert.ErrorIs(t, err, config.ErrInvalidIDToken)
+
+	// a new key id refetches the key set, once a minute at most
+	m.kid = "key-2"
+	s.providers["mock"].fetchedAt = time.Now().Add(-2 * refetchInterval)
+	_, err = login(t, s, m)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.keyFetches)
+
+	m.kid = "key-3"
+	_, err = login(t, s, m)
+	assert.ErrorIs(t, err, config.ErrInvalidIDToken)
+	assert.Equal(t, 2, m.keyFetches)
+}
+
+func TestLoginState(t *testing.T) {
+	m := newMockProvider(t)
+	s, identities, _ := testService(t, m, ProviderConfig{})
+	identities.identities["link-1"] = models.FederatedIdentity{ID: "link-1", Issuer: m.URL, Subject: "external-1", UserID: "1"}
+	ctx := context.Background()
+
+	authURL, state, err := s.Begin(ctx, "mock")
+	assert.NoError(t, err)
+	code := m.approve(authURL)
+
+	test := []struct {
+		Name        string
+		Callback    Callback
+		State       string
+		ExpectedErr error
+	}{
+		{Name: "Missing Cookie", Callback: Callback{Code: code, State: "x"}, ExpectedErr: config.ErrLoginState},
+		{Name: "Mismatch", Callback: Callback{Code: code, State: "forged"}, State: state, ExpectedErr: config.ErrLoginState},
+		{Name: "Tampered", Callback: Callback{Code: code, State: "x"}, State: state + "x", ExpectedErr: config.ErrLoginState},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, completeErr := s.Complete(ctx, "mock", tt.Callback, tt.State)
+			assert.ErrorIs(t, completeErr, tt.ExpectedErr)
+		})
+	}
+
+	u, _ := url.Parse(authURL)
+	_, err = s.Complete(ctx, "mock", Callback{Error: "access_denied", State: u.Query().Get("state")}, state)
+	assert.ErrorIs(t, err, config.ErrLoginRejected)
+
+	_, err = s.Complete(ctx, "other", Callback{Code: code}, state)
+	assert.ErrorIs(t, err, config.ErrUnknownProvider)
+}
+
+func TestLoginStaleIdentity(t *testing.T) {
+	m := newMockProvider(t)
+	m.claims = jwt.MapClaims{"email": "john@example.com", "email_verified": true}
+	s, identities, _ := testService(t, m, ProviderConfig{LinkByEmail: true})
+	identities.identities["stale"] = models.FederatedIdentity{ID: "stale", Issuer: m.URL, Subject: "external-1", UserID: "deleted"}
+
+	user, err := login(t, s, m)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+	assert.NotContains(t, identities.identities, "stale")
+	assert.Len(t, identities.identities, 1)
+}
+
+func TestLoginDisabledUser(t *testing.T) {
+	m := newMockProvider(t)
+	s, identities, users := testService(t, m, ProviderConfig{})
+	identities.identities["link-1"] = models.FederatedIdentity{ID: "link-1", Issuer: m.URL, Subject: "external-1", UserID: "1"}
+	disabled := users.users["1"]
+	disabled.Disabled = true
+	users.users["1"] = disabled
+
+	_, err := login(t, s, m)
+
+	assert.ErrorIs(t, err, config.ErrUserDisabled)
+}
+
+func TestLoadProviders(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("s3cret\n"), 0o600))
+
+	test := []struct {
+		Name        string
+		File        string
+		ExpectedErr string
+	}{
+		{
+			Name: "Valid",
+			File: "providers:\n  - name: corp\n    issuer: https://id.example.com\n    client_id: app\n    client_secret_file: " + secretFile +
+				"\n    provision: true\n    allowed_domains: [Example.com]\n",
+		},
+		{Name: "Empty", File: "", ExpectedErr: "lists no provider"},
+		{Name: "Unknown Key", File: "providers:\n  - name: corp\n    tenant: x\n", ExpectedErr: "field tenant not found"},
+		{
+			Name:        "Invalid Entries",
+			File:        "providers:\n  - name: Corp\n    issuer: http://id.example.com\n  - name: corp2\n    issuer: https://id.example.com\n    client_id: app\n    scopes: [email]\n",
+			ExpectedErr: "providers[0].name",
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.Name, " ", "_")+".yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.File), 0o600))
+
+			providers, err := LoadProviders(path)
+
+			if tt.ExpectedErr != "" {
+				assert.ErrorContains(t, err, tt.ExpectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "s3cret", providers[0].ClientSecret)
+			assert.Equal(t, []string{"openid", "email", "profile"}, providers[0].Scopes)
+			assert.Equal(t, []string{"example.com"}, providers[0].AllowedDomains)
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package federation
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// clockSkew is the leeway given to the exp and iat claims
+	clockSkew = time.Minute
+	// refetchInterval limits how often an unknown key id refetches the key set
+	refetchInterval = time.Minute
+)
+
+// metadata is the part of the discovery document the api uses.
+type metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider talks to one identity provider. The discovery document and the
+// signing keys are fetched on first use and cached.
+type Provider struct {
+	ProviderConfig
+	client *http.Client
+
+	metaMu sync.Mutex
+	meta   *metadata
+
+	keysMu    sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newProvider(cfg ProviderConfig, client *http.Client) *Provider {
+	return &Provider{ProviderConfig: cfg, client: client}
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.metaMu.Lock()
+	defer p.metaMu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var meta metadata
+	if err := p.get(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, err
+	}
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: discovery document is for issuer %q", config.ErrProviderFailed, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document lacks an endpoint", config.ErrProviderFailed)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the signing key with id kid, refetching the key set once in
+// a while when the provider rotated its keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.fetchedAt) < refetchInterval {
+		return nil, fmt.Errorf("%w: unknown signing key %q", config.ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.get(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		if key, ok := rsaKey(k); ok {
+			keys[k.Kid] = key
+		}
+	}
+	p.keys, p.fetchedAt = keys, time.Now()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", config.ErrInvalidIDToken, kid)
+}
+
+// lookup finds kid in the cached keys, a token without kid matches the only
+// key of a single key set.
+func (p *Provider) lookup(kid string) (*rsa.PublicKey, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, bool) {
+	n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+	e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+	if nErr != nil || eErr != nil || len(e) == 0 || len(e) > 4 {
+		return nil, false
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, true
+}
+
+// authorizationURL sends the user to the provider with PKCE and a nonce.
+func (p *Provider) authorizationURL(ctx context.Context, redirectURI, state, nonce, challenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// exchange redeems code for the raw id token.
+func (p *Provider) exchange(ctx context.Context, code, redirectURI, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	// client_secret_basic is the default, some providers only take the post form
+	postSecret := p.ClientSecret != "" && len(meta.TokenEndpointAuthMethodsSupported) > 0 &&
+		!slices.Contains(meta.TokenEndpointAuthMethodsSupported, "client_secret_basic") &&
+		slices.Contains(meta.TokenEndpointAuthMethodsSupported, "client_secret_post")
+	if p.ClientSecret == "" || postSecret {
+		form.Set("client_id", p.ClientID)
+	}
+	if postSecret {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if reqErr != nil {
+		return "", fmt.Errorf("%w: %v", config.ErrProviderFailed, reqErr)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" && !postSecret {
+		// RFC 6749 form-encodes both before building the header
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, doErr := p.client.Do(req)
+	if doErr != nil {
+		return "", fmt.Errorf("%w: %v", config.ErrProviderFailed, doErr)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("%w: token response: %v", config.ErrProviderFailed, err)
+	}
+	switch {
+	case token.Error != "":
+		// a bad or replayed code is the user's login failing, not the provider
+		return "", fmt.Errorf("%w: %s %s", config.ErrLoginRejected, token.Error, token.ErrorDescription)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%w: token endpoint answered %d", config.ErrProviderFailed, resp.StatusCode)
+	case token.IDToken == "":
+		return "", fmt.Errorf("%w: token response has no id token", config.ErrProviderFailed)
+	}
+	return token.IDToken, nil
+}
+
+// verify checks the signature and the claims of an id token.
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (Claims, error) {
+	var claims Claims
+	var keyErr error
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512"}, SkipClaimsValidation: true}
+	_, parseErr := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		keyErr = err
+		return key, err
+	})
+	if keyErr != nil && errors.Is(keyErr, config.ErrProviderFailed) {
+		return Claims{}, keyErr
+	}
+	if parseErr != nil {
+		return Claims{}, fmt.Errorf("%w: %v", config.ErrInvalidIDToken, parseErr)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.Issuer:
+		return Claims{}, fmt.Errorf("%w: issued by %q", config.ErrInvalidIDToken, claims.Issuer)
+	case claims.Subject == "":
+		return Claims{}, fmt.Errorf("%w: no subject", config.ErrInvalidIDToken)
+	case !slices.Contains(claims.Audience, p.ClientID):
+		return Claims{}, fmt.Errorf("%w: not issued for this client", config.ErrInvalidIDToken)
+	case (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.ClientID:
+		return Claims{}, fmt.Errorf("%w: authorized party is %q", config.ErrInvalidIDToken, claims.AuthorizedParty)
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return Claims{}, fmt.Errorf("%w: expired", config.ErrInvalidIDToken)
+	case claims.IssuedAt == 0 || time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)):
+		return Claims{}, fmt.Errorf("%w: issued in the future", config.ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return Claims{}, fmt.Errorf("%w: nonce does not match", config.ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func (p *Provider) get(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", config.ErrProviderFailed, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", config.ErrProviderFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %d", config.ErrProviderFailed, target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", config.ErrProviderFailed, target, err)
+	}
+	return nil
+}
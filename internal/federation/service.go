@@ -0,0 +1,312 @@
+package federation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/models"
+	pwd "go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"go-manage-mysql/internal/utils/validator"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// login results, as counted by metrics.FederatedLogins
+const (
+	resultExisting    = "existing"
+	resultLinked      = "linked"
+	resultProvisioned = "provisioned"
+	resultFailed      = "failed"
+)
+
+// Callback is what the provider sends back to the callback url.
+type Callback struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// stateClaims travel in the state cookie between Begin and Complete.
+type stateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// Service logs users in through external openid connect providers, linking
+// each external identity to a user of the api.
+type Service struct {
+	providers  map[string]*Provider
+	names      []string
+	identities repository.IdentityRepository
+	users      services.UserServices
+	cfg        config.FederationConfig
+}
+
+func NewService(providers []ProviderConfig, identities repository.IdentityRepository, users services.UserServices, cfg config.FederationConfig) *Service {
+	client := &http.Client{Timeout: cfg.HTTPTimeout, Transport: tracing.Transport{}}
+	s := &Service{
+		providers:  map[string]*Provider{},
+		identities: identities,
+		users:      users,
+		cfg:        cfg,
+	}
+	for _, p := range providers {
+		s.providers[p.Name] = newProvider(p, client)
+		s.names = append(s.names, p.Name)
+	}
+	return s
+}
+
+// Providers lists the provider names in the order of the providers file.
+func (s *Service) Providers() []string {
+	return s.names
+}
+
+// CallbackURL is the redirect uri to register at the provider.
+func (s *Service) CallbackURL(name string) string {
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/login/" + name + "/callback"
+}
+
+// StateTTL is how long a login can take at the provider.
+func (s *Service) StateTTL() time.Duration {
+	return s.cfg.StateTTL
+}
+
+// Begin returns the url sending the user to the provider and the state token
+// the callback must present.
+func (s *Service) Begin(ctx context.Context, name string) (authURL, stateToken string, err error) {
+	ctx, span := tracing.Start(ctx, "federation.Begin", attribute.String("provider", name))
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", "", config.ErrUnknownProvider
+	}
+
+	claims := stateClaims{Provider: name}
+	for _, field := range []*string{&claims.State, &claims.Nonce, &claims.Verifier} {
+		if *field, err = random(); err != nil {
+			return "", "", err
+		}
+	}
+	claims.ExpiresAt = time.Now().Add(s.cfg.StateTTL).Unix()
+
+	authURL, err = provider.authorizationURL(ctx, s.CallbackURL(name), claims.State, claims.Nonce, challenge(claims.Verifier))
+	if err != nil {
+		return "", "", err
+	}
+	stateToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stateKey())
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+// Complete finishes the login the provider answered with callback and
+// returns the user it resolves to.
+func (s *Service) Complete(ctx context.Context, name string, callback Callback, stateToken string) (user models.User, err error) {
+	ctx, span := tracing.Start(ctx, "federation.Complete", attribute.String("provider", name))
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.providers[name]
+	if !ok {
+		return models.User{}, config.ErrUnknownProvider
+	}
+	result := resultFailed
+	defer func() { metrics.FederatedLogins.WithLabelValues(name, result).Inc() }()
+
+	state, err := s.checkState(name, callback.State, stateToken)
+	if err != nil {
+		return models.User{}, err
+	}
+	if callback.Error != "" {
+		return models.User{}, fmt.Errorf("%w: %s %s", config.ErrLoginRejected, callback.Error, callback.ErrorDescription)
+	}
+	if callback.Code == "" {
+		return models.User{}, fmt.Errorf("%w: no authorization code", config.ErrLoginRejected)
+	}
+
+	raw, err := provider.exchange(ctx, callback.Code, s.CallbackURL(name), state.Verifier)
+	if err != nil {
+		return models.User{}, err
+	}
+	claims, err := provider.verify(ctx, raw, state.Nonce)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, result, err = s.resolve(ctx, provider, claims)
+	if err != nil {
+		result = resultFailed
+		return models.User{}, err
+	}
+	if user.Disabled {
+		result = resultFailed
+		return models.User{}, config.ErrUserDisabled
+	}
+	return user, nil
+}
+
+// resolve finds the user linked to the identity of claims, linking or
+// creating one as the provider allows.
+func (s *Service) resolve(ctx context.Context, provider *Provider, claims Claims) (models.User, string, error) {
+	identity, findErr := s.identities.FindIdentity(ctx, claims.Issuer, claims.Subject)
+	switch {
+	case findErr == nil:
+		user, searchErr := s.users.SearchUserByID(ctx, identity.UserID)
+		if searchErr == nil {
+			if err := s.identities.TouchIdentity(ctx, identity.ID, time.Now()); err != nil {
+				return models.User{}, "", apperror.AppError(config.ErrFederatedLogin, err)
+			}
+			return user, resultExisting, nil
+		}
+		if !errors.Is(searchErr, config.ErrUserNotFound) {
+			return models.User{}, "", searchErr
+		}
+		// the user was deleted, the identity is free to link again
+		if err := s.identities.DeleteIdentity(ctx, identity.ID); err != nil && !errors.Is(err, config.ErrNoRowsAffected) {
+			return models.User{}, "", apperror.AppError(config.ErrFederatedLogin, err)
+		}
+	case !errors.Is(findErr, gorm.ErrRecordNotFound):
+		return models.User{}, "", apperror.AppError(config.ErrFederatedLogin, findErr)
+	}
+
+	user, result, err := s.match(ctx, provider, claims)
+	if err != nil {
+		return models.User{}, "", err
+	}
+	now := time.Now()
+	identity = models.FederatedIdentity{
+		ID:          uuid.NewString(),
+		Issuer:      claims.Issuer,
+		Subject:     claims.Subject,
+		Provider:    provider.Name,
+		UserID:      user.ID,
+		Email:       claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	if err := s.identities.CreateIdentity(ctx, identity); err != nil {
+		return models.User{}, "", apperror.AppError(config.ErrFederatedLogin, err)
+	}
+	return user, result, nil
+}
+
+// match links the identity to the user holding its verified email or
+// provisions a new user for it. Admins are never linked by email, a provider
+// that lets anyone claim their address would hand over the api.
+func (s *Service) match(ctx context.Context, provider *Provider, claims Claims) (models.User, string, error) {
+	if provider.LinkByEmail && claims.EmailVerified && claims.Email != "" {
+		user, searchErr := s.users.SearchUserByEmail(ctx, claims.Email)
+		if searchErr == nil {
+			if user.Role == models.RoleAdmin {
+				return models.User{}, "", config.ErrIdentityNotLinked
+			}
+			return user, resultLinked, nil
+		}
+		if !errors.Is(searchErr, config.ErrUserNotFound) {
+			return models.User{}, "", searchErr
+		}
+	}
+
+	if !provider.Provision {
+		return models.User{}, "", config.ErrIdentityNotLinked
+	}
+	if !provider.allows(claims.Email, claims.EmailVerified) {
+		return models.User{}, "", config.ErrDomainNotAllowed
+	}
+
+	user := newUser(claims)
+	if validate := validator.ValidateData(user, config.SCIM_ValidateFields); validate != nil {
+		return models.User{}, "", fmt.Errorf("%w: %v", config.ErrMissingClaims, validate)
+	}
+	// the user logs in through the provider, a password nobody knows keeps
+	// direct logins closed until it is reset
+	generated, generateErr := pwd.Generate()
+	if generateErr != nil {
+		return models.User{}, "", generateErr
+	}
+	user.Password = generated
+
+	created, createErr := s.users.CreateUser(ctx, user)
+	if createErr != nil {
+		return models.User{}, "", createErr
+	}
+	return created, resultProvisioned, nil
+}
+
+// newUser fills a user from the claims of the id token.
+func newUser(claims Claims) models.User {
+	name, surname := claims.GivenName, claims.FamilyName
+	if name == "" && surname == "" {
+		name, surname, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	username := claims.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return models.User{
+		Name:     strings.TrimSpace(name),
+		Surname:  strings.TrimSpace(surname),
+		Username: username,
+		Email:    claims.Email,
+		Phone:    claims.PhoneNumber,
+	}
+}
+
+func (s *Service) checkState(name, state, stateToken string) (stateClaims, error) {
+	var claims stateClaims
+	token, parseErr := jwt.ParseWithClaims(stateToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return stateKey(), nil
+	})
+	if parseErr != nil || !token.Valid || token.Method != jwt.SigningMethodHS256 {
+		return stateClaims{}, config.ErrLoginState
+	}
+	if claims.Provider != name || subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return stateClaims{}, config.ErrLoginState
+	}
+	return claims, nil
+}
+
+// stateKey signs the state tokens. It is derived from the api token key so
+// a state token is never accepted as an access token.
+func stateKey() []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetToken()))
+	mac.Write([]byte("federation state"))
+	return mac.Sum(nil)
+}
+
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge is the S256 PKCE challenge of verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/apikey"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/utils/web"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler lets users manage their own api keys and admins the keys of
+// any user, such as service accounts.
+type APIKeyHandler struct {
+	Service *apikey.Service
+}
+
+func NewAPIKeyHandler(service *apikey.Service) *APIKeyHandler {
+	return &APIKeyHandler{Service: service}
+}
+
+type keyRequest struct {
+	apikey.Request
+	// Username owns the key, admins only
+	Username string `json:"username"`
+}
+
+type createdKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+func (h *APIKeyHandler) CreateOwnKeyHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var request apikey.Request
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidBody)
+		return
+	}
+	h.create(ctx, middleware.Username(ctx), request)
+}
+
+func (h *APIKeyHandler) ListOwnKeysHandler(ctx *gin.Context) {
+	h.list(ctx, middleware.Username(ctx))
+}
+
+func (h *APIKeyHandler) RevokeOwnKeyHandler(ctx *gin.Context) {
+	h.revoke(ctx, middleware.Username(ctx))
+}
+
+func (h *APIKeyHandler) CreateKeyHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var request keyRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || request.Username == "" {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidBody)
+		return
+	}
+	h.create(ctx, request.Username, request.Request)
+}
+
+func (h *APIKeyHandler) ListKeysHandler(ctx *gin.Context) {
+	h.list(ctx, ctx.Query("username"))
+}
+
+func (h *APIKeyHandler) RevokeKeyHandler(ctx *gin.Context) {
+	h.revoke(ctx, "")
+}
+
+func (h *APIKeyHandler) create(ctx *gin.Context, username string, request apikey.Request) {
+	key, secret, createErr := h.Service.Create(ctx, username, request, middleware.Username(ctx))
+	if createErr != nil {
+		web.NewError(ctx, keyStatus(createErr), createErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusCreated, usersResponse(config.CreateKeyMessage, http.StatusCreated, createdKey{APIKey: key, Key: secret}))
+}
+
+func (h *APIKeyHandler) list(ctx *gin.Context, username string) {
+	ctx.Header("Content-Type", "application/json")
+
+	keys, listErr := h.Service.List(ctx, username)
+	if listErr != nil {
+		web.NewError(ctx, keyStatus(listErr), listErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.ListKeysMessage, http.StatusOK, keys))
+}
+
+// revoke only finds the keys of username, other users' keys look missing.
+func (h *APIKeyHandler) revoke(ctx *gin.Context, username string) {
+	ctx.Header("Content-Type", "application/json")
+
+	if revokeErr := h.Service.Revoke(ctx, ctx.Param("id"), username); revokeErr != nil {
+		web.NewError(ctx, keyStatus(revokeErr), revokeErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.RevokeKeyMessage, http.StatusOK, nil))
+}
+
+func keyStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrInvalidKeyRequest), errors.Is(err, config.ErrInvalidScope), errors.Is(err, config.ErrInvalidExpiry):
+		return http.StatusBadRequest
+	case errors.Is(err, config.ErrAPIKeyNotFound), errors.Is(err, config.ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
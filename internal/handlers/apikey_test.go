@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/apikey"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestAPIKeyHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	users := services.NewUserServices(repository.NewUserRepository(gormDB))
+	keys := apikey.NewService(repository.NewAPIKeyRepository(gormDB), users, config.APIKeysConfig{DefaultTTL: time.Hour, MaxTTL: 2 * time.Hour})
+	handler := NewAPIKeyHandler(keys)
+
+	r := gin.New()
+	r.POST("/admin/api-keys", handler.CreateKeyHandler)
+	r.GET("/admin/api-keys", handler.ListKeysHandler)
+	r.DELETE("/admin/api-keys/:id", handler.RevokeKeyHandler)
+
+	test := []struct {
+		Name         string
+		Method       string
+		Path         string
+		Body         string
+		ExpectedCode int
+		MockAct      func()
+	}{
+		{
+			Name:         "Create Without Owner",
+			Method:       http.MethodPost,
+			Path:         "/admin/api-keys",
+			Body:         `{"name":"reports","scopes":["jobs"]}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Create Unknown Scope",
+			Method:       http.MethodPost,
+			Path:         "/admin/api-keys",
+			Body:         `{"username":"svc","name":"reports","scopes":["everything"]}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Create Unknown Owner",
+			Method:       http.MethodPost,
+			Path:         "/admin/api-keys",
+			Body:         `{"username":"svc","name":"reports","scopes":["jobs"]}`,
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("svc", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:         "List By Owner",
+			Method:       http.MethodGet,
+			Path:         "/admin/api-keys?username=svc",
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.ListAPIKeysTestQuery).WithArgs("svc").WillReturnRows(sqlmock.NewRows([]string{"id", "scopes"}).AddRow("key-1", []byte(`["jobs"]`)))
+			},
+		},
+		{
+			Name:         "Revoke",
+			Method:       http.MethodDelete,
+			Path:         "/admin/api-keys/key-1",
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RevokeAPIKeyTestQuery).WithArgs(sqlmock.AnyArg(), "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(tt.Method, tt.Path, strings.NewReader(tt.Body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
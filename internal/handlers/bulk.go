@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) ImportUsersHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	format := ctx.Query("format")
+	if format == "" {
+		format = bulk.FormatOf(ctx.ContentType())
+	}
+	mode := ctx.DefaultQuery("mode", services.ImportInsert)
+	dryRun, dryRunErr := strconv.ParseBool(ctx.DefaultQuery("dry_run", "false"))
+	if dryRunErr != nil || (mode != services.ImportInsert && mode != services.ImportUpsert) {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidQueryParam)
+		return
+	}
+
+	cfg := config.Current().Bulk
+	liftDeadlines(ctx)
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, cfg.MaxImportBytes)
+
+	reader, readerErr := bulk.NewReader(format, body)
+	if readerErr != nil {
+		web.NewError(ctx, importStatus(readerErr), readerErr.Error())
+		return
+	}
+
+	report, importErr := h.Service.ImportUsers(ctx, reader, services.ImportOptions{
+		Mode:        mode,
+		DryRun:      dryRun,
+		BatchSize:   cfg.BatchSize,
+		HashWorkers: cfg.HashWorkers,
+	})
+	if importErr != nil {
+		web.NewError(ctx, importStatus(importErr), importErr.Error())
+		return
+	}
+
+	message := config.ImportUsersMessage
+	if dryRun {
+		message = config.DryRunMessage
+	}
+	ctx.JSON(http.StatusOK, usersResponse(message, http.StatusOK, report))
+}
+
+// importStatus is 413 past the body limit, any other read error is a
+// malformed input.
+func importStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func (h *Handler) ExportUsersHandler(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", bulk.FormatCSV)
+	filter, ok := exportFilter(ctx)
+	writer, writerErr := bulk.NewWriter(format, ctx.Writer)
+	if !ok || writerErr != nil {
+		ctx.Header("Content-Type", "application/json")
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidQueryParam)
+		return
+	}
+
+	liftDeadlines(ctx)
+	ctx.Header("Content-Type", bulk.ContentTypes[format])
+	ctx.Header("Content-Disposition", `attachment; filename="users.`+format+`"`)
+
+	// every batch is sent as soon as it is read
+	exportErr := h.Service.ExportUsers(ctx, filter, config.Current().Bulk.BatchSize, func(users []models.User) error {
+		for _, user := range users {
+			if err := writer.Write(user); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		ctx.Writer.Flush()
+		return nil
+	})
+	if exportErr == nil {
+		exportErr = writer.Flush()
+	}
+	if exportErr != nil {
+		if !ctx.Writer.Written() {
+			ctx.Header("Content-Type", "application/json")
+			ctx.Header("Content-Disposition", "")
+			web.NewError(ctx, http.StatusInternalServerError, exportErr.Error())
+			return
+		}
+		// the status is already sent, a cut stream is all the client can get
+		slog.ErrorContext(ctx, "export interrupted", "error", exportErr)
+		ctx.Abort()
+	}
+}
+
+func exportFilter(ctx *gin.Context) (repository.UserFilter, bool) {
+	filter := repository.UserFilter{
+		Role:           ctx.Query("role"),
+		UsernamePrefix: ctx.Query("username_prefix"),
+	}
+	if filter.Role != "" && filter.Role != models.RoleUser && filter.Role != models.RoleAdmin {
+		return repository.UserFilter{}, false
+	}
+	if raw := ctx.Query("disabled"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return repository.UserFilter{}, false
+		}
+		filter.Disabled = &disabled
+	}
+	return filter, true
+}
+
+// liftDeadlines lets a bulk transfer outlive the server read and write
+// timeouts, the import body is still bounded by its size.
+func liftDeadlines(ctx *gin.Context) {
+	controller := http.NewResponseController(ctx.Writer)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+}
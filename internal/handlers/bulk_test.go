@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func bulkRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	handler := NewUserHandler(services.NewUserServices(repository.NewUserRepository(gormDB)))
+	r := gin.New()
+	r.POST("/import", handler.ImportUsersHandler)
+	r.GET("/export", handler.ExportUsersHandler)
+	return r, mock
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	r, mock := bulkRouter(t)
+
+	cfg := config.Current()
+	cfg.Bulk.MaxImportBytes = 256
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+
+	csvBody := "username,name,surname,email,phone,password\n" +
+		"johndoe,John,Doe,john@example.com,111,Password1234\n" +
+		"bob,Bob,Doe,not-an-email,222,Password1234\n"
+
+	test := []struct {
+		Name            string
+		Query           string
+		ContentType     string
+		Body            string
+		ExpectedCode    int
+		ExpectedCreated int
+		ExpectedInvalid int
+		MockAct         func()
+	}{
+		{
+			Name:            "Success",
+			ContentType:     "text/csv",
+			Body:            csvBody,
+			ExpectedCode:    http.StatusOK,
+			ExpectedCreated: 1,
+			ExpectedInvalid: 1,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Dry Run",
+			Query:           "?format=csv&mode=upsert&dry_run=true",
+			Body:            csvBody,
+			ExpectedCode:    http.StatusOK,
+			ExpectedCreated: 1,
+			ExpectedInvalid: 1,
+			MockAct: func() {
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:         "Invalid Mode",
+			Query:        "?format=csv&mode=merge",
+			Body:         csvBody,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Unknown Format",
+			ContentType:  "application/json",
+			Body:         csvBody,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Bad Header",
+			Query:        "?format=csv",
+			Body:         "username,nickname\n",
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Too Large",
+			Query:        "?format=ndjson",
+			Body:         strings.Repeat(`{"username":"johndoe"}`+"\n", 20),
+			ExpectedCode: http.StatusRequestEntityTooLarge,
+			MockAct:      func() {},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(http.MethodPost, "/import"+tt.Query, bytes.NewBufferString(tt.Body))
+			req.Header.Set("Content-Type", tt.ContentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			if tt.ExpectedCode == http.StatusOK {
+				var response struct {
+					Data services.ImportReport `json:"data"`
+				}
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.ExpectedCreated, response.Data.Created)
+				assert.Equal(t, tt.ExpectedInvalid, response.Data.Invalid)
+			}
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestExportUsersHandler(t *testing.T) {
+	r, mock := bulkRouter(t)
+
+	test := []struct {
+		Name                string
+		Query               string
+		ExpectedCode        int
+		ExpectedContentType string
+		ExpectedBody        string
+		MockAct             func()
+	}{
+		{
+			Name:                "CSV",
+			Query:               "?role=user&disabled=false",
+			ExpectedCode:        http.StatusOK,
+			ExpectedContentType: "text/csv",
+			ExpectedBody: "id,username,name,surname,email,phone,role,disabled,must_change_password\n" +
+				"1,johndoe,John,Doe,john@example.com,111,user,false,false\n",
+			MockAct: func() {
+				mock.ExpectQuery(config.ExportTestQuery).
+					WithArgs("user", false, 500).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "name", "surname", "email", "phone", "password", "role"}).
+						AddRow("1", "johndoe", "John", "Doe", "john@example.com", "111", "hash", "user"))
+			},
+		},
+		{
+			Name:                "NDJSON Empty",
+			Query:               "?format=ndjson",
+			ExpectedCode:        http.StatusOK,
+			ExpectedContentType: "application/x-ndjson",
+			ExpectedBody:        "",
+			MockAct: func() {
+				mock.ExpectQuery(config.ExportTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:                "Invalid Filter",
+			Query:               "?disabled=maybe",
+			ExpectedCode:        http.StatusBadRequest,
+			ExpectedContentType: "application/json",
+			MockAct:             func() {},
+		},
+		{
+			Name:                "Unknown Format",
+			Query:               "?format=xml",
+			ExpectedCode:        http.StatusBadRequest,
+			ExpectedContentType: "application/json",
+			MockAct:             func() {},
+		},
+		{
+			Name:                "Database Error",
+			ExpectedCode:        http.StatusInternalServerError,
+			ExpectedContentType: "application/json",
+			MockAct: func() {
+				mock.ExpectQuery(config.ExportTestQuery).WillReturnError(config.ErrDbError)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(http.MethodGet, "/export"+tt.Query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			assert.Equal(t, tt.ExpectedContentType, w.Header().Get("Content-Type"))
+			if tt.ExpectedCode == http.StatusOK {
+				assert.Equal(t, tt.ExpectedBody, w.Body.String())
+			}
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
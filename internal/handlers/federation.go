@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/federation"
+	"go-manage-mysql/internal/session"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// FederationHandler logs users in through external identity providers.
+// Service is nil while no provider is configured.
+type FederationHandler struct {
+	Service *federation.Service
+	// Sessions, when set, records a session for every login
+	Sessions *session.Service
+}
+
+func NewFederationHandler(service *federation.Service) *FederationHandler {
+	return &FederationHandler{Service: service}
+}
+
+// RequireEnabled answers 404 while no identity provider is configured.
+func (h *FederationHandler) RequireEnabled(ctx *gin.Context) {
+	if h.Service == nil {
+		web.NewError(ctx, http.StatusNotFound, "federated login is not enabled")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+func (h *FederationHandler) ProvidersHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+	ctx.JSON(http.StatusOK, usersResponse(config.ListProvidersMessage, http.StatusOK, h.Service.Providers()))
+}
+
+// BeginHandler sends the user to the provider, the state of the login waits
+// in a cookie scoped to the callback.
+func (h *FederationHandler) BeginHandler(ctx *gin.Context) {
+	name := ctx.Param("provider")
+	authURL, state, beginErr := h.Service.Begin(ctx, name)
+	if beginErr != nil {
+		h.fail(ctx, beginErr)
+		return
+	}
+
+	h.setState(ctx, name, state, int(h.Service.StateTTL().Seconds()))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+// CallbackHandler finishes the login and answers with an api token, like
+// LoginUserHandler does.
+func (h *FederationHandler) CallbackHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+
+	name := ctx.Param("provider")
+	var callback federation.Callback
+	_ = ctx.ShouldBindWith(&callback, binding.Query)
+
+	state, _ := ctx.Cookie(federation.StateCookie)
+	// the state is good for a single try
+	h.setState(ctx, name, "", -1)
+
+	user, completeErr := h.Service.Complete(ctx, name, callback, state)
+	if completeErr != nil {
+		h.fail(ctx, completeErr)
+		return
+	}
+
+	// a pending password change holds here too, an admin may have expired
+	// the password of an account they no longer trust
+	tokenString, err := issueToken(ctx, h.Sessions, user)
+	if err != nil {
+		web.NewError(ctx, http.StatusInternalServerError, "error generating token")
+		return
+	}
+
+	message := "WELCOME " + user.Username
+	if user.MustChangePassword {
+		message += ". " + config.PasswordChangeMessage
+	}
+	ctx.JSON(http.StatusOK, usersResponse(message, http.StatusOK, tokenString))
+}
+
+func (h *FederationHandler) setState(ctx *gin.Context, name, value string, maxAge int) {
+	callback, _ := url.Parse(h.Service.CallbackURL(name))
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(federation.StateCookie, value, maxAge, callback.Path, "", callback.Scheme == "https", true)
+}
+
+func (h *FederationHandler) fail(ctx *gin.Context, err error) {
+	status := federationStatus(err)
+	if status == http.StatusInternalServerError || status == http.StatusBadGateway {
+		slog.ErrorContext(ctx, "federated login failed", "error", err)
+	}
+	// provider failures are logged, their details stay out of the answer
+	message := err.Error()
+	switch status {
+	case http.StatusInternalServerError:
+		message = config.ErrFederatedLogin
+	case http.StatusBadGateway:
+		message = config.ErrProviderFailed.Error()
+	}
+	web.NewError(ctx, status, message)
+}
+
+func federationStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrUnknownProvider):
+		return http.StatusNotFound
+	case errors.Is(err, config.ErrLoginState), errors.Is(err, config.ErrLoginRejected), errors.Is(err, config.ErrInvalidIDToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, config.ErrIdentityNotLinked), errors.Is(err, config.ErrDomainNotAllowed),
+		errors.Is(err, config.ErrMissingClaims), errors.Is(err, config.ErrUserDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, config.ErrUserAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, config.ErrProviderFailed):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
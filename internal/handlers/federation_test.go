@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/federation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func federationRouter(t *testing.T, enabled bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	var service *federation.Service
+	if enabled {
+		// the provider only has to be discovered to start a login
+		var issuer string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/authorize",
+				"token_endpoint":         issuer + "/token",
+				"jwks_uri":               issuer + "/jwks",
+			})
+		}))
+		t.Cleanup(srv.Close)
+		issuer = srv.URL
+
+		providers := []federation.ProviderConfig{{Name: "corp", Issuer: issuer, ClientID: "app", Scopes: []string{"openid"}}}
+		cfg := config.FederationConfig{PublicURL: "https://api.example.com/api/v1", StateTTL: time.Minute, HTTPTimeout: time.Second}
+		service = federation.NewService(providers, nil, nil, cfg)
+	}
+
+	handler := NewFederationHandler(service)
+	r := gin.New()
+	group := r.Group("/login", handler.RequireEnabled)
+	group.GET("/providers", handler.ProvidersHandler)
+	group.GET("/:provider", handler.BeginHandler)
+	group.GET("/:provider/callback", handler.CallbackHandler)
+	return r
+}
+
+func TestFederationHandlers(t *testing.T) {
+	r := federationRouter(t, true)
+
+	test := []struct {
+		Name           string
+		Path           string
+		Cookie         string
+		ExpectedCode   int
+		ExpectedCookie string
+		ExpectedPrefix string
+	}{
+		{
+			Name:         "List Providers",
+			Path:         "/login/providers",
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Name:           "Begin",
+			Path:           "/login/corp",
+			ExpectedCode:   http.StatusFound,
+			ExpectedCookie: "Path=/api/v1/login/corp/callback; Max-Age=60; HttpOnly; Secure; SameSite=Lax",
+			ExpectedPrefix: "/authorize?",
+		},
+		{
+			Name:         "Begin Unknown Provider",
+			Path:         "/login/other",
+			ExpectedCode: http.StatusNotFound,
+		},
+		{
+			Name:           "Callback Without State",
+			Path:           "/login/corp/callback?code=abc&state=xyz",
+			ExpectedCode:   http.StatusUnauthorized,
+			ExpectedCookie: "Path=/api/v1/login/corp/callback; Max-Age=0; HttpOnly; Secure; SameSite=Lax",
+		},
+		{
+			Name:         "Callback Forged State",
+			Path:         "/login/corp/callback?code=abc&state=xyz",
+			Cookie:       "forged",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.Path, nil)
+			if tt.Cookie != "" {
+				req.AddCookie(&http.Cookie{Name: federation.StateCookie, Value: tt.Cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			if tt.ExpectedCookie != "" {
+				_, attributes, _ := strings.Cut(w.Header().Get("Set-Cookie"), "; ")
+				assert.Equal(t, tt.ExpectedCookie, attributes)
+			}
+			if tt.ExpectedPrefix != "" {
+				assert.Equal(t, true, strings.Contains(w.Header().Get("Location"), tt.ExpectedPrefix))
+			}
+		})
+	}
+}
+
+func TestFederationDisabled(t *testing.T) {
+	r := federationRouter(t, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/providers", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"go-manage-mysql/internal/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	Checks *health.Registry
+}
+
+func NewHealthHandler(checks *health.Registry) *HealthHandler {
+	return &HealthHandler{Checks: checks}
+}
+
+// LivenessHandler only proves the process is serving requests.
+func (h *HealthHandler) LivenessHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, health.Report{Status: health.StatusUp})
+}
+
+// ReadinessHandler runs every dependency check without exposing their details.
+func (h *HealthHandler) ReadinessHandler(ctx *gin.Context) {
+	report := h.Checks.Check(ctx)
+	ctx.JSON(reportStatus(report), health.Report{Status: report.Status, ShuttingDown: report.ShuttingDown})
+}
+
+func (h *HealthHandler) DetailsHandler(ctx *gin.Context) {
+	report := h.Checks.Check(ctx)
+	ctx.JSON(reportStatus(report), report)
+}
+
+func reportStatus(report health.Report) int {
+	if report.Status != health.StatusUp {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
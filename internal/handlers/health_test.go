@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/internal/health"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	down := false
+	registry := health.NewRegistry(time.Second)
+	registry.Register("database", func(ctx context.Context) error {
+		if down {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	handler := NewHealthHandler(registry)
+
+	r := gin.Default()
+	r.GET("/healthz", handler.LivenessHandler)
+	r.GET("/readyz", handler.ReadinessHandler)
+	r.GET("/details", handler.DetailsHandler)
+
+	test := []struct {
+		Name           string
+		Path           string
+		Down           bool
+		ExpectedCode   int
+		ExpectedChecks int
+	}{
+		{Name: "Liveness", Path: "/healthz", ExpectedCode: http.StatusOK},
+		{Name: "Liveness With Dependency Down", Path: "/healthz", Down: true, ExpectedCode: http.StatusOK},
+		{Name: "Ready", Path: "/readyz", ExpectedCode: http.StatusOK},
+		{Name: "Not Ready", Path: "/readyz", Down: true, ExpectedCode: http.StatusServiceUnavailable},
+		{Name: "Details", Path: "/details", ExpectedCode: http.StatusOK, ExpectedChecks: 1},
+		{Name: "Details Down", Path: "/details", Down: true, ExpectedCode: http.StatusServiceUnavailable, ExpectedChecks: 1},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			down = tt.Down
+
+			req, _ := http.NewRequest(http.MethodGet, tt.Path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var report health.Report
+			_ = json.Unmarshal(w.Body.Bytes(), &report)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			assert.Equal(t, tt.ExpectedChecks, len(report.Checks))
+		})
+	}
+}
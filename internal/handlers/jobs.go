@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/utils/web"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	Jobs jobs.JobServices
+}
+
+func NewJobHandler(service jobs.JobServices) *JobHandler {
+	return &JobHandler{Jobs: service}
+}
+
+type jobRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params"`
+}
+
+func (h *JobHandler) SubmitJobHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	// an import carries its whole file
+	liftDeadlines(ctx)
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, config.Current().Bulk.MaxImportBytes)
+
+	var request jobRequest
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
+		web.NewError(ctx, importStatus(err), config.ErrInvalidBody)
+		return
+	}
+	if request.Type == "" {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrAllFieldsAreRequired)
+		return
+	}
+
+	job, submitErr := h.Jobs.Submit(ctx, request.Type, request.Params, middleware.Username(ctx))
+	if submitErr != nil {
+		web.NewError(ctx, jobStatus(submitErr), submitErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusAccepted, usersResponse(config.SubmitJobMessage, http.StatusAccepted, job))
+}
+
+func (h *JobHandler) SearchJobHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	job, searchErr := h.Jobs.Get(ctx, ctx.Param("id"))
+	if searchErr != nil {
+		web.NewError(ctx, jobStatus(searchErr), searchErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.SearchJobMessage, http.StatusOK, job))
+}
+
+func (h *JobHandler) CancelJobHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	job, cancelErr := h.Jobs.Cancel(ctx, ctx.Param("id"))
+	if cancelErr != nil {
+		web.NewError(ctx, jobStatus(cancelErr), cancelErr.Error())
+		return
+	}
+
+	message := config.CancelJobMessage
+	if job.State == models.JobRunning {
+		message = config.CancellingJobMessage
+	}
+	ctx.JSON(http.StatusOK, usersResponse(message, http.StatusOK, job))
+}
+
+func jobStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrUnknownJobType), errors.Is(err, config.ErrInvalidJobParams):
+		return http.StatusBadRequest
+	case errors.Is(err, config.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, config.ErrJobFinished):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func jobRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	users := services.NewUserServices(repository.NewUserRepository(gormDB))
+	handler := NewJobHandler(jobs.NewManager(repository.NewJobRepository(gormDB), users, config.Current().Jobs))
+	r := gin.New()
+	r.POST("/jobs", handler.SubmitJobHandler)
+	r.GET("/jobs/:id", handler.SearchJobHandler)
+	r.DELETE("/jobs/:id", handler.CancelJobHandler)
+	return r, mock
+}
+
+func jobRows(state string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "type", "state", "params", "total", "processed", "progress"}).
+		AddRow("job-1", models.JobDisable, state, []byte(`{"role":"user"}`), 10, 5, 50)
+}
+
+func TestJobHandlers(t *testing.T) {
+	r, mock := jobRouter(t)
+
+	cfg := config.Current()
+	cfg.Bulk.MaxImportBytes = 256
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+
+	test := []struct {
+		Name            string
+		Method          string
+		Path            string
+		Body            string
+		ExpectedCode    int
+		ExpectedState   string
+		ExpectedMessage string
+		MockAct         func()
+	}{
+		{
+			Name:          "Submit Success",
+			Method:        http.MethodPost,
+			Path:          "/jobs",
+			Body:          `{"type":"disable","params":{"role":"user"}}`,
+			ExpectedCode:  http.StatusAccepted,
+			ExpectedState: models.JobQueued,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Submit Missing Type",
+			Method:       http.MethodPost,
+			Path:         "/jobs",
+			Body:         `{"params":{"role":"user"}}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Submit Unknown Type",
+			Method:       http.MethodPost,
+			Path:         "/jobs",
+			Body:         `{"type":"purge"}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Submit Invalid Params",
+			Method:       http.MethodPost,
+			Path:         "/jobs",
+			Body:         `{"type":"import","params":{"format":"xml","data":"x"}}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Submit Too Large",
+			Method:       http.MethodPost,
+			Path:         "/jobs",
+			Body:         `{"type":"import","params":{"format":"ndjson","data":"` + strings.Repeat("x", 300) + `"}}`,
+			ExpectedCode: http.StatusRequestEntityTooLarge,
+			MockAct:      func() {},
+		},
+		{
+			Name:          "Search Success",
+			Method:        http.MethodGet,
+			Path:          "/jobs/job-1",
+			ExpectedCode:  http.StatusOK,
+			ExpectedState: models.JobRunning,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetJobTestQuery).WithArgs("job-1", 1).WillReturnRows(jobRows(models.JobRunning))
+			},
+		},
+		{
+			Name:         "Search Not Found",
+			Method:       http.MethodGet,
+			Path:         "/jobs/job-1",
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetJobTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:            "Cancel Running",
+			Method:          http.MethodDelete,
+			Path:            "/jobs/job-1",
+			ExpectedCode:    http.StatusOK,
+			ExpectedState:   models.JobRunning,
+			ExpectedMessage: config.CancellingJobMessage,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).WillReturnRows(jobRows(models.JobRunning))
+				mock.ExpectExec(config.UpdateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Cancel Queued",
+			Method:          http.MethodDelete,
+			Path:            "/jobs/job-1",
+			ExpectedCode:    http.StatusOK,
+			ExpectedState:   models.JobCancelled,
+			ExpectedMessage: config.CancelJobMessage,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).WillReturnRows(jobRows(models.JobQueued))
+				mock.ExpectExec(config.UpdateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Cancel Finished",
+			Method:       http.MethodDelete,
+			Path:         "/jobs/job-1",
+			ExpectedCode: http.StatusConflict,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).WillReturnRows(jobRows(models.JobSucceeded))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Cancel Database Error",
+			Method:       http.MethodDelete,
+			Path:         "/jobs/job-1",
+			ExpectedCode: http.StatusInternalServerError,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(tt.Method, tt.Path, bytes.NewBufferString(tt.Body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			if tt.ExpectedState != "" {
+				var response struct {
+					Message string     `json:"message"`
+					Data    models.Job `json:"data"`
+				}
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.ExpectedState, response.Data.State)
+				if tt.ExpectedMessage != "" {
+					assert.Equal(t, tt.ExpectedMessage, response.Message)
+				}
+			}
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
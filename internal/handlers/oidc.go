@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// OIDCHandler serves the openid connect provider and the registration of
+// its clients. Provider is nil while the provider is not configured.
+type OIDCHandler struct {
+	Provider *oidc.Provider
+}
+
+func NewOIDCHandler(provider *oidc.Provider) *OIDCHandler {
+	return &OIDCHandler{Provider: provider}
+}
+
+type clientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+type registeredClient struct {
+	models.OAuthClient
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// RequireEnabled answers 404 while the provider is not configured.
+func (h *OIDCHandler) RequireEnabled(ctx *gin.Context) {
+	if h.Provider == nil {
+		web.NewError(ctx, http.StatusNotFound, "openid connect provider is not enabled")
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+func (h *OIDCHandler) DiscoveryHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=3600")
+	ctx.JSON(http.StatusOK, h.Provider.Metadata())
+}
+
+func (h *OIDCHandler) KeySetHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=3600")
+	ctx.JSON(http.StatusOK, h.Provider.KeySet())
+}
+
+// AuthorizeHandler shows the sign in and consent page of a valid request.
+func (h *OIDCHandler) AuthorizeHandler(ctx *gin.Context) {
+	var req oidc.AuthorizationRequest
+	_ = ctx.ShouldBindWith(&req, binding.Form)
+
+	client, checkErr := h.Provider.CheckAuthorization(ctx, req)
+	if checkErr != nil {
+		h.authorizeFailed(ctx, http.StatusFound, client, req, checkErr)
+		return
+	}
+	h.page(ctx, http.StatusOK, client, req, "", "")
+}
+
+// ApproveHandler signs the user in from the page and, when allowed, sends
+// the authorization code back to the client.
+func (h *OIDCHandler) ApproveHandler(ctx *gin.Context) {
+	var req oidc.AuthorizationRequest
+	_ = ctx.ShouldBindWith(&req, binding.Form)
+
+	client, checkErr := h.Provider.CheckAuthorization(ctx, req)
+	if checkErr != nil {
+		h.authorizeFailed(ctx, http.StatusSeeOther, client, req, checkErr)
+		return
+	}
+	if ctx.PostForm("decision") != "allow" {
+		ctx.Redirect(http.StatusSeeOther, h.Provider.Redirect(req, url.Values{"error": {oidc.AccessDenied}}))
+		return
+	}
+
+	username := ctx.PostForm("username")
+	redirect, authErr := h.Provider.Authorize(ctx, client, req, username, ctx.PostForm("password"))
+	switch {
+	case authErr == nil:
+		ctx.Redirect(http.StatusSeeOther, redirect)
+	case errors.Is(authErr, config.ErrPwdMatching), errors.Is(authErr, config.ErrUserNotFound):
+		h.page(ctx, http.StatusUnauthorized, client, req, username, config.ErrUnauthorizedUser)
+	case errors.Is(authErr, config.ErrUserDisabled), errors.Is(authErr, config.ErrPasswordChange):
+		h.page(ctx, http.StatusForbidden, client, req, username, authErr.Error())
+	default:
+		h.authorizeFailed(ctx, http.StatusSeeOther, client, req, authErr)
+	}
+}
+
+func (h *OIDCHandler) TokenHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	client, ok := h.client(ctx)
+	if !ok {
+		return
+	}
+	var req oidc.TokenRequest
+	_ = ctx.ShouldBindWith(&req, binding.Form)
+
+	response, exchangeErr := h.Provider.Exchange(ctx, client, req)
+	if exchangeErr != nil {
+		h.fail(ctx, exchangeErr)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (h *OIDCHandler) UserInfoHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		h.fail(ctx, oidc.NewError(http.StatusUnauthorized, oidc.InvalidToken, "a bearer access token is required"))
+		return
+	}
+	claims, infoErr := h.Provider.UserInfo(ctx, token)
+	if infoErr != nil {
+		h.fail(ctx, infoErr)
+		return
+	}
+	ctx.JSON(http.StatusOK, claims)
+}
+
+func (h *OIDCHandler) IntrospectHandler(ctx *gin.Context) {
+	client, ok := h.client(ctx)
+	if !ok {
+		return
+	}
+	token := ctx.PostForm("token")
+	if token == "" {
+		h.fail(ctx, oidc.NewError(http.StatusBadRequest, oidc.InvalidRequest, "token is required"))
+		return
+	}
+
+	introspection, introspectErr := h.Provider.Introspect(ctx, client, token)
+	if introspectErr != nil {
+		h.fail(ctx, introspectErr)
+		return
+	}
+	ctx.JSON(http.StatusOK, introspection)
+}
+
+func (h *OIDCHandler) RevokeHandler(ctx *gin.Context) {
+	client, ok := h.client(ctx)
+	if !ok {
+		return
+	}
+	token := ctx.PostForm("token")
+	if token == "" {
+		h.fail(ctx, oidc.NewError(http.StatusBadRequest, oidc.InvalidRequest, "token is required"))
+		return
+	}
+
+	if revokeErr := h.Provider.Revoke(ctx, client, token); revokeErr != nil {
+		h.fail(ctx, revokeErr)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (h *OIDCHandler) RegisterClientHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var request clientRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidBody)
+		return
+	}
+
+	client, secret, registerErr := h.Provider.RegisterClient(ctx, request.Name, request.RedirectURIs, request.Public, middleware.Username(ctx))
+	if registerErr != nil {
+		web.NewError(ctx, clientStatus(registerErr), registerErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusCreated, usersResponse(config.RegisterClientMessage, http.StatusCreated, registeredClient{OAuthClient: client, Secret: secret}))
+}
+
+func (h *OIDCHandler) ListClientsHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	clients, listErr := h.Provider.ListClients(ctx)
+	if listErr != nil {
+		web.NewError(ctx, clientStatus(listErr), listErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.ListClientsMessage, http.StatusOK, clients))
+}
+
+func (h *OIDCHandler) DeleteClientHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	if deleteErr := h.Provider.DeleteClient(ctx, ctx.Param("id")); deleteErr != nil {
+		web.NewError(ctx, clientStatus(deleteErr), deleteErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.DeleteClientMessage, http.StatusOK, nil))
+}
+
+// client authenticates the caller with http basic or the client_id and
+// client_secret form fields, and answers the failure itself.
+func (h *OIDCHandler) client(ctx *gin.Context) (models.OAuthClient, bool) {
+	id, secret, basic := ctx.Request.BasicAuth()
+	if basic {
+		// RFC 6749 form-encodes both before building the header
+		var idErr, secretErr error
+		id, idErr = url.QueryUnescape(id)
+		secret, secretErr = url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil || ctx.PostForm("client_secret") != "" {
+			h.fail(ctx, oidc.NewError(http.StatusUnauthorized, oidc.InvalidClient, "client authentication failed"))
+			return models.OAuthClient{}, false
+		}
+	} else {
+		id, secret = ctx.PostForm("client_id"), ctx.PostForm("client_secret")
+	}
+
+	client, authErr := h.Provider.AuthenticateClient(ctx, id, secret)
+	if authErr != nil {
+		h.fail(ctx, authErr)
+		return models.OAuthClient{}, false
+	}
+	return client, true
+}
+
+// fail answers with the oauth error matching err, other errors are logged
+// and hidden behind server_error.
+func (h *OIDCHandler) fail(ctx *gin.Context, err error) {
+	var oauthErr *oidc.Error
+	if !errors.As(err, &oauthErr) {
+		slog.ErrorContext(ctx, "openid connect request failed", "error", err)
+		oauthErr = oidc.NewError(http.StatusInternalServerError, oidc.ServerError, "")
+	}
+	switch oauthErr.Code {
+	case oidc.InvalidClient:
+		ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	case oidc.InvalidToken:
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	ctx.JSON(oauthErr.Status, oauthErr)
+}
+
+// authorizeFailed sends the error back to the client once its redirect uri
+// is trusted, and shows it to the user otherwise.
+func (h *OIDCHandler) authorizeFailed(ctx *gin.Context, redirectStatus int, client models.OAuthClient, req oidc.AuthorizationRequest, err error) {
+	var oauthErr *oidc.Error
+	if !errors.As(err, &oauthErr) {
+		slog.ErrorContext(ctx, "openid connect authorization failed", "error", err)
+		oauthErr = oidc.NewError(http.StatusInternalServerError, oidc.ServerError, "the request could not be processed")
+	}
+	if client.ID == "" {
+		h.page(ctx, oauthErr.Status, client, req, "", oauthErr.Description)
+		return
+	}
+
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	ctx.Redirect(redirectStatus, h.Provider.Redirect(req, params))
+}
+
+func (h *OIDCHandler) page(ctx *gin.Context, status int, client models.OAuthClient, req oidc.AuthorizationRequest, username, message string) {
+	// the page asks for a password, it must not be framed or cached
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	ctx.Render(status, render.HTML{Template: oidc.Page, Data: oidc.PageData{
+		Client:   client.Name,
+		Action:   ctx.Request.URL.Path,
+		Request:  req,
+		Scopes:   oidc.DescribeScope(req.Scope),
+		Username: username,
+		Error:    message,
+	}})
+}
+
+func clientStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrInvalidClient):
+		return http.StatusBadRequest
+	case errors.Is(err, config.ErrClientNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func oidcRouter(t *testing.T, enabled bool) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	var provider *oidc.Provider
+	if enabled {
+		key, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+		if keyErr != nil {
+			t.Fatal(keyErr)
+		}
+		cfg := config.OIDCConfig{Issuer: "https://id.example.com", CodeTTL: time.Minute, AccessTokenTTL: time.Hour, RefreshTokenTTL: time.Hour}
+		users := services.NewUserServices(repository.NewUserRepository(gormDB))
+		provider = oidc.NewProvider(repository.NewOAuthRepository(gormDB), users, key, cfg)
+	}
+
+	handler := NewOIDCHandler(provider)
+	r := gin.New()
+	group := r.Group("/oauth2", handler.RequireEnabled)
+	group.GET("/authorize", handler.AuthorizeHandler)
+	group.POST("/authorize", handler.ApproveHandler)
+	group.POST("/token", handler.TokenHandler)
+	group.GET("/userinfo", handler.UserInfoHandler)
+	group.POST("/clients", handler.RegisterClientHandler)
+	group.DELETE("/clients/:id", handler.DeleteClientHandler)
+	return r, mock
+}
+
+func TestOIDCHandlers(t *testing.T) {
+	r, mock := oidcRouter(t, true)
+
+	clientRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "redirect_uris", "public"}).
+			AddRow("client-1", "App", []byte(`["https://app.example.com/callback"]`), true)
+	}
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"client-1"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"code_challenge":        {strings.Repeat("a", 43)},
+		"code_challenge_method": {"S256"},
+	}
+	form := func(values url.Values, extra ...string) string {
+		copied := url.Values{}
+		for key, value := range values {
+			copied[key] = value
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			copied.Set(extra[i], extra[i+1])
+		}
+		return copied.Encode()
+	}
+
+	test := []struct {
+		Name             string
+		Method           string
+		Path             string
+		Body             string
+		ContentType      string
+		BasicAuth        bool
+		ExpectedCode     int
+		ExpectedLocation string
+		ExpectedHeader   string
+		MockAct          func()
+	}{
+		{
+			Name:         "Authorize Page",
+			Method:       http.MethodGet,
+			Path:         "/oauth2/authorize?" + authorize.Encode(),
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetClientTestQuery).WithArgs("client-1", 1).WillReturnRows(clientRows())
+			},
+		},
+		{
+			Name:         "Authorize Unknown Client",
+			Method:       http.MethodGet,
+			Path:         "/oauth2/authorize?" + authorize.Encode(),
+			ExpectedCode: http.StatusBadRequest,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetClientTestQuery).WithArgs("client-1", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:             "Authorize Without PKCE",
+			Method:           http.MethodGet,
+			Path:             "/oauth2/authorize?" + form(authorize, "code_challenge_method", "plain"),
+			ExpectedCode:     http.StatusFound,
+			ExpectedLocation: "https://app.example.com/callback?error=invalid_request&error_description=an+S256+code_challenge+is+required&iss=https%3A%2F%2Fid.example.com&state=xyz",
+			MockAct: func() {
+				mock.ExpectQuery(config.GetClientTestQuery).WithArgs("client-1", 1).WillReturnRows(clientRows())
+			},
+		},
+		{
+			Name:             "Approve Denied",
+			Method:           http.MethodPost,
+			Path:             "/oauth2/authorize",
+			Body:             form(authorize, "decision", "deny"),
+			ContentType:      "application/x-www-form-urlencoded",
+			ExpectedCode:     http.StatusSeeOther,
+			ExpectedLocation: "https://app.example.com/callback?error=access_denied&iss=https%3A%2F%2Fid.example.com&state=xyz",
+			MockAct: func() {
+				mock.ExpectQuery(config.GetClientTestQuery).WithArgs("client-1", 1).WillReturnRows(clientRows())
+			},
+		},
+		{
+			Name:           "Token Without Client",
+			Method:         http.MethodPost,
+			Path:           "/oauth2/token",
+			Body:           "grant_type=authorization_code&code=abc",
+			ContentType:    "application/x-www-form-urlencoded",
+			ExpectedCode:   http.StatusUnauthorized,
+			ExpectedHeader: `Basic realm="oauth"`,
+			MockAct:        func() {},
+		},
+		{
+			Name:           "Token With Two Credentials",
+			Method:         http.MethodPost,
+			Path:           "/oauth2/token",
+			Body:           "grant_type=authorization_code&code=abc&client_secret=secret",
+			ContentType:    "application/x-www-form-urlencoded",
+			BasicAuth:      true,
+			ExpectedCode:   http.StatusUnauthorized,
+			ExpectedHeader: `Basic realm="oauth"`,
+			MockAct:        func() {},
+		},
+		{
+			Name:         "Token Unsupported Grant",
+			Method:       http.MethodPost,
+			Path:         "/oauth2/token",
+			Body:         "grant_type=password&client_id=client-1",
+			ContentType:  "application/x-www-form-urlencoded",
+			ExpectedCode: http.StatusBadRequest,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetClientTestQuery).WithArgs("client-1", 1).WillReturnRows(clientRows())
+			},
+		},
+		{
+			Name:           "User Info Without Token",
+			Method:         http.MethodGet,
+			Path:           "/oauth2/userinfo",
+			ExpectedCode:   http.StatusUnauthorized,
+			ExpectedHeader: `Bearer error="invalid_token"`,
+			MockAct:        func() {},
+		},
+		{
+			Name:         "Register Invalid Redirect",
+			Method:       http.MethodPost,
+			Path:         "/oauth2/clients",
+			Body:         `{"name":"App","redirect_uris":["http://app.example.com/callback"]}`,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Delete Unknown Client",
+			Method:       http.MethodDelete,
+			Path:         "/oauth2/clients/client-2",
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteClientTestQuery).WithArgs("client-2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(tt.Method, tt.Path, strings.NewReader(tt.Body))
+			if tt.ContentType != "" {
+				req.Header.Set("Content-Type", tt.ContentType)
+			}
+			if tt.BasicAuth {
+				req.SetBasicAuth("client-1", "secret")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			if tt.ExpectedLocation != "" {
+				assert.Equal(t, tt.ExpectedLocation, w.Header().Get("Location"))
+			}
+			if tt.ExpectedHeader != "" {
+				assert.Equal(t, tt.ExpectedHeader, w.Header().Get("WWW-Authenticate"))
+			}
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	r, _ := oidcRouter(t, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/userinfo", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/privacy"
+	"go-manage-mysql/internal/utils/web"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyHandler lets users download their data and ask for it to be
+// erased, and admins handle erasures of any user.
+type PrivacyHandler struct {
+	Service *privacy.Service
+}
+
+func NewPrivacyHandler(service *privacy.Service) *PrivacyHandler {
+	return &PrivacyHandler{Service: service}
+}
+
+type erasureRequest struct {
+	Username string `json:"username"`
+	// Immediate skips the grace period
+	Immediate bool `json:"immediate"`
+}
+
+func (h *PrivacyHandler) ExportOwnDataHandler(ctx *gin.Context) {
+	username := middleware.Username(ctx)
+	archive, exportErr := h.Service.Export(ctx, username)
+	if exportErr != nil {
+		ctx.Header("Content-Type", "application/json")
+		web.NewError(ctx, erasureStatus(exportErr), exportErr.Error())
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="`+username+`.zip"`)
+	ctx.Data(http.StatusOK, privacy.ContentType, archive)
+}
+
+func (h *PrivacyHandler) RequestOwnErasureHandler(ctx *gin.Context) {
+	h.request(ctx, middleware.Username(ctx), false)
+}
+
+func (h *PrivacyHandler) FindOwnErasureHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	request, findErr := h.Service.Pending(ctx, middleware.Username(ctx))
+	if findErr != nil {
+		web.NewError(ctx, erasureStatus(findErr), findErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.FindErasureMessage, http.StatusOK, request))
+}
+
+func (h *PrivacyHandler) CancelOwnErasureHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	if cancelErr := h.Service.CancelPending(ctx, middleware.Username(ctx)); cancelErr != nil {
+		web.NewError(ctx, erasureStatus(cancelErr), cancelErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.CancelErasureMessage, http.StatusOK, nil))
+}
+
+func (h *PrivacyHandler) RequestErasureHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var request erasureRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || request.Username == "" {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidBody)
+		return
+	}
+	h.request(ctx, request.Username, request.Immediate)
+}
+
+func (h *PrivacyHandler) ListErasuresHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	state := ctx.Query("state")
+	if state != "" && !slices.Contains(privacy.States, state) {
+		web.NewError(ctx, http.StatusBadRequest, config.ErrInvalidQueryParam)
+		return
+	}
+	requests, listErr := h.Service.List(ctx, state)
+	if listErr != nil {
+		web.NewError(ctx, erasureStatus(listErr), listErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.ListErasuresMessage, http.StatusOK, requests))
+}
+
+func (h *PrivacyHandler) FindErasureHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	request, findErr := h.Service.Get(ctx, ctx.Param("id"))
+	if findErr != nil {
+		web.NewError(ctx, erasureStatus(findErr), findErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.FindErasureMessage, http.StatusOK, request))
+}
+
+func (h *PrivacyHandler) CancelErasureHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	if cancelErr := h.Service.Cancel(ctx, ctx.Param("id")); cancelErr != nil {
+		web.NewError(ctx, erasureStatus(cancelErr), cancelErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.CancelErasureMessage, http.StatusOK, nil))
+}
+
+// request answers 202 while the erasure waits for its grace period and 200
+// once it is done.
+func (h *PrivacyHandler) request(ctx *gin.Context, username string, immediate bool) {
+	ctx.Header("Content-Type", "application/json")
+
+	request, requestErr := h.Service.RequestErasure(ctx, username, middleware.Username(ctx), immediate)
+	if requestErr != nil {
+		web.NewError(ctx, erasureStatus(requestErr), requestErr.Error())
+		return
+	}
+	if immediate {
+		ctx.JSON(http.StatusOK, usersResponse(config.ErasedMessage, http.StatusOK, request))
+		return
+	}
+	ctx.JSON(http.StatusAccepted, usersResponse(config.RequestErasureMessage, http.StatusAccepted, request))
+}
+
+func erasureStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrErasureNotFound), errors.Is(err, config.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, config.ErrErasurePending), errors.Is(err, config.ErrLastAdmin):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
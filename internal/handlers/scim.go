@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/scim"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/utils/validator"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMHandler serves the scim 2.0 user endpoints to identity providers.
+type SCIMHandler struct {
+	Service services.UserServices
+}
+
+func NewSCIMHandler(service services.UserServices) *SCIMHandler {
+	return &SCIMHandler{Service: service}
+}
+
+func (h *SCIMHandler) ServiceProviderConfigHandler(ctx *gin.Context) {
+	scimJSON(ctx, http.StatusOK, scim.NewServiceProviderConfig(config.Current().SCIM.MaxResults))
+}
+
+func (h *SCIMHandler) ListSCIMUsersHandler(ctx *gin.Context) {
+	startIndex, count, pageErr := scimPage(ctx, config.Current().SCIM.MaxResults)
+	if pageErr != nil {
+		h.fail(ctx, pageErr)
+		return
+	}
+
+	var users []models.User
+	total := 0
+	if filter := ctx.Query("filter"); filter != "" {
+		username, filterErr := scim.ParseFilter(filter)
+		if filterErr != nil {
+			h.fail(ctx, filterErr)
+			return
+		}
+		// a missing user is an empty list, not an error
+		user, searchErr := h.Service.SearchUser(ctx, username)
+		switch {
+		case searchErr == nil:
+			total = 1
+			if startIndex == 1 && count > 0 {
+				users = []models.User{user}
+			}
+		case !errors.Is(searchErr, config.ErrUserNotFound):
+			h.fail(ctx, searchErr)
+			return
+		}
+	} else {
+		counted, countErr := h.Service.CountUsers(ctx, repository.UserFilter{})
+		if countErr != nil {
+			h.fail(ctx, countErr)
+			return
+		}
+		total = int(counted)
+		if count > 0 {
+			list, listErr := h.Service.ListUsers(ctx, startIndex-1, count)
+			if listErr != nil {
+				h.fail(ctx, listErr)
+				return
+			}
+			users = list
+		}
+	}
+
+	resources := make([]scim.User, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, scim.NewUser(user, scimLocation(ctx, user.ID)))
+	}
+	scimJSON(ctx, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.ListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *SCIMHandler) GetSCIMUserHandler(ctx *gin.Context) {
+	user, searchErr := h.Service.SearchUserByID(ctx, ctx.Param("id"))
+	if searchErr != nil {
+		h.fail(ctx, searchErr)
+		return
+	}
+
+	version := scim.Version(user)
+	if match := ctx.GetHeader("If-None-Match"); match != "" && scim.Matches(match, version) {
+		ctx.Header("ETag", version)
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	h.respond(ctx, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateSCIMUserHandler(ctx *gin.Context) {
+	var resource scim.User
+	if err := ctx.ShouldBindJSON(&resource); err != nil {
+		h.fail(ctx, scim.NewError(http.StatusBadRequest, scim.InvalidSyntax, config.ErrInvalidBody))
+		return
+	}
+
+	user := resource.Apply(models.User{})
+	if validate := validator.ValidateData(user, config.SCIM_ValidateFields); validate != nil {
+		h.fail(ctx, scim.NewError(http.StatusBadRequest, scim.InvalidValue, validate.Error()))
+		return
+	}
+	// provisioned users usually sign in through the provider, a password
+	// nobody knows keeps direct logins closed until it is reset
+	if user.Password == "" {
+		generated, generateErr := password.Generate()
+		if generateErr != nil {
+			h.fail(ctx, generateErr)
+			return
+		}
+		user.Password = generated
+	}
+
+	created, createErr := h.Service.CreateUser(ctx, user)
+	if createErr != nil {
+		h.fail(ctx, createErr)
+		return
+	}
+	ctx.Header("Location", scimLocation(ctx, created.ID))
+	h.respond(ctx, http.StatusCreated, created)
+}
+
+func (h *SCIMHandler) ReplaceSCIMUserHandler(ctx *gin.Context) {
+	var replacement scim.User
+	if err := ctx.ShouldBindJSON(&replacement); err != nil {
+		h.fail(ctx, scim.NewError(http.StatusBadRequest, scim.InvalidSyntax, config.ErrInvalidBody))
+		return
+	}
+
+	h.modify(ctx, func(resource *scim.User) error {
+		*resource = replacement
+		return nil
+	})
+}
+
+func (h *SCIMHandler) PatchSCIMUserHandler(ctx *gin.Context) {
+	var request scim.PatchRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || len(request.Operations) == 0 {
+		h.fail(ctx, scim.NewError(http.StatusBadRequest, scim.InvalidSyntax, config.ErrInvalidBody))
+		return
+	}
+
+	h.modify(ctx, func(resource *scim.User) error {
+		return resource.Patch(request.Operations)
+	})
+}
+
+func (h *SCIMHandler) DeleteSCIMUserHandler(ctx *gin.Context) {
+	user, searchErr := h.Service.SearchUserByID(ctx, ctx.Param("id"))
+	if searchErr != nil {
+		h.fail(ctx, searchErr)
+		return
+	}
+	if match := ctx.GetHeader("If-Match"); match != "" && !scim.Matches(match, scim.Version(user)) {
+		h.fail(ctx, config.ErrVersionMismatch)
+		return
+	}
+
+	if deleteErr := h.Service.DeleteUser(ctx, user.Username); deleteErr != nil {
+		h.fail(ctx, deleteErr)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// modify applies change to the resource of the user at :id, under the row
+// lock and after checking If-Match, and stores the result.
+func (h *SCIMHandler) modify(ctx *gin.Context, change func(resource *scim.User) error) {
+	ifMatch := ctx.GetHeader("If-Match")
+	user, modifyErr := h.Service.ModifyUser(ctx, ctx.Param("id"), func(current models.User) (models.User, error) {
+		if ifMatch != "" && !scim.Matches(ifMatch, scim.Version(current)) {
+			return models.User{}, config.ErrVersionMismatch
+		}
+
+		resource := scim.NewUser(current, "")
+		if err := change(&resource); err != nil {
+			return models.User{}, err
+		}
+		next := resource.Apply(current)
+
+		// the stored hash is not a password to validate
+		check := next
+		if check.Password == current.Password {
+			check.Password = ""
+		}
+		if validate := validator.ValidateData(check, config.SCIM_ValidateFields); validate != nil {
+			return models.User{}, scim.NewError(http.StatusBadRequest, scim.InvalidValue, validate.Error())
+		}
+		return next, nil
+	})
+	if modifyErr != nil {
+		h.fail(ctx, modifyErr)
+		return
+	}
+	h.respond(ctx, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) respond(ctx *gin.Context, status int, user models.User) {
+	resource := scim.NewUser(user, scimLocation(ctx, user.ID))
+	ctx.Header("ETag", resource.Meta.Version)
+	scimJSON(ctx, status, resource)
+}
+
+// fail answers with the scim error matching err.
+func (h *SCIMHandler) fail(ctx *gin.Context, err error) {
+	var scimErr *scim.Error
+	switch {
+	case errors.As(err, &scimErr):
+	case errors.Is(err, config.ErrUserNotFound):
+		scimErr = scim.NewError(http.StatusNotFound, "", err.Error())
+	case errors.Is(err, config.ErrUserAlreadyExists):
+		scimErr = scim.NewError(http.StatusConflict, scim.Uniqueness, err.Error())
+	case errors.Is(err, config.ErrUsernameChange):
+		scimErr = scim.NewError(http.StatusBadRequest, scim.Mutability, err.Error())
+	case errors.Is(err, config.ErrVersionMismatch):
+		scimErr = scim.NewError(http.StatusPreconditionFailed, "", err.Error())
+	default:
+		scimErr = scim.NewError(http.StatusInternalServerError, "", err.Error())
+	}
+	scimJSON(ctx, scimErr.StatusCode(), scimErr)
+}
+
+func scimJSON(ctx *gin.Context, status int, body interface{}) {
+	ctx.Header("Content-Type", scim.ContentType)
+	ctx.JSON(status, body)
+}
+
+// scimPage reads startIndex and count, out of range values are clamped as
+// RFC 7644 asks.
+func scimPage(ctx *gin.Context, maxResults int) (startIndex, count int, err error) {
+	startIndex, count = 1, maxResults
+	if value := ctx.Query("startIndex"); value != "" {
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			return 0, 0, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "startIndex must be a number")
+		}
+		startIndex = max(n, 1)
+	}
+	if value := ctx.Query("count"); value != "" {
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			return 0, 0, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "count must be a number")
+		}
+		count = min(max(n, 0), maxResults)
+	}
+	return startIndex, count, nil
+}
+
+func scimLocation(ctx *gin.Context, id string) string {
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + ctx.Request.Host + config.Current().Server.BasePath + scim.Prefix + "/Users/" + id
+}
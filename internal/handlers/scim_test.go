@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/scim"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func scimRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	handler := NewSCIMHandler(services.NewUserServices(repository.NewUserRepository(gormDB)))
+	r := gin.New()
+	r.GET("/Users", handler.ListSCIMUsersHandler)
+	r.POST("/Users", handler.CreateSCIMUserHandler)
+	r.GET("/Users/:id", handler.GetSCIMUserHandler)
+	r.PUT("/Users/:id", handler.ReplaceSCIMUserHandler)
+	r.PATCH("/Users/:id", handler.PatchSCIMUserHandler)
+	r.DELETE("/Users/:id", handler.DeleteSCIMUserHandler)
+	return r, mock
+}
+
+func TestSCIMHandlers(t *testing.T) {
+	r, mock := scimRouter(t)
+
+	stored := models.User{
+		ID:       "1",
+		Name:     "John",
+		Surname:  "Doe",
+		Username: "johndoe",
+		Phone:    "123456",
+		Email:    "john@example.com",
+		Password: "hash",
+		Role:     models.RoleUser,
+	}
+	storedRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "password", "role", "disabled", "must_change_password"}).
+			AddRow(stored.ID, stored.Name, stored.Surname, stored.Username, stored.Phone, stored.Email, stored.Password, stored.Role, false, false)
+	}
+	create := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"janedoe","name":{"givenName":"Jane","familyName":"Doe"},` +
+		`"emails":[{"value":"jane@example.com","primary":true}],"phoneNumbers":[{"value":"654321"}],"externalId":"00u1"}`
+
+	test := []struct {
+		Name             string
+		Method           string
+		Path             string
+		Body             string
+		Header           map[string]string
+		ExpectedCode     int
+		ExpectedScimType string
+		Check            func(t *testing.T, w *httptest.ResponseRecorder)
+		MockAct          func()
+	}{
+		{
+			Name:         "Create Success",
+			Method:       http.MethodPost,
+			Path:         "/Users",
+			Body:         create,
+			ExpectedCode: http.StatusCreated,
+			Check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resource scim.User
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &resource))
+				assert.Equal(t, "janedoe", resource.UserName)
+				assert.Equal(t, "", resource.Password)
+				assert.Equal(t, true, strings.HasSuffix(w.Header().Get("Location"), "/scim/v2/Users/"+resource.ID))
+				assert.Equal(t, resource.Meta.Version, w.Header().Get("ETag"))
+			},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:             "Create Missing Email",
+			Method:           http.MethodPost,
+			Path:             "/Users",
+			Body:             `{"userName":"janedoe","name":{"givenName":"Jane","familyName":"Doe"},"phoneNumbers":[{"value":"654321"}]}`,
+			ExpectedCode:     http.StatusBadRequest,
+			ExpectedScimType: scim.InvalidValue,
+			MockAct:          func() {},
+		},
+		{
+			Name:             "Create Conflict",
+			Method:           http.MethodPost,
+			Path:             "/Users",
+			Body:             create,
+			ExpectedCode:     http.StatusConflict,
+			ExpectedScimType: scim.Uniqueness,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'janedoe' for key 'users.username'"})
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "List Page",
+			Method:       http.MethodGet,
+			Path:         "/Users?startIndex=2&count=1",
+			ExpectedCode: http.StatusOK,
+			Check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var list scim.ListResponse
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &list))
+				assert.Equal(t, 3, list.TotalResults)
+				assert.Equal(t, 2, list.StartIndex)
+				assert.Equal(t, 1, list.ItemsPerPage)
+				assert.Equal(t, "johndoe", list.Resources[0].UserName)
+			},
+			MockAct: func() {
+				mock.ExpectQuery(config.CountTestQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery(config.ListTestQuery).WithArgs(1, 1).WillReturnRows(storedRows())
+			},
+		},
+		{
+			Name:         "List Filter Without Match",
+			Method:       http.MethodGet,
+			Path:         `/Users?filter=userName+eq+"nobody"`,
+			ExpectedCode: http.StatusOK,
+			Check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var list scim.ListResponse
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &list))
+				assert.Equal(t, 0, list.TotalResults)
+				assert.Equal(t, 0, len(list.Resources))
+			},
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("nobody", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:         "List Filter Database Error",
+			Method:       http.MethodGet,
+			Path:         `/Users?filter=userName+eq+"johndoe"`,
+			ExpectedCode: http.StatusInternalServerError,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnError(config.ErrDbError)
+			},
+		},
+		{
+			Name:         "Get Not Modified",
+			Method:       http.MethodGet,
+			Path:         "/Users/1",
+			Header:       map[string]string{"If-None-Match": scim.Version(stored)},
+			ExpectedCode: http.StatusNotModified,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+			},
+		},
+		{
+			Name:         "Get Not Found",
+			Method:       http.MethodGet,
+			Path:         "/Users/2",
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("2", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:         "Replace Stale Version",
+			Method:       http.MethodPut,
+			Path:         "/Users/1",
+			Body:         `{"userName":"johndoe","name":{"givenName":"John","familyName":"Smith"},"emails":[{"value":"john@example.com"}],"phoneNumbers":[{"value":"123456"}]}`,
+			Header:       map[string]string{"If-Match": `W/"0000000000000000"`},
+			ExpectedCode: http.StatusPreconditionFailed,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Replace Without Active Keeps Disabled",
+			Method:       http.MethodPut,
+			Path:         "/Users/1",
+			Body:         `{"userName":"johndoe","name":{"givenName":"John","familyName":"Smith"},"emails":[{"value":"john@example.com"}],"phoneNumbers":[{"value":"123456"}]}`,
+			ExpectedCode: http.StatusOK,
+			Check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resource scim.User
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &resource))
+				assert.Equal(t, false, *resource.Active)
+			},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "password", "role", "disabled", "must_change_password"}).
+						AddRow(stored.ID, stored.Name, stored.Surname, stored.Username, stored.Phone, stored.Email, stored.Password, stored.Role, true, false))
+				mock.ExpectExec(config.ReplaceTestQuery).
+					WithArgs("John", "Smith", "123456", "john@example.com", "hash", models.RoleUser, true, false, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Patch Disable",
+			Method:       http.MethodPatch,
+			Path:         "/Users/1",
+			Body:         `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","path":"active","value":false}]}`,
+			Header:       map[string]string{"If-Match": scim.Version(stored)},
+			ExpectedCode: http.StatusOK,
+			Check: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var resource scim.User
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &resource))
+				assert.Equal(t, false, *resource.Active)
+				assert.NotEqual(t, scim.Version(stored), w.Header().Get("ETag"))
+			},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+				mock.ExpectExec(config.ReplaceTestQuery).
+					WithArgs("John", "Doe", "123456", "john@example.com", "hash", models.RoleUser, true, false, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:             "Patch Username",
+			Method:           http.MethodPatch,
+			Path:             "/Users/1",
+			Body:             `{"Operations":[{"op":"replace","path":"userName","value":"johnny"}]}`,
+			ExpectedCode:     http.StatusBadRequest,
+			ExpectedScimType: scim.Mutability,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:             "Patch Unsupported Path",
+			Method:           http.MethodPatch,
+			Path:             "/Users/1",
+			Body:             `{"Operations":[{"op":"add","path":"roles","value":[{"value":"admin"}]}]}`,
+			ExpectedCode:     http.StatusBadRequest,
+			ExpectedScimType: scim.InvalidPath,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Delete",
+			Method:       http.MethodDelete,
+			Path:         "/Users/1",
+			ExpectedCode: http.StatusNoContent,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("1", 1).WillReturnRows(storedRows())
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteTestQuery).WithArgs("johndoe").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			req := httptest.NewRequest(tt.Method, tt.Path, bytes.NewBufferString(tt.Body))
+			req.Header.Set("Content-Type", scim.ContentType)
+			for key, value := range tt.Header {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+			if tt.ExpectedScimType != "" {
+				var scimErr scim.Error
+				assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &scimErr))
+				assert.Equal(t, tt.ExpectedScimType, scimErr.ScimType)
+			}
+			if tt.Check != nil {
+				tt.Check(t, w)
+			}
+			assert.Equal(t, nil, mock.ExpectationsWereMet())
+		})
+	}
+}
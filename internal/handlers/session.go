@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/session"
+	"go-manage-mysql/internal/utils/web"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets users see where they are logged in and sign out
+// devices, and admins do the same for any user.
+type SessionHandler struct {
+	Service *session.Service
+}
+
+func NewSessionHandler(service *session.Service) *SessionHandler {
+	return &SessionHandler{Service: service}
+}
+
+type sessionView struct {
+	models.Session
+	// Current is the session the request comes from
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) ListOwnSessionsHandler(ctx *gin.Context) {
+	h.list(ctx, middleware.Username(ctx))
+}
+
+func (h *SessionHandler) EndOwnSessionHandler(ctx *gin.Context) {
+	h.end(ctx, middleware.Username(ctx))
+}
+
+// EndOtherSessionsHandler signs the caller out everywhere but the session
+// the request comes from.
+func (h *SessionHandler) EndOtherSessionsHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	ended, endErr := h.Service.EndOthers(ctx, middleware.Username(ctx), ctx.GetString(middleware.SessionIDKey))
+	if endErr != nil {
+		web.NewError(ctx, sessionStatus(endErr), endErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.EndSessionsMessage, http.StatusOK, gin.H{"ended": ended}))
+}
+
+func (h *SessionHandler) ListSessionsHandler(ctx *gin.Context) {
+	h.list(ctx, ctx.Query("username"))
+}
+
+func (h *SessionHandler) EndSessionHandler(ctx *gin.Context) {
+	h.end(ctx, "")
+}
+
+func (h *SessionHandler) list(ctx *gin.Context, username string) {
+	ctx.Header("Content-Type", "application/json")
+
+	sessions, listErr := h.Service.List(ctx, username)
+	if listErr != nil {
+		web.NewError(ctx, sessionStatus(listErr), listErr.Error())
+		return
+	}
+	current := ctx.GetString(middleware.SessionIDKey)
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == current})
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.ListSessionsMessage, http.StatusOK, views))
+}
+
+// end only finds the sessions of username, other users' sessions look
+// missing.
+func (h *SessionHandler) end(ctx *gin.Context, username string) {
+	ctx.Header("Content-Type", "application/json")
+
+	if endErr := h.Service.End(ctx, ctx.Param("id"), username); endErr != nil {
+		web.NewError(ctx, sessionStatus(endErr), endErr.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, usersResponse(config.EndSessionMessage, http.StatusOK, nil))
+}
+
+func sessionStatus(err error) int {
+	if errors.Is(err, config.ErrSessionNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
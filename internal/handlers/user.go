@@ -3,19 +3,24 @@ package handlers
 import (
 	"errors"
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/middleware"
 	"go-manage-mysql/internal/models"
 	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/session"
 	"go-manage-mysql/internal/utils/validator"
+	"go-manage-mysql/internal/utils/web"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"github.com/gustyaguero21/go-core/pkg/web"
 )
 
 type Handler struct {
 	Service services.UserServices
+	// Sessions, when set, records a session for every login
+	Sessions *session.Service
 }
 
 func NewUserHandler(service services.UserServices) *Handler {
@@ -39,11 +44,11 @@ func (h *Handler) CreateUserHandler(ctx *gin.Context) {
 
 	create, createErr := h.Service.CreateUser(ctx, user)
 	if createErr != nil {
-		web.NewError(ctx, http.StatusInternalServerError, createErr.Error())
+		web.NewError(ctx, errorStatus(createErr), createErr.Error())
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, usersResponse(config.CreatedUserMessage, http.StatusCreated, create))
+	ctx.JSON(http.StatusCreated, usersResponse(config.CreatedUserMessage, http.StatusCreated, withoutPassword(create)))
 }
 
 func (h *Handler) SearchUserHandler(ctx *gin.Context) {
@@ -61,7 +66,7 @@ func (h *Handler) SearchUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, usersResponse(config.SearchUserMessage, http.StatusOK, search))
+	ctx.JSON(http.StatusOK, usersResponse(config.SearchUserMessage, http.StatusOK, withoutPassword(search)))
 }
 
 func (h *Handler) UpdateUserHandler(ctx *gin.Context) {
@@ -86,7 +91,7 @@ func (h *Handler) UpdateUserHandler(ctx *gin.Context) {
 	}
 
 	if update := h.Service.UpdateUser(ctx, username, update); update != nil {
-		web.NewError(ctx, http.StatusInternalServerError, update.Error())
+		web.NewError(ctx, errorStatus(update), update.Error())
 		return
 	}
 
@@ -125,6 +130,12 @@ func (h *Handler) ChangePwdHandler(ctx *gin.Context) {
 		return
 	}
 
+	// a one-time password only allows changing its own password
+	if ctx.GetBool(middleware.PasswordChangeKey) && user.Username != ctx.GetString(middleware.UsernameKey) {
+		web.NewError(ctx, http.StatusForbidden, config.PasswordChangeMessage)
+		return
+	}
+
 	if changeErr := h.Service.ChangeUserPwd(ctx, user.Username, user.Password); changeErr != nil {
 		web.NewError(ctx, http.StatusInternalServerError, changeErr.Error())
 		return
@@ -148,7 +159,7 @@ func (h *Handler) LoginUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	err := h.Service.LoginUser(ctx, user.Username, user.Password)
+	login, err := h.Service.LoginUser(ctx, user.Username, user.Password)
 	if err != nil {
 		if errors.Is(err, config.ErrRecordNotFound) {
 			web.NewError(ctx, http.StatusNotFound, config.ErrUserNotFound.Error())
@@ -159,26 +170,72 @@ func (h *Handler) LoginUserHandler(ctx *gin.Context) {
 		}
 	}
 
-	tokenString, err := generateJWT(user.Username)
+	tokenString, err := issueToken(ctx, h.Sessions, login)
 	if err != nil {
 		web.NewError(ctx, http.StatusInternalServerError, "error generating token")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, usersResponse("WELCOME "+user.Username, http.StatusOK, tokenString))
+	message := "WELCOME " + user.Username
+	if login.MustChangePassword {
+		message += ". " + config.PasswordChangeMessage
+	}
+	ctx.JSON(http.StatusOK, usersResponse(message, http.StatusOK, tokenString))
+}
+
+// issueToken starts a session for user when sessions are recorded and
+// returns a token bound to it.
+func issueToken(ctx *gin.Context, sessions *session.Service, user models.User) (string, error) {
+	var sessionID string
+	if sessions != nil {
+		started, err := sessions.Start(ctx, user, ctx.Request.UserAgent(), ctx.ClientIP())
+		if err != nil {
+			return "", err
+		}
+		sessionID = started.ID
+	}
+
+	tokenString, err := generateJWT(user, sessionID)
+	if err != nil {
+		return "", err
+	}
+	metrics.TokensIssued.Inc()
+	return tokenString, nil
 }
 
-func generateJWT(username string) (string, error) {
-	token_time := config.GetTokenValidTime()
+func generateJWT(user models.User, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
-		"username": username,
-		"exp":      time.Now().Add(time.Hour * time.Duration(token_time)).Unix(),
+		middleware.UserIDKey: user.ID,
+		"username":           user.Username,
+		"role":               user.Role,
+		"exp":                time.Now().Add(config.GetTokenValidTime()).Unix(),
+	}
+	if user.MustChangePassword {
+		claims[middleware.PasswordChangeKey] = true
+	}
+	if sessionID != "" {
+		claims[middleware.SessionIDKey] = sessionID
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(config.GetToken()))
 }
 
+// errorStatus is 409 when a unique field is taken, 500 otherwise.
+func errorStatus(err error) int {
+	if errors.Is(err, config.ErrUserAlreadyExists) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// withoutPassword leaves the hash out of a user sent back, the password is
+// write only.
+func withoutPassword(user models.User) models.User {
+	user.Password = ""
+	return user
+}
+
 func usersResponse(msg string, status int, data interface{}) models.UserResponse {
 	return models.UserResponse{
 		Message: msg,
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
 	"go-manage-mysql/internal/mocks"
+	"go-manage-mysql/internal/models"
 	"go-manage-mysql/internal/repository"
 	"go-manage-mysql/internal/services"
 	"log"
@@ -14,6 +17,8 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt"
 	"github.com/gustyaguero21/go-core/pkg/encrypter"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -51,11 +56,7 @@ func TestCreateUserHandler(t *testing.T) {
 			Name:         "Success",
 			Body:         mocks.CreateUser,
 			ExpectedCode: http.StatusCreated,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.SaveTestQuery).
@@ -78,6 +79,18 @@ func TestCreateUserHandler(t *testing.T) {
 			ExistsMock:   func() {},
 			MockAct:      func() {},
 		},
+		{
+			Name:         "Conflict",
+			Body:         mocks.CreateUser,
+			ExpectedCode: http.StatusConflict,
+			ExistsMock:   func() {},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe' for key 'users.username'"})
+				mock.ExpectRollback()
+			},
+		},
 		{
 			Name:         "Error",
 			Body:         mocks.CreateUser,
@@ -210,13 +223,13 @@ func TestUpdate(t *testing.T) {
 			Body:         mocks.UpdateUser,
 			ExpectedCode: http.StatusOK,
 			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
 					WithArgs("johndoe", 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "password"}).
 						AddRow(1, "John", "Doe", "johndoe", "1234567890", "johndoe@example.com", "Password1234"))
 			},
 			MockAct: func() {
-				mock.ExpectBegin()
 				mock.ExpectExec(config.UpdateTestQuery).
 					WithArgs("Johncito", "Doecito", "23456789", "johncitodoecito@example.com", "johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
@@ -252,13 +265,24 @@ func TestUpdate(t *testing.T) {
 			Username:     "johndoe",
 			Body:         mocks.UpdateUser,
 			ExpectedCode: http.StatusInternalServerError,
+			ExistsMock:   func() {},
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Conflict",
+			Username:     "johndoe",
+			Body:         mocks.UpdateUser,
+			ExpectedCode: http.StatusConflict,
 			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "1234567890", "johndoe@example.com", "Password1234"))
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 			},
 			MockAct: func() {
+				mock.ExpectExec(config.UpdateTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johncitodoecito@example.com' for key 'users.email'"})
+				mock.ExpectRollback()
 			},
 		},
 	}
@@ -312,12 +336,7 @@ func TestDelete(t *testing.T) {
 			Name:         "Success",
 			Username:     "johndoe",
 			ExpectedCode: http.StatusOK,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "johndoe@example.com", "Password1234"))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.DeleteTestQuery).
@@ -339,12 +358,7 @@ func TestDelete(t *testing.T) {
 			Name:         "Error",
 			Username:     "johndoe",
 			ExpectedCode: http.StatusInternalServerError,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "johndoe@example.com", "Password1234"))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 			},
 		},
@@ -401,16 +415,11 @@ func TestChangePwdHandler(t *testing.T) {
 			Name:         "Success",
 			Body:         mocks.ChangePwd,
 			ExpectedCode: http.StatusOK,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "johndoe@example.com", "Password1234"))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
-					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WithArgs(false, sqlmock.AnyArg(), "johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 			},
@@ -437,12 +446,7 @@ func TestChangePwdHandler(t *testing.T) {
 			Name:         "Error",
 			Body:         mocks.ChangePwd,
 			ExpectedCode: http.StatusInternalServerError,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "johndoe@example.com", "Password1234"))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 			},
 		},
@@ -499,12 +503,7 @@ func TestLoginUserHandler(t *testing.T) {
 				"password":"Password1234"
 			}`,
 			ExpectedCode: http.StatusOK,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "username", "email", "password"}).
-						AddRow(1, "John", "Doe", "johndoe", "johndoe@example.com", "Password1234"))
-			},
+			ExistsMock:   func() {},
 			MockAct: func() {
 				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
 
@@ -586,3 +585,51 @@ func TestLoginUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginPasswordChangeRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	handler := NewUserHandler(services.NewUserServices(repository.NewUserRepository(gormDB)))
+
+	r := gin.New()
+	r.POST("/login", handler.LoginUserHandler)
+	r.PATCH("/change-password", middleware.JWTMiddleware(), handler.ChangePwdHandler)
+
+	hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
+	mock.ExpectQuery(config.SearchTestQuery).
+		WithArgs("admin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "must_change_password"}).
+			AddRow(1, "admin", hashedPwd, models.RoleAdmin, true))
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"username": "admin", "password": "Password1234"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var login models.UserResponse
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.Equal(t, "WELCOME admin. "+config.PasswordChangeMessage, login.Message)
+
+	token, _ := login.Data.(string)
+	parsed, _ := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte(config.GetToken()), nil })
+	assert.Equal(t, true, parsed.Claims.(jwt.MapClaims)[middleware.PasswordChangeKey])
+
+	req, _ = http.NewRequest(http.MethodPatch, "/change-password", bytes.NewBufferString(mocks.ChangePwd))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, nil, mock.ExpectationsWereMet())
+}
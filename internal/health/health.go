@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// check statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// CheckFunc reports a dependency as healthy by returning nil.
+type CheckFunc func(ctx context.Context) error
+
+type CheckResult struct {
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	LatencyMs     float64    `json:"latency_ms"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastCheckedAt time.Time  `json:"last_checked_at"`
+}
+
+type Report struct {
+	Status       string        `json:"status"`
+	ShuttingDown bool          `json:"shutting_down,omitempty"`
+	Checks       []CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt *time.Time
+}
+
+// Registry holds the readiness checks of every dependency. Components add
+// themselves with Register.
+type Registry struct {
+	timeout time.Duration
+
+	mu           sync.RWMutex
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named check; registering a name again replaces it.
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.checks {
+		if c.name == name {
+			r.checks[i] = &check{name: name, fn: fn}
+			return
+		}
+	}
+	r.checks = append(r.checks, &check{name: name, fn: fn})
+	sort.Slice(r.checks, func(i, j int) bool { return r.checks[i].name < r.checks[j].name })
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing traffic.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+// Check runs every registered check concurrently, each bounded by the registry timeout.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]*check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, r.timeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results, ShuttingDown: r.shuttingDown.Load()}
+	if report.ShuttingDown {
+		report.Status = StatusDown
+	}
+	for _, result := range results {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (c *check) run(ctx context.Context, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	result := CheckResult{
+		Name:          c.name,
+		Status:        StatusUp,
+		LatencyMs:     float64(time.Since(start).Microseconds()) / 1000,
+		LastCheckedAt: start.UTC(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		at := start.UTC()
+		c.lastError = err.Error()
+		c.lastErrorAt = &at
+		result.Status = StatusDown
+	}
+	result.LastError = c.lastError
+	result.LastErrorAt = c.lastErrorAt
+	return result
+}
@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	test := []struct {
+		Name           string
+		Checks         map[string]CheckFunc
+		ShuttingDown   bool
+		ExpectedStatus string
+	}{
+		{
+			Name:           "No Checks",
+			ExpectedStatus: StatusUp,
+		},
+		{
+			Name: "All Up",
+			Checks: map[string]CheckFunc{
+				"database": func(ctx context.Context) error { return nil },
+				"cache":    func(ctx context.Context) error { return nil },
+			},
+			ExpectedStatus: StatusUp,
+		},
+		{
+			Name: "One Down",
+			Checks: map[string]CheckFunc{
+				"database": func(ctx context.Context) error { return errors.New("connection refused") },
+				"cache":    func(ctx context.Context) error { return nil },
+			},
+			ExpectedStatus: StatusDown,
+		},
+		{
+			Name: "Timeout",
+			Checks: map[string]CheckFunc{
+				"slow": func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				},
+			},
+			ExpectedStatus: StatusDown,
+		},
+		{
+			Name:           "Shutting Down",
+			ShuttingDown:   true,
+			ExpectedStatus: StatusDown,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			registry := NewRegistry(50 * time.Millisecond)
+			for name, fn := range tt.Checks {
+				registry.Register(name, fn)
+			}
+			if tt.ShuttingDown {
+				registry.SetShuttingDown()
+			}
+
+			report := registry.Check(context.Background())
+
+			assert.Equal(t, tt.ExpectedStatus, report.Status)
+			assert.Len(t, report.Checks, len(tt.Checks))
+		})
+	}
+}
+
+func TestCheckKeepsLastError(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	fail := true
+	registry.Register("database", func(ctx context.Context) error {
+		if fail {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	report := registry.Check(context.Background())
+	assert.Equal(t, StatusDown, report.Checks[0].Status)
+	assert.Equal(t, "connection refused", report.Checks[0].LastError)
+
+	fail = false
+	report = registry.Check(context.Background())
+	assert.Equal(t, StatusUp, report.Checks[0].Status)
+	assert.Equal(t, "connection refused", report.Checks[0].LastError)
+	assert.NotNil(t, report.Checks[0].LastErrorAt)
+}
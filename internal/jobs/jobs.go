@@ -0,0 +1,300 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"gorm.io/gorm"
+)
+
+type JobServices interface {
+	Submit(ctx context.Context, jobType string, params json.RawMessage, createdBy string) (job models.Job, err error)
+	Get(ctx context.Context, id string) (job models.Job, err error)
+	Cancel(ctx context.Context, id string) (job models.Job, err error)
+}
+
+// errStopped is returned by a task that stopped between two batches, the
+// cause of its stop context tells why.
+var errStopped = errors.New("job stopped")
+
+var errCancelRequested = errors.New("job cancel requested")
+
+// Manager queues jobs and runs them with a pool of workers. Every instance
+// may run one, a job is claimed by a single worker at a time.
+type Manager struct {
+	repo  repository.JobRepository
+	users services.UserServices
+	cfg   config.JobsConfig
+	// owner marks the claims of this instance
+	owner string
+	wake  chan struct{}
+}
+
+var _ JobServices = (*Manager)(nil)
+
+func NewManager(repo repository.JobRepository, users services.UserServices, cfg config.JobsConfig) *Manager {
+	return &Manager{repo: repo, users: users, cfg: cfg, owner: uuid.NewString(), wake: make(chan struct{}, 1)}
+}
+
+// Submit validates params for jobType and queues the job.
+func (m *Manager) Submit(ctx context.Context, jobType string, params json.RawMessage, createdBy string) (job models.Job, err error) {
+	ctx, span := tracing.Start(ctx, "jobs.Submit")
+	defer func() { tracing.End(span, err) }()
+
+	t, ok := tasks[jobType]
+	if !ok {
+		return models.Job{}, apperror.AppError(config.ErrSubmittingJob, config.ErrUnknownJobType)
+	}
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	if checkErr := t.check(params); checkErr != nil {
+		return models.Job{}, apperror.AppError(config.ErrSubmittingJob, fmt.Errorf("%w: %v", config.ErrInvalidJobParams, checkErr))
+	}
+
+	job = models.Job{
+		ID:        uuid.NewString(),
+		Type:      jobType,
+		State:     models.JobQueued,
+		Params:    params,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if createErr := m.repo.Create(ctx, job); createErr != nil {
+		return models.Job{}, apperror.AppError(config.ErrSubmittingJob, createErr)
+	}
+	metrics.JobsSubmitted.WithLabelValues(jobType).Inc()
+
+	// an idle worker of this instance starts right away
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (job models.Job, err error) {
+	ctx, span := tracing.Start(ctx, "jobs.Get")
+	defer func() { tracing.End(span, err) }()
+
+	job, getErr := m.repo.Get(ctx, id)
+	if getErr != nil {
+		return models.Job{}, apperror.AppError(config.ErrSearchingJob, notFound(getErr))
+	}
+	return job, nil
+}
+
+// Cancel cancels a queued job at once, a running one stops after its current
+// batch.
+func (m *Manager) Cancel(ctx context.Context, id string) (job models.Job, err error) {
+	ctx, span := tracing.Start(ctx, "jobs.Cancel")
+	defer func() { tracing.End(span, err) }()
+
+	job, cancelErr := m.repo.Cancel(ctx, id)
+	if cancelErr != nil {
+		return models.Job{}, apperror.AppError(config.ErrCancellingJob, notFound(cancelErr))
+	}
+	if job.State == models.JobCancelled {
+		metrics.JobsFinished.WithLabelValues(job.Type, models.JobCancelled).Inc()
+	}
+	return job, nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return config.ErrJobNotFound
+	}
+	return err
+}
+
+// Run claims and runs jobs with cfg.Workers workers until ctx is done. A job
+// still running then is queued again and resumed by the next worker to
+// claim it, here or in another instance.
+func (m *Manager) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for range m.cfg.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			m.work(ctx)
+		}()
+	}
+	workers.Wait()
+}
+
+func (m *Manager) work(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// every claimable job is run before waiting again
+		for ctx.Err() == nil && m.runNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// runNext runs the next claimable job, false when there was none.
+func (m *Manager) runNext(ctx context.Context) bool {
+	job, err := m.repo.Claim(ctx, m.owner, time.Now().UTC().Add(-m.cfg.StaleAfter))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error claiming job", "error", err)
+		}
+		return false
+	}
+	m.execute(ctx, job)
+	return true
+}
+
+// execute runs a claimed job and records how it ended. The batch in flight
+// is always finished, ctx only keeps the next one from starting.
+func (m *Manager) execute(ctx context.Context, job models.Job) {
+	logger := slog.With("job_id", job.ID, "job_type", job.Type)
+	workCtx, span := tracing.Start(context.WithoutCancel(ctx), "jobs."+job.Type)
+	defer span.End()
+
+	stop, halt := context.WithCancelCause(ctx)
+	defer halt(nil)
+	var beating sync.WaitGroup
+	beating.Add(1)
+	go func() {
+		defer beating.Done()
+		m.heartbeat(stop, halt, job)
+	}()
+
+	metrics.JobsRunning.Inc()
+	defer metrics.JobsRunning.Dec()
+	if job.Processed > 0 {
+		logger.InfoContext(workCtx, "resuming job", "processed", job.Processed, "total", job.Total)
+	}
+
+	p := &progress{job: job, repo: m.repo, stop: stop}
+	var err error
+	switch t, ok := tasks[job.Type]; {
+	case job.CancelRequested:
+		halt(errCancelRequested)
+		err = errStopped
+	case !ok:
+		err = config.ErrUnknownJobType
+	default:
+		err = t.run(workCtx, m.users, p)
+	}
+	cause := context.Cause(stop)
+	halt(nil)
+	beating.Wait()
+
+	switch {
+	case err == nil:
+		p.job.State, p.job.Progress = models.JobSucceeded, 100
+	case errors.Is(err, config.ErrJobLost) || errors.Is(err, errStopped) && errors.Is(cause, config.ErrJobLost):
+		logger.WarnContext(workCtx, "job taken over by another worker")
+		return
+	case !errors.Is(err, errStopped):
+		p.job.State, p.job.Error = models.JobFailed, err.Error()
+	case errors.Is(cause, errCancelRequested):
+		p.job.State = models.JobCancelled
+	default:
+		if releaseErr := m.repo.Release(workCtx, p.job); releaseErr != nil {
+			logger.ErrorContext(workCtx, "error releasing job", "error", releaseErr)
+			return
+		}
+		logger.InfoContext(workCtx, "job interrupted, it is resumed on the next start", "processed", p.job.Processed)
+		return
+	}
+
+	if finishErr := m.repo.Finish(workCtx, p.job); finishErr != nil {
+		logger.ErrorContext(workCtx, "error finishing job", "error", finishErr)
+		return
+	}
+	metrics.JobsFinished.WithLabelValues(job.Type, p.job.State).Inc()
+	logger.InfoContext(workCtx, "job finished", "state", p.job.State, "processed", p.job.Processed, "error", p.job.Error)
+}
+
+// heartbeat keeps the claim of job alive and halts it when a cancel is
+// requested or the claim is lost.
+func (m *Manager) heartbeat(stop context.Context, halt context.CancelCauseFunc, job models.Job) {
+	ticker := time.NewTicker(m.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cancelRequested, err := m.repo.Heartbeat(stop, job)
+		switch {
+		case errors.Is(err, config.ErrJobLost):
+			halt(config.ErrJobLost)
+			return
+		case err != nil:
+			if stop.Err() == nil {
+				slog.WarnContext(stop, "error sending job heartbeat", "job_id", job.ID, "error", err)
+			}
+		case cancelRequested:
+			halt(errCancelRequested)
+			return
+		}
+	}
+}
+
+// progress is the state of a running job shared with its task.
+type progress struct {
+	job  models.Job
+	repo repository.JobRepository
+	stop context.Context
+}
+
+// save stores the counters and the partial result, then returns errStopped
+// when the job must not start another batch.
+func (p *progress) save(ctx context.Context, result interface{}) error {
+	if err := p.setResult(result); err != nil {
+		return err
+	}
+	if err := p.repo.SaveProgress(ctx, p.job); err != nil {
+		return err
+	}
+	if p.stop.Err() != nil {
+		return errStopped
+	}
+	return nil
+}
+
+func (p *progress) setResult(result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	p.job.Result = data
+	p.job.Progress = 0
+	if p.job.Total > 0 {
+		p.job.Progress = min(100, p.job.Processed*100/p.job.Total)
+	}
+	return nil
+}
+
+// result decodes the partial result left by an interrupted run, if any.
+func (p *progress) result(v interface{}) error {
+	if len(p.job.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(p.job.Result, v)
+}
@@ -0,0 +1,408 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var testConfig = config.JobsConfig{Workers: 1, PollInterval: time.Hour, HeartbeatInterval: time.Hour, StaleAfter: 2 * time.Hour}
+
+func testManager(t *testing.T) (*Manager, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	users := services.NewUserServices(repository.NewUserRepository(gormDB))
+	return NewManager(repository.NewJobRepository(gormDB), users, testConfig), mock
+}
+
+// captured keeps the last value it matched.
+type captured struct {
+	value driver.Value
+}
+
+func (c *captured) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func (c *captured) json(t *testing.T, v interface{}) {
+	data, ok := c.value.([]byte)
+	if !assert.True(t, ok, "captured %T", c.value) {
+		return
+	}
+	assert.NoError(t, json.Unmarshal(data, v))
+}
+
+func TestSubmit(t *testing.T) {
+	manager, mock := testManager(t)
+
+	test := []struct {
+		Name        string
+		Type        string
+		Params      string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name:   "Success",
+			Type:   models.JobDisable,
+			Params: `{"role":"user"}`,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Unknown Type",
+			Type:        "explode",
+			ExpectedErr: config.ErrUnknownJobType,
+			MockAct:     func() {},
+		},
+		{
+			Name:        "Empty Selection",
+			Type:        models.JobResetPassword,
+			ExpectedErr: config.ErrInvalidJobParams,
+			MockAct:     func() {},
+		},
+		{
+			Name:        "Unknown Param",
+			Type:        models.JobDisable,
+			Params:      `{"role":"user","everyone":true}`,
+			ExpectedErr: config.ErrInvalidJobParams,
+			MockAct:     func() {},
+		},
+		{
+			Name: "Reencrypt Without Params",
+			Type: models.JobReencrypt,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Unreadable Import",
+			Type:        models.JobImport,
+			Params:      `{"format":"csv","data":"username,username\n"}`,
+			ExpectedErr: config.ErrInvalidJobParams,
+			MockAct:     func() {},
+		},
+		{
+			Name:        "Db Error",
+			Type:        models.JobImport,
+			Params:      `{"format":"ndjson","data":"{\"username\":\"johndoe\"}\n"}`,
+			ExpectedErr: config.ErrDbError,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateJobTestQuery).WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			job, err := manager.Submit(context.Background(), tt.Type, json.RawMessage(tt.Params), "admin")
+
+			if tt.ExpectedErr != nil {
+				assert.ErrorIs(t, err, tt.ExpectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, models.JobQueued, job.State)
+				assert.Equal(t, "admin", job.CreatedBy)
+				assert.NotEmpty(t, job.ID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetAndCancel(t *testing.T) {
+	manager, mock := testManager(t)
+
+	t.Run("Get Not Found", func(t *testing.T) {
+		mock.ExpectQuery(config.GetJobTestQuery).WithArgs("job-1", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := manager.Get(context.Background(), "job-1")
+
+		assert.ErrorIs(t, err, config.ErrJobNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Cancel Finished", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(config.LockJobTestQuery).WithArgs("job-1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow("job-1", models.JobFailed))
+		mock.ExpectRollback()
+
+		_, err := manager.Cancel(context.Background(), "job-1")
+
+		assert.ErrorIs(t, err, config.ErrJobFinished)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func userRows(users ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "username"})
+	for i, username := range users {
+		rows.AddRow(string(rune('1'+i)), username)
+	}
+	return rows
+}
+
+func TestExecute(t *testing.T) {
+	manager, mock := testManager(t)
+	disable := models.Job{
+		ID:        "job-1",
+		Type:      models.JobDisable,
+		State:     models.JobRunning,
+		Params:    json.RawMessage(`{"role":"user"}`),
+		Owner:     "worker-1",
+		CreatedBy: "admin",
+	}
+	importData := `{"username":"johndoe","name":"John","surname":"Doe","email":"johndoe@example.com","phone":"123456","password":"Password1234"}
+{"username":"janedoe","name":"Jane","surname":"Doe","email":"janedoe@example.com","phone":"654321","password":"Password1234"}
+{"username":"jimdoe","name":"Jim","surname":"Doe","email":"jimdoe@example.com","phone":"111111","password":"Password1234"}
+`
+
+	// finish and progress updates set their columns in name order:
+	// cursor, error, finished_at, owner, processed, progress, result, state, total,
+	// a nil result is written inline
+	test := []struct {
+		Name     string
+		Job      func() models.Job
+		Shutdown bool
+		MockAct  func(result, state *captured)
+		Check    func(t *testing.T, result, state *captured)
+	}{
+		{
+			Name: "Disable Succeeds",
+			Job:  func() models.Job { return disable },
+			MockAct: func(result, state *captured) {
+				mock.ExpectQuery(config.CountTestQuery).WithArgs(models.RoleUser).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery(config.ExportTestQuery).WillReturnRows(userRows("johndoe", "admin"))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableManyTestQuery).WithArgs(true, "johndoe", false).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("2", "", sqlmock.AnyArg(), "", []byte(`{}`), 2, 100, result, state, 2, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				var counts SelectionResult
+				result.json(t, &counts)
+				assert.Equal(t, SelectionResult{Changed: 1, Skipped: 1}, counts)
+				assert.Equal(t, models.JobSucceeded, state.value)
+			},
+		},
+		{
+			Name: "Cancelled Before Start",
+			Job: func() models.Job {
+				job := disable
+				job.CancelRequested = true
+				return job
+			},
+			MockAct: func(result, state *captured) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", "", sqlmock.AnyArg(), "", []byte(`{}`), 0, 0, state, 0, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				assert.Equal(t, models.JobCancelled, state.value)
+			},
+		},
+		{
+			Name: "Failure Recorded",
+			Job:  func() models.Job { return disable },
+			MockAct: func(result, state *captured) {
+				mock.ExpectQuery(config.CountTestQuery).WillReturnError(config.ErrDbError)
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", result, sqlmock.AnyArg(), "", []byte(`{}`), 0, 0, state, 0, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				assert.Contains(t, result.value, config.ErrDbError.Error())
+				assert.Equal(t, models.JobFailed, state.value)
+			},
+		},
+		{
+			Name: "Reencrypt Fails Without Encryption",
+			Job: func() models.Job {
+				job := disable
+				job.Type = models.JobReencrypt
+				job.Params = json.RawMessage(`{}`)
+				return job
+			},
+			MockAct: func(result, state *captured) {
+				mock.ExpectQuery(config.CountTestQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", result, sqlmock.AnyArg(), "", []byte(`{}`), 0, 0, state, 2, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				assert.Contains(t, result.value, config.ErrEncryptionOff.Error())
+				assert.Equal(t, models.JobFailed, state.value)
+			},
+		},
+		{
+			Name:     "Shutdown Releases After The Batch",
+			Job:      func() models.Job { return disable },
+			Shutdown: true,
+			MockAct: func(result, state *captured) {
+				mock.ExpectQuery(config.CountTestQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(config.ExportTestQuery).WillReturnRows(userRows("johndoe"))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableManyTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("1", sqlmock.AnyArg(), 1, 100, result, 1, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", state, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				var counts SelectionResult
+				result.json(t, &counts)
+				assert.Equal(t, SelectionResult{Changed: 1}, counts)
+				assert.Equal(t, models.JobQueued, state.value)
+			},
+		},
+		{
+			Name: "Import Resumed",
+			Job: func() models.Job {
+				done, _ := json.Marshal(services.ImportReport{
+					Mode:    services.ImportInsert,
+					Total:   1,
+					Created: 1,
+					Rows:    []services.ImportRow{{Row: 1, Username: "johndoe", Result: services.RowCreated}},
+				})
+				params, _ := json.Marshal(ImportParams{Format: "ndjson", Data: importData})
+				return models.Job{
+					ID:        "job-1",
+					Type:      models.JobImport,
+					State:     models.JobRunning,
+					Params:    params,
+					Total:     3,
+					Processed: 1,
+					Result:    done,
+					Owner:     "worker-1",
+				}
+			},
+			MockAct: func(result, state *captured) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).
+					WithArgs("janedoe", "jimdoe", "janedoe@example.com", "jimdoe@example.com", "654321", "111111").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", "", sqlmock.AnyArg(), "", []byte(`{}`), 3, 100, result, state, 3, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Check: func(t *testing.T, result, state *captured) {
+				var report services.ImportReport
+				result.json(t, &report)
+				assert.Equal(t, 3, report.Total)
+				assert.Equal(t, 3, report.Created)
+				assert.Equal(t, []int{1, 2, 3}, []int{report.Rows[0].Row, report.Rows[1].Row, report.Rows[2].Row})
+				assert.Equal(t, "jimdoe", report.Rows[2].Username)
+				assert.Equal(t, models.JobSucceeded, state.value)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			result, state := &captured{}, &captured{}
+			tt.MockAct(result, state)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.Shutdown {
+				cancel()
+			}
+			manager.execute(ctx, tt.Job())
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+			tt.Check(t, result, state)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	manager, mock := testManager(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(config.ClaimJobTestQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "state", "params", "cancel_requested"}).
+			AddRow("job-1", models.JobDisable, models.JobQueued, []byte(`{"role":"user"}`), true))
+	mock.ExpectExec(config.UpdateJobTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(config.UpdateJobTestQuery).
+		WithArgs("", "", sqlmock.AnyArg(), "", []byte(`{}`), 0, 0, models.JobCancelled, 0, "job-1", manager.owner, models.JobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// nothing left, the worker waits
+	mock.ExpectBegin()
+	mock.ExpectQuery(config.ClaimJobTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers did not stop")
+	}
+}
@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"io"
+	"slices"
+	"strings"
+)
+
+// task runs one type of job.
+type task struct {
+	// check validates the params of a submitted job
+	check func(params json.RawMessage) error
+	// run does the work, saving progress after every batch through p. A
+	// resumed job carries on from the counters and cursor of p.job.
+	run func(ctx context.Context, users services.UserServices, p *progress) error
+}
+
+var tasks = map[string]task{
+	models.JobImport: {check: checkImport, run: runImport},
+	models.JobDisable: {check: checkSelection, run: func(ctx context.Context, users services.UserServices, p *progress) error {
+		return runSelection(ctx, users, p, users.DisableUsers)
+	}},
+	models.JobResetPassword: {check: checkSelection, run: func(ctx context.Context, users services.UserServices, p *progress) error {
+		return runSelection(ctx, users, p, users.ExpirePasswords)
+	}},
+	models.JobReencrypt: {check: checkReencrypt, run: runReencrypt},
+}
+
+// Types lists the job types that can be submitted.
+var Types = []string{models.JobImport, models.JobDisable, models.JobResetPassword, models.JobReencrypt}
+
+// ImportParams are the params of an import job, the file travels inline.
+type ImportParams struct {
+	Format string `json:"format"`
+	// Mode defaults to insert
+	Mode   string `json:"mode,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+	Data   string `json:"data"`
+}
+
+// Selection picks the users of a disable or reset_password job. At least one
+// criterion is required, the admin submitting the job is never changed.
+type Selection struct {
+	Role           string   `json:"role,omitempty"`
+	UsernamePrefix string   `json:"username_prefix,omitempty"`
+	Usernames      []string `json:"usernames,omitempty"`
+}
+
+// SelectionResult counts the users a disable or reset_password job went
+// through. Skipped users already were in the target state or submitted the
+// job.
+type SelectionResult struct {
+	Changed int `json:"changed"`
+	Skipped int `json:"skipped"`
+}
+
+// ReencryptParams are the params of a reencrypt job.
+type ReencryptParams struct {
+	// Rotate starts with a new data key, every user ends up encrypted with it
+	Rotate bool `json:"rotate,omitempty"`
+}
+
+// ReencryptResult counts the users a reencrypt job went through. Unchanged
+// users already were encrypted with the current data key.
+type ReencryptResult struct {
+	Reencrypted int `json:"reencrypted"`
+	Unchanged   int `json:"unchanged"`
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func checkImport(params json.RawMessage) error {
+	var p ImportParams
+	if err := decodeParams(params, &p); err != nil {
+		return err
+	}
+	if p.Mode != "" && p.Mode != services.ImportInsert && p.Mode != services.ImportUpsert {
+		return fmt.Errorf("mode must be %s or %s", services.ImportInsert, services.ImportUpsert)
+	}
+	if p.Data == "" {
+		return errors.New("data is required")
+	}
+	// a file that cannot be read is refused before it is queued
+	_, err := countRecords(p)
+	return err
+}
+
+// countRecords reads the whole file, rows with invalid values count too.
+func countRecords(p ImportParams) (int, error) {
+	reader, err := bulk.NewReader(p.Format, strings.NewReader(p.Data))
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for {
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+func runImport(ctx context.Context, users services.UserServices, p *progress) error {
+	var params ImportParams
+	if err := json.Unmarshal(p.job.Params, &params); err != nil {
+		return err
+	}
+	if params.Mode == "" {
+		params.Mode = services.ImportInsert
+	}
+	if p.job.Processed == 0 {
+		total, err := countRecords(params)
+		if err != nil {
+			return err
+		}
+		p.job.Total = total
+	}
+
+	// the rows written before an interruption are kept and skipped
+	done := services.ImportReport{Mode: params.Mode, DryRun: params.DryRun, Rows: []services.ImportRow{}}
+	if err := p.result(&done); err != nil {
+		return err
+	}
+	reader, err := bulk.NewReader(params.Format, strings.NewReader(params.Data))
+	if err != nil {
+		return err
+	}
+
+	merge := func(report services.ImportReport) services.ImportReport {
+		merged := done
+		merged.Rows = slices.Clone(done.Rows)
+		merged.Append(report)
+		return merged
+	}
+	cfg := config.Current().Bulk
+	report, err := users.ImportUsers(ctx, &skipReader{Reader: reader, skip: p.job.Processed}, services.ImportOptions{
+		Mode:        params.Mode,
+		DryRun:      params.DryRun,
+		BatchSize:   cfg.BatchSize,
+		HashWorkers: cfg.HashWorkers,
+		Progress: func(report services.ImportReport) error {
+			partial := merge(report)
+			p.job.Processed = partial.Total
+			return p.save(ctx, partial)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	final := merge(report)
+	p.job.Processed = final.Total
+	return p.setResult(final)
+}
+
+// skipReader drops the records an interrupted run already imported.
+type skipReader struct {
+	bulk.Reader
+	skip int
+}
+
+func (r *skipReader) Read() (bulk.Record, error) {
+	for ; r.skip > 0; r.skip-- {
+		if _, err := r.Reader.Read(); err != nil {
+			return bulk.Record{}, err
+		}
+	}
+	return r.Reader.Read()
+}
+
+func checkSelection(params json.RawMessage) error {
+	var s Selection
+	if err := decodeParams(params, &s); err != nil {
+		return err
+	}
+	if s.Role == "" && s.UsernamePrefix == "" && len(s.Usernames) == 0 {
+		return errors.New("role, username_prefix or usernames is required")
+	}
+	if s.Role != "" && s.Role != models.RoleUser && s.Role != models.RoleAdmin {
+		return config.ErrInvalidRole
+	}
+	return nil
+}
+
+// runSelection applies apply to every selected user in id order, the cursor
+// is the last id done.
+func runSelection(ctx context.Context, users services.UserServices, p *progress, apply func(ctx context.Context, usernames []string) (int64, error)) error {
+	var s Selection
+	if err := json.Unmarshal(p.job.Params, &s); err != nil {
+		return err
+	}
+	filter := repository.UserFilter{Role: s.Role, UsernamePrefix: s.UsernamePrefix, Usernames: s.Usernames}
+	if p.job.Cursor == "" {
+		total, err := users.CountUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+		p.job.Total = int(total)
+	}
+
+	var result SelectionResult
+	if err := p.result(&result); err != nil {
+		return err
+	}
+	filter.AfterID = p.job.Cursor
+
+	var applyErr error
+	err := users.ExportUsers(ctx, filter, config.Current().Bulk.BatchSize, func(batch []models.User) error {
+		usernames := make([]string, 0, len(batch))
+		for _, user := range batch {
+			if user.Username != p.job.CreatedBy {
+				usernames = append(usernames, user.Username)
+			}
+		}
+		changed, err := apply(ctx, usernames)
+		if err != nil {
+			applyErr = err
+			return err
+		}
+
+		result.Changed += int(changed)
+		result.Skipped += len(batch) - int(changed)
+		p.job.Processed += len(batch)
+		p.job.Cursor = batch[len(batch)-1].ID
+		return p.save(ctx, result)
+	})
+	if applyErr != nil {
+		return applyErr
+	}
+	if err != nil {
+		return err
+	}
+	return p.setResult(result)
+}
+
+func checkReencrypt(params json.RawMessage) error {
+	var p ReencryptParams
+	return decodeParams(params, &p)
+}
+
+// runReencrypt walks every user in id order, the cursor is the last id done.
+func runReencrypt(ctx context.Context, users services.UserServices, p *progress) error {
+	var params ReencryptParams
+	if err := json.Unmarshal(p.job.Params, &params); err != nil {
+		return err
+	}
+	if p.job.Cursor == "" {
+		if params.Rotate {
+			if err := users.RotateDataKey(ctx); err != nil {
+				return err
+			}
+		}
+		total, err := users.CountUsers(ctx, repository.UserFilter{})
+		if err != nil {
+			return err
+		}
+		p.job.Total = int(total)
+	}
+
+	var result ReencryptResult
+	if err := p.result(&result); err != nil {
+		return err
+	}
+	for {
+		batch, err := users.ReencryptUsers(ctx, p.job.Cursor, config.Current().Bulk.BatchSize)
+		if err != nil {
+			return err
+		}
+		if batch.Read == 0 {
+			return p.setResult(result)
+		}
+
+		result.Reencrypted += batch.Changed
+		result.Unchanged += batch.Read - batch.Changed
+		p.job.Processed += batch.Read
+		p.job.Cursor = batch.LastID
+		if err := p.save(ctx, result); err != nil {
+			return err
+		}
+	}
+}
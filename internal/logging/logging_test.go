@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Level: "info", Format: "json"}, &buf)
+
+	logger.Info("login",
+		"username", "johndoe",
+		"password", "hunter2",
+		"new_password", "hunter3",
+		"token_secret", "jwt-key",
+		"Authorization", "Bearer abc",
+		"header", "Basic dXNlcjpwd2Q=",
+	)
+
+	assert.NotContains(t, buf.String(), "hunter")
+	assert.NotContains(t, buf.String(), "jwt-key")
+	assert.NotContains(t, buf.String(), "abc")
+	assert.NotContains(t, buf.String(), "dXNlcjpwd2Q")
+
+	record := decode(t, &buf)[0]
+	assert.Equal(t, "johndoe", record["username"])
+	assert.Equal(t, Redacted, record["password"])
+	assert.Equal(t, Redacted, record["header"])
+}
+
+func TestLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Level: "warn", Format: "text"}, &buf)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "level=WARN msg=shown")
+	assert.Equal(t, slog.LevelDebug, ParseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("unknown"))
+}
+
+func TestContextIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogConfig{Level: "info", Format: "json"}, &buf)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithLogger(ctx, logger.With("component", "test"))
+
+	FromContext(ctx).InfoContext(ctx, "hello")
+
+	record := decode(t, &buf)[0]
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", record["span_id"])
+	assert.Equal(t, "test", record["component"])
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+}
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	gormLogger := NewGormLogger(New(config.LogConfig{Level: "info", Format: "json"}, &buf), 100*time.Millisecond)
+	ctx := context.Background()
+
+	sql, params := gormLogger.ParamsFilter(ctx, "SELECT * FROM users WHERE password = ?", "hash")
+	assert.Equal(t, "SELECT * FROM users WHERE password = ?", sql)
+	assert.Nil(t, params)
+
+	query := func() (string, int64) { return "SELECT * FROM `users`", 1 }
+
+	gormLogger.Trace(ctx, time.Now(), query, nil)
+	assert.Empty(t, buf.String())
+
+	gormLogger.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	gormLogger.Trace(ctx, time.Now(), query, errors.New("connection refused"))
+
+	records := decode(t, &buf)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "slow query", records[0]["msg"])
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Equal(t, "query failed", records[1]["msg"])
+	assert.Equal(t, "connection refused", records[1]["error"])
+}
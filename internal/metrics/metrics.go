@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "gomanage"
+
+// Registry holds every collector exposed on /metrics.
+var Registry = prometheus.NewRegistry()
+
+// http
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+)
+
+// database
+var (
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "GORM query latency by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "GORM queries that returned an error, excluding record not found.",
+	}, []string{"operation", "table"})
+
+	DBQueryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_retries_total",
+		Help:      "Reads run again after a transient error.",
+	}, []string{"operation"})
+
+	DBRouting = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "routing_total",
+		Help:      "Statements routed by target (primary or replica) and reason.",
+	}, []string{"target", "reason"})
+
+	DBReplicaUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "replica_up",
+		Help:      "Whether a read replica is currently taking reads.",
+	}, []string{"replica"})
+)
+
+// cache
+var (
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "User lookups by cache result.",
+	}, []string{"result"})
+
+	CacheErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "errors_total",
+		Help:      "Failed cache operations, the database was used instead.",
+	}, []string{"operation"})
+)
+
+// cache results
+const (
+	CacheHit         = "hit"
+	CacheNegativeHit = "negative_hit"
+	CacheMiss        = "miss"
+)
+
+// cache operations
+const (
+	CacheGet    = "get"
+	CacheSet    = "set"
+	CacheDelete = "delete"
+)
+
+// rate limits
+var (
+	RateLimitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_total",
+		Help:      "Requests rejected with 429 by rate limit policy.",
+	}, []string{"policy"})
+
+	RateLimitErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "errors_total",
+		Help:      "Failed calls to the rate limit store, the requests were let through.",
+	})
+)
+
+// auth and business
+var (
+	PasswordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time spent hashing or verifying passwords.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2},
+	}, []string{"operation"})
+
+	PasswordRehashes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "password_rehashes_total",
+		Help:      "Password hashes replaced at login because their algorithm or settings were outdated.",
+	})
+
+	UsersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "created_total",
+		Help:      "Users created.",
+	})
+
+	UsersDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "deleted_total",
+		Help:      "Users deleted.",
+	})
+
+	UsersImported = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "imported_rows_total",
+		Help:      "Import rows by result: created, updated, invalid, conflict or failed.",
+	}, []string{"result"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	TokensIssued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "tokens_issued_total",
+		Help:      "JWTs issued.",
+	})
+
+	OAuthTokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oauth",
+		Name:      "tokens_issued_total",
+		Help:      "Token responses of the openid connect provider by grant type.",
+	}, []string{"grant_type"})
+
+	FederatedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "federated_logins_total",
+		Help:      "Logins through external identity providers by provider and result: linked, provisioned, existing or failed.",
+	}, []string{"provider", "result"})
+)
+
+// jobs
+var (
+	JobsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "submitted_total",
+		Help:      "Jobs queued by type.",
+	}, []string{"type"})
+
+	JobsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "finished_total",
+		Help:      "Jobs finished by type and final state: succeeded, failed or cancelled.",
+	}, []string{"type", "state"})
+
+	JobsRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "running",
+		Help:      "Jobs currently run by this instance.",
+	})
+)
+
+// login results
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+)
+
+// password hash operations
+const (
+	HashOperation   = "hash"
+	VerifyOperation = "verify"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration, HTTPInFlight,
+		DBQueryDuration, DBQueryErrors, DBQueryRetries, DBRouting, DBReplicaUp,
+		CacheRequests, CacheErrors,
+		RateLimitRejected, RateLimitErrors,
+		PasswordHashDuration, PasswordRehashes, UsersCreated, UsersDeleted, UsersImported, Logins, TokensIssued, OAuthTokensIssued,
+		FederatedLogins,
+		JobsSubmitted, JobsFinished, JobsRunning,
+	)
+
+	for _, result := range []string{LoginSucceeded, LoginFailed} {
+		Logins.WithLabelValues(result)
+	}
+}
+
+// ObservePasswordHash records how long a hashing operation started at start took.
+func ObservePasswordHash(operation string, start time.Time) {
+	PasswordHashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
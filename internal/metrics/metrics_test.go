@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(GinMiddleware())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", Handler())
+
+	test := []struct {
+		Name   string
+		Path   string
+		Route  string
+		Status string
+	}{
+		{Name: "Route Template", Path: "/users/42", Route: "/users/:id", Status: "200"},
+		{Name: "Other Id Same Series", Path: "/users/43", Route: "/users/:id", Status: "200"},
+		{Name: "Unmatched", Path: "/random/path", Route: UnmatchedRoute, Status: "404"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			before := testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, tt.Route, tt.Status))
+
+			req := httptest.NewRequest(http.MethodGet, tt.Path, nil)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, before+1, testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, tt.Route, tt.Status)))
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `gomanage_http_requests_total{method="GET",route="/users/:id",status="200"}`))
+	assert.False(t, strings.Contains(w.Body.String(), "/users/42"))
+}
+
+func TestGormPlugin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	assert.NoError(t, gormDB.Use(GormPlugin{}))
+	assert.NoError(t, RegisterDBStats(gormDB, "test"))
+	assert.NoError(t, RegisterDBStats(gormDB, "test"))
+
+	type widget struct {
+		ID   int
+		Name string
+	}
+
+	mock.ExpectQuery("SELECT \\* FROM `widgets`").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+	mock.ExpectQuery("SELECT \\* FROM `widgets`").WillReturnError(errors.New("db error"))
+	mock.ExpectQuery("SELECT \\* FROM `widgets`").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	errorsBefore := testutil.ToFloat64(DBQueryErrors.WithLabelValues("query", "widgets"))
+
+	var found widget
+	assert.NoError(t, gormDB.First(&found).Error)
+	assert.Error(t, gormDB.First(&found).Error)
+	assert.ErrorIs(t, gormDB.First(&found).Error, gorm.ErrRecordNotFound)
+
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(DBQueryErrors.WithLabelValues("query", "widgets")))
+	assert.Equal(t, 1, testutil.CollectAndCount(DBQueryDuration, "gomanage_db_query_duration_seconds"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
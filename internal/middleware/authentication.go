@@ -1,39 +1,230 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/scim"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"github.com/gustyaguero21/go-core/pkg/web"
 )
 
+// context keys filled from the token claims or the api key
+const (
+	UsernameKey       = "username"
+	RoleKey           = "role"
+	PasswordChangeKey = "pwd_change"
+	ScopesKey         = "scopes"
+	APIKeyIDKey       = "api_key_id"
+	// SessionIDKey is also the claim carrying the session of a token
+	SessionIDKey = "sid"
+	// UserIDKey is the claim carrying the id of the user a token was issued to
+	UserIDKey = "user_id"
+)
+
+// Username returns the authenticated user behind ctx, empty when anonymous.
+// It works on the gin context and on any context derived from it.
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(UsernameKey).(string)
+	return username
+}
+
+// Principal is who a request is authenticated as.
+type Principal struct {
+	// UserID is only known for user tokens
+	UserID         string
+	Username       string
+	Role           string
+	PasswordChange bool
+	// Scopes limit the routes an api key can call, nil for user tokens
+	Scopes []string
+	// KeyID is the api key the request used, empty for user tokens
+	KeyID string
+	// SessionID is the login session of a user token, empty for api keys
+	SessionID string
+}
+
+// Authenticator checks one kind of credentials. It reports ok false when the
+// request does not carry them, so the next authenticator can try.
+type Authenticator interface {
+	Authenticate(ctx *gin.Context) (principal Principal, ok bool, err error)
+}
+
+// Authenticate lets through requests the first authenticator carrying its
+// credentials accepts, and fills the context keys from the principal.
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, authenticator := range authenticators {
+			principal, ok, err := authenticator.Authenticate(ctx)
+			if err != nil {
+				authFailed(ctx, err)
+				return
+			}
+			if !ok {
+				continue
+			}
+
+			ctx.Set(UsernameKey, principal.Username)
+			ctx.Set(RoleKey, principal.Role)
+			ctx.Set(PasswordChangeKey, principal.PasswordChange)
+			if principal.KeyID != "" {
+				ctx.Set(ScopesKey, principal.Scopes)
+				ctx.Set(APIKeyIDKey, principal.KeyID)
+			}
+			if principal.SessionID != "" {
+				ctx.Set(SessionIDKey, principal.SessionID)
+			}
+			ctx.Next()
+			return
+		}
+
+		authFailed(ctx, config.ErrMissingToken)
+	}
+}
+
+func authFailed(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, config.ErrUserDisabled):
+		web.NewError(ctx, http.StatusForbidden, err.Error())
+	case errors.Is(err, config.ErrMissingToken), errors.Is(err, config.ErrTokenFormat), errors.Is(err, config.ErrInvalidToken),
+		errors.Is(err, config.ErrInvalidAPIKey), errors.Is(err, config.ErrAPIKeyExpired), errors.Is(err, config.ErrSessionEnded):
+		web.NewError(ctx, http.StatusUnauthorized, err.Error())
+	default:
+		slog.ErrorContext(ctx, "authentication failed", "error", err)
+		web.NewError(ctx, http.StatusInternalServerError, config.ErrAuthenticating)
+	}
+	ctx.Abort()
+}
+
+// SessionChecker tells whether the login session of a token is still active.
+type SessionChecker interface {
+	CheckSession(ctx context.Context, id, userID string) error
+}
+
+// JWT authenticates the bearer tokens issued at login. With Sessions set,
+// tokens without a session or of an ended one are refused.
+type JWT struct {
+	Sessions SessionChecker
+}
+
+func (j JWT) Authenticate(ctx *gin.Context) (Principal, bool, error) {
+	authHeader := ctx.GetHeader("Authorization")
+	if authHeader == "" {
+		return Principal{}, false, nil
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return Principal{}, false, config.ErrTokenFormat
+	}
+
+	token, err := jwt.Parse(parts[1], func(t *jwt.Token) (interface{}, error) {
+		return []byte(config.GetToken()), nil
+	})
+	if err != nil {
+		return Principal{}, false, config.ErrInvalidToken
+	}
+
+	var principal Principal
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		principal.UserID, _ = claims[UserIDKey].(string)
+		principal.Username, _ = claims["username"].(string)
+		principal.Role, _ = claims["role"].(string)
+		principal.PasswordChange, _ = claims[PasswordChangeKey].(bool)
+		principal.SessionID, _ = claims[SessionIDKey].(string)
+	}
+	if j.Sessions != nil {
+		// every token issued while sessions are recorded carries one
+		if principal.SessionID == "" {
+			return Principal{}, false, config.ErrInvalidToken
+		}
+		if err := j.Sessions.CheckSession(ctx, principal.SessionID, principal.UserID); err != nil {
+			return Principal{}, false, err
+		}
+	}
+	return principal, true, nil
+}
+
+// JWTMiddleware only accepts the bearer tokens issued at login.
 func JWTMiddleware() gin.HandlerFunc {
+	return Authenticate(JWT{})
+}
+
+// RequireScope lets api keys through only when they hold scope, user tokens
+// are not limited by scopes. It must run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if scopes, restricted := ctx.Get(ScopesKey); restricted && !slices.Contains(scopes.([]string), scope) {
+			web.NewError(ctx, http.StatusForbidden, "api key lacks the "+scope+" scope")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireUserToken refuses api keys, for routes such as managing the keys
+// themselves. It must run after Authenticate.
+func RequireUserToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString(APIKeyIDKey) != "" {
+			web.NewError(ctx, http.StatusForbidden, "api keys cannot call this route")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireAdmin only lets through requests authenticated as an admin. It must
+// run after Authenticate.
+func RequireAdmin() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		jwtSecret := []byte(config.GetToken())
-		authHeader := ctx.GetHeader("Authorization")
-		if authHeader == "" {
-			web.NewError(ctx, http.StatusUnauthorized, "required token")
+		if ctx.GetString(RoleKey) != models.RoleAdmin {
+			web.NewError(ctx, http.StatusForbidden, "admin role required")
 			ctx.Abort()
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			web.NewError(ctx, http.StatusUnauthorized, "invalid token format")
+		ctx.Next()
+	}
+}
+
+// RequirePasswordChanged rejects tokens issued to users that still have to
+// replace a one-time password. It must run after Authenticate.
+func RequirePasswordChanged() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetBool(PasswordChangeKey) {
+			web.NewError(ctx, http.StatusForbidden, config.PasswordChangeMessage)
 			ctx.Abort()
 			return
 		}
 
-		tokenString := parts[1]
+		ctx.Next()
+	}
+}
 
-		_, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil {
-			web.NewError(ctx, http.StatusUnauthorized, "invalid token")
+// RequireSCIMToken only lets through identity providers presenting the scim
+// token, user JWTs are not accepted. Without a configured token every request
+// is refused.
+func RequireSCIMToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := config.Current().SCIM.Token
+		presented, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			ctx.Header("Content-Type", scim.ContentType)
+			ctx.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			ctx.JSON(http.StatusUnauthorized, scim.NewError(http.StatusUnauthorized, "", "missing or invalid scim token"))
 			ctx.Abort()
 			return
 		}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"go-manage-mysql/cmd/config"
 	"net/http"
 	"net/http/httptest"
@@ -49,3 +51,270 @@ func TestJWTMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireAdmin(t *testing.T) {
+	sign := func(role string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "testuser", "role": role}).
+			SignedString([]byte(config.GetToken()))
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		expectStatus int
+	}{
+		{"Admin", sign("admin"), http.StatusOK},
+		{"User", sign("user"), http.StatusForbidden},
+		{"No Role", sign(""), http.StatusForbidden},
+		{"Missing Token", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.Default()
+			r.Use(JWTMiddleware(), RequireAdmin())
+			r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequirePasswordChanged(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GetToken()))
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		expectStatus int
+	}{
+		{"Regular Token", sign(jwt.MapClaims{"username": "testuser"}), http.StatusOK},
+		{"Pending Change", sign(jwt.MapClaims{"username": "admin", PasswordChangeKey: true}), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(JWTMiddleware(), RequirePasswordChanged())
+			r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("Authorization", tt.token)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireSCIMToken(t *testing.T) {
+	const scimToken = "scim-token-used-by-the-identity-provider"
+
+	tests := []struct {
+		name         string
+		configured   string
+		token        string
+		expectStatus int
+	}{
+		{"Valid Token", scimToken, "Bearer " + scimToken, http.StatusOK},
+		{"Wrong Token", scimToken, "Bearer other-token", http.StatusUnauthorized},
+		{"Missing Token", scimToken, "", http.StatusUnauthorized},
+		{"Disabled", "", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *config.Current()
+			cfg.SCIM.Token = tt.configured
+			config.SetCurrent(&cfg)
+			t.Cleanup(func() { config.SetCurrent(nil) })
+
+			r := gin.New()
+			r.Use(RequireSCIMToken())
+			r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+// keyAuthenticator accepts the "good" key from the X-Test-Key header.
+type keyAuthenticator struct{}
+
+func (keyAuthenticator) Authenticate(ctx *gin.Context) (Principal, bool, error) {
+	switch ctx.GetHeader("X-Test-Key") {
+	case "":
+		return Principal{}, false, nil
+	case "good":
+		return Principal{Username: "svc", Role: "admin", Scopes: []string{"users:read"}, KeyID: "key-1"}, true, nil
+	case "broken":
+		return Principal{}, false, errors.New("database is down")
+	}
+	return Principal{}, false, config.ErrInvalidAPIKey
+}
+
+func TestAuthenticateChain(t *testing.T) {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "testuser"}).SignedString([]byte(config.GetToken()))
+
+	tests := []struct {
+		name         string
+		token        string
+		key          string
+		scope        string
+		expectStatus int
+	}{
+		{"JWT", "Bearer " + token, "", "users:write", http.StatusOK},
+		{"Key With Scope", "", "good", "users:read", http.StatusOK},
+		{"Key Without Scope", "", "good", "users:write", http.StatusForbidden},
+		{"Invalid Key", "", "bad", "users:read", http.StatusUnauthorized},
+		{"Key Lookup Failed", "", "broken", "users:read", http.StatusInternalServerError},
+		{"Invalid JWT Is Not Retried", "Bearer invalid", "good", "users:read", http.StatusUnauthorized},
+		{"No Credentials", "", "", "users:read", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Authenticate(JWT{}, keyAuthenticator{}), RequireScope(tt.scope))
+			r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			if tt.key != "" {
+				req.Header.Set("X-Test-Key", tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireUserToken(t *testing.T) {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "testuser"}).SignedString([]byte(config.GetToken()))
+
+	tests := []struct {
+		name         string
+		token        string
+		key          string
+		expectStatus int
+	}{
+		{"JWT", "Bearer " + token, "", http.StatusOK},
+		{"Key", "", "good", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Authenticate(JWT{}, keyAuthenticator{}), RequireUserToken())
+			r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			if tt.key != "" {
+				req.Header.Set("X-Test-Key", tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+// sessionChecker only knows the active session "active", of the user "1".
+type sessionChecker struct{}
+
+func (sessionChecker) CheckSession(ctx context.Context, id, userID string) error {
+	switch {
+	case id == "active" && userID == "1":
+		return nil
+	case id == "broken":
+		return errors.New("database is down")
+	}
+	return config.ErrSessionEnded
+}
+
+func TestJWTSessions(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GetToken()))
+		return token
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		expectStatus int
+		expectSID    string
+	}{
+		{"Active Session", sign(jwt.MapClaims{UserIDKey: "1", "username": "testuser", SessionIDKey: "active"}), http.StatusOK, "active"},
+		{"Ended Session", sign(jwt.MapClaims{UserIDKey: "1", "username": "testuser", SessionIDKey: "ended"}), http.StatusUnauthorized, ""},
+		{"Session Of Another User", sign(jwt.MapClaims{UserIDKey: "2", "username": "testuser", SessionIDKey: "active"}), http.StatusUnauthorized, ""},
+		{"Session Lookup Failed", sign(jwt.MapClaims{UserIDKey: "1", "username": "testuser", SessionIDKey: "broken"}), http.StatusInternalServerError, ""},
+		{"Token Without Session", sign(jwt.MapClaims{UserIDKey: "1", "username": "testuser"}), http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sid string
+			r := gin.New()
+			r.Use(Authenticate(JWT{Sessions: sessionChecker{}}))
+			r.GET("/test", func(c *gin.Context) {
+				sid = c.GetString(SessionIDKey)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.expectStatus, w.Code)
+			}
+			if sid != tt.expectSID {
+				t.Errorf("%s: expected session %q, got %q", tt.name, tt.expectSID, sid)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"go-manage-mysql/internal/logging"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	RequestIDKey    = "request_id"
+)
+
+// incoming ids are echoed back, so only short, printable ones are accepted
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID accepts the caller's X-Request-ID or generates one, and stores a
+// request scoped logger in the request context.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		ctx.Set(RequestIDKey, id)
+		ctx.Header(RequestIDHeader, id)
+
+		reqCtx := logging.WithRequestID(ctx.Request.Context(), id)
+		logger := slog.Default().With(slog.String("method", ctx.Request.Method), slog.String("path", ctx.Request.URL.Path))
+		ctx.Request = ctx.Request.WithContext(logging.WithLogger(reqCtx, logger))
+
+		ctx.Next()
+	}
+}
+
+// AccessLog writes one record per request once the response is sent.
+func AccessLog() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		reqCtx := ctx.Request.Context()
+		attrs := []slog.Attr{
+			slog.String("route", ctx.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", ctx.ClientIP()),
+			slog.Int("size", ctx.Writer.Size()),
+		}
+		if errs := ctx.Errors.String(); errs != "" {
+			attrs = append(attrs, slog.String("errors", errs))
+		}
+		logging.FromContext(reqCtx).LogAttrs(reqCtx, level, "request", attrs...)
+	}
+}
+
+// Recovery logs panics through the request logger and answers 500.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(ctx *gin.Context, err any) {
+		reqCtx := ctx.Request.Context()
+		logging.FromContext(reqCtx).ErrorContext(reqCtx, "panic recovered", "panic", err)
+		web.NewError(ctx, http.StatusInternalServerError, "internal server error")
+		ctx.Abort()
+	})
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/logging"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expectID func(t *testing.T, id string)
+	}{
+		{"Accepts Valid Header", "req-123", func(t *testing.T, id string) {
+			assert.Equal(t, "req-123", id)
+		}},
+		{"Generates When Missing", "", func(t *testing.T, id string) {
+			assert.Len(t, id, 36)
+		}},
+		{"Replaces Invalid Header", "bad id\r\nx", func(t *testing.T, id string) {
+			assert.Len(t, id, 36)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromCtx string
+			r := gin.New()
+			r.Use(RequestID())
+			r.GET("/test", func(c *gin.Context) {
+				fromCtx = logging.RequestID(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			tt.expectID(t, w.Header().Get(RequestIDHeader))
+			assert.Equal(t, w.Header().Get(RequestIDHeader), fromCtx)
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(config.LogConfig{Level: "info", Format: "json"}, &buf))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	r := gin.New()
+	r.Use(RequestID(), AccessLog(), Recovery())
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-456")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `"request_id":"req-456"`)
+	assert.NotContains(t, buf.String(), "secret-token")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "req-456", record["request_id"])
+	assert.Equal(t, "/panic", record["route"])
+	assert.Equal(t, float64(http.StatusInternalServerError), record["status"])
+}
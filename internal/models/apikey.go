@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// APIKey lets an integration call the api as its owner, limited to the
+// routes its scopes allow. The key is shown once, only the hash of its
+// secret is kept; the prefix identifies it in listings and lookups.
+type APIKey struct {
+	ID         string     `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	Name       string     `gorm:"type:varchar(255);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(32);not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	UserID     string     `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	Username   string     `gorm:"type:varchar(255);not null;index" json:"username"`
+	Scopes     []string   `gorm:"type:json;not null;serializer:json" json:"scopes"`
+	CreatedBy  string     `gorm:"type:varchar(255);not null" json:"created_by"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (APIKey) TableName() string { return "api_keys" }
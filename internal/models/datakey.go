@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DataKey encrypts personal data. It is stored wrapped by a master key and
+// only unwrapped in memory, the newest one encrypts new values. IndexCheck
+// identifies the index key the blind indexes were computed with.
+type DataKey struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	MasterKeyID string    `gorm:"type:varchar(64);not null" json:"master_key_id"`
+	Wrapped     []byte    `gorm:"type:varbinary(255);not null" json:"-"`
+	IndexCheck  string    `gorm:"type:char(64);not null;default:''" json:"-"`
+	CreatedAt   time.Time `gorm:"not null;index" json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// erasure request states
+const (
+	ErasurePending   = "pending"
+	ErasureCancelled = "cancelled"
+	ErasureCompleted = "completed"
+)
+
+// ErasureRequest asks for the data of a user to be erased once its grace
+// period is over. A completed request keeps the receipt of the erasure and
+// the id of the user, but no longer its username.
+type ErasureRequest struct {
+	ID          string          `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	UserID      string          `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	Username    string          `gorm:"type:varchar(255);not null" json:"username"`
+	RequestedBy string          `gorm:"type:varchar(255);not null" json:"requested_by"`
+	State       string          `gorm:"type:varchar(16);not null;index:idx_erasures_state_scheduled,priority:1" json:"state"`
+	RequestedAt time.Time       `gorm:"not null" json:"requested_at"`
+	ScheduledAt time.Time       `gorm:"not null;index:idx_erasures_state_scheduled,priority:2" json:"scheduled_at"`
+	CancelledAt *time.Time      `json:"cancelled_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	Receipt     *ErasureReceipt `gorm:"type:json;serializer:json" json:"receipt,omitempty"`
+}
+
+// ErasureReceipt records how many rows of each table an erasure deleted, how
+// many it kept with the user's name redacted and, by table and column, how
+// many documents naming the user it emptied.
+type ErasureReceipt struct {
+	RequestID   string           `json:"request_id"`
+	UserID      string           `json:"user_id"`
+	RequestedAt time.Time        `json:"requested_at"`
+	CompletedAt time.Time        `json:"completed_at"`
+	Deleted     map[string]int64 `json:"deleted"`
+	Redacted    map[string]int64 `json:"redacted"`
+	Scrubbed    map[string]int64 `json:"scrubbed"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// FederatedIdentity links an account at an external openid connect provider,
+// known by its issuer and subject, to a user.
+type FederatedIdentity struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Provider    string    `gorm:"type:varchar(64);not null" json:"provider"`
+	UserID      string    `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	Email       string    `gorm:"type:varchar(255);not null;default:''" json:"email"`
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	LastLoginAt time.Time `gorm:"not null" json:"last_login_at"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// job types
+const (
+	JobImport        = "import"
+	JobDisable       = "disable"
+	JobResetPassword = "reset_password"
+	JobReencrypt     = "reencrypt"
+)
+
+// job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+type Job struct {
+	ID        string          `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	Type      string          `gorm:"type:varchar(32);not null" json:"type"`
+	State     string          `gorm:"type:varchar(16);not null;index:idx_jobs_state_created,priority:1" json:"state"`
+	Params    json.RawMessage `gorm:"type:json;not null" json:"-"`
+	Total     int             `gorm:"not null;default:0" json:"total"`
+	Processed int             `gorm:"not null;default:0" json:"processed"`
+	Progress  int             `gorm:"not null;default:0" json:"progress"`
+	Result    json.RawMessage `gorm:"type:json" json:"result,omitempty"`
+	Error     string          `gorm:"type:text" json:"error,omitempty"`
+	CreatedBy string          `gorm:"type:varchar(255);not null" json:"created_by"`
+
+	// Cursor is where a resumed job carries on
+	Cursor          string     `gorm:"type:varchar(255);not null;default:''" json:"-"`
+	Owner           string     `gorm:"type:varchar(64);not null;default:''" json:"-"`
+	HeartbeatAt     *time.Time `json:"-"`
+	CancelRequested bool       `gorm:"not null;default:false" json:"cancel_requested"`
+
+	CreatedAt  time.Time  `gorm:"not null;index:idx_jobs_state_created,priority:2" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job reached a final state.
+func (j Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// token kinds
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// OAuthClient is an application allowed to sign users in through the api.
+// Public clients, such as single page apps, have no secret.
+type OAuthClient struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36);not null" json:"client_id"`
+	Name         string    `gorm:"type:varchar(255);not null" json:"name"`
+	SecretHash   string    `gorm:"type:varchar(64);not null;default:''" json:"-"`
+	RedirectURIs []string  `gorm:"type:json;not null;serializer:json" json:"redirect_uris"`
+	Public       bool      `gorm:"not null;default:false" json:"public"`
+	CreatedBy    string    `gorm:"type:varchar(255);not null" json:"created_by"`
+	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+}
+
+func (OAuthClient) TableName() string { return "oauth_clients" }
+
+// OAuthCode is an authorization code, kept by its hash until it expires.
+type OAuthCode struct {
+	Hash string `gorm:"primaryKey;type:varchar(64);not null"`
+	// GrantID is shared by the code and every token issued from it
+	GrantID       string    `gorm:"type:varchar(36);not null"`
+	ClientID      string    `gorm:"type:varchar(36);not null"`
+	UserID        string    `gorm:"type:varchar(36);not null"`
+	RedirectURI   string    `gorm:"type:text;not null"`
+	Scope         string    `gorm:"type:varchar(255);not null"`
+	Nonce         string    `gorm:"type:varchar(255);not null;default:''"`
+	CodeChallenge string    `gorm:"type:varchar(128);not null"`
+	AuthTime      time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+}
+
+func (OAuthCode) TableName() string { return "oauth_codes" }
+
+// OAuthToken is an access or refresh token, kept by its hash.
+type OAuthToken struct {
+	Hash      string    `gorm:"primaryKey;type:varchar(64);not null"`
+	Kind      string    `gorm:"type:varchar(16);not null"`
+	GrantID   string    `gorm:"type:varchar(36);not null;index"`
+	ClientID  string    `gorm:"type:varchar(36);not null;index"`
+	UserID    string    `gorm:"type:varchar(36);not null"`
+	Scope     string    `gorm:"type:varchar(255);not null"`
+	AuthTime  time.Time `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+}
+
+func (OAuthToken) TableName() string { return "oauth_tokens" }
+
+// Active reports whether the token can still be used at now.
+func (t OAuthToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. Tokens issued at login carry its
+// id and stop working as soon as it ends.
+type Session struct {
+	ID         string     `gorm:"primaryKey;type:varchar(36);not null" json:"id"`
+	UserID     string     `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	Username   string     `gorm:"type:varchar(255);not null;index" json:"username"`
+	UserAgent  string     `gorm:"type:varchar(255);not null" json:"user_agent"`
+	IP         string     `gorm:"type:varchar(45);not null" json:"ip"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -1,13 +1,28 @@
 package models
 
+// user roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID       string `gorm:"primaryKey;type:varchar(36);not null;unique" json:"id"`
-	Name     string `gorm:"type:varchar(255);not null" json:"name"`
-	Surname  string `gorm:"type:varchar(255);not null" json:"surname"`
+	Name     string `gorm:"type:varchar(512);not null" json:"name"`
+	Surname  string `gorm:"type:varchar(512);not null" json:"surname"`
 	Username string `gorm:"type:varchar(255);not null;unique" json:"username"`
-	Phone    string `gorm:"type:varchar(255);not null;unique" json:"phone"`
-	Email    string `gorm:"type:varchar(255);not null;unique" json:"email"`
-	Password string `gorm:"type:varchar(255);not null" json:"password"`
+	Phone    string `gorm:"type:varchar(512);not null;unique" json:"phone"`
+	Email    string `gorm:"type:varchar(512);not null;unique" json:"email"`
+	Password string `gorm:"type:varchar(255);not null" json:"password,omitempty"`
+	Role     string `gorm:"type:varchar(32);not null;default:user" json:"role"`
+	Disabled bool   `gorm:"not null;default:false" json:"disabled"`
+
+	MustChangePassword bool `gorm:"not null;default:false" json:"must_change_password"`
+
+	// blind indexes of the encrypted email and phone, they keep both unique
+	// and searchable. Nil while the user is stored in plaintext.
+	EmailIndex *string `gorm:"type:char(64);unique" json:"-"`
+	PhoneIndex *string `gorm:"type:char(64);unique" json:"-"`
 }
 
 type UserResponse struct {
@@ -0,0 +1,249 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// routes, relative to the base path
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	Prefix        = "/oauth2"
+)
+
+// scopes
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopePhone         = "phone"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// Scopes lists the supported scopes in the order they are granted.
+var Scopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeOfflineAccess}
+
+// error codes of RFC 6749, 6750 and 7009
+const (
+	InvalidRequest          = "invalid_request"
+	InvalidClient           = "invalid_client"
+	InvalidGrant            = "invalid_grant"
+	InvalidScope            = "invalid_scope"
+	InvalidToken            = "invalid_token"
+	UnauthorizedClient      = "unauthorized_client"
+	UnsupportedGrantType    = "unsupported_grant_type"
+	UnsupportedResponseType = "unsupported_response_type"
+	UnsupportedTokenType    = "unsupported_token_type"
+	AccessDenied            = "access_denied"
+	ServerError             = "server_error"
+)
+
+// Error is an oauth error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func NewError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, Status: status}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func badRequest(code, description string) *Error {
+	return NewError(http.StatusBadRequest, code, description)
+}
+
+// Metadata is the discovery document of OpenID Connect Discovery 1.0.
+type Metadata struct {
+	Issuer                                 string   `json:"issuer"`
+	AuthorizationEndpoint                  string   `json:"authorization_endpoint"`
+	TokenEndpoint                          string   `json:"token_endpoint"`
+	UserinfoEndpoint                       string   `json:"userinfo_endpoint"`
+	JWKSURI                                string   `json:"jwks_uri"`
+	IntrospectionEndpoint                  string   `json:"introspection_endpoint"`
+	RevocationEndpoint                     string   `json:"revocation_endpoint"`
+	ScopesSupported                        []string `json:"scopes_supported"`
+	ResponseTypesSupported                 []string `json:"response_types_supported"`
+	GrantTypesSupported                    []string `json:"grant_types_supported"`
+	SubjectTypesSupported                  []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported       []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported      []string `json:"token_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethods       []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethods          []string `json:"revocation_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported          []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                        []string `json:"claims_supported"`
+	AuthorizationResponseIssParamSupported bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+// KeySet is a JSON Web Key Set holding the public signing key.
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func newJWK(key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// KeyID is the RFC 7638 thumbprint of key, it changes with the key so
+// clients refetch the key set on rotation.
+func KeyID(key *rsa.PublicKey) string {
+	jwk := newJWK(key)
+	// members in lexicographic order, without whitespace
+	thumb := sha256.Sum256([]byte(`{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`))
+	return base64.RawURLEncoding.EncodeToString(thumb[:])
+}
+
+// LoadKey reads a pem rsa private key in PKCS #1 or PKCS #8 form.
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not pem encoded")
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				return nil, errors.New("signing key is not an rsa key")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected pem block %q in signing key", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing key: %w", err)
+	}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("signing key must have at least 2048 bits")
+	}
+	return key, nil
+}
+
+// ValidRedirectURI follows RFC 8252: https, http on a loopback address, or
+// a private-use scheme of a native app, never with a fragment.
+func ValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.Contains(uri, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || net.ParseIP(host).IsLoopback()
+	}
+	// private-use schemes are reverse domain names, such as com.example.app
+	return strings.Contains(u.Scheme, ".")
+}
+
+// ParseScope keeps the supported scopes of a space separated list, unknown
+// ones are ignored as OpenID Connect asks.
+func ParseScope(scope string) []string {
+	requested := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		requested[s] = true
+	}
+	var granted []string
+	for _, s := range Scopes {
+		if requested[s] {
+			granted = append(granted, s)
+		}
+	}
+	return granted
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// PKCE verifiers are 43 to 128 unreserved characters, S256 challenges the
+// unpadded base64url of a sha256
+var (
+	verifierPattern  = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+	challengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+)
+
+// VerifyPKCE checks verifier against an S256 challenge.
+func VerifyPKCE(challenge, verifier string) bool {
+	if !verifierPattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// randomToken returns 256 random bits, unpadded base64url encoded.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hash is how codes, tokens and client secrets are stored. They are random
+// and long, a slow hash would add nothing.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// halfHash is the at_hash of an access token.
+func halfHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,565 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/services"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const (
+	testIssuer   = "https://id.example.com/api"
+	testVerifier = "dBjftJeZ4CVP-mJ92K9ZUXOtesbZ4yVvQnpGhY9pCbVXk"
+	testRedirect = "https://app.example.com/callback"
+)
+
+// fakeRepo keeps clients, codes and tokens in memory.
+type fakeRepo struct {
+	clients map[string]models.OAuthClient
+	codes   map[string]models.OAuthCode
+	tokens  map[string]models.OAuthToken
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{clients: map[string]models.OAuthClient{}, codes: map[string]models.OAuthCode{}, tokens: map[string]models.OAuthToken{}}
+}
+
+func (r *fakeRepo) CreateClient(ctx context.Context, client models.OAuthClient) error {
+	r.clients[client.ID] = client
+	return nil
+}
+
+func (r *fakeRepo) GetClient(ctx context.Context, id string) (models.OAuthClient, error) {
+	client, ok := r.clients[id]
+	if !ok {
+		return models.OAuthClient{}, gorm.ErrRecordNotFound
+	}
+	return client, nil
+}
+
+func (r *fakeRepo) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (r *fakeRepo) DeleteClient(ctx context.Context, id string) error {
+	if _, ok := r.clients[id]; !ok {
+		return config.ErrNoRowsAffected
+	}
+	delete(r.clients, id)
+	return nil
+}
+
+func (r *fakeRepo) SaveCode(ctx context.Context, code models.OAuthCode) error {
+	r.codes[code.Hash] = code
+	return nil
+}
+
+func (r *fakeRepo) RedeemCode(ctx context.Context, hash string) (models.OAuthCode, error) {
+	code, ok := r.codes[hash]
+	if !ok {
+		return models.OAuthCode{}, gorm.ErrRecordNotFound
+	}
+	if code.UsedAt != nil {
+		return code, config.ErrCodeUsed
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	r.codes[hash] = code
+	return code, nil
+}
+
+func (r *fakeRepo) SaveTokens(ctx context.Context, tokens ...models.OAuthToken) error {
+	for _, token := range tokens {
+		r.tokens[token.Hash] = token
+	}
+	return nil
+}
+
+func (r *fakeRepo) GetToken(ctx context.Context, hash string) (models.OAuthToken, error) {
+	token, ok := r.tokens[hash]
+	if !ok {
+		return models.OAuthToken{}, gorm.ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (r *fakeRepo) UseRefreshToken(ctx context.Context, hash string) (models.OAuthToken, error) {
+	token, ok := r.tokens[hash]
+	if !ok || token.Kind != models.TokenRefresh {
+		return models.OAuthToken{}, gorm.ErrRecordNotFound
+	}
+	if token.RevokedAt != nil {
+		return token, config.ErrTokenRevoked
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	r.tokens[hash] = token
+	return token, nil
+}
+
+func (r *fakeRepo) RevokeGrant(ctx context.Context, grantID string) error {
+	now := time.Now()
+	for hash, token := range r.tokens {
+		if token.GrantID == grantID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// fakeUsers signs in a single user whose password is "Password1234".
+type fakeUsers struct {
+	services.UserServices
+	user models.User
+}
+
+func (u *fakeUsers) LoginUser(ctx context.Context, username, password string) (models.User, error) {
+	if username != u.user.Username {
+		return models.User{}, config.ErrUserNotFound
+	}
+	if password != "Password1234" {
+		return models.User{}, config.ErrPwdMatching
+	}
+	return u.user, nil
+}
+
+func (u *fakeUsers) SearchUserByID(ctx context.Context, id string) (models.User, error) {
+	if id != u.user.ID {
+		return models.User{}, config.ErrUserNotFound
+	}
+	return u.user, nil
+}
+
+func testProvider(t *testing.T) (*Provider, *fakeRepo, *fakeUsers) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeRepo()
+	users := &fakeUsers{user: models.User{ID: "1", Name: "John", Surname: "Doe", Username: "johndoe", Email: "john@example.com", Phone: "123456"}}
+	cfg := config.OIDCConfig{Issuer: testIssuer, CodeTTL: time.Minute, AccessTokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour}
+	return NewProvider(repo, users, key, cfg), repo, users
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authorizationRequest(clientID string) AuthorizationRequest {
+	return AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirect,
+		Scope:               "openid profile email offline_access",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       challenge(testVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// authorize registers a confidential client and returns it, its secret and
+// a fresh authorization code for johndoe.
+func authorize(t *testing.T, p *Provider) (models.OAuthClient, string, string) {
+	ctx := context.Background()
+	client, secret, err := p.RegisterClient(ctx, "App", []string{testRedirect}, false, "admin")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	req := authorizationRequest(client.ID)
+	checked, err := p.CheckAuthorization(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, client.ID, checked.ID)
+
+	redirect, err := p.Authorize(ctx, checked, req, "johndoe", "Password1234")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	u, _ := url.Parse(redirect)
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	assert.Equal(t, testIssuer, u.Query().Get("iss"))
+	return client, secret, u.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	p, repo, _ := testProvider(t)
+	ctx := context.Background()
+	client, secret, code := authorize(t, p)
+
+	authenticated, err := p.AuthenticateClient(ctx, client.ID, secret)
+	assert.NoError(t, err)
+
+	tokens, err := p.Exchange(ctx, authenticated, TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, "openid profile email offline_access", tokens.Scope)
+
+	idToken, err := jwt.Parse(tokens.IDToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, p.keyID, token.Header["kid"])
+		return &p.key.PublicKey, nil
+	})
+	if assert.NoError(t, err) {
+		claims := idToken.Claims.(jwt.MapClaims)
+		assert.Equal(t, testIssuer, claims["iss"])
+		assert.Equal(t, client.ID, claims["aud"])
+		assert.Equal(t, "1", claims["sub"])
+		assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+		assert.Equal(t, "johndoe", claims["preferred_username"])
+		assert.Equal(t, halfHash(tokens.AccessToken), claims["at_hash"])
+		assert.NotContains(t, claims, "phone_number")
+	}
+
+	claims, err := p.UserInfo(ctx, tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "john@example.com", claims["email"])
+
+	introspection, err := p.Introspect(ctx, authenticated, tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "johndoe", introspection.Username)
+
+	// a replayed code revokes what was issued from it
+	_, err = p.Exchange(ctx, authenticated, TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier})
+	assert.Equal(t, InvalidGrant, err.(*Error).Code)
+	assert.False(t, repo.tokens[hash(tokens.AccessToken)].Active(time.Now()))
+}
+
+func TestRefreshRotation(t *testing.T) {
+	p, repo, _ := testProvider(t)
+	ctx := context.Background()
+	client, _, code := authorize(t, p)
+
+	first, err := p.Exchange(ctx, client, TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = p.Exchange(ctx, client, TokenRequest{GrantType: GrantRefreshToken, RefreshToken: first.RefreshToken, Scope: "openid phone"})
+	assert.Equal(t, InvalidScope, err.(*Error).Code)
+
+	// the failed attempt above used the token, start again from a new code
+	client, _, code = authorize(t, p)
+	first, err = p.Exchange(ctx, client, TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier})
+	if !assert.NoError(t, err) {
+		return
+	}
+	second, err := p.Exchange(ctx, client, TokenRequest{GrantType: GrantRefreshToken, RefreshToken: first.RefreshToken, Scope: "openid offline_access"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "openid offline_access", second.Scope)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// replaying the first refresh token revokes the whole grant
+	_, err = p.Exchange(ctx, client, TokenRequest{GrantType: GrantRefreshToken, RefreshToken: first.RefreshToken})
+	assert.Equal(t, InvalidGrant, err.(*Error).Code)
+	assert.False(t, repo.tokens[hash(second.AccessToken)].Active(time.Now()))
+	assert.False(t, repo.tokens[hash(second.RefreshToken)].Active(time.Now()))
+}
+
+func TestExchangeFailures(t *testing.T) {
+	p, _, users := testProvider(t)
+	ctx := context.Background()
+
+	test := []struct {
+		Name         string
+		Request      func(code string) TokenRequest
+		OtherClient  bool
+		DisableUser  bool
+		ExpectedCode string
+	}{
+		{
+			Name: "Wrong Verifier",
+			Request: func(code string) TokenRequest {
+				return TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: strings.Repeat("a", 43)}
+			},
+			ExpectedCode: InvalidGrant,
+		},
+		{
+			Name: "Wrong Redirect URI",
+			Request: func(code string) TokenRequest {
+				return TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: "https://app.example.com/other", CodeVerifier: testVerifier}
+			},
+			ExpectedCode: InvalidGrant,
+		},
+		{
+			Name: "Other Client",
+			Request: func(code string) TokenRequest {
+				return TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier}
+			},
+			OtherClient:  true,
+			ExpectedCode: InvalidGrant,
+		},
+		{
+			Name: "Disabled User",
+			Request: func(code string) TokenRequest {
+				return TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier}
+			},
+			DisableUser:  true,
+			ExpectedCode: InvalidGrant,
+		},
+		{
+			Name: "Unsupported Grant",
+			Request: func(code string) TokenRequest {
+				return TokenRequest{GrantType: "password"}
+			},
+			ExpectedCode: UnsupportedGrantType,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			users.user.Disabled = false
+			client, _, code := authorize(t, p)
+			if tt.OtherClient {
+				client.ID = "other"
+			}
+			users.user.Disabled = tt.DisableUser
+
+			_, err := p.Exchange(ctx, client, tt.Request(code))
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.ExpectedCode, err.(*Error).Code)
+			}
+		})
+	}
+}
+
+func TestCheckAuthorization(t *testing.T) {
+	p, _, _ := testProvider(t)
+	ctx := context.Background()
+	client, _, err := p.RegisterClient(ctx, "App", []string{testRedirect}, true, "admin")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	test := []struct {
+		Name         string
+		Modify       func(req *AuthorizationRequest)
+		Redirects    bool
+		ExpectedCode string
+	}{
+		{
+			Name:         "Unknown Client",
+			Modify:       func(req *AuthorizationRequest) { req.ClientID = "unknown" },
+			ExpectedCode: InvalidRequest,
+		},
+		{
+			Name:         "Unregistered Redirect URI",
+			Modify:       func(req *AuthorizationRequest) { req.RedirectURI = testRedirect + "/other" },
+			ExpectedCode: InvalidRequest,
+		},
+		{
+			Name:         "Token Response Type",
+			Modify:       func(req *AuthorizationRequest) { req.ResponseType = "token" },
+			Redirects:    true,
+			ExpectedCode: UnsupportedResponseType,
+		},
+		{
+			Name:         "Without OpenID Scope",
+			Modify:       func(req *AuthorizationRequest) { req.Scope = "profile" },
+			Redirects:    true,
+			ExpectedCode: InvalidScope,
+		},
+		{
+			Name:         "Plain Challenge",
+			Modify:       func(req *AuthorizationRequest) { req.CodeChallengeMethod = "plain" },
+			Redirects:    true,
+			ExpectedCode: InvalidRequest,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := authorizationRequest(client.ID)
+			tt.Modify(&req)
+
+			checked, err := p.CheckAuthorization(ctx, req)
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.ExpectedCode, err.(*Error).Code)
+			}
+			assert.Equal(t, tt.Redirects, checked.ID != "")
+		})
+	}
+}
+
+func TestAuthorizeLogin(t *testing.T) {
+	p, _, users := testProvider(t)
+	ctx := context.Background()
+	client, _, err := p.RegisterClient(ctx, "App", []string{testRedirect}, true, "admin")
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := authorizationRequest(client.ID)
+
+	_, err = p.Authorize(ctx, client, req, "johndoe", "wrong")
+	assert.ErrorIs(t, err, config.ErrPwdMatching)
+
+	users.user.MustChangePassword = true
+	_, err = p.Authorize(ctx, client, req, "johndoe", "Password1234")
+	assert.ErrorIs(t, err, config.ErrPasswordChange)
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	p, _, _ := testProvider(t)
+	ctx := context.Background()
+	confidential, secret, _ := p.RegisterClient(ctx, "Server", []string{testRedirect}, false, "admin")
+	public, _, _ := p.RegisterClient(ctx, "Browser", []string{testRedirect}, true, "admin")
+
+	test := []struct {
+		Name        string
+		ID          string
+		Secret      string
+		ExpectedErr bool
+	}{
+		{Name: "Confidential", ID: confidential.ID, Secret: secret},
+		{Name: "Wrong Secret", ID: confidential.ID, Secret: "wrong", ExpectedErr: true},
+		{Name: "Missing Secret", ID: confidential.ID, ExpectedErr: true},
+		{Name: "Public", ID: public.ID},
+		{Name: "Public With Secret", ID: public.ID, Secret: "anything", ExpectedErr: true},
+		{Name: "Unknown", ID: "unknown", ExpectedErr: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := p.AuthenticateClient(ctx, tt.ID, tt.Secret)
+			if tt.ExpectedErr {
+				assert.Equal(t, InvalidClient, err.(*Error).Code)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	p, _, _ := testProvider(t)
+	ctx := context.Background()
+	client, _, code := authorize(t, p)
+
+	tokens, err := p.Exchange(ctx, client, TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirect, CodeVerifier: testVerifier})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// tokens of other clients and unknown tokens are left alone
+	assert.NoError(t, p.Revoke(ctx, models.OAuthClient{ID: "other"}, tokens.RefreshToken))
+	assert.NoError(t, p.Revoke(ctx, client, "unknown"))
+	introspection, _ := p.Introspect(ctx, client, tokens.AccessToken)
+	assert.True(t, introspection.Active)
+
+	assert.NoError(t, p.Revoke(ctx, client, tokens.RefreshToken))
+	introspection, _ = p.Introspect(ctx, client, tokens.AccessToken)
+	assert.False(t, introspection.Active)
+
+	_, err = p.UserInfo(ctx, tokens.AccessToken)
+	assert.Equal(t, InvalidToken, err.(*Error).Code)
+}
+
+func TestRegisterClient(t *testing.T) {
+	p, _, _ := testProvider(t)
+	ctx := context.Background()
+
+	_, _, err := p.RegisterClient(ctx, "App", []string{"http://app.example.com/callback"}, false, "admin")
+	assert.ErrorIs(t, err, config.ErrInvalidClient)
+
+	_, _, err = p.RegisterClient(ctx, " ", []string{testRedirect}, false, "admin")
+	assert.ErrorIs(t, err, config.ErrInvalidClient)
+
+	client, secret, err := p.RegisterClient(ctx, "App", []string{testRedirect}, false, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, hash(secret), client.SecretHash)
+
+	assert.ErrorIs(t, p.DeleteClient(ctx, "unknown"), config.ErrClientNotFound)
+	assert.NoError(t, p.DeleteClient(ctx, client.ID))
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	test := []struct {
+		URI      string
+		Expected bool
+	}{
+		{URI: "https://app.example.com/callback", Expected: true},
+		{URI: "http://127.0.0.1:8400/callback", Expected: true},
+		{URI: "http://localhost/callback", Expected: true},
+		{URI: "com.example.app:/callback", Expected: true},
+		{URI: "http://app.example.com/callback"},
+		{URI: "https://app.example.com/callback#fragment"},
+		{URI: "myapp:/callback"},
+		{URI: "/callback"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.URI, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, ValidRedirectURI(tt.URI))
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	assert.Equal(t, []string{ScopeOpenID, ScopeEmail, ScopeOfflineAccess}, ParseScope("offline_access email  unknown openid"))
+	assert.Empty(t, ParseScope("admin"))
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	assert.True(t, VerifyPKCE(challenge(testVerifier), testVerifier))
+	assert.False(t, VerifyPKCE(challenge(testVerifier), strings.Replace(testVerifier, "d", "e", 1)))
+	assert.False(t, VerifyPKCE(challenge("short"), "short"))
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	loaded, err := LoadKey(write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(loaded))
+
+	loaded, err = LoadKey(write("pkcs8.pem", "PRIVATE KEY", pkcs8))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(loaded))
+
+	_, err = LoadKey(write("small.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(small)))
+	assert.Error(t, err)
+
+	_, err = LoadKey(write("cert.pem", "CERTIFICATE", []byte("x")))
+	assert.Error(t, err)
+
+	_, err = LoadKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
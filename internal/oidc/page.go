@@ -0,0 +1,40 @@
+package oidc
+
+import (
+	_ "embed"
+	"html/template"
+)
+
+//go:embed consent.html
+var consentPage string
+
+// Page is the sign in and consent page of an authorization request.
+var Page = template.Must(template.New("consent").Parse(consentPage))
+
+// PageData fills Page. Without a client only the error is shown, the
+// request could not be trusted enough to ask for a password.
+type PageData struct {
+	Client   string
+	Action   string
+	Request  AuthorizationRequest
+	Scopes   []string
+	Username string
+	Error    string
+}
+
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:        "Know who you are",
+	ScopeProfile:       "See your name and username",
+	ScopeEmail:         "See your email address",
+	ScopePhone:         "See your phone number",
+	ScopeOfflineAccess: "Keep access while you are not using it",
+}
+
+// DescribeScope lists what each granted scope of scope lets the client do.
+func DescribeScope(scope string) []string {
+	var descriptions []string
+	for _, s := range ParseScope(scope) {
+		descriptions = append(descriptions, scopeDescriptions[s])
+	}
+	return descriptions
+}
@@ -0,0 +1,578 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"gorm.io/gorm"
+)
+
+// grant types
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+)
+
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection is the RFC 7662 description of a token.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+}
+
+// Provider is the openid connect provider. Users sign in with the password
+// checked by services.LoginUser; clients get opaque access tokens and
+// RS256-signed id tokens.
+type Provider struct {
+	repo  repository.OAuthRepository
+	users services.UserServices
+	cfg   config.OIDCConfig
+	key   *rsa.PrivateKey
+	keyID string
+	now   func() time.Time
+}
+
+func NewProvider(repo repository.OAuthRepository, users services.UserServices, key *rsa.PrivateKey, cfg config.OIDCConfig) *Provider {
+	return &Provider{repo: repo, users: users, cfg: cfg, key: key, keyID: KeyID(&key.PublicKey), now: time.Now}
+}
+
+func (p *Provider) Metadata() Metadata {
+	endpoint := func(path string) string {
+		return p.cfg.Issuer + Prefix + path
+	}
+	return Metadata{
+		Issuer:                                 p.cfg.Issuer,
+		AuthorizationEndpoint:                  endpoint("/authorize"),
+		TokenEndpoint:                          endpoint("/token"),
+		UserinfoEndpoint:                       endpoint("/userinfo"),
+		JWKSURI:                                endpoint("/jwks"),
+		IntrospectionEndpoint:                  endpoint("/introspect"),
+		RevocationEndpoint:                     endpoint("/revoke"),
+		ScopesSupported:                        Scopes,
+		ResponseTypesSupported:                 []string{"code"},
+		GrantTypesSupported:                    []string{GrantAuthorizationCode, GrantRefreshToken},
+		SubjectTypesSupported:                  []string{"public"},
+		IDTokenSigningAlgValuesSupported:       []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:      []string{"client_secret_basic", "client_secret_post", "none"},
+		IntrospectionEndpointAuthMethods:       []string{"client_secret_basic", "client_secret_post"},
+		RevocationEndpointAuthMethods:          []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:          []string{"S256"},
+		ClaimsSupported:                        []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "name", "given_name", "family_name", "preferred_username", "email", "email_verified", "phone_number", "phone_number_verified"},
+		AuthorizationResponseIssParamSupported: true,
+	}
+}
+
+func (p *Provider) KeySet() KeySet {
+	jwk := newJWK(&p.key.PublicKey)
+	jwk.Kid = p.keyID
+	return KeySet{Keys: []JWK{jwk}}
+}
+
+// RegisterClient stores a new client and returns it with its secret, which
+// is not kept and cannot be shown again. Public clients get no secret.
+func (p *Provider) RegisterClient(ctx context.Context, name string, redirectURIs []string, public bool, createdBy string) (client models.OAuthClient, secret string, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.RegisterClient")
+	defer func() { tracing.End(span, err) }()
+
+	if strings.TrimSpace(name) == "" || len(redirectURIs) == 0 {
+		return models.OAuthClient{}, "", apperror.AppError(config.ErrRegisteringClient, config.ErrInvalidClient)
+	}
+	for _, uri := range redirectURIs {
+		if !ValidRedirectURI(uri) {
+			return models.OAuthClient{}, "", apperror.AppError(config.ErrRegisteringClient, config.ErrInvalidClient)
+		}
+	}
+
+	client = models.OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         strings.TrimSpace(name),
+		RedirectURIs: redirectURIs,
+		Public:       public,
+		CreatedBy:    createdBy,
+		CreatedAt:    p.now().UTC(),
+	}
+	if !public {
+		generated, randErr := randomToken()
+		if randErr != nil {
+			return models.OAuthClient{}, "", apperror.AppError(config.ErrRegisteringClient, randErr)
+		}
+		secret, client.SecretHash = generated, hash(generated)
+	}
+	if createErr := p.repo.CreateClient(ctx, client); createErr != nil {
+		return models.OAuthClient{}, "", apperror.AppError(config.ErrRegisteringClient, createErr)
+	}
+	return client, secret, nil
+}
+
+func (p *Provider) ListClients(ctx context.Context) (clients []models.OAuthClient, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.ListClients")
+	defer func() { tracing.End(span, err) }()
+
+	clients, listErr := p.repo.ListClients(ctx)
+	if listErr != nil {
+		return nil, apperror.AppError(config.ErrListingClients, listErr)
+	}
+	return clients, nil
+}
+
+func (p *Provider) DeleteClient(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "oidc.DeleteClient")
+	defer func() { tracing.End(span, err) }()
+
+	deleteErr := p.repo.DeleteClient(ctx, id)
+	if errors.Is(deleteErr, config.ErrNoRowsAffected) {
+		deleteErr = config.ErrClientNotFound
+	}
+	if deleteErr != nil {
+		return apperror.AppError(config.ErrDeletingClient, deleteErr)
+	}
+	return nil
+}
+
+// CheckAuthorization validates req. Errors about the client or the redirect
+// uri are for the user to see; once both are known good the client is
+// returned, along with any other error, which goes back to the redirect uri.
+func (p *Provider) CheckAuthorization(ctx context.Context, req AuthorizationRequest) (client models.OAuthClient, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.CheckAuthorization")
+	defer func() { tracing.End(span, err) }()
+
+	client, getErr := p.repo.GetClient(ctx, req.ClientID)
+	if errors.Is(getErr, gorm.ErrRecordNotFound) {
+		return models.OAuthClient{}, badRequest(InvalidRequest, "unknown client_id")
+	}
+	if getErr != nil {
+		return models.OAuthClient{}, getErr
+	}
+	// only exact matches, a prefix would let codes leak to other paths
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return models.OAuthClient{}, badRequest(InvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		return client, badRequest(UnsupportedResponseType, "response_type must be code")
+	case !slices.Contains(ParseScope(req.Scope), ScopeOpenID):
+		return client, badRequest(InvalidScope, "the openid scope is required")
+	case req.CodeChallengeMethod != "S256" || !challengePattern.MatchString(req.CodeChallenge):
+		return client, badRequest(InvalidRequest, "an S256 code_challenge is required")
+	case len(req.Nonce) > 255:
+		return client, badRequest(InvalidRequest, "nonce is too long")
+	}
+	return client, nil
+}
+
+// Authorize signs the user in and returns the redirect carrying a new
+// authorization code. req must have passed CheckAuthorization for client.
+func (p *Provider) Authorize(ctx context.Context, client models.OAuthClient, req AuthorizationRequest, username, password string) (redirect string, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.Authorize")
+	defer func() { tracing.End(span, err) }()
+
+	user, loginErr := p.users.LoginUser(ctx, username, password)
+	if loginErr != nil {
+		return "", loginErr
+	}
+	if user.MustChangePassword {
+		return "", config.ErrPasswordChange
+	}
+
+	code, randErr := randomToken()
+	if randErr != nil {
+		return "", randErr
+	}
+	now := p.now().UTC()
+	record := models.OAuthCode{
+		Hash:          hash(code),
+		GrantID:       uuid.NewString(),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(ParseScope(req.Scope), " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(p.cfg.CodeTTL),
+	}
+	if saveErr := p.repo.SaveCode(ctx, record); saveErr != nil {
+		return "", saveErr
+	}
+	return p.Redirect(req, url.Values{"code": {code}}), nil
+}
+
+// Redirect is the redirect uri of req with params, the state and the issuer
+// added, as RFC 9207 asks.
+func (p *Provider) Redirect(req AuthorizationRequest, params url.Values) string {
+	// registered uris were parsed on registration
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", p.cfg.Issuer)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// AuthenticateClient checks the credentials of a client calling the token,
+// introspection or revocation endpoints. Public clients only send their id.
+func (p *Provider) AuthenticateClient(ctx context.Context, id, secret string) (client models.OAuthClient, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.AuthenticateClient")
+	defer func() { tracing.End(span, err) }()
+
+	failed := NewError(http.StatusUnauthorized, InvalidClient, "client authentication failed")
+	if id == "" {
+		return models.OAuthClient{}, failed
+	}
+	client, getErr := p.repo.GetClient(ctx, id)
+	if errors.Is(getErr, gorm.ErrRecordNotFound) {
+		return models.OAuthClient{}, failed
+	}
+	if getErr != nil {
+		return models.OAuthClient{}, getErr
+	}
+
+	if client.Public {
+		if secret != "" {
+			return models.OAuthClient{}, failed
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(client.SecretHash)) != 1 {
+		return models.OAuthClient{}, failed
+	}
+	return client, nil
+}
+
+// Exchange answers the token endpoint for an authenticated client.
+func (p *Provider) Exchange(ctx context.Context, client models.OAuthClient, req TokenRequest) (response TokenResponse, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.Exchange")
+	defer func() { tracing.End(span, err) }()
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return p.exchangeCode(ctx, client, req)
+	case GrantRefreshToken:
+		return p.refresh(ctx, client, req)
+	}
+	return TokenResponse{}, badRequest(UnsupportedGrantType, "grant_type must be authorization_code or refresh_token")
+}
+
+func (p *Provider) exchangeCode(ctx context.Context, client models.OAuthClient, req TokenRequest) (TokenResponse, error) {
+	if req.Code == "" {
+		return TokenResponse{}, badRequest(InvalidRequest, "code is required")
+	}
+
+	invalid := badRequest(InvalidGrant, "the code is invalid, expired or was issued to another client")
+	code, redeemErr := p.repo.RedeemCode(ctx, hash(req.Code))
+	switch {
+	case errors.Is(redeemErr, config.ErrCodeUsed):
+		// a replayed code may have leaked, what was issued from it goes too
+		if revokeErr := p.repo.RevokeGrant(ctx, code.GrantID); revokeErr != nil {
+			return TokenResponse{}, revokeErr
+		}
+		return TokenResponse{}, invalid
+	case errors.Is(redeemErr, gorm.ErrRecordNotFound):
+		return TokenResponse{}, invalid
+	case redeemErr != nil:
+		return TokenResponse{}, redeemErr
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI || !p.now().Before(code.ExpiresAt) {
+		return TokenResponse{}, invalid
+	}
+	if !VerifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return TokenResponse{}, badRequest(InvalidGrant, "code_verifier does not match the code_challenge")
+	}
+	return p.issue(ctx, client, GrantAuthorizationCode, code.GrantID, code.UserID, code.Scope, code.Nonce, code.AuthTime)
+}
+
+func (p *Provider) refresh(ctx context.Context, client models.OAuthClient, req TokenRequest) (TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return TokenResponse{}, badRequest(InvalidRequest, "refresh_token is required")
+	}
+
+	invalid := badRequest(InvalidGrant, "the refresh token is invalid, expired or was issued to another client")
+	token, useErr := p.repo.UseRefreshToken(ctx, hash(req.RefreshToken))
+	switch {
+	case errors.Is(useErr, config.ErrTokenRevoked):
+		// refresh tokens are rotated, replaying a used one means it leaked
+		if revokeErr := p.repo.RevokeGrant(ctx, token.GrantID); revokeErr != nil {
+			return TokenResponse{}, revokeErr
+		}
+		return TokenResponse{}, invalid
+	case errors.Is(useErr, gorm.ErrRecordNotFound):
+		return TokenResponse{}, invalid
+	case useErr != nil:
+		return TokenResponse{}, useErr
+	}
+
+	if token.ClientID != client.ID || !p.now().Before(token.ExpiresAt) {
+		return TokenResponse{}, invalid
+	}
+
+	// the scope may only be narrowed
+	scope := token.Scope
+	if req.Scope != "" {
+		requested := ParseScope(req.Scope)
+		for _, s := range requested {
+			if !hasScope(token.Scope, s) {
+				return TokenResponse{}, badRequest(InvalidScope, "scope "+s+" was not granted")
+			}
+		}
+		scope = strings.Join(requested, " ")
+	}
+	return p.issue(ctx, client, GrantRefreshToken, token.GrantID, token.UserID, scope, "", token.AuthTime)
+}
+
+// issue creates the tokens of a grant for the user, who must still be
+// allowed to sign in.
+func (p *Provider) issue(ctx context.Context, client models.OAuthClient, grantType, grantID, userID, scope, nonce string, authTime time.Time) (TokenResponse, error) {
+	user, searchErr := p.users.SearchUserByID(ctx, userID)
+	if searchErr != nil && !errors.Is(searchErr, config.ErrUserNotFound) {
+		return TokenResponse{}, searchErr
+	}
+	if searchErr != nil || user.Disabled {
+		if revokeErr := p.repo.RevokeGrant(ctx, grantID); revokeErr != nil {
+			return TokenResponse{}, revokeErr
+		}
+		return TokenResponse{}, badRequest(InvalidGrant, "the user can no longer sign in")
+	}
+
+	now := p.now().UTC()
+	access, randErr := randomToken()
+	if randErr != nil {
+		return TokenResponse{}, randErr
+	}
+	record := models.OAuthToken{
+		Kind:      models.TokenAccess,
+		GrantID:   grantID,
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scope:     scope,
+		AuthTime:  authTime,
+		CreatedAt: now,
+	}
+	accessRecord := record
+	accessRecord.Hash, accessRecord.ExpiresAt = hash(access), now.Add(p.cfg.AccessTokenTTL)
+	tokens := []models.OAuthToken{accessRecord}
+	response := TokenResponse{AccessToken: access, TokenType: "Bearer", ExpiresIn: int(p.cfg.AccessTokenTTL.Seconds()), Scope: scope}
+
+	if hasScope(scope, ScopeOfflineAccess) {
+		refresh, randErr := randomToken()
+		if randErr != nil {
+			return TokenResponse{}, randErr
+		}
+		refreshRecord := record
+		refreshRecord.Hash, refreshRecord.Kind, refreshRecord.ExpiresAt = hash(refresh), models.TokenRefresh, now.Add(p.cfg.RefreshTokenTTL)
+		tokens = append(tokens, refreshRecord)
+		response.RefreshToken = refresh
+	}
+	if hasScope(scope, ScopeOpenID) {
+		idToken, signErr := p.idToken(client, user, scope, nonce, access, authTime, now)
+		if signErr != nil {
+			return TokenResponse{}, signErr
+		}
+		response.IDToken = idToken
+	}
+
+	if saveErr := p.repo.SaveTokens(ctx, tokens...); saveErr != nil {
+		return TokenResponse{}, saveErr
+	}
+	metrics.OAuthTokensIssued.WithLabelValues(grantType).Inc()
+	return response, nil
+}
+
+func (p *Provider) idToken(client models.OAuthClient, user models.User, scope, nonce, access string, authTime, now time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       p.cfg.Issuer,
+		"aud":       client.ID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.cfg.AccessTokenTTL).Unix(),
+		"auth_time": authTime.Unix(),
+		"at_hash":   halfHash(access),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for name, value := range UserClaims(user, scope) {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+// UserClaims returns the standard claims about user that scope releases.
+// Emails and phones are never verified by the api.
+func UserClaims(user models.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID}
+	if hasScope(scope, ScopeProfile) {
+		claims["name"] = strings.TrimSpace(user.Name + " " + user.Surname)
+		claims["given_name"] = user.Name
+		claims["family_name"] = user.Surname
+		claims["preferred_username"] = user.Username
+	}
+	if hasScope(scope, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = false
+	}
+	if hasScope(scope, ScopePhone) {
+		claims["phone_number"] = user.Phone
+		claims["phone_number_verified"] = false
+	}
+	return claims
+}
+
+// UserInfo returns the claims about the user behind an access token.
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (claims map[string]interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.UserInfo")
+	defer func() { tracing.End(span, err) }()
+
+	invalid := NewError(http.StatusUnauthorized, InvalidToken, "the access token is invalid or expired")
+	token, user, lookupErr := p.lookup(ctx, accessToken)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if token.Kind != models.TokenAccess || user.ID == "" {
+		return nil, invalid
+	}
+	return UserClaims(user, token.Scope), nil
+}
+
+// Introspect describes token to the confidential client it was issued to,
+// for any other client it is inactive.
+func (p *Provider) Introspect(ctx context.Context, client models.OAuthClient, token string) (introspection Introspection, err error) {
+	ctx, span := tracing.Start(ctx, "oidc.Introspect")
+	defer func() { tracing.End(span, err) }()
+
+	if client.Public {
+		return Introspection{}, NewError(http.StatusUnauthorized, InvalidClient, "public clients cannot introspect tokens")
+	}
+	record, user, lookupErr := p.lookup(ctx, token)
+	if lookupErr != nil {
+		return Introspection{}, lookupErr
+	}
+	if user.ID == "" || record.ClientID != client.ID {
+		return Introspection{Active: false}, nil
+	}
+
+	introspection = Introspection{
+		Active:   true,
+		Scope:    record.Scope,
+		ClientID: record.ClientID,
+		Username: user.Username,
+		Exp:      record.ExpiresAt.Unix(),
+		Iat:      record.CreatedAt.Unix(),
+		Sub:      user.ID,
+		Aud:      record.ClientID,
+		Iss:      p.cfg.Issuer,
+	}
+	if record.Kind == models.TokenAccess {
+		introspection.TokenType = "Bearer"
+	}
+	return introspection, nil
+}
+
+// Revoke revokes token, and every token issued along with it, when it
+// belongs to client. Unknown tokens are ignored as RFC 7009 asks.
+func (p *Provider) Revoke(ctx context.Context, client models.OAuthClient, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "oidc.Revoke")
+	defer func() { tracing.End(span, err) }()
+
+	record, getErr := p.repo.GetToken(ctx, hash(token))
+	if errors.Is(getErr, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if getErr != nil {
+		return getErr
+	}
+	if record.ClientID != client.ID || record.RevokedAt != nil {
+		return nil
+	}
+	return p.repo.RevokeGrant(ctx, record.GrantID)
+}
+
+// lookup returns an active token and its user. The user is empty when the
+// token is unknown, expired or revoked, or the user can no longer sign in.
+func (p *Provider) lookup(ctx context.Context, token string) (models.OAuthToken, models.User, error) {
+	if token == "" {
+		return models.OAuthToken{}, models.User{}, nil
+	}
+	record, getErr := p.repo.GetToken(ctx, hash(token))
+	if errors.Is(getErr, gorm.ErrRecordNotFound) {
+		return models.OAuthToken{}, models.User{}, nil
+	}
+	if getErr != nil {
+		return models.OAuthToken{}, models.User{}, getErr
+	}
+	if !record.Active(p.now()) {
+		return record, models.User{}, nil
+	}
+
+	user, searchErr := p.users.SearchUserByID(ctx, record.UserID)
+	if errors.Is(searchErr, config.ErrUserNotFound) {
+		return record, models.User{}, nil
+	}
+	if searchErr != nil {
+		return models.OAuthToken{}, models.User{}, searchErr
+	}
+	if user.Disabled {
+		return record, models.User{}, nil
+	}
+	return record, user, nil
+}
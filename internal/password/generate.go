@@ -0,0 +1,50 @@
+package password
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+const (
+	generatedPasswordLength = 16
+	lowerChars              = "abcdefghijkmnopqrstuvwxyz"
+	upperChars              = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	digitChars              = "23456789"
+)
+
+// Generate returns a random password accepted by the password validator:
+// letters and digits only, with at least one of each kind.
+func Generate() (string, error) {
+	all := lowerChars + upperChars + digitChars
+	chars := []string{lowerChars, upperChars, digitChars}
+	for len(chars) < generatedPasswordLength {
+		chars = append(chars, all)
+	}
+
+	password := make([]byte, len(chars))
+	for i, set := range chars {
+		c, err := randomIndex(len(set))
+		if err != nil {
+			return "", err
+		}
+		password[i] = set[c]
+	}
+
+	// move the guaranteed characters away from the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+func randomIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
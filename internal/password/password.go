@@ -0,0 +1,220 @@
+package password
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/tracing"
+	"math/bits"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/sync/semaphore"
+)
+
+// algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+	Scrypt   = "scrypt"
+)
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// params are the settings a hash was computed with. Hashes of other
+// algorithms leave the fields they do not use at zero.
+type params struct {
+	algorithm   string
+	cost        int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	n, r, p     int
+	salt, key   []byte
+}
+
+// Hasher hashes passwords with the configured algorithm and verifies hashes
+// of every supported one. Hashes are written in the modular crypt format
+// tagged with their algorithm and settings:
+//
+//	$2a$10$...                                     bcrypt
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>    argon2id
+//	$scrypt$ln=15,r=8,p=1$<salt>$<key>             scrypt
+//
+// Hashing is slow on purpose, at most max_concurrent hashes are computed at
+// once and the rest wait their turn.
+type Hasher struct {
+	cfg   config.PasswordConfig
+	slots *semaphore.Weighted
+}
+
+func NewHasher(cfg config.PasswordConfig) *Hasher {
+	slots := cfg.MaxConcurrent
+	if slots <= 0 {
+		slots = runtime.NumCPU()
+	}
+	return &Hasher{cfg: cfg, slots: semaphore.NewWeighted(int64(slots))}
+}
+
+// Hash returns the hash of password with the configured algorithm.
+func (h *Hasher) Hash(ctx context.Context, password string) (hash string, err error) {
+	ctx, span := tracing.Start(ctx, "password.hash")
+	defer func() { tracing.End(span, err) }()
+
+	if err := h.slots.Acquire(ctx, 1); err != nil {
+		return "", err
+	}
+	defer h.slots.Release(1)
+	defer metrics.ObservePasswordHash(metrics.HashOperation, time.Now())
+
+	if h.cfg.Algorithm == Bcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hashed), err
+	}
+
+	target := h.target()
+	target.salt = make([]byte, saltSize)
+	if _, err := rand.Read(target.salt); err != nil {
+		return "", err
+	}
+	target.key, err = derive(target, password)
+	if err != nil {
+		return "", err
+	}
+	return target.encode(), nil
+}
+
+// Verify reports whether password matches hash, whatever supported
+// algorithm computed it.
+func (h *Hasher) Verify(ctx context.Context, hash, password string) (ok bool, err error) {
+	ctx, span := tracing.Start(ctx, "password.verify")
+	defer func() { tracing.End(span, err) }()
+
+	stored, err := parse(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if err := h.slots.Acquire(ctx, 1); err != nil {
+		return false, err
+	}
+	defer h.slots.Release(1)
+	defer metrics.ObservePasswordHash(metrics.VerifyOperation, time.Now())
+
+	if stored.algorithm == Bcrypt {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+	}
+	key, err := derive(stored, password)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, stored.key) == 1, nil
+}
+
+// NeedsRehash reports whether hash was computed with another algorithm or
+// other settings than the configured ones.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	stored, err := parse(hash)
+	if err != nil {
+		return true
+	}
+	target := h.target()
+	return stored.algorithm != target.algorithm || stored.cost != target.cost ||
+		stored.memory != target.memory || stored.iterations != target.iterations || stored.parallelism != target.parallelism ||
+		stored.n != target.n || stored.r != target.r || stored.p != target.p
+}
+
+// IsHash reports whether s is a hash of a supported algorithm rather than a
+// plaintext password.
+func IsHash(s string) bool {
+	_, err := parse(s)
+	return err == nil
+}
+
+// target are the params new hashes are computed with.
+func (h *Hasher) target() params {
+	switch h.cfg.Algorithm {
+	case Argon2id:
+		return params{
+			algorithm:   Argon2id,
+			memory:      uint32(h.cfg.Argon2Memory),
+			iterations:  uint32(h.cfg.Argon2Iterations),
+			parallelism: uint8(h.cfg.Argon2Parallelism),
+		}
+	case Scrypt:
+		return params{algorithm: Scrypt, n: h.cfg.ScryptN, r: h.cfg.ScryptR, p: h.cfg.ScryptP}
+	}
+	return params{algorithm: Bcrypt, cost: h.cfg.BcryptCost}
+}
+
+func derive(p params, password string) ([]byte, error) {
+	size := len(p.key)
+	if size == 0 {
+		size = keySize
+	}
+	switch p.algorithm {
+	case Argon2id:
+		return argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(size)), nil
+	case Scrypt:
+		return scrypt.Key([]byte(password), p.salt, p.n, p.r, p.p, size)
+	}
+	return nil, config.ErrUnknownHash
+}
+
+func (p params) encode() string {
+	salt := base64.RawStdEncoding.EncodeToString(p.salt)
+	key := base64.RawStdEncoding.EncodeToString(p.key)
+	if p.algorithm == Argon2id {
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.iterations, p.parallelism, salt, key)
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", bits.TrailingZeros(uint(p.n)), p.r, p.p, salt, key)
+}
+
+func parse(hash string) (params, error) {
+	if cost, err := bcrypt.Cost([]byte(hash)); err == nil {
+		return params{algorithm: Bcrypt, cost: cost}, nil
+	}
+
+	var p params
+	var valid bool
+	var salt, key string
+	parts := strings.Split(hash, "$")
+	switch {
+	case len(parts) == 6 && parts[1] == Argon2id && parts[2] == fmt.Sprintf("v=%d", argon2.Version):
+		p.algorithm = Argon2id
+		_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+		valid = err == nil && p.parallelism > 0 && p.memory >= 8*uint32(p.parallelism) && p.memory <= config.MaxArgon2Memory &&
+			p.iterations > 0 && p.iterations <= config.MaxArgon2Iterations
+		salt, key = parts[4], parts[5]
+	case len(parts) == 5 && parts[1] == Scrypt:
+		var ln int
+		p.algorithm = Scrypt
+		_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &p.r, &p.p)
+		valid = err == nil && ln > 0 && ln < 63 && p.r > 0 && p.p > 0 && p.p <= config.MaxScryptP &&
+			p.r <= config.MaxScryptMemory>>ln
+		p.n = 1 << ln
+		salt, key = parts[3], parts[4]
+	}
+	if !valid {
+		return params{}, config.ErrUnknownHash
+	}
+
+	var saltErr, keyErr error
+	p.salt, saltErr = base64.RawStdEncoding.DecodeString(salt)
+	p.key, keyErr = base64.RawStdEncoding.DecodeString(key)
+	if saltErr != nil || keyErr != nil || len(p.salt) == 0 || len(p.key) == 0 {
+		return params{}, config.ErrUnknownHash
+	}
+	return p, nil
+}
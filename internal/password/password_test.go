@@ -0,0 +1,151 @@
+package password
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/utils/validator"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap settings, these tests are about formats rather than strength
+func testConfig(algorithm string) config.PasswordConfig {
+	return config.PasswordConfig{
+		Algorithm:         algorithm,
+		BcryptCost:        bcrypt.MinCost,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		ScryptN:           16,
+		ScryptR:           1,
+		ScryptP:           1,
+		MaxConcurrent:     2,
+	}
+}
+
+func TestHashAndVerify(t *testing.T) {
+	test := []struct {
+		Name      string
+		Algorithm string
+		Prefix    string
+	}{
+		{Name: "Bcrypt", Algorithm: Bcrypt, Prefix: "$2a$04$"},
+		{Name: "Argon2id", Algorithm: Argon2id, Prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{Name: "Scrypt", Algorithm: Scrypt, Prefix: "$scrypt$ln=4,r=1,p=1$"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			h := NewHasher(testConfig(tt.Algorithm))
+
+			hash, err := h.Hash(context.Background(), "Password1234")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.Prefix), hash)
+			assert.True(t, IsHash(hash))
+			assert.False(t, h.NeedsRehash(hash))
+
+			ok, err := h.Verify(context.Background(), hash, "Password1234")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = h.Verify(context.Background(), hash, "Password12345")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			// the salt is random
+			again, err := h.Hash(context.Background(), "Password1234")
+			assert.NoError(t, err)
+			assert.NotEqual(t, hash, again)
+		})
+	}
+}
+
+func TestVerifyEveryFormat(t *testing.T) {
+	var hashes []string
+	for _, algorithm := range []string{Bcrypt, Argon2id, Scrypt} {
+		hash, err := NewHasher(testConfig(algorithm)).Hash(context.Background(), "Password1234")
+		assert.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+
+	h := NewHasher(testConfig(Argon2id))
+	for _, hash := range hashes {
+		ok, err := h.Verify(context.Background(), hash, "Password1234")
+		assert.NoError(t, err)
+		assert.True(t, ok, hash)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	cfg := testConfig(Argon2id)
+	h := NewHasher(cfg)
+	hash, err := h.Hash(context.Background(), "Password1234")
+	assert.NoError(t, err)
+
+	stronger := cfg
+	stronger.Argon2Iterations = 2
+	assert.True(t, NewHasher(stronger).NeedsRehash(hash))
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("Password1234"), bcrypt.MinCost)
+	assert.True(t, h.NeedsRehash(string(bcryptHash)))
+
+	cfg.Algorithm = Bcrypt
+	assert.False(t, NewHasher(cfg).NeedsRehash(string(bcryptHash)))
+	cfg.BcryptCost++
+	assert.True(t, NewHasher(cfg).NeedsRehash(string(bcryptHash)))
+}
+
+func TestUnknownFormats(t *testing.T) {
+	h := NewHasher(testConfig(Bcrypt))
+
+	for _, hash := range []string{
+		"",
+		"Password1234",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$$a2V5",
+		"$scrypt$ln=0,r=1,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=4,r=1,p=1$c2FsdA$not base64",
+		// above the ceilings, too costly to verify
+		"$argon2id$v=19$m=4194304,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=4294967295,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=30,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=4,r=1,p=1024$c2FsdA$a2V5",
+	} {
+		assert.False(t, IsHash(hash), hash)
+		_, err := h.Verify(context.Background(), hash, "Password1234")
+		assert.ErrorIs(t, err, config.ErrUnknownHash, hash)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	h := NewHasher(testConfig(Bcrypt))
+
+	// with every slot taken, hashing waits until the caller gives up
+	assert.NoError(t, h.slots.Acquire(context.Background(), 2))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := h.Hash(ctx, "Password1234")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	h.slots.Release(1)
+	_, err = h.Hash(context.Background(), "Password1234")
+	assert.NoError(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		pwd, err := Generate()
+		assert.NoError(t, err)
+		assert.NoError(t, validator.ValidateData(models.User{Password: pwd}, nil))
+		assert.False(t, seen[pwd])
+		seen[pwd] = true
+	}
+}
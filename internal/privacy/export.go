@@ -0,0 +1,116 @@
+package privacy
+
+import (
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"sort"
+	"time"
+)
+
+// Profile is the exported user, without its password hash.
+type Profile struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Surname            string `json:"surname"`
+	Username           string `json:"username"`
+	Email              string `json:"email"`
+	Phone              string `json:"phone"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+func newProfile(user models.User) Profile {
+	return Profile{
+		ID:                 user.ID,
+		Name:               user.Name,
+		Surname:            user.Surname,
+		Username:           user.Username,
+		Email:              user.Email,
+		Phone:              user.Phone,
+		Role:               user.Role,
+		Disabled:           user.Disabled,
+		MustChangePassword: user.MustChangePassword,
+	}
+}
+
+// Consent is an access the user granted to an oauth client, made of every
+// token issued from the same authorization.
+type Consent struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scope      string    `json:"scope"`
+	GrantedAt  time.Time `json:"granted_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Revoked    bool      `json:"revoked"`
+}
+
+// consents groups the tokens of data by grant, the oldest grant first.
+func consents(data repository.SubjectData) []Consent {
+	names := map[string]string{}
+	for _, client := range data.Clients {
+		names[client.ID] = client.Name
+	}
+
+	grants := map[string]*Consent{}
+	var order []string
+	for _, token := range data.Tokens {
+		consent, ok := grants[token.GrantID]
+		if !ok {
+			consent = &Consent{
+				ClientID:   token.ClientID,
+				ClientName: names[token.ClientID],
+				Scope:      token.Scope,
+				GrantedAt:  token.AuthTime,
+				Revoked:    true,
+			}
+			grants[token.GrantID] = consent
+			order = append(order, token.GrantID)
+		}
+		if token.ExpiresAt.After(consent.ExpiresAt) {
+			consent.ExpiresAt = token.ExpiresAt
+		}
+		// a grant stays in force while any of its tokens does
+		if token.RevokedAt == nil {
+			consent.Revoked = false
+		}
+	}
+
+	result := make([]Consent, 0, len(order))
+	for _, id := range order {
+		result = append(result, *grants[id])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].GrantedAt.Before(result[j].GrantedAt) })
+	return result
+}
+
+// audit actions
+const (
+	ActionSubmittedJob     = "submitted_job"
+	ActionRegisteredClient = "registered_client"
+	ActionCreatedKey       = "created_api_key"
+)
+
+// AuditEntry is something the user did, as recorded by the rows naming it.
+type AuditEntry struct {
+	Action   string    `json:"action"`
+	TargetID string    `json:"target_id"`
+	Detail   string    `json:"detail"`
+	At       time.Time `json:"at"`
+}
+
+// audit lists what data records the user did, the oldest first.
+func audit(data repository.SubjectData) []AuditEntry {
+	entries := make([]AuditEntry, 0, len(data.CreatedJobs)+len(data.CreatedClients)+len(data.CreatedKeys))
+	for _, job := range data.CreatedJobs {
+		entries = append(entries, AuditEntry{Action: ActionSubmittedJob, TargetID: job.ID, Detail: job.Type, At: job.CreatedAt})
+	}
+	for _, client := range data.CreatedClients {
+		entries = append(entries, AuditEntry{Action: ActionRegisteredClient, TargetID: client.ID, Detail: client.Name, At: client.CreatedAt})
+	}
+	for _, key := range data.CreatedKeys {
+		entries = append(entries, AuditEntry{Action: ActionCreatedKey, TargetID: key.ID, Detail: key.Name, At: key.CreatedAt})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries
+}
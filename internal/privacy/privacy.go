@@ -0,0 +1,300 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of exports.
+const ContentType = "application/zip"
+
+// States lists the states of erasure requests.
+var States = []string{models.ErasurePending, models.ErasureCancelled, models.ErasureCompleted}
+
+// sweepBatch is how many due requests a sweep reads at once
+const sweepBatch = 100
+
+// Service exports the data kept about a user and erases it on request. An
+// erasure waits for its grace period, while it can be cancelled, and is then
+// carried out by Run.
+type Service struct {
+	repo  repository.PrivacyRepository
+	users services.UserServices
+	cfg   config.PrivacyConfig
+	now   func() time.Time
+}
+
+func NewService(repo repository.PrivacyRepository, users services.UserServices, cfg config.PrivacyConfig) *Service {
+	return &Service{repo: repo, users: users, cfg: cfg, now: time.Now}
+}
+
+// Export returns a zip archive with a json file for each kind of data kept
+// about username. Password hashes and secrets are left out.
+func (s *Service) Export(ctx context.Context, username string) (archive []byte, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.Export")
+	defer func() { tracing.End(span, err) }()
+
+	user, searchErr := s.users.SearchUser(ctx, username)
+	if searchErr != nil {
+		return nil, apperror.AppError(config.ErrExportingData, searchErr)
+	}
+	data, dataErr := s.repo.SubjectData(ctx, user.ID, user.Username)
+	if dataErr != nil {
+		return nil, apperror.AppError(config.ErrExportingData, dataErr)
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", newProfile(user)},
+		{"sessions.json", data.Sessions},
+		{"api_keys.json", data.APIKeys},
+		{"identities.json", data.Identities},
+		{"consents.json", consents(data)},
+		{"audit.json", audit(data)},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, createErr := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: s.now().UTC()})
+		if createErr != nil {
+			return nil, apperror.AppError(config.ErrExportingData, createErr)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(file.content); encodeErr != nil {
+			return nil, apperror.AppError(config.ErrExportingData, encodeErr)
+		}
+	}
+	if closeErr := zw.Close(); closeErr != nil {
+		return nil, apperror.AppError(config.ErrExportingData, closeErr)
+	}
+	return buf.Bytes(), nil
+}
+
+// RequestErasure asks for username to be erased once the grace period is
+// over, or right away when immediate, in which case the completed request is
+// returned.
+func (s *Service) RequestErasure(ctx context.Context, username, requestedBy string, immediate bool) (request models.ErasureRequest, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.RequestErasure")
+	defer func() { tracing.End(span, err) }()
+
+	user, searchErr := s.users.SearchUser(ctx, username)
+	if searchErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrRequestingErasure, searchErr)
+	}
+	if _, pendingErr := s.repo.PendingErasure(ctx, user.ID); !errors.Is(pendingErr, gorm.ErrRecordNotFound) {
+		if pendingErr == nil {
+			pendingErr = config.ErrErasurePending
+		}
+		return models.ErasureRequest{}, apperror.AppError(config.ErrRequestingErasure, pendingErr)
+	}
+	if guardErr := s.guardLastAdmin(ctx, user); guardErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrRequestingErasure, guardErr)
+	}
+
+	now := s.now().UTC()
+	request = models.ErasureRequest{
+		ID:          uuid.NewString(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		RequestedBy: requestedBy,
+		State:       models.ErasurePending,
+		RequestedAt: now,
+		ScheduledAt: now.Add(s.cfg.ErasureGracePeriod),
+	}
+	if immediate {
+		request.ScheduledAt = now
+	}
+	if createErr := s.repo.CreateErasure(ctx, request); createErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrRequestingErasure, createErr)
+	}
+	if !immediate {
+		return request, nil
+	}
+
+	if eraseErr := s.erase(ctx, request); eraseErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrErasingUser, eraseErr)
+	}
+	return s.Get(ctx, request.ID)
+}
+
+// Pending returns the pending request to erase username.
+func (s *Service) Pending(ctx context.Context, username string) (request models.ErasureRequest, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.Pending")
+	defer func() { tracing.End(span, err) }()
+
+	user, searchErr := s.users.SearchUser(ctx, username)
+	if searchErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrSearchingErasure, searchErr)
+	}
+	request, pendingErr := s.repo.PendingErasure(ctx, user.ID)
+	if pendingErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrSearchingErasure, notFound(pendingErr))
+	}
+	return request, nil
+}
+
+// CancelPending cancels the pending request to erase username.
+func (s *Service) CancelPending(ctx context.Context, username string) (err error) {
+	ctx, span := tracing.Start(ctx, "privacy.CancelPending")
+	defer func() { tracing.End(span, err) }()
+
+	request, pendingErr := s.Pending(ctx, username)
+	if pendingErr != nil {
+		return pendingErr
+	}
+	return s.Cancel(ctx, request.ID)
+}
+
+func (s *Service) Get(ctx context.Context, id string) (request models.ErasureRequest, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.Get")
+	defer func() { tracing.End(span, err) }()
+
+	request, getErr := s.repo.GetErasure(ctx, id)
+	if getErr != nil {
+		return models.ErasureRequest{}, apperror.AppError(config.ErrSearchingErasure, notFound(getErr))
+	}
+	return request, nil
+}
+
+// List returns the requests in state, or every request when it is empty.
+func (s *Service) List(ctx context.Context, state string) (requests []models.ErasureRequest, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.List")
+	defer func() { tracing.End(span, err) }()
+
+	requests, listErr := s.repo.ListErasures(ctx, state)
+	if listErr != nil {
+		return nil, apperror.AppError(config.ErrSearchingErasure, listErr)
+	}
+	return requests, nil
+}
+
+// Cancel cancels the request with id while it is pending.
+func (s *Service) Cancel(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "privacy.Cancel")
+	defer func() { tracing.End(span, err) }()
+
+	if cancelErr := s.repo.CancelErasure(ctx, id, s.now().UTC()); cancelErr != nil {
+		if errors.Is(cancelErr, config.ErrNoRowsAffected) {
+			cancelErr = config.ErrErasureNotFound
+		}
+		return apperror.AppError(config.ErrCancellingErasure, cancelErr)
+	}
+	return nil
+}
+
+// Run carries out the requests past their grace period every sweep
+// interval until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error sweeping erasure requests", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep carries out every request past its grace period and returns how
+// many users were erased. A request that fails stays pending for the next
+// sweep.
+func (s *Service) Sweep(ctx context.Context) (erased int, err error) {
+	ctx, span := tracing.Start(ctx, "privacy.Sweep")
+	defer func() { tracing.End(span, err) }()
+
+	for ctx.Err() == nil {
+		due, dueErr := s.repo.DueErasures(ctx, s.now().UTC(), sweepBatch)
+		if dueErr != nil {
+			return erased, dueErr
+		}
+		failed := 0
+		for _, request := range due {
+			if eraseErr := s.erase(ctx, request); eraseErr != nil {
+				slog.ErrorContext(ctx, "error erasing user", "request", request.ID, "error", eraseErr)
+				failed++
+				continue
+			}
+			erased++
+		}
+		// failed requests would be read again, they wait for the next sweep
+		if len(due) < sweepBatch || failed == len(due) {
+			break
+		}
+	}
+	return erased, nil
+}
+
+// erase erases the user of request in a single transaction, then deletes it
+// again through the user services so their cache forgets it.
+func (s *Service) erase(ctx context.Context, request models.ErasureRequest) error {
+	user, searchErr := s.users.SearchUserByID(ctx, request.UserID)
+	switch {
+	case searchErr == nil:
+		if guardErr := s.guardLastAdmin(ctx, user); guardErr != nil {
+			return guardErr
+		}
+	case !errors.Is(searchErr, config.ErrUserNotFound):
+		return searchErr
+	}
+
+	receipt := models.ErasureReceipt{
+		RequestID:   request.ID,
+		UserID:      request.UserID,
+		RequestedAt: request.RequestedAt,
+		CompletedAt: s.now().UTC(),
+	}
+	if _, eraseErr := s.repo.Erase(ctx, request, receipt); eraseErr != nil {
+		if errors.Is(eraseErr, config.ErrNoRowsAffected) {
+			// cancelled meanwhile or erased by another instance
+			return nil
+		}
+		return eraseErr
+	}
+	// the username may belong to someone else by now, only the cache entry goes
+	s.users.ForgetCachedUser(ctx, request.Username)
+	slog.InfoContext(ctx, "user erased", "request", request.ID, "user_id", request.UserID)
+	return nil
+}
+
+// guardLastAdmin refuses to erase user when no other admin would be left.
+func (s *Service) guardLastAdmin(ctx context.Context, user models.User) error {
+	if user.Role != models.RoleAdmin {
+		return nil
+	}
+	admins, countErr := s.users.CountUsers(ctx, repository.UserFilter{Role: models.RoleAdmin})
+	if countErr != nil {
+		return countErr
+	}
+	if admins <= 1 {
+		return config.ErrLastAdmin
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return config.ErrErasureNotFound
+	}
+	return err
+}
@@ -0,0 +1,297 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeRepo struct {
+	data     repository.SubjectData
+	requests map[string]models.ErasureRequest
+	erased   []string
+}
+
+func (r *fakeRepo) SubjectData(ctx context.Context, userID, username string) (repository.SubjectData, error) {
+	return r.data, nil
+}
+
+func (r *fakeRepo) CreateErasure(ctx context.Context, request models.ErasureRequest) error {
+	r.requests[request.ID] = request
+	return nil
+}
+
+func (r *fakeRepo) GetErasure(ctx context.Context, id string) (models.ErasureRequest, error) {
+	request, ok := r.requests[id]
+	if !ok {
+		return models.ErasureRequest{}, gorm.ErrRecordNotFound
+	}
+	return request, nil
+}
+
+func (r *fakeRepo) PendingErasure(ctx context.Context, userID string) (models.ErasureRequest, error) {
+	for _, request := range r.requests {
+		if request.UserID == userID && request.State == models.ErasurePending {
+			return request, nil
+		}
+	}
+	return models.ErasureRequest{}, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) ListErasures(ctx context.Context, state string) ([]models.ErasureRequest, error) {
+	var requests []models.ErasureRequest
+	for _, request := range r.requests {
+		if state == "" || request.State == state {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+func (r *fakeRepo) CancelErasure(ctx context.Context, id string, at time.Time) error {
+	request, ok := r.requests[id]
+	if !ok || request.State != models.ErasurePending {
+		return config.ErrNoRowsAffected
+	}
+	request.State = models.ErasureCancelled
+	request.CancelledAt = &at
+	r.requests[id] = request
+	return nil
+}
+
+func (r *fakeRepo) DueErasures(ctx context.Context, now time.Time, limit int) ([]models.ErasureRequest, error) {
+	var due []models.ErasureRequest
+	for _, request := range r.requests {
+		if request.State == models.ErasurePending && !request.ScheduledAt.After(now) {
+			due = append(due, request)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeRepo) Erase(ctx context.Context, request models.ErasureRequest, receipt models.ErasureReceipt) (models.ErasureReceipt, error) {
+	stored := r.requests[request.ID]
+	if stored.State != models.ErasurePending {
+		return models.ErasureReceipt{}, config.ErrNoRowsAffected
+	}
+	receipt.Deleted = map[string]int64{"users": 1}
+	stored.State = models.ErasureCompleted
+	stored.Username = "erased:" + request.ID
+	stored.CompletedAt = &receipt.CompletedAt
+	stored.Receipt = &receipt
+	r.requests[request.ID] = stored
+	r.erased = append(r.erased, request.UserID)
+	return receipt, nil
+}
+
+type fakeUsers struct {
+	services.UserServices
+	users     map[string]models.User
+	deleted   []string
+	forgotten []string
+}
+
+func (u *fakeUsers) SearchUser(ctx context.Context, username string) (models.User, error) {
+	for _, user := range u.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, config.ErrUserNotFound
+}
+
+func (u *fakeUsers) SearchUserByID(ctx context.Context, id string) (models.User, error) {
+	user, ok := u.users[id]
+	if !ok {
+		return models.User{}, config.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (u *fakeUsers) DeleteUser(ctx context.Context, username string) error {
+	u.deleted = append(u.deleted, username)
+	return config.ErrUserNotFound
+}
+
+func (u *fakeUsers) ForgetCachedUser(ctx context.Context, username string) {
+	u.forgotten = append(u.forgotten, username)
+}
+
+func (u *fakeUsers) CountUsers(ctx context.Context, filter repository.UserFilter) (int64, error) {
+	var count int64
+	for _, user := range u.users {
+		if user.Role == filter.Role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func testService(now time.Time) (*Service, *fakeRepo, *fakeUsers) {
+	repo := &fakeRepo{requests: map[string]models.ErasureRequest{}}
+	users := &fakeUsers{users: map[string]models.User{
+		"1": {ID: "1", Username: "johndoe", Email: "johndoe@example.com", Password: "$2a$10$hash", Role: models.RoleUser},
+		"2": {ID: "2", Username: "admin", Role: models.RoleAdmin},
+	}}
+	s := NewService(repo, users, config.PrivacyConfig{ErasureGracePeriod: 24 * time.Hour, SweepInterval: time.Minute})
+	s.now = func() time.Time { return now }
+	return s, repo, users
+}
+
+func TestExport(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s, repo, _ := testService(now)
+	repo.data = repository.SubjectData{
+		Sessions: []models.Session{{ID: "session-1", UserID: "1"}},
+		Tokens: []models.OAuthToken{
+			{Hash: "h1", GrantID: "grant-1", ClientID: "client-1", Scope: "openid", AuthTime: now, ExpiresAt: now.Add(time.Hour), RevokedAt: &now},
+			{Hash: "h2", GrantID: "grant-1", ClientID: "client-1", Scope: "openid", AuthTime: now, ExpiresAt: now.Add(24 * time.Hour)},
+		},
+		Clients:     []models.OAuthClient{{ID: "client-1", Name: "Portal"}},
+		CreatedJobs: []models.Job{{ID: "job-1", Type: models.JobDisable, CreatedAt: now}},
+	}
+
+	archive, err := s.Export(context.Background(), "johndoe")
+	assert.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		rc, openErr := file.Open()
+		assert.NoError(t, openErr)
+		files[file.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	assert.Len(t, files, 6)
+
+	var profile map[string]interface{}
+	assert.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "johndoe@example.com", profile["email"])
+	assert.NotContains(t, profile, "password")
+
+	var consents []Consent
+	assert.NoError(t, json.Unmarshal(files["consents.json"], &consents))
+	assert.Equal(t, []Consent{{ClientID: "client-1", ClientName: "Portal", Scope: "openid", GrantedAt: now, ExpiresAt: now.Add(24 * time.Hour)}}, consents)
+
+	var audit []AuditEntry
+	assert.NoError(t, json.Unmarshal(files["audit.json"], &audit))
+	assert.Equal(t, []AuditEntry{{Action: ActionSubmittedJob, TargetID: "job-1", Detail: models.JobDisable, At: now}}, audit)
+
+	_, err = s.Export(context.Background(), "janedoe")
+	assert.ErrorIs(t, err, config.ErrUserNotFound)
+}
+
+func TestRequestErasure(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	test := []struct {
+		Name        string
+		Username    string
+		Pending     bool
+		ExpectedErr error
+	}{
+		{Name: "Scheduled After Grace Period", Username: "johndoe"},
+		{Name: "Already Pending", Username: "johndoe", Pending: true, ExpectedErr: config.ErrErasurePending},
+		{Name: "Last Admin", Username: "admin", ExpectedErr: config.ErrLastAdmin},
+		{Name: "Unknown User", Username: "janedoe", ExpectedErr: config.ErrUserNotFound},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			s, repo, _ := testService(now)
+			if tt.Pending {
+				repo.requests["erasure-0"] = models.ErasureRequest{ID: "erasure-0", UserID: "1", State: models.ErasurePending}
+			}
+
+			request, err := s.RequestErasure(context.Background(), tt.Username, tt.Username, false)
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			if tt.ExpectedErr == nil {
+				assert.Equal(t, models.ErasurePending, request.State)
+				assert.Equal(t, now.Add(24*time.Hour), request.ScheduledAt)
+				assert.Contains(t, repo.requests, request.ID)
+			}
+		})
+	}
+}
+
+func TestImmediateErasure(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s, repo, users := testService(now)
+
+	request, err := s.RequestErasure(context.Background(), "johndoe", "admin", true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ErasureCompleted, request.State)
+	assert.Equal(t, &models.ErasureReceipt{
+		RequestID:   request.ID,
+		UserID:      "1",
+		RequestedAt: now,
+		CompletedAt: now,
+		Deleted:     map[string]int64{"users": 1},
+	}, request.Receipt)
+	assert.Equal(t, []string{"1"}, repo.erased)
+	// dropped from the cache of the user services
+	assert.Equal(t, []string{"johndoe"}, users.forgotten)
+	assert.Empty(t, users.deleted)
+}
+
+func TestSweepUsernameTakenAgain(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s, repo, users := testService(now)
+	request, err := s.RequestErasure(context.Background(), "johndoe", "johndoe", false)
+	assert.NoError(t, err)
+
+	// johndoe was deleted during the grace period and someone else signed up
+	// with the name
+	delete(users.users, "1")
+	users.users["3"] = models.User{ID: "3", Username: "johndoe", Role: models.RoleUser}
+	s.now = func() time.Time { return now.Add(25 * time.Hour) }
+
+	erased, err := s.Sweep(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, erased)
+	assert.Equal(t, models.ErasureCompleted, repo.requests[request.ID].State)
+	assert.Equal(t, []string{"1"}, repo.erased)
+	assert.Empty(t, users.deleted)
+	assert.Contains(t, users.users, "3")
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s, repo, _ := testService(now)
+
+	due, err := s.RequestErasure(context.Background(), "johndoe", "johndoe", false)
+	assert.NoError(t, err)
+	repo.requests["erasure-cancelled"] = models.ErasureRequest{ID: "erasure-cancelled", UserID: "3", State: models.ErasurePending, ScheduledAt: now}
+	assert.NoError(t, s.Cancel(context.Background(), "erasure-cancelled"))
+	assert.ErrorIs(t, s.Cancel(context.Background(), "erasure-cancelled"), config.ErrErasureNotFound)
+
+	// nothing is due before the grace period is over
+	erased, err := s.Sweep(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, erased)
+
+	s.now = func() time.Time { return now.Add(25 * time.Hour) }
+	erased, err = s.Sweep(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, erased)
+	assert.Equal(t, models.ErasureCompleted, repo.requests[due.ID].State)
+	assert.Equal(t, []string{"1"}, repo.erased)
+
+	_, err = s.Pending(context.Background(), "admin")
+	assert.ErrorIs(t, err, config.ErrErasureNotFound)
+}
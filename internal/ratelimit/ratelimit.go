@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/utils/web"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headers
+const (
+	LimitHeader      = "RateLimit-Limit"
+	RemainingHeader  = "RateLimit-Remaining"
+	ResetHeader      = "RateLimit-Reset"
+	PolicyHeader     = "RateLimit-Policy"
+	RetryAfterHeader = "Retry-After"
+)
+
+// Limiter enforces the configured policies. Policies keyed by ip run before
+// routing, the ones keyed by user or api key once the request is
+// authenticated, and in each stage the first matching policy applies.
+type Limiter struct {
+	store     Store
+	basePath  string
+	byIP      []config.RatePolicy
+	principal []config.RatePolicy
+}
+
+// New parses the policies of cfg, whose buckets are kept in store. The
+// routes of the policies are relative to basePath.
+func New(cfg config.RateLimitConfig, basePath string, store Store) (*Limiter, error) {
+	l := &Limiter{store: store, basePath: basePath}
+	if !cfg.Enabled {
+		return l, nil
+	}
+	policies, err := cfg.ParsePolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range policies {
+		if policy.Key == config.RateKeyIP {
+			l.byIP = append(l.byIP, policy)
+		} else {
+			l.principal = append(l.principal, policy)
+		}
+	}
+	return l, nil
+}
+
+// ByIP limits every client ip. Behind a reverse proxy the ip is only read
+// from X-Forwarded-For when the proxy is one of server.trusted_proxies.
+func (l *Limiter) ByIP() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if l.take(ctx, l.byIP, func(config.RatePolicy) string { return "ip:" + ctx.ClientIP() }) {
+			ctx.Next()
+		}
+	}
+}
+
+// ByPrincipal limits every user or api key. It must run after
+// Authenticate, anonymous requests are limited by ip instead.
+func (l *Limiter) ByPrincipal() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if l.take(ctx, l.principal, func(policy config.RatePolicy) string { return principalKey(ctx, policy) }) {
+			ctx.Next()
+		}
+	}
+}
+
+func principalKey(ctx *gin.Context, policy config.RatePolicy) string {
+	if id := ctx.GetString(middleware.APIKeyIDKey); id != "" && policy.Key == config.RateKeyAPIKey {
+		return "key:" + id
+	}
+	// user policies count requests made with api keys against their owner
+	if username := ctx.GetString(middleware.UsernameKey); username != "" && policy.Key == config.RateKeyUser {
+		return "user:" + username
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// take takes a token for the first of policies matching the request and
+// reports whether it may go on, otherwise it has been answered with 429.
+// Errors of the store let the request through.
+func (l *Limiter) take(ctx *gin.Context, policies []config.RatePolicy, key func(config.RatePolicy) string) bool {
+	route := strings.TrimPrefix(ctx.FullPath(), l.basePath)
+	for _, policy := range policies {
+		if !policy.Matches(ctx.Request.Method, route) {
+			continue
+		}
+
+		result, err := l.store.Take(ctx, "ratelimit:"+policy.String()+":"+key(policy), policy)
+		if err != nil {
+			metrics.RateLimitErrors.Inc()
+			slog.WarnContext(ctx, "rate limit store failed, request let through", "policy", policy.String(), "error", err)
+			return true
+		}
+		setHeaders(ctx, policy, result)
+		if !result.Allowed {
+			metrics.RateLimitRejected.WithLabelValues(policy.String()).Inc()
+			ctx.Header(RetryAfterHeader, strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			web.NewError(ctx, http.StatusTooManyRequests, config.ErrTooManyRequests.Error())
+			ctx.Abort()
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+// setHeaders describes the bucket, when an earlier stage already did the
+// tighter of both is kept.
+func setHeaders(ctx *gin.Context, policy config.RatePolicy, result Result) {
+	if previous := ctx.Writer.Header().Get(RemainingHeader); previous != "" {
+		if remaining, err := strconv.Atoi(previous); err == nil && remaining <= result.Remaining {
+			return
+		}
+	}
+	ctx.Header(LimitHeader, strconv.Itoa(policy.Burst))
+	ctx.Header(RemainingHeader, strconv.Itoa(result.Remaining))
+	ctx.Header(ResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+	ctx.Header(PolicyHeader, strconv.Itoa(policy.Tokens)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
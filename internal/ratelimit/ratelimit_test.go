@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var loginPolicy = config.RatePolicy{Method: "POST", Route: "/login", Tokens: 2, Period: time.Minute, Burst: 3, Key: config.RateKeyIP}
+
+func TestMemory(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := m.Take(context.Background(), "ip:10.0.0.1", loginPolicy)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	// a token comes back every 30s
+	result, _ := m.Take(context.Background(), "ip:10.0.0.1", loginPolicy)
+	assert.Equal(t, Result{Allowed: false, RetryAfter: 30 * time.Second, Reset: 90 * time.Second}, result)
+	other, _ := m.Take(context.Background(), "ip:10.0.0.2", loginPolicy)
+	assert.True(t, other.Allowed)
+
+	now = now.Add(45 * time.Second)
+	result, _ = m.Take(context.Background(), "ip:10.0.0.1", loginPolicy)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0, Reset: 75 * time.Second}, result)
+
+	// refilled buckets are forgotten
+	now = now.Add(time.Hour)
+	m.sweep(now)
+	assert.Zero(t, m.Len())
+}
+
+type fakeScripter struct {
+	reply interface{}
+	err   error
+	keys  []string
+	args  []string
+}
+
+func (s *fakeScripter) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	s.keys, s.args = keys, args
+	return s.reply, s.err
+}
+
+func TestRedis(t *testing.T) {
+	client := &fakeScripter{reply: []interface{}{int64(1), []byte("1.5")}}
+
+	result, err := NewRedis(client).Take(context.Background(), "bucket", loginPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1, Reset: 45 * time.Second}, result)
+	assert.Equal(t, []string{"bucket"}, client.keys)
+	assert.Equal(t, []string{"3", "3.3333333333333335e-05"}, client.args)
+
+	client.reply = []interface{}{int64(0), []byte("0.5")}
+	result, err = NewRedis(client).Take(context.Background(), "bucket", loginPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: false, RetryAfter: 15 * time.Second, Reset: 75 * time.Second}, result)
+
+	client.reply = "OK"
+	_, err = NewRedis(client).Take(context.Background(), "bucket", loginPolicy)
+	assert.ErrorContains(t, err, "unexpected rate limit reply")
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, policy config.RatePolicy) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func testEngine(t *testing.T, policies []string, store Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter, err := New(config.RateLimitConfig{Enabled: true, Policies: policies}, "/api", store)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	assert.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	r.Use(limiter.ByIP())
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	r.POST("/api/login", ok)
+	r.GET("/api/search", func(ctx *gin.Context) {
+		ctx.Set(middleware.UsernameKey, ctx.GetHeader("X-User"))
+		if id := ctx.GetHeader("X-Key"); id != "" {
+			ctx.Set(middleware.APIKeyIDKey, id)
+		}
+	}, limiter.ByPrincipal(), ok)
+	return r
+}
+
+func request(r *gin.Engine, method, path, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestByIP(t *testing.T) {
+	r := testEngine(t, []string{"POST /login 1/1m"}, NewMemory())
+
+	w := request(r, http.MethodPost, "/api/login", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(LimitHeader))
+	assert.Equal(t, "0", w.Header().Get(RemainingHeader))
+	assert.Equal(t, "60", w.Header().Get(ResetHeader))
+	assert.Equal(t, "1;w=60", w.Header().Get(PolicyHeader))
+
+	w = request(r, http.MethodPost, "/api/login", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get(RetryAfterHeader))
+	assert.Contains(t, w.Body.String(), config.ErrTooManyRequests.Error())
+
+	// an untrusted peer cannot pick its ip
+	w = request(r, http.MethodPost, "/api/login", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// behind a trusted proxy every client has its own bucket
+	for _, client := range []string{"198.51.100.7", "198.51.100.8"} {
+		w = request(r, http.MethodPost, "/api/login", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": client})
+		assert.Equal(t, http.StatusOK, w.Code, client)
+	}
+
+	// routes without a policy are not limited
+	w = request(r, http.MethodGet, "/api/search", "192.0.2.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(LimitHeader))
+}
+
+func TestByPrincipal(t *testing.T) {
+	r := testEngine(t, []string{"GET /search 1/1m key=api_key", "GET * 2/1m key=user"}, NewMemory())
+	johndoe := map[string]string{"X-User": "johndoe"}
+	key := map[string]string{"X-User": "johndoe", "X-Key": "key-1"}
+
+	// the key has its own bucket, the user one is left alone
+	assert.Equal(t, http.StatusOK, request(r, http.MethodGet, "/api/search", "192.0.2.1:1234", key).Code)
+	assert.Equal(t, http.StatusTooManyRequests, request(r, http.MethodGet, "/api/search", "192.0.2.1:1234", key).Code)
+
+	// user tokens fall back to the ip for an api key policy
+	assert.Equal(t, http.StatusOK, request(r, http.MethodGet, "/api/search", "192.0.2.2:1234", johndoe).Code)
+	assert.Equal(t, http.StatusTooManyRequests, request(r, http.MethodGet, "/api/search", "192.0.2.2:1234", johndoe).Code)
+	assert.Equal(t, http.StatusOK, request(r, http.MethodGet, "/api/search", "192.0.2.3:1234", johndoe).Code)
+}
+
+func TestStoreErrorLetsThrough(t *testing.T) {
+	r := testEngine(t, []string{"POST /login 1/1m"}, failingStore{})
+
+	for i := 0; i < 3; i++ {
+		w := request(r, http.MethodPost, "/api/login", "192.0.2.1:1234", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	limiter, err := New(config.RateLimitConfig{Policies: []string{"not a policy"}}, "/api", NewMemory())
+	assert.NoError(t, err)
+	assert.Empty(t, limiter.byIP)
+
+	_, err = New(config.RateLimitConfig{Enabled: true, Policies: []string{"not a policy"}}, "/api", NewMemory())
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many takes the memory store serves between sweeps of
+// its full buckets
+const sweepEvery = 1024
+
+// Result is the state of a bucket after a take.
+type Result struct {
+	Allowed bool
+	// Remaining are the whole tokens left
+	Remaining int
+	// RetryAfter is the wait until the next token, zero when allowed
+	RetryAfter time.Duration
+	// Reset is the wait until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the token buckets. Take takes a token from the bucket of key,
+// which starts full, when one is left.
+type Store interface {
+	Take(ctx context.Context, key string, policy config.RatePolicy) (Result, error)
+}
+
+// perSecond is the rate tokens come back at.
+func perSecond(policy config.RatePolicy) float64 {
+	return float64(policy.Tokens) / policy.Period.Seconds()
+}
+
+func result(policy config.RatePolicy, tokens float64, allowed bool) Result {
+	rate := perSecond(policy)
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(policy.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(0, s) * float64(time.Second))
+}
+
+// Memory keeps the buckets of this instance only, each instance then allows
+// the full rate.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket is full again and can be forgotten
+	full time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, policy config.RatePolicy) (Result, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.takes++
+	if m.takes%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(policy.Burst), b.tokens+now.Sub(b.updated).Seconds()*perSecond(policy))
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	r := result(policy, b.tokens, allowed)
+	b.full = now.Add(r.Reset)
+	return r, nil
+}
+
+// Len returns how many buckets are kept.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+// sweep forgets the buckets that refilled, they would start full anyway.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Scripter runs Lua scripts on a Redis compatible server, as cache.RESP does.
+type Scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error)
+}
+
+// takeScript refills and takes from the bucket at KEYS[1] atomically. ARGV
+// are the burst and the tokens per millisecond. The clock of the server is
+// used so every instance agrees on it, which needs Redis 5 or later.
+const takeScript = `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+// Redis keeps the buckets on a Redis compatible server, shared by every
+// instance.
+type Redis struct {
+	client Scripter
+}
+
+var _ Store = (*Redis)(nil)
+
+func NewRedis(client Scripter) *Redis {
+	return &Redis{client: client}
+}
+
+func (r *Redis) Take(ctx context.Context, key string, policy config.RatePolicy) (Result, error) {
+	perMilli := perSecond(policy) / 1000
+	reply, err := r.client.Eval(ctx, takeScript, []string{key},
+		strconv.Itoa(policy.Burst), strconv.FormatFloat(perMilli, 'g', -1, 64))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, allowedOK := values[0].(int64)
+	raw, tokensOK := values[1].([]byte)
+	if !allowedOK || !tokensOK {
+		return Result{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	tokens, parseErr := strconv.ParseFloat(string(raw), 64)
+	if parseErr != nil {
+		return Result{}, errors.Join(errors.New("unexpected rate limit reply"), parseErr)
+	}
+	return result(policy, tokens, allowed == 1), nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyStore struct {
+	DB *gorm.DB
+}
+
+var _ APIKeyRepository = (*APIKeyStore)(nil)
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{DB: db}
+}
+
+func (s *APIKeyStore) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	return s.DB.WithContext(ctx).Create(&key).Error
+}
+
+func (s *APIKeyStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	var key models.APIKey
+	if err := s.DB.WithContext(ctx).Where("prefix = ?", prefix).Take(&key).Error; err != nil {
+		return models.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *APIKeyStore) ListAPIKeys(ctx context.Context, username string) ([]models.APIKey, error) {
+	query := s.DB.WithContext(ctx).Order("created_at")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	var keys []models.APIKey
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *APIKeyStore) RevokeAPIKey(ctx context.Context, id, username string) error {
+	query := s.DB.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Where("revoked_at IS NULL")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	result := query.Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (s *APIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	return s.DB.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
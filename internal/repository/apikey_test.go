@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func apiKeyRepo(t *testing.T) (*APIKeyStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewAPIKeyRepository(gormDB), mock
+}
+
+func TestGetAPIKeyByPrefix(t *testing.T) {
+	repo, mock := apiKeyRepo(t)
+
+	mock.ExpectQuery(config.GetAPIKeyTestQuery).WithArgs("gmk_0123456789ab", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "prefix", "scopes"}).AddRow("key-1", "gmk_0123456789ab", []byte(`["jobs","users:read"]`)))
+
+	key, err := repo.GetAPIKeyByPrefix(context.Background(), "gmk_0123456789ab")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jobs", "users:read"}, key.Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	repo, mock := apiKeyRepo(t)
+
+	test := []struct {
+		Name        string
+		Username    string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Any Owner",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RevokeAPIKeyTestQuery+"$").WithArgs(sqlmock.AnyArg(), "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:     "Own Key",
+			Username: "johndoe",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RevokeAPIKeyTestQuery+" AND username = \\?").WithArgs(sqlmock.AnyArg(), "key-1", "johndoe").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Not Found",
+			Username:    "johndoe",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RevokeAPIKeyTestQuery).WithArgs(sqlmock.AnyArg(), "key-1", "johndoe").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			assert.ErrorIs(t, repo.RevokeAPIKey(context.Background(), "key-1", tt.Username), tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
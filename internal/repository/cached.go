@@ -0,0 +1,427 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/internal/cache"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/models"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+const userKeyPrefix = "gomanage:user:"
+
+// cached for usernames that don't exist
+var missingUser = []byte("-")
+
+// CachedRepository caches Search results of an UserRepository, without their
+// password hash. Every write invalidates the user it touches, cache failures
+// fall back to the wrapped repository.
+type CachedRepository struct {
+	// Cipher, when set, encrypts the personal fields of the entries like
+	// the database stores them
+	Cipher FieldCipher
+
+	repo        UserRepository
+	cache       cache.Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	group singleflight.Group
+	// generation is bumped on every invalidation so a load that raced with a
+	// write is not stored, mu orders the bump against stores
+	mu         sync.Mutex
+	generation atomic.Uint64
+}
+
+var _ UserRepository = (*CachedRepository)(nil)
+
+// NewCachedRepository keeps found users for ttl and missing ones for
+// negativeTTL, zero disables negative caching.
+func NewCachedRepository(repo UserRepository, c cache.Cache, ttl, negativeTTL time.Duration) *CachedRepository {
+	return &CachedRepository{repo: repo, cache: c, ttl: ttl, negativeTTL: negativeTTL}
+}
+
+func (r *CachedRepository) Search(ctx context.Context, username string) (models.User, error) {
+	key := userKeyPrefix + username
+
+	data, found, err := r.cache.Get(ctx, key)
+	if err != nil {
+		r.cacheFailed(ctx, metrics.CacheGet, err)
+	}
+	if found {
+		user, err := r.decodeUser(ctx, data)
+		if err == nil {
+			if user == nil {
+				metrics.CacheRequests.WithLabelValues(metrics.CacheNegativeHit).Inc()
+				return models.User{}, gorm.ErrRecordNotFound
+			}
+			metrics.CacheRequests.WithLabelValues(metrics.CacheHit).Inc()
+			return *user, nil
+		}
+		r.cacheFailed(ctx, metrics.CacheGet, err)
+	}
+	metrics.CacheRequests.WithLabelValues(metrics.CacheMiss).Inc()
+
+	// concurrent misses of the same user share one query
+	result, err, shared := r.group.Do(key, func() (interface{}, error) {
+		return r.load(ctx, key, username)
+	})
+	if shared && isContextError(err) && ctx.Err() == nil {
+		// the request that ran the query was cancelled, not this one
+		user, err := r.repo.Search(ctx, username)
+		return withoutSecrets(user), err
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return result.(models.User), nil
+}
+
+// SearchFresh always reads the wrapped repository, logins must not trust a
+// copy another instance may have outdated.
+func (r *CachedRepository) SearchFresh(ctx context.Context, username string) (models.User, error) {
+	return r.repo.SearchFresh(ctx, username)
+}
+
+func (r *CachedRepository) load(ctx context.Context, key, username string) (models.User, error) {
+	generation := r.generation.Load()
+	user, err := r.repo.Search(ctx, username)
+	user = withoutSecrets(user)
+
+	switch {
+	case err == nil:
+		if data, encodeErr := r.encodeUser(ctx, user); encodeErr == nil {
+			r.store(ctx, generation, key, data, r.ttl)
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound) && r.negativeTTL > 0:
+		r.store(ctx, generation, key, missingUser, r.negativeTTL)
+	}
+	return user, err
+}
+
+// store skips values read before a write that already invalidated them.
+func (r *CachedRepository) store(ctx context.Context, generation uint64, key string, data []byte, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation.Load() != generation {
+		return
+	}
+	if err := r.cache.Set(ctx, key, data, ttl); err != nil {
+		r.cacheFailed(ctx, metrics.CacheSet, err)
+	}
+}
+
+// SearchByID is not cached, entries are keyed by username.
+func (r *CachedRepository) SearchByID(ctx context.Context, id string) (models.User, error) {
+	return r.repo.SearchByID(ctx, id)
+}
+
+func (r *CachedRepository) Save(ctx context.Context, user models.User) error {
+	// also drops a cached "missing" for this username
+	defer r.Invalidate(ctx, user.Username)
+	return r.repo.Save(ctx, user)
+}
+
+func (r *CachedRepository) Update(ctx context.Context, username string, update models.User) error {
+	defer r.Invalidate(ctx, username)
+	return r.repo.Update(ctx, username, update)
+}
+
+func (r *CachedRepository) Delete(ctx context.Context, username string) error {
+	defer r.Invalidate(ctx, username)
+	return r.repo.Delete(ctx, username)
+}
+
+func (r *CachedRepository) ChangePwd(ctx context.Context, username string, newPwd string) error {
+	defer r.Invalidate(ctx, username)
+	return r.repo.ChangePwd(ctx, username, newPwd)
+}
+
+func (r *CachedRepository) RehashPwd(ctx context.Context, username, current, rehashed string) error {
+	defer r.Invalidate(ctx, username)
+	return r.repo.RehashPwd(ctx, username, current, rehashed)
+}
+
+func (r *CachedRepository) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	defer r.Invalidate(ctx, username)
+	return r.repo.SetDisabled(ctx, username, disabled)
+}
+
+func (r *CachedRepository) SaveBatch(ctx context.Context, users []models.User) error {
+	defer func() {
+		for _, user := range users {
+			r.Invalidate(ctx, user.Username)
+		}
+	}()
+	return r.repo.SaveBatch(ctx, users)
+}
+
+func (r *CachedRepository) Replace(ctx context.Context, user models.User) error {
+	defer r.Invalidate(ctx, user.Username)
+	return r.repo.Replace(ctx, user)
+}
+
+func (r *CachedRepository) DisableMany(ctx context.Context, usernames []string) (int64, error) {
+	defer r.invalidateAll(ctx, usernames)
+	return r.repo.DisableMany(ctx, usernames)
+}
+
+func (r *CachedRepository) ExpirePasswords(ctx context.Context, usernames []string) (int64, error) {
+	defer r.invalidateAll(ctx, usernames)
+	return r.repo.ExpirePasswords(ctx, usernames)
+}
+
+func (r *CachedRepository) FindTaken(ctx context.Context, usernames, emails, phones []string) ([]models.User, error) {
+	return r.repo.FindTaken(ctx, usernames, emails, phones)
+}
+
+func (r *CachedRepository) Export(ctx context.Context, filter UserFilter, batchSize int, fn func(users []models.User) error) error {
+	return r.repo.Export(ctx, filter, batchSize, fn)
+}
+
+func (r *CachedRepository) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	return r.repo.Count(ctx, filter)
+}
+
+func (r *CachedRepository) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	return r.repo.List(ctx, offset, limit)
+}
+
+// RotateDataKey and Reencrypt leave the cache alone, re-encrypting changes no
+// user and older data keys still open the entries.
+func (r *CachedRepository) RotateDataKey(ctx context.Context) error {
+	return r.repo.RotateDataKey(ctx)
+}
+
+func (r *CachedRepository) Reencrypt(ctx context.Context, afterID string, limit int) (ReencryptBatch, error) {
+	return r.repo.Reencrypt(ctx, afterID, limit)
+}
+
+// Transaction bypasses the cache inside fn and invalidates every user written
+// once the transaction is over, committed or not.
+func (r *CachedRepository) Transaction(ctx context.Context, fn func(tx UserRepository) error) error {
+	recorder := &writeRecorder{}
+	defer func() {
+		for _, username := range recorder.written {
+			r.Invalidate(ctx, username)
+		}
+	}()
+	return r.repo.Transaction(ctx, func(tx UserRepository) error {
+		recorder.repo = tx
+		return fn(recorder)
+	})
+}
+
+// writeRecorder remembers the users written through a transaction.
+type writeRecorder struct {
+	repo    UserRepository
+	written []string
+}
+
+func (w *writeRecorder) Search(ctx context.Context, username string) (models.User, error) {
+	return w.repo.Search(ctx, username)
+}
+
+func (w *writeRecorder) SearchFresh(ctx context.Context, username string) (models.User, error) {
+	return w.repo.SearchFresh(ctx, username)
+}
+
+func (w *writeRecorder) SearchByID(ctx context.Context, id string) (models.User, error) {
+	return w.repo.SearchByID(ctx, id)
+}
+
+func (w *writeRecorder) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	return w.repo.List(ctx, offset, limit)
+}
+
+func (w *writeRecorder) FindTaken(ctx context.Context, usernames, emails, phones []string) ([]models.User, error) {
+	return w.repo.FindTaken(ctx, usernames, emails, phones)
+}
+
+func (w *writeRecorder) Export(ctx context.Context, filter UserFilter, batchSize int, fn func(users []models.User) error) error {
+	return w.repo.Export(ctx, filter, batchSize, fn)
+}
+
+func (w *writeRecorder) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	return w.repo.Count(ctx, filter)
+}
+
+func (w *writeRecorder) SaveBatch(ctx context.Context, users []models.User) error {
+	for _, user := range users {
+		w.written = append(w.written, user.Username)
+	}
+	return w.repo.SaveBatch(ctx, users)
+}
+
+func (w *writeRecorder) Replace(ctx context.Context, user models.User) error {
+	w.written = append(w.written, user.Username)
+	return w.repo.Replace(ctx, user)
+}
+
+func (w *writeRecorder) DisableMany(ctx context.Context, usernames []string) (int64, error) {
+	w.written = append(w.written, usernames...)
+	return w.repo.DisableMany(ctx, usernames)
+}
+
+func (w *writeRecorder) ExpirePasswords(ctx context.Context, usernames []string) (int64, error) {
+	w.written = append(w.written, usernames...)
+	return w.repo.ExpirePasswords(ctx, usernames)
+}
+
+func (w *writeRecorder) Save(ctx context.Context, user models.User) error {
+	w.written = append(w.written, user.Username)
+	return w.repo.Save(ctx, user)
+}
+
+func (w *writeRecorder) Update(ctx context.Context, username string, update models.User) error {
+	w.written = append(w.written, username)
+	return w.repo.Update(ctx, username, update)
+}
+
+func (w *writeRecorder) Delete(ctx context.Context, username string) error {
+	w.written = append(w.written, username)
+	return w.repo.Delete(ctx, username)
+}
+
+func (w *writeRecorder) ChangePwd(ctx context.Context, username string, newPwd string) error {
+	w.written = append(w.written, username)
+	return w.repo.ChangePwd(ctx, username, newPwd)
+}
+
+func (w *writeRecorder) RehashPwd(ctx context.Context, username, current, rehashed string) error {
+	w.written = append(w.written, username)
+	return w.repo.RehashPwd(ctx, username, current, rehashed)
+}
+
+func (w *writeRecorder) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	w.written = append(w.written, username)
+	return w.repo.SetDisabled(ctx, username, disabled)
+}
+
+func (w *writeRecorder) RotateDataKey(ctx context.Context) error {
+	return w.repo.RotateDataKey(ctx)
+}
+
+func (w *writeRecorder) Reencrypt(ctx context.Context, afterID string, limit int) (ReencryptBatch, error) {
+	return w.repo.Reencrypt(ctx, afterID, limit)
+}
+
+func (w *writeRecorder) Transaction(ctx context.Context, fn func(tx UserRepository) error) error {
+	return w.repo.Transaction(ctx, func(tx UserRepository) error {
+		outer := w.repo
+		w.repo = tx
+		defer func() { w.repo = outer }()
+		return fn(w)
+	})
+}
+
+// Invalidate drops username from the cache. Writes call it even when they
+// fail, the change may have been applied anyway.
+func (r *CachedRepository) Invalidate(ctx context.Context, username string) {
+	key := userKeyPrefix + username
+	r.mu.Lock()
+	r.generation.Add(1)
+	r.mu.Unlock()
+	r.group.Forget(key)
+	if err := r.cache.Delete(context.WithoutCancel(ctx), key); err != nil {
+		r.cacheFailed(ctx, metrics.CacheDelete, err)
+	}
+}
+
+func (r *CachedRepository) invalidateAll(ctx context.Context, usernames []string) {
+	for _, username := range usernames {
+		r.Invalidate(ctx, username)
+	}
+}
+
+func (r *CachedRepository) cacheFailed(ctx context.Context, operation string, err error) {
+	metrics.CacheErrors.WithLabelValues(operation).Inc()
+	slog.WarnContext(ctx, "cache error, using the database", "operation", operation, "error", err)
+}
+
+// cachedUser is the cache entry of a user. Its own json tags keep the
+// encoding apart from the api one.
+type cachedUser struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Surname            string `json:"surname"`
+	Username           string `json:"username"`
+	Phone              string `json:"phone"`
+	Email              string `json:"email"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+func newCachedUser(user models.User) cachedUser {
+	return cachedUser{
+		ID:                 user.ID,
+		Name:               user.Name,
+		Surname:            user.Surname,
+		Username:           user.Username,
+		Phone:              user.Phone,
+		Email:              user.Email,
+		Role:               user.Role,
+		Disabled:           user.Disabled,
+		MustChangePassword: user.MustChangePassword,
+	}
+}
+
+func (c cachedUser) user() models.User {
+	return models.User{
+		ID:                 c.ID,
+		Name:               c.Name,
+		Surname:            c.Surname,
+		Username:           c.Username,
+		Phone:              c.Phone,
+		Email:              c.Email,
+		Role:               c.Role,
+		Disabled:           c.Disabled,
+		MustChangePassword: c.MustChangePassword,
+	}
+}
+
+// withoutSecrets keeps only what a cache entry holds, cached or not Search
+// returns the same user.
+func withoutSecrets(user models.User) models.User {
+	user.Password = ""
+	user.EmailIndex = nil
+	user.PhoneIndex = nil
+	return user
+}
+
+// encodeUser seals a copy of user, the caller keeps the plaintext.
+func (r *CachedRepository) encodeUser(ctx context.Context, user models.User) ([]byte, error) {
+	if err := Seal(ctx, r.Cipher, &user); err != nil {
+		return nil, err
+	}
+	return json.Marshal(newCachedUser(user))
+}
+
+// decodeUser returns nil for a cached missing user.
+func (r *CachedRepository) decodeUser(ctx context.Context, data []byte) (*models.User, error) {
+	if string(data) == string(missingUser) {
+		return nil, nil
+	}
+	var entry cachedUser
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	user := entry.user()
+	if err := open(ctx, r.Cipher, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
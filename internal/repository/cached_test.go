@@ -0,0 +1,395 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/cache"
+	"go-manage-mysql/internal/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// fakeRepo keeps users in memory and counts lookups.
+type fakeRepo struct {
+	mu       sync.Mutex
+	users    map[string]models.User
+	searches atomic.Int32
+	// block, when set, holds Search until it is closed
+	block chan struct{}
+}
+
+func newFakeRepo(users ...models.User) *fakeRepo {
+	r := &fakeRepo{users: map[string]models.User{}}
+	for _, user := range users {
+		r.users[user.Username] = user
+	}
+	return r
+}
+
+func (r *fakeRepo) Search(ctx context.Context, username string) (models.User, error) {
+	r.searches.Add(1)
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[username]
+	if !ok {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (r *fakeRepo) SearchFresh(ctx context.Context, username string) (models.User, error) {
+	return r.Search(ctx, username)
+}
+
+func (r *fakeRepo) SearchByID(ctx context.Context, id string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) Save(ctx context.Context, user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.Username] = user
+	return nil
+}
+
+func (r *fakeRepo) Update(ctx context.Context, username string, update models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.users[username]
+	user.Name = update.Name
+	r.users[username] = user
+	return nil
+}
+
+func (r *fakeRepo) Delete(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, username)
+	return nil
+}
+
+func (r *fakeRepo) ChangePwd(ctx context.Context, username string, newPwd string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.users[username]
+	user.Password = newPwd
+	r.users[username] = user
+	return nil
+}
+
+func (r *fakeRepo) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.users[username]
+	user.Disabled = disabled
+	r.users[username] = user
+	return nil
+}
+
+func (r *fakeRepo) RehashPwd(ctx context.Context, username, current, rehashed string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.users[username]
+	if user.Password != current {
+		return config.ErrNoRowsAffected
+	}
+	user.Password = rehashed
+	r.users[username] = user
+	return nil
+}
+
+func (r *fakeRepo) FindTaken(ctx context.Context, usernames, emails, phones []string) ([]models.User, error) {
+	return nil, nil
+}
+
+func (r *fakeRepo) SaveBatch(ctx context.Context, users []models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range users {
+		r.users[user.Username] = user
+	}
+	return nil
+}
+
+func (r *fakeRepo) Replace(ctx context.Context, user models.User) error {
+	return r.Save(ctx, user)
+}
+
+func (r *fakeRepo) Export(ctx context.Context, filter UserFilter, batchSize int, fn func(users []models.User) error) error {
+	return nil
+}
+
+func (r *fakeRepo) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeRepo) DisableMany(ctx context.Context, usernames []string) (int64, error) {
+	for _, username := range usernames {
+		if err := r.SetDisabled(ctx, username, true); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(usernames)), nil
+}
+
+func (r *fakeRepo) ExpirePasswords(ctx context.Context, usernames []string) (int64, error) {
+	return int64(len(usernames)), nil
+}
+
+func (r *fakeRepo) Transaction(ctx context.Context, fn func(tx UserRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeRepo) RotateDataKey(ctx context.Context) error {
+	return nil
+}
+
+func (r *fakeRepo) Reencrypt(ctx context.Context, afterID string, limit int) (ReencryptBatch, error) {
+	return ReencryptBatch{}, nil
+}
+
+// failingCache fails every call.
+type failingCache struct{}
+
+func (failingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("cache down")
+}
+
+func (failingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errors.New("cache down")
+}
+
+func (failingCache) Delete(ctx context.Context, keys ...string) error {
+	return errors.New("cache down")
+}
+
+func (failingCache) Close() error { return nil }
+
+var johndoe = models.User{ID: "1", Username: "johndoe", Name: "John", Password: "hash"}
+
+// cachedJohndoe is johndoe as the cache returns him
+var cachedJohndoe = models.User{ID: "1", Username: "johndoe", Name: "John"}
+
+func TestCachedSearch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Hit", func(t *testing.T) {
+		inner := newFakeRepo(johndoe)
+		repo := NewCachedRepository(inner, cache.NewLRU(10), time.Minute, time.Minute)
+
+		for range 3 {
+			user, err := repo.Search(ctx, "johndoe")
+			assert.NoError(t, err)
+			assert.Equal(t, cachedJohndoe, user)
+		}
+		assert.Equal(t, int32(1), inner.searches.Load())
+	})
+
+	t.Run("Fresh Skips Cache", func(t *testing.T) {
+		inner := newFakeRepo(johndoe)
+		lru := cache.NewLRU(10)
+		repo := NewCachedRepository(inner, lru, time.Minute, time.Minute)
+
+		for range 3 {
+			user, err := repo.SearchFresh(ctx, "johndoe")
+			assert.NoError(t, err)
+			assert.Equal(t, johndoe, user)
+		}
+		assert.Equal(t, int32(3), inner.searches.Load())
+		assert.Equal(t, 0, lru.Len())
+	})
+
+	t.Run("Entry Without Password", func(t *testing.T) {
+		lru := cache.NewLRU(10)
+		repo := NewCachedRepository(newFakeRepo(johndoe), lru, time.Minute, time.Minute)
+
+		_, err := repo.Search(ctx, "johndoe")
+		assert.NoError(t, err)
+		data, found, err := lru.Get(ctx, userKeyPrefix+"johndoe")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.NotContains(t, string(data), "hash")
+		assert.NotContains(t, string(data), `"password"`)
+	})
+
+	t.Run("Entry Encrypted", func(t *testing.T) {
+		lru := cache.NewLRU(10)
+		inner := newFakeRepo(models.User{ID: "1", Username: "johndoe", Name: "John", Email: "johndoe@example.com"})
+		repo := NewCachedRepository(inner, lru, time.Minute, time.Minute)
+		repo.Cipher = &fakeCipher{}
+
+		for range 2 {
+			user, err := repo.Search(ctx, "johndoe")
+			assert.NoError(t, err)
+			assert.Equal(t, "johndoe@example.com", user.Email)
+		}
+		assert.Equal(t, int32(1), inner.searches.Load())
+		data, _, err := lru.Get(ctx, userKeyPrefix+"johndoe")
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "enc:email:johndoe@example.com")
+		assert.Contains(t, string(data), "enc:name:John")
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		inner := newFakeRepo()
+		repo := NewCachedRepository(inner, cache.NewLRU(10), time.Minute, time.Minute)
+
+		for range 3 {
+			_, err := repo.Search(ctx, "ghost")
+			assert.Equal(t, gorm.ErrRecordNotFound, err)
+		}
+		assert.Equal(t, int32(1), inner.searches.Load())
+	})
+
+	t.Run("Negative Disabled", func(t *testing.T) {
+		inner := newFakeRepo()
+		repo := NewCachedRepository(inner, cache.NewLRU(10), time.Minute, 0)
+
+		for range 3 {
+			_, err := repo.Search(ctx, "ghost")
+			assert.Equal(t, gorm.ErrRecordNotFound, err)
+		}
+		assert.Equal(t, int32(3), inner.searches.Load())
+	})
+
+	t.Run("Cache Down Uses Repository", func(t *testing.T) {
+		inner := newFakeRepo(johndoe)
+		repo := NewCachedRepository(inner, failingCache{}, time.Minute, time.Minute)
+
+		user, err := repo.Search(ctx, "johndoe")
+		assert.NoError(t, err)
+		assert.Equal(t, cachedJohndoe, user)
+		assert.NoError(t, repo.Delete(ctx, "johndoe"))
+	})
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	ctx := context.Background()
+	inner := newFakeRepo(johndoe)
+	repo := NewCachedRepository(inner, cache.NewLRU(10), time.Minute, time.Minute)
+
+	writes := []struct {
+		Name  string
+		Write func() error
+		Check func(t *testing.T, user models.User, err error)
+	}{
+		{
+			Name:  "Update",
+			Write: func() error { return repo.Update(ctx, "johndoe", models.User{Name: "Johnny"}) },
+			Check: func(t *testing.T, user models.User, err error) { assert.Equal(t, "Johnny", user.Name) },
+		},
+		{
+			Name:  "Change Password",
+			Write: func() error { return repo.ChangePwd(ctx, "johndoe", "new-hash") },
+			Check: func(t *testing.T, user models.User, err error) { assert.NoError(t, err) },
+		},
+		{
+			Name:  "Disable",
+			Write: func() error { return repo.SetDisabled(ctx, "johndoe", true) },
+			Check: func(t *testing.T, user models.User, err error) { assert.True(t, user.Disabled) },
+		},
+		{
+			Name:  "Delete",
+			Write: func() error { return repo.Delete(ctx, "johndoe") },
+			Check: func(t *testing.T, user models.User, err error) { assert.Equal(t, gorm.ErrRecordNotFound, err) },
+		},
+		{
+			Name:  "Replace",
+			Write: func() error { return repo.Replace(ctx, models.User{Username: "johndoe", Name: "Jon"}) },
+			Check: func(t *testing.T, user models.User, err error) { assert.Equal(t, "Jon", user.Name) },
+		},
+		{
+			Name: "Disable Many",
+			Write: func() error {
+				_, err := repo.DisableMany(ctx, []string{"johndoe"})
+				return err
+			},
+			Check: func(t *testing.T, user models.User, err error) { assert.True(t, user.Disabled) },
+		},
+		{
+			Name:  "Save Drops Negative Entry",
+			Write: func() error { return repo.Save(ctx, johndoe) },
+			Check: func(t *testing.T, user models.User, err error) { assert.Equal(t, cachedJohndoe, user) },
+		},
+	}
+
+	for _, tt := range writes {
+		t.Run(tt.Name, func(t *testing.T) {
+			// warm the cache first
+			_, _ = repo.Search(ctx, "johndoe")
+
+			assert.NoError(t, tt.Write())
+
+			searches := inner.searches.Load()
+			user, err := repo.Search(ctx, "johndoe")
+			tt.Check(t, user, err)
+			assert.Equal(t, searches+1, inner.searches.Load(), "not reloaded")
+		})
+	}
+}
+
+func TestCachedSingleFlight(t *testing.T) {
+	inner := newFakeRepo(johndoe)
+	inner.block = make(chan struct{})
+	repo := NewCachedRepository(inner, cache.NewLRU(10), time.Minute, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := repo.Search(context.Background(), "johndoe")
+			assert.NoError(t, err)
+			assert.Equal(t, cachedJohndoe, user)
+		}()
+	}
+
+	// let every goroutine join the flight before the query returns
+	assert.Eventually(t, func() bool { return inner.searches.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(inner.block)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inner.searches.Load())
+}
+
+func TestCachedLoadRacingWrite(t *testing.T) {
+	inner := newFakeRepo(johndoe)
+	inner.block = make(chan struct{})
+	lru := cache.NewLRU(10)
+	repo := NewCachedRepository(inner, lru, time.Minute, time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = repo.Search(context.Background(), "johndoe")
+	}()
+	assert.Eventually(t, func() bool { return inner.searches.Load() == 1 }, time.Second, time.Millisecond)
+
+	// the write lands while the read is in flight, its result is stale
+	assert.NoError(t, repo.SetDisabled(context.Background(), "johndoe", true))
+	close(inner.block)
+	<-done
+
+	assert.Equal(t, 0, lru.Len())
+}
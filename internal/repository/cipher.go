@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/internal/models"
+)
+
+// personal are the user fields encrypted at rest, by column.
+func personal(user *models.User) map[string]*string {
+	return map[string]*string{"name": &user.Name, "surname": &user.Surname, "phone": &user.Phone, "email": &user.Email}
+}
+
+// Seal encrypts the personal fields of user and sets its blind indexes.
+// Without a cipher user is left as it is.
+func Seal(ctx context.Context, cipher FieldCipher, user *models.User) error {
+	if cipher == nil {
+		return nil
+	}
+	emailIndex, phoneIndex := cipher.BlindIndex("email", user.Email), cipher.BlindIndex("phone", user.Phone)
+	for field, value := range personal(user) {
+		sealed, err := cipher.Encrypt(ctx, field, *value)
+		if err != nil {
+			return err
+		}
+		*value = sealed
+	}
+	user.EmailIndex, user.PhoneIndex = &emailIndex, &phoneIndex
+	return nil
+}
+
+// open decrypts the personal fields of user in place.
+func open(ctx context.Context, cipher FieldCipher, user *models.User) error {
+	if cipher == nil {
+		return nil
+	}
+	for field, value := range personal(user) {
+		opened, err := cipher.Decrypt(ctx, field, *value)
+		if err != nil {
+			return err
+		}
+		*value = opened
+	}
+	return nil
+}
+
+// stale reports whether user is due for re-encryption.
+func stale(ctx context.Context, cipher FieldCipher, user models.User) bool {
+	if user.EmailIndex == nil || user.PhoneIndex == nil {
+		return true
+	}
+	for _, value := range personal(&user) {
+		if cipher.Stale(ctx, *value) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexes returns the blind indexes of values.
+func indexes(cipher FieldCipher, field string, values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		out = append(out, cipher.BlindIndex(field, value))
+	}
+	return out
+}
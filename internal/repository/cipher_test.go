@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// fakeCipher tags values instead of encrypting them, so the statements can
+// be matched. Values tagged old use a previous key.
+type fakeCipher struct {
+	rotated bool
+}
+
+func (c *fakeCipher) Encrypt(ctx context.Context, field, value string) (string, error) {
+	return "enc:" + field + ":" + value, nil
+}
+
+func (c *fakeCipher) Decrypt(ctx context.Context, field, value string) (string, error) {
+	if rest, ok := strings.CutPrefix(value, "old:"); ok {
+		value = rest
+	}
+	return strings.TrimPrefix(value, "enc:"+field+":"), nil
+}
+
+func (c *fakeCipher) BlindIndex(field, value string) string {
+	return "idx:" + field + ":" + value
+}
+
+func (c *fakeCipher) Stale(ctx context.Context, value string) bool {
+	return !strings.HasPrefix(value, "enc:")
+}
+
+func (c *fakeCipher) Rotate(ctx context.Context) error {
+	c.rotated = true
+	return nil
+}
+
+func encryptedRepository(t *testing.T) (*Repository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	repo := NewUserRepository(gormDB)
+	repo.Cipher = &fakeCipher{}
+	return repo, mock
+}
+
+func encryptedRows(users ...models.User) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "email_index", "phone_index"})
+	for _, user := range users {
+		rows.AddRow(user.ID, user.Name, user.Surname, user.Username, user.Phone, user.Email, user.EmailIndex, user.PhoneIndex)
+	}
+	return rows
+}
+
+func sealedUser(id, username string) models.User {
+	email, phone := "idx:email:"+username+"@example.com", "idx:phone:123456"
+	return models.User{
+		ID:         id,
+		Name:       "enc:name:John",
+		Surname:    "enc:surname:Doe",
+		Username:   username,
+		Phone:      "enc:phone:123456",
+		Email:      "enc:email:" + username + "@example.com",
+		EmailIndex: &email,
+		PhoneIndex: &phone,
+	}
+}
+
+func TestEncryptedWrites(t *testing.T) {
+	repo, mock := encryptedRepository(t)
+	user := models.User{ID: "1", Name: "John", Surname: "Doe", Username: "johndoe", Phone: "123456", Email: "johndoe@example.com", Password: "hash", Role: models.RoleUser}
+
+	mock.ExpectQuery(config.PlaintextTakenTestQuery).WithArgs("johndoe@example.com", "123456").
+		WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(config.SaveTestQuery).
+		WithArgs("1", "enc:name:John", "enc:surname:Doe", "johndoe", "enc:phone:123456", "enc:email:johndoe@example.com", "hash", models.RoleUser, false, false, "idx:email:johndoe@example.com", "idx:phone:123456").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, repo.Save(context.Background(), user))
+	// the caller keeps the plaintext
+	assert.Equal(t, "John", user.Name)
+
+	mock.ExpectQuery(config.PlaintextTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	batch := []models.User{user}
+	assert.NoError(t, repo.SaveBatch(context.Background(), batch))
+	assert.Equal(t, "John", batch[0].Name)
+	assert.Nil(t, batch[0].EmailIndex)
+
+	// the user itself still in plaintext is no duplicate
+	mock.ExpectQuery(config.PlaintextTakenTestQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}).AddRow("johndoe", "johndoe@example.com", "123456"))
+	mock.ExpectBegin()
+	mock.ExpectExec(config.ReplaceTestQuery + ".*`email_index`=.*`phone_index`=").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, repo.Replace(context.Background(), user))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEncryptedWritesPlaintextTaken(t *testing.T) {
+	user := models.User{ID: "1", Name: "John", Surname: "Doe", Username: "johndoe", Phone: "123456", Email: "johndoe@example.com"}
+
+	test := []struct {
+		Name          string
+		Held          models.User
+		ExpectedField string
+	}{
+		{Name: "Email", Held: models.User{Username: "janedoe", Email: "JohnDoe@example.com", Phone: "654321"}, ExpectedField: "email"},
+		{Name: "Phone", Held: models.User{Username: "janedoe", Email: "janedoe@example.com", Phone: "123456"}, ExpectedField: "phone"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			repo, mock := encryptedRepository(t)
+			// a user the backfill has not reached yet, only its plaintext
+			// columns hold the values
+			mock.ExpectQuery(config.PlaintextTakenTestQuery).WithArgs("johndoe@example.com", "123456").
+				WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}).AddRow(tt.Held.Username, tt.Held.Email, tt.Held.Phone))
+
+			err := repo.Save(context.Background(), user)
+
+			var duplicate *DuplicateError
+			assert.ErrorAs(t, err, &duplicate)
+			assert.Equal(t, tt.ExpectedField, duplicate.Field)
+			assert.ErrorIs(t, err, config.ErrUserAlreadyExists)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestEncryptedReads(t *testing.T) {
+	repo, mock := encryptedRepository(t)
+	stored := sealedUser("1", "johndoe")
+	// written before encryption was enabled
+	legacy := models.User{ID: "2", Name: "Jane", Surname: "Doe", Username: "janedoe", Phone: "654321", Email: "janedoe@example.com"}
+
+	mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(encryptedRows(stored))
+	user, err := repo.Search(context.Background(), "johndoe")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"John", "Doe", "123456", "johndoe@example.com"}, []string{user.Name, user.Surname, user.Phone, user.Email})
+
+	mock.ExpectQuery(config.FindTakenIndexTestQuery).
+		WithArgs("johndoe@example.com", "janedoe@example.com", "idx:email:johndoe@example.com", "idx:email:janedoe@example.com").
+		WillReturnRows(encryptedRows(stored, legacy))
+	users, err := repo.FindTaken(context.Background(), nil, []string{"johndoe@example.com", "janedoe@example.com"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "johndoe@example.com", users[0].Email)
+	assert.Equal(t, "janedoe@example.com", users[1].Email)
+
+	mock.ExpectQuery(config.ExportTestQuery).WillReturnRows(encryptedRows(stored))
+	err = repo.Export(context.Background(), UserFilter{}, 10, func(users []models.User) error {
+		assert.Equal(t, "John", users[0].Name)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEncryptedUpdate(t *testing.T) {
+	test := []struct {
+		Name        string
+		Update      models.User
+		ExpectedErr error
+		MockAct     func(mock sqlmock.Sqlmock)
+	}{
+		{
+			Name:   "Success",
+			Update: models.User{Name: "Johnny", Surname: "Doe", Phone: "123456", Email: "johndoe@example.com"},
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(encryptedRows(sealedUser("1", "johndoe")))
+				mock.ExpectQuery(config.PlaintextTakenTestQuery).WithArgs("johndoe@example.com", "123456").
+					WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateTestQuery).
+					WithArgs("enc:name:Johnny", "enc:surname:Doe", "enc:phone:123456", "enc:email:johndoe@example.com", "idx:email:johndoe@example.com", "idx:phone:123456", "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Email Held In Plaintext",
+			Update:      models.User{Name: "John", Surname: "Doe", Phone: "123456", Email: "janedoe@example.com"},
+			ExpectedErr: config.ErrUserAlreadyExists,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(encryptedRows(sealedUser("1", "johndoe")))
+				mock.ExpectQuery(config.PlaintextTakenTestQuery).WithArgs("janedoe@example.com", "123456").
+					WillReturnRows(sqlmock.NewRows([]string{"username", "email", "phone"}).AddRow("janedoe", "janedoe@example.com", "654321"))
+			},
+		},
+		{
+			// a new ciphertext would always count as a change
+			Name:        "Unchanged",
+			Update:      models.User{Name: "John", Surname: "Doe", Phone: "123456", Email: "johndoe@example.com"},
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(encryptedRows(sealedUser("1", "johndoe")))
+			},
+		},
+		{
+			Name:        "Not Found",
+			Update:      models.User{Name: "John"},
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(encryptedRows())
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			repo, mock := encryptedRepository(t)
+			tt.MockAct(mock)
+
+			err := repo.Update(context.Background(), "johndoe", tt.Update)
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	repo, mock := encryptedRepository(t)
+	legacy := models.User{ID: "2", Name: "Jane", Surname: "Doe", Username: "janedoe", Phone: "654321", Email: "janedoe@example.com"}
+	old := sealedUser("3", "jimdoe")
+	old.Name = "old:" + old.Name
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(config.ReencryptTestQuery).WithArgs("1", 3).
+		WillReturnRows(encryptedRows(sealedUser("2a", "johndoe"), legacy, old))
+	mock.ExpectExec(config.ReencryptUserTestQuery).
+		WithArgs("enc:name:Jane", "enc:surname:Doe", "enc:phone:654321", "enc:email:janedoe@example.com", "idx:email:janedoe@example.com", "idx:phone:654321", "2", "2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(config.ReencryptUserTestQuery).
+		WithArgs("enc:name:John", "enc:surname:Doe", "enc:phone:123456", "enc:email:jimdoe@example.com", "idx:email:jimdoe@example.com", "idx:phone:123456", "3", "3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	batch, err := repo.Reencrypt(context.Background(), "1", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, ReencryptBatch{Read: 3, Changed: 2, LastID: "3"}, batch)
+
+	assert.NoError(t, repo.RotateDataKey(context.Background()))
+	assert.True(t, repo.Cipher.(*fakeCipher).rotated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	plain := NewUserRepository(repo.DB)
+	_, err = plain.Reencrypt(context.Background(), "", 3)
+	assert.ErrorIs(t, err, config.ErrEncryptionOff)
+	assert.ErrorIs(t, plain.RotateDataKey(context.Background()), config.ErrEncryptionOff)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type DataKeyStore struct {
+	DB *gorm.DB
+}
+
+var _ DataKeyRepository = (*DataKeyStore)(nil)
+
+func NewDataKeyRepository(db *gorm.DB) *DataKeyStore {
+	return &DataKeyStore{DB: db}
+}
+
+func (s *DataKeyStore) CreateDataKey(ctx context.Context, key models.DataKey) error {
+	return s.DB.WithContext(ctx).Create(&key).Error
+}
+
+func (s *DataKeyStore) ListDataKeys(ctx context.Context) ([]models.DataKey, error) {
+	var keys []models.DataKey
+	if err := s.DB.WithContext(ctx).Order("created_at, id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *DataKeyStore) RewrapDataKey(ctx context.Context, key models.DataKey) error {
+	result := s.DB.WithContext(ctx).Model(&models.DataKey{}).Where("id = ?", key.ID).
+		Updates(map[string]interface{}{"master_key_id": key.MasterKeyID, "wrapped": key.Wrapped})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (s *DataKeyStore) RecordIndexCheck(ctx context.Context, check string) error {
+	return s.DB.WithContext(ctx).Model(&models.DataKey{}).Where("index_check = ?", "").
+		Update("index_check", check).Error
+}
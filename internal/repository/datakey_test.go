@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func dataKeyRepo(t *testing.T) (*DataKeyStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewDataKeyRepository(gormDB), mock
+}
+
+func TestListDataKeys(t *testing.T) {
+	repo, mock := dataKeyRepo(t)
+
+	mock.ExpectQuery(config.ListDataKeysTestQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "master_key_id", "wrapped"}).AddRow("key-1", "master", []byte("wrapped")))
+
+	keys, err := repo.ListDataKeys(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DataKey{{ID: "key-1", MasterKeyID: "master", Wrapped: []byte("wrapped")}}, keys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRewrapDataKey(t *testing.T) {
+	repo, mock := dataKeyRepo(t)
+
+	test := []struct {
+		Name        string
+		Affected    int64
+		ExpectedErr error
+	}{
+		{Name: "Success", Affected: 1},
+		{Name: "Not Found", ExpectedErr: config.ErrNoRowsAffected},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(config.RewrapDataKeyTestQuery).WithArgs("new", []byte("rewrapped"), "key-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.Affected))
+			mock.ExpectCommit()
+
+			err := repo.RewrapDataKey(context.Background(), models.DataKey{ID: "key-1", MasterKeyID: "new", Wrapped: []byte("rewrapped")})
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRecordIndexCheck(t *testing.T) {
+	repo, mock := dataKeyRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(config.RecordIndexCheckTestQuery).WithArgs("check", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.RecordIndexCheck(context.Background(), "check")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
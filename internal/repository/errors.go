@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const duplicateEntry = 1062
+
+// DuplicateError reports the unique field a write collided on. It matches
+// config.ErrUserAlreadyExists with errors.Is.
+type DuplicateError struct {
+	Field string
+	Err   error
+}
+
+func (e *DuplicateError) Error() string {
+	return e.Field + " already exists"
+}
+
+func (e *DuplicateError) Unwrap() []error {
+	return []error{config.ErrUserAlreadyExists, e.Err}
+}
+
+// translate turns driver errors the services act on into repository errors.
+func translate(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != duplicateEntry {
+		return err
+	}
+	return &DuplicateError{Field: duplicateField(mysqlErr.Message), Err: err}
+}
+
+// duplicateField reads the index from "Duplicate entry 'x' for key 'users.email'".
+// Older servers omit the table, and gorm may name unique indexes uni_users_email.
+// A blind index stands for the encrypted field it indexes.
+func duplicateField(message string) string {
+	i := strings.LastIndex(message, "for key '")
+	if i < 0 {
+		return "user"
+	}
+	key := strings.TrimSuffix(message[i+len("for key '"):], "'")
+	key = key[strings.LastIndex(key, ".")+1:]
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "uni_users_"), "idx_users_")
+	key = strings.TrimSuffix(key, "_index")
+	if key == "PRIMARY" {
+		return "id"
+	}
+	return key
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslate(t *testing.T) {
+	test := []struct {
+		Name          string
+		Err           error
+		ExpectedField string
+	}{
+		{
+			Name:          "Username",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe' for key 'users.username'"},
+			ExpectedField: "username",
+		},
+		{
+			Name:          "Email Without Table",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'email'"},
+			ExpectedField: "email",
+		},
+		{
+			Name:          "Gorm Index",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '123' for key 'users.uni_users_phone'"},
+			ExpectedField: "phone",
+		},
+		{
+			Name:          "Blind Index",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '3f2a' for key 'users.uni_users_email_index'"},
+			ExpectedField: "email",
+		},
+		{
+			Name:          "Primary Key",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'users.PRIMARY'"},
+			ExpectedField: "id",
+		},
+		{
+			Name:          "Unknown Key",
+			Err:           &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"},
+			ExpectedField: "user",
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := translate(tt.Err)
+
+			var duplicate *DuplicateError
+			assert.True(t, errors.As(err, &duplicate))
+			assert.Equal(t, tt.ExpectedField, duplicate.Field)
+			assert.ErrorIs(t, err, config.ErrUserAlreadyExists)
+			assert.ErrorIs(t, err, tt.Err)
+		})
+	}
+
+	t.Run("Other Errors Untouched", func(t *testing.T) {
+		err := &mysql.MySQLError{Number: 1045, Message: "Access denied"}
+		assert.Equal(t, error(err), translate(err))
+		assert.NoError(t, translate(nil))
+	})
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IdentityStore struct {
+	DB *gorm.DB
+}
+
+var _ IdentityRepository = (*IdentityStore)(nil)
+
+func NewIdentityRepository(db *gorm.DB) *IdentityStore {
+	return &IdentityStore{DB: db}
+}
+
+func (s *IdentityStore) FindIdentity(ctx context.Context, issuer, subject string) (models.FederatedIdentity, error) {
+	var identity models.FederatedIdentity
+	if err := s.DB.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).Take(&identity).Error; err != nil {
+		return models.FederatedIdentity{}, err
+	}
+	return identity, nil
+}
+
+func (s *IdentityStore) CreateIdentity(ctx context.Context, identity models.FederatedIdentity) error {
+	return s.DB.WithContext(ctx).Create(&identity).Error
+}
+
+func (s *IdentityStore) TouchIdentity(ctx context.Context, id string, at time.Time) error {
+	return s.DB.WithContext(ctx).Model(&models.FederatedIdentity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
+
+func (s *IdentityStore) DeleteIdentity(ctx context.Context, id string) error {
+	result := s.DB.WithContext(ctx).Where("id = ?", id).Delete(&models.FederatedIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
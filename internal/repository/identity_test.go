@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func identityRepo(t *testing.T) (*IdentityStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewIdentityRepository(gormDB), mock
+}
+
+func TestFindIdentity(t *testing.T) {
+	repo, mock := identityRepo(t)
+
+	test := []struct {
+		Name           string
+		ExpectedUserID string
+		ExpectedErr    error
+		MockAct        func()
+	}{
+		{
+			Name:           "Found",
+			ExpectedUserID: "1",
+			MockAct: func() {
+				mock.ExpectQuery(config.FindIdentityTestQuery).WithArgs("https://id.example.com", "external-1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "issuer", "subject", "user_id"}).AddRow("link-1", "https://id.example.com", "external-1", "1"))
+			},
+		},
+		{
+			Name:        "Not Found",
+			ExpectedErr: gorm.ErrRecordNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.FindIdentityTestQuery).WithArgs("https://id.example.com", "external-1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			identity, err := repo.FindIdentity(context.Background(), "https://id.example.com", "external-1")
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			assert.Equal(t, tt.ExpectedUserID, identity.UserID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteIdentity(t *testing.T) {
+	repo, mock := identityRepo(t)
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Deleted",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteIdentityTestQuery).WithArgs("link-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Not Found",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteIdentityTestQuery).WithArgs("link-1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			assert.ErrorIs(t, repo.DeleteIdentity(context.Background(), "link-1"), tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
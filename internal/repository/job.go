@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JobStore struct {
+	DB *gorm.DB
+}
+
+var _ JobRepository = (*JobStore)(nil)
+
+// clearedParams replace the params of a job once it is over, an import
+// carries the whole file, passwords included.
+var clearedParams = json.RawMessage(`{}`)
+
+func NewJobRepository(db *gorm.DB) *JobStore {
+	return &JobStore{DB: db}
+}
+
+func (s *JobStore) Create(ctx context.Context, job models.Job) error {
+	return s.DB.WithContext(ctx).Create(&job).Error
+}
+
+func (s *JobStore) Get(ctx context.Context, id string) (models.Job, error) {
+	var job models.Job
+	result := s.DB.WithContext(ctx).Where("id = ?", id).Take(&job)
+	if result.Error != nil {
+		return models.Job{}, result.Error
+	}
+	return job, nil
+}
+
+func (s *JobStore) Claim(ctx context.Context, owner string, stale time.Time) (models.Job, error) {
+	var job models.Job
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// other workers skip the row instead of waiting for this claim
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("state = ? OR (state = ? AND heartbeat_at < ?)", models.JobQueued, models.JobRunning, stale).
+			Order("created_at").Take(&job)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		now := time.Now().UTC()
+		job.State, job.Owner, job.HeartbeatAt = models.JobRunning, owner, &now
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		return tx.Model(&job).Select("state", "owner", "heartbeat_at", "started_at").Updates(&job).Error
+	})
+	if err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
+
+func (s *JobStore) Heartbeat(ctx context.Context, job models.Job) (bool, error) {
+	if err := s.owned(ctx, job, map[string]interface{}{"heartbeat_at": time.Now().UTC()}); err != nil {
+		return false, err
+	}
+	var current models.Job
+	result := s.DB.WithContext(ctx).Select("cancel_requested").Where("id = ?", job.ID).Take(&current)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return current.CancelRequested, nil
+}
+
+func (s *JobStore) SaveProgress(ctx context.Context, job models.Job) error {
+	return s.owned(ctx, job, map[string]interface{}{
+		"total":        job.Total,
+		"processed":    job.Processed,
+		"progress":     job.Progress,
+		"cursor":       job.Cursor,
+		"result":       job.Result,
+		"heartbeat_at": time.Now().UTC(),
+	})
+}
+
+func (s *JobStore) Finish(ctx context.Context, job models.Job) error {
+	return s.owned(ctx, job, map[string]interface{}{
+		"state":       job.State,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"progress":    job.Progress,
+		"cursor":      job.Cursor,
+		"result":      job.Result,
+		"error":       job.Error,
+		"owner":       "",
+		"params":      clearedParams,
+		"finished_at": time.Now().UTC(),
+	})
+}
+
+func (s *JobStore) Release(ctx context.Context, job models.Job) error {
+	return s.owned(ctx, job, map[string]interface{}{"state": models.JobQueued, "owner": ""})
+}
+
+// owned applies updates while job is still running for its owner.
+func (s *JobStore) owned(ctx context.Context, job models.Job, updates map[string]interface{}) error {
+	result := s.DB.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND owner = ? AND state = ?", job.ID, job.Owner, models.JobRunning).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrJobLost
+	}
+	return nil
+}
+
+func (s *JobStore) Cancel(ctx context.Context, id string) (models.Job, error) {
+	var job models.Job
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&job).Error; err != nil {
+			return err
+		}
+
+		columns := []string{"state", "cancel_requested", "finished_at"}
+		switch job.State {
+		case models.JobQueued:
+			now := time.Now().UTC()
+			job.State, job.FinishedAt, job.Params = models.JobCancelled, &now, clearedParams
+			columns = append(columns, "params")
+		case models.JobRunning:
+			// the owner stops at its next heartbeat and records the state
+			job.CancelRequested = true
+		default:
+			return config.ErrJobFinished
+		}
+		return tx.Model(&job).Select(columns).Updates(&job).Error
+	})
+	if err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
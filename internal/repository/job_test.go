@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func jobRows(state string, cancelRequested bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "type", "state", "params", "owner", "cancel_requested"}).
+		AddRow("job-1", models.JobDisable, state, []byte(`{"role":"user"}`), "", cancelRequested)
+}
+
+func TestJobClaim(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewJobRepository(gormDB)
+	stale := time.Now().Add(-time.Minute)
+
+	test := []struct {
+		Name          string
+		ExpectedErr   error
+		ExpectedState string
+		MockAct       func()
+	}{
+		{
+			Name:          "Claims Oldest",
+			ExpectedState: models.JobRunning,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.ClaimJobTestQuery).
+					WithArgs(models.JobQueued, models.JobRunning, stale, 1).
+					WillReturnRows(jobRows(models.JobQueued, false))
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs(models.JobRunning, "worker-1", sqlmock.AnyArg(), sqlmock.AnyArg(), "job-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Nothing Queued",
+			ExpectedErr: gorm.ErrRecordNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.ClaimJobTestQuery).
+					WithArgs(models.JobQueued, models.JobRunning, stale, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			job, claimErr := repo.Claim(context.Background(), "worker-1", stale)
+
+			assert.ErrorIs(t, claimErr, tt.ExpectedErr)
+			assert.Equal(t, tt.ExpectedState, job.State)
+			if tt.ExpectedErr == nil {
+				assert.Equal(t, "worker-1", job.Owner)
+				assert.NotNil(t, job.StartedAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestJobOwnedWrites(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewJobRepository(gormDB)
+	job := models.Job{ID: "job-1", Owner: "worker-1", State: models.JobRunning}
+
+	test := []struct {
+		Name                    string
+		Write                   func() (bool, error)
+		ExpectedCancelRequested bool
+		ExpectedErr             error
+		MockAct                 func()
+	}{
+		{
+			Name:  "Heartbeat",
+			Write: func() (bool, error) { return repo.Heartbeat(context.Background(), job) },
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs(sqlmock.AnyArg(), "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(config.CancelRequestedTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"cancel_requested"}).AddRow(false))
+			},
+		},
+		{
+			Name:                    "Heartbeat Cancel Requested",
+			Write:                   func() (bool, error) { return repo.Heartbeat(context.Background(), job) },
+			ExpectedCancelRequested: true,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs(sqlmock.AnyArg(), "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(config.CancelRequestedTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"cancel_requested"}).AddRow(true))
+			},
+		},
+		{
+			Name:        "Save Progress Lost",
+			Write:       func() (bool, error) { return false, repo.SaveProgress(context.Background(), job) },
+			ExpectedErr: config.ErrJobLost,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:  "Release",
+			Write: func() (bool, error) { return false, repo.Release(context.Background(), job) },
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs("", models.JobQueued, "job-1", "worker-1", models.JobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Finish Error",
+			Write:       func() (bool, error) { return false, repo.Finish(context.Background(), job) },
+			ExpectedErr: config.ErrDbError,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			cancelRequested, writeErr := tt.Write()
+
+			assert.ErrorIs(t, writeErr, tt.ExpectedErr)
+			assert.Equal(t, tt.ExpectedCancelRequested, cancelRequested)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewJobRepository(gormDB)
+
+	test := []struct {
+		Name                    string
+		ExpectedState           string
+		ExpectedCancelRequested bool
+		ExpectedErr             error
+		MockAct                 func()
+	}{
+		{
+			Name:          "Queued",
+			ExpectedState: models.JobCancelled,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(jobRows(models.JobQueued, false))
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs(models.JobCancelled, []byte(`{}`), false, sqlmock.AnyArg(), "job-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:                    "Running",
+			ExpectedState:           models.JobRunning,
+			ExpectedCancelRequested: true,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(jobRows(models.JobRunning, false))
+				mock.ExpectExec(config.UpdateJobTestQuery).
+					WithArgs(models.JobRunning, true, nil, "job-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Finished",
+			ExpectedErr: config.ErrJobFinished,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(jobRows(models.JobSucceeded, false))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:        "Not Found",
+			ExpectedErr: gorm.ErrRecordNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockJobTestQuery).
+					WithArgs("job-1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			job, cancelErr := repo.Cancel(context.Background(), "job-1")
+
+			assert.True(t, errors.Is(cancelErr, tt.ExpectedErr), "got %v", cancelErr)
+			assert.Equal(t, tt.ExpectedState, job.State)
+			assert.Equal(t, tt.ExpectedCancelRequested, job.CancelRequested)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthStore struct {
+	DB *gorm.DB
+}
+
+var _ OAuthRepository = (*OAuthStore)(nil)
+
+func NewOAuthRepository(db *gorm.DB) *OAuthStore {
+	return &OAuthStore{DB: db}
+}
+
+func (s *OAuthStore) CreateClient(ctx context.Context, client models.OAuthClient) error {
+	return s.DB.WithContext(ctx).Create(&client).Error
+}
+
+func (s *OAuthStore) GetClient(ctx context.Context, id string) (models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&client).Error; err != nil {
+		return models.OAuthClient{}, err
+	}
+	return client, nil
+}
+
+func (s *OAuthStore) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	if err := s.DB.WithContext(ctx).Order("created_at").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (s *OAuthStore) DeleteClient(ctx context.Context, id string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&models.OAuthClient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return config.ErrNoRowsAffected
+		}
+		return tx.Model(&models.OAuthToken{}).Where("client_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now().UTC()).Error
+	})
+}
+
+func (s *OAuthStore) SaveCode(ctx context.Context, code models.OAuthCode) error {
+	return s.DB.WithContext(ctx).Create(&code).Error
+}
+
+func (s *OAuthStore) RedeemCode(ctx context.Context, hash string) (models.OAuthCode, error) {
+	var code models.OAuthCode
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// two exchanges of the same code must not both succeed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", hash).Take(&code).Error; err != nil {
+			return err
+		}
+		if code.UsedAt != nil {
+			return config.ErrCodeUsed
+		}
+		now := time.Now().UTC()
+		code.UsedAt = &now
+		return tx.Model(&code).Update("used_at", now).Error
+	})
+	if err != nil && !errors.Is(err, config.ErrCodeUsed) {
+		return models.OAuthCode{}, err
+	}
+	return code, err
+}
+
+func (s *OAuthStore) SaveTokens(ctx context.Context, tokens ...models.OAuthToken) error {
+	return s.DB.WithContext(ctx).Create(&tokens).Error
+}
+
+func (s *OAuthStore) GetToken(ctx context.Context, hash string) (models.OAuthToken, error) {
+	var token models.OAuthToken
+	if err := s.DB.WithContext(ctx).Where("hash = ?", hash).Take(&token).Error; err != nil {
+		return models.OAuthToken{}, err
+	}
+	return token, nil
+}
+
+func (s *OAuthStore) UseRefreshToken(ctx context.Context, hash string) (models.OAuthToken, error) {
+	var token models.OAuthToken
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("hash = ? AND kind = ?", hash, models.TokenRefresh).Take(&token).Error; err != nil {
+			return err
+		}
+		if token.RevokedAt != nil {
+			return config.ErrTokenRevoked
+		}
+		now := time.Now().UTC()
+		token.RevokedAt = &now
+		return tx.Model(&token).Update("revoked_at", now).Error
+	})
+	if err != nil && !errors.Is(err, config.ErrTokenRevoked) {
+		return models.OAuthToken{}, err
+	}
+	return token, err
+}
+
+func (s *OAuthStore) RevokeGrant(ctx context.Context, grantID string) error {
+	return s.DB.WithContext(ctx).Model(&models.OAuthToken{}).Where("grant_id = ? AND revoked_at IS NULL", grantID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
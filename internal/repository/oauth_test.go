@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func oauthRepo(t *testing.T) (*OAuthStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewOAuthRepository(gormDB), mock
+}
+
+func TestOAuthDeleteClient(t *testing.T) {
+	repo, mock := oauthRepo(t)
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Revokes Tokens",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteClientTestQuery).WithArgs("client-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(config.RevokeClientTestQuery).WithArgs(sqlmock.AnyArg(), "client-1").WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Not Found",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteClientTestQuery).WithArgs("client-1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			assert.ErrorIs(t, repo.DeleteClient(context.Background(), "client-1"), tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOAuthRedeemCode(t *testing.T) {
+	repo, mock := oauthRepo(t)
+	columns := []string{"hash", "grant_id", "client_id", "used_at"}
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Marks Used",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockCodeTestQuery).WithArgs("code-hash", 1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("code-hash", "grant-1", "client-1", nil))
+				mock.ExpectExec(config.UseCodeTestQuery).WithArgs(sqlmock.AnyArg(), "code-hash").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Replayed",
+			ExpectedErr: config.ErrCodeUsed,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockCodeTestQuery).WithArgs("code-hash", 1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("code-hash", "grant-1", "client-1", time.Now()))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:        "Unknown",
+			ExpectedErr: gorm.ErrRecordNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockCodeTestQuery).WithArgs("code-hash", 1).WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			code, redeemErr := repo.RedeemCode(context.Background(), "code-hash")
+
+			assert.ErrorIs(t, redeemErr, tt.ExpectedErr)
+			if tt.ExpectedErr != gorm.ErrRecordNotFound {
+				// the grant is still needed to revoke it on replay
+				assert.Equal(t, "grant-1", code.GrantID)
+				assert.NotNil(t, code.UsedAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOAuthUseRefreshToken(t *testing.T) {
+	repo, mock := oauthRepo(t)
+	columns := []string{"hash", "kind", "grant_id", "revoked_at"}
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Rotates",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockRefreshTokenTestQuery).WithArgs("token-hash", models.TokenRefresh, 1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("token-hash", models.TokenRefresh, "grant-1", nil))
+				mock.ExpectExec(config.RevokeTokenTestQuery).WithArgs(sqlmock.AnyArg(), "token-hash").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Replayed",
+			ExpectedErr: config.ErrTokenRevoked,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockRefreshTokenTestQuery).WithArgs("token-hash", models.TokenRefresh, 1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("token-hash", models.TokenRefresh, "grant-1", time.Now()))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			token, useErr := repo.UseRefreshToken(context.Background(), "token-hash")
+
+			assert.ErrorIs(t, useErr, tt.ExpectedErr)
+			assert.Equal(t, "grant-1", token.GrantID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOAuthRevokeGrant(t *testing.T) {
+	repo, mock := oauthRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(config.RevokeTokenTestQuery).WithArgs(sqlmock.AnyArg(), "grant-1").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.RevokeGrant(context.Background(), "grant-1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
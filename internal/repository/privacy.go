@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// column is a column of a table naming a user.
+type column struct {
+	table, name string
+}
+
+// erased are the rows of a user deleted by an erasure, found by its id.
+var erased = []column{
+	{"sessions", "user_id"},
+	{"api_keys", "user_id"},
+	{"federated_identities", "user_id"},
+	{"oauth_codes", "user_id"},
+	{"oauth_tokens", "user_id"},
+	{"users", "id"},
+}
+
+// redactions are the audit columns naming a user by its username. The rows
+// record what happened and are kept, the name is replaced by the erasure
+// request.
+var redactions = []column{
+	{"jobs", "created_by"},
+	{"oauth_clients", "created_by"},
+	{"api_keys", "created_by"},
+	{"erasure_requests", "requested_by"},
+}
+
+// finishedJobs are the states of jobs that no longer read their params.
+var finishedJobs = []string{models.JobSucceeded, models.JobFailed, models.JobCancelled}
+
+type PrivacyStore struct {
+	DB *gorm.DB
+}
+
+var _ PrivacyRepository = (*PrivacyStore)(nil)
+
+func NewPrivacyRepository(db *gorm.DB) *PrivacyStore {
+	return &PrivacyStore{DB: db}
+}
+
+func (s *PrivacyStore) SubjectData(ctx context.Context, userID, username string) (SubjectData, error) {
+	db := s.DB.WithContext(ctx)
+	var data SubjectData
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&data.Sessions).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&data.APIKeys).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&data.Identities).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&data.Tokens).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if len(data.Tokens) > 0 {
+		ids := make([]string, 0, len(data.Tokens))
+		for _, token := range data.Tokens {
+			ids = append(ids, token.ClientID)
+		}
+		if err := db.Where("id IN ?", ids).Find(&data.Clients).Error; err != nil {
+			return SubjectData{}, err
+		}
+	}
+	if err := db.Where("created_by = ?", username).Order("created_at").Find(&data.CreatedJobs).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if err := db.Where("created_by = ?", username).Order("created_at").Find(&data.CreatedClients).Error; err != nil {
+		return SubjectData{}, err
+	}
+	if err := db.Where("created_by = ?", username).Order("created_at").Find(&data.CreatedKeys).Error; err != nil {
+		return SubjectData{}, err
+	}
+	return data, nil
+}
+
+func (s *PrivacyStore) CreateErasure(ctx context.Context, request models.ErasureRequest) error {
+	return s.DB.WithContext(ctx).Create(&request).Error
+}
+
+func (s *PrivacyStore) GetErasure(ctx context.Context, id string) (models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	if err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&request).Error; err != nil {
+		return models.ErasureRequest{}, err
+	}
+	return request, nil
+}
+
+func (s *PrivacyStore) PendingErasure(ctx context.Context, userID string) (models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	err := s.DB.WithContext(ctx).Where("user_id = ? AND state = ?", userID, models.ErasurePending).Take(&request).Error
+	if err != nil {
+		return models.ErasureRequest{}, err
+	}
+	return request, nil
+}
+
+func (s *PrivacyStore) ListErasures(ctx context.Context, state string) ([]models.ErasureRequest, error) {
+	query := s.DB.WithContext(ctx).Order("requested_at DESC")
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	var requests []models.ErasureRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (s *PrivacyStore) CancelErasure(ctx context.Context, id string, at time.Time) error {
+	result := s.DB.WithContext(ctx).Model(&models.ErasureRequest{}).
+		Where("id = ? AND state = ?", id, models.ErasurePending).
+		Updates(map[string]interface{}{"state": models.ErasureCancelled, "cancelled_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (s *PrivacyStore) DueErasures(ctx context.Context, now time.Time, limit int) ([]models.ErasureRequest, error) {
+	var requests []models.ErasureRequest
+	err := s.DB.WithContext(ctx).Where("state = ? AND scheduled_at <= ?", models.ErasurePending, now).
+		Order("scheduled_at").Limit(limit).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// Erase locks the request first, so instances sweeping at the same time
+// erase a user once.
+func (s *PrivacyStore) Erase(ctx context.Context, request models.ErasureRequest, receipt models.ErasureReceipt) (models.ErasureReceipt, error) {
+	receipt.Deleted = map[string]int64{}
+	receipt.Redacted = map[string]int64{}
+	receipt.Scrubbed = map[string]int64{}
+	redacted := "erased:" + request.ID
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked models.ErasureRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND state = ?", request.ID, models.ErasurePending).Take(&locked).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return config.ErrNoRowsAffected
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, c := range erased {
+			result := tx.Exec("DELETE FROM ? WHERE ? = ?", clause.Table{Name: c.table}, clause.Column{Name: c.name}, locked.UserID)
+			if result.Error != nil {
+				return result.Error
+			}
+			receipt.Deleted[c.table] += result.RowsAffected
+		}
+		params, results, err := scrubJobs(tx, locked.Username)
+		if err != nil {
+			return err
+		}
+		receipt.Scrubbed["jobs.params"], receipt.Scrubbed["jobs.result"] = params, results
+		for _, c := range redactions {
+			name := clause.Column{Name: c.name}
+			result := tx.Exec("UPDATE ? SET ? = ? WHERE ? = ?", clause.Table{Name: c.table}, name, redacted, name, locked.Username)
+			if result.Error != nil {
+				return result.Error
+			}
+			receipt.Redacted[c.table] += result.RowsAffected
+		}
+
+		if locked.RequestedBy == locked.Username {
+			locked.RequestedBy = redacted
+		}
+		locked.Username = redacted
+		locked.State = models.ErasureCompleted
+		locked.CompletedAt = &receipt.CompletedAt
+		locked.Receipt = &receipt
+		return tx.Model(&locked).Select("username", "requested_by", "state", "completed_at", "receipt").Updates(&locked).Error
+	})
+	if err != nil {
+		return models.ErasureReceipt{}, err
+	}
+	return receipt, nil
+}
+
+// scrubJobs empties the params and result of the finished jobs naming
+// username, in a selection, the rows of an import report or a field of an
+// inline import file. Jobs still queued or running keep their input.
+func scrubJobs(tx *gorm.DB, username string) (params, results int64, err error) {
+	// a coarse match, the documents are then checked value by value
+	pattern := "%" + likePrefix(username)
+	var jobs []models.Job
+	err = tx.Model(&models.Job{}).Select("id", "params", "result").Where("state IN ?", finishedJobs).
+		Where("JSON_SEARCH(params, 'one', ?) IS NOT NULL OR JSON_SEARCH(result, 'one', ?) IS NOT NULL", pattern, pattern).
+		Find(&jobs).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var withParams, withResult []string
+	for _, job := range jobs {
+		if names(job.Params, username) {
+			withParams = append(withParams, job.ID)
+		}
+		if names(job.Result, username) {
+			withResult = append(withResult, job.ID)
+		}
+	}
+	if len(withParams) > 0 {
+		if err := tx.Model(&models.Job{}).Where("id IN ?", withParams).Update("params", clearedParams).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(withResult) > 0 {
+		if err := tx.Model(&models.Job{}).Where("id IN ?", withResult).Update("result", nil).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+	return int64(len(withParams)), int64(len(withResult)), nil
+}
+
+// names reports whether a value of document is username, or a whole field of
+// one of its lines when the value is an inline csv or ndjson file.
+func names(document json.RawMessage, username string) bool {
+	var value interface{}
+	if len(document) == 0 || json.Unmarshal(document, &value) != nil {
+		return false
+	}
+	return mentions(value, username)
+}
+
+func mentions(value interface{}, username string) bool {
+	switch value := value.(type) {
+	case string:
+		if value == username {
+			return true
+		}
+		if !strings.Contains(value, "\n") {
+			return false
+		}
+		for _, line := range strings.Split(value, "\n") {
+			var record interface{}
+			if json.Unmarshal([]byte(line), &record) == nil {
+				if _, isString := record.(string); !isString && mentions(record, username) {
+					return true
+				}
+				continue
+			}
+			fields, err := csv.NewReader(strings.NewReader(line)).Read()
+			if err == nil && slices.Contains(fields, username) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if mentions(item, username) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			if mentions(item, username) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func privacyRepo(t *testing.T) (*PrivacyStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewPrivacyRepository(gormDB), mock
+}
+
+func TestSubjectData(t *testing.T) {
+	repo, mock := privacyRepo(t)
+
+	mock.ExpectQuery("SELECT \\* FROM `sessions` WHERE user_id = \\?").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow("session-1", "1"))
+	mock.ExpectQuery("SELECT \\* FROM `api_keys` WHERE user_id = \\?").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `federated_identities` WHERE user_id = \\?").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `oauth_tokens` WHERE user_id = \\?").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "grant_id", "client_id"}).AddRow("h1", "grant-1", "client-1").AddRow("h2", "grant-1", "client-1"))
+	mock.ExpectQuery("SELECT \\* FROM `oauth_clients` WHERE id IN \\(\\?,\\?\\)").WithArgs("client-1", "client-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("client-1", "Portal"))
+	mock.ExpectQuery("SELECT \\* FROM `jobs` WHERE created_by = \\?").WithArgs("johndoe").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `oauth_clients` WHERE created_by = \\?").WithArgs("johndoe").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM `api_keys` WHERE created_by = \\?").WithArgs("johndoe").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	data, err := repo.SubjectData(context.Background(), "1", "johndoe")
+
+	assert.NoError(t, err)
+	assert.Len(t, data.Sessions, 1)
+	assert.Len(t, data.Tokens, 2)
+	assert.Len(t, data.Clients, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelErasure(t *testing.T) {
+	repo, mock := privacyRepo(t)
+
+	test := []struct {
+		Name        string
+		Affected    int64
+		ExpectedErr error
+	}{
+		{Name: "Pending", Affected: 1},
+		{Name: "Not Pending", ExpectedErr: config.ErrNoRowsAffected},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(config.CancelErasureTestQuery).WithArgs(sqlmock.AnyArg(), models.ErasureCancelled, "erasure-1", models.ErasurePending).
+				WillReturnResult(sqlmock.NewResult(0, tt.Affected))
+			mock.ExpectCommit()
+
+			assert.ErrorIs(t, repo.CancelErasure(context.Background(), "erasure-1", time.Now()), tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	repo, mock := privacyRepo(t)
+	request := models.ErasureRequest{ID: "erasure-1", UserID: "1", Username: "johndoe", RequestedBy: "johndoe", State: models.ErasurePending}
+	lockedRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "username", "requested_by", "state"}).
+			AddRow(request.ID, request.UserID, request.Username, request.RequestedBy, request.State)
+	}
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Success",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockErasureTestQuery).WithArgs("erasure-1", models.ErasurePending, 1).WillReturnRows(lockedRows())
+				for _, c := range erased {
+					mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `" + c.table + "` WHERE `" + c.name + "` = ?")).WithArgs("1").
+						WillReturnResult(sqlmock.NewResult(0, 2))
+				}
+				// johndoes only contains the name, it is not scrubbed
+				mock.ExpectQuery(config.ScrubJobsTestQuery).
+					WithArgs(models.JobSucceeded, models.JobFailed, models.JobCancelled, "%johndoe%", "%johndoe%").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "params", "result"}).
+						AddRow("job-1", []byte(`{"usernames":["johndoe","jane"]}`), []byte(`{"changed":2,"skipped":0}`)).
+						AddRow("job-2", []byte(`{"format":"csv","data":"username,name\njohndoe,John\n"}`), nil).
+						AddRow("job-3", []byte(`{}`), []byte(`{"rows":[{"row":1,"username":"johndoe","result":"created"}]}`)).
+						AddRow("job-4", []byte(`{"usernames":["johndoes"]}`), []byte(`{"rows":[{"row":1,"username":"johndoes"}]}`)))
+				mock.ExpectExec(config.ScrubJobParamsTestQuery).WithArgs([]byte(`{}`), "job-1", "job-2").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(config.ScrubJobResultTestQuery).WithArgs(nil, "job-3").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				for _, c := range redactions {
+					mock.ExpectExec(regexp.QuoteMeta("UPDATE `"+c.table+"` SET `"+c.name+"` = ? WHERE `"+c.name+"` = ?")).
+						WithArgs("erased:erasure-1", "johndoe").WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				// the user asked itself, so both names are redacted
+				mock.ExpectExec(config.CompleteErasureTestQuery).
+					WithArgs("erased:erasure-1", "erased:erasure-1", models.ErasureCompleted, sqlmock.AnyArg(), sqlmock.AnyArg(), "erasure-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "No Longer Pending",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockErasureTestQuery).WithArgs("erasure-1", models.ErasurePending, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			receipt, err := repo.Erase(context.Background(), request, models.ErasureReceipt{RequestID: "erasure-1", UserID: "1", CompletedAt: time.Now()})
+
+			assert.ErrorIs(t, err, tt.ExpectedErr)
+			if tt.ExpectedErr == nil {
+				assert.Equal(t, int64(2), receipt.Deleted["users"])
+				assert.Equal(t, int64(1), receipt.Redacted["jobs"])
+				assert.Equal(t, int64(2), receipt.Scrubbed["jobs.params"])
+				assert.Equal(t, int64(1), receipt.Scrubbed["jobs.result"])
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	test := []struct {
+		Name     string
+		Document string
+		Expected bool
+	}{
+		{Name: "Selection", Document: `{"usernames":["jane","johndoe"]}`, Expected: true},
+		{Name: "Import Report", Document: `{"rows":[{"row":1,"username":"johndoe"}]}`, Expected: true},
+		{Name: "CSV Field", Document: `{"data":"username,email\njohndoe,john@example.com\n"}`, Expected: true},
+		{Name: "NDJSON Field", Document: `{"data":"{\"username\":\"johndoe\"}\n"}`, Expected: true},
+		{Name: "Longer Username", Document: `{"usernames":["johndoes","xjohndoe"]}`},
+		{Name: "Longer CSV Field", Document: `{"data":"username,email\njohndoes,johndoe@example.com\n"}`},
+		{Name: "Longer NDJSON Field", Document: `{"data":"{\"username\":\"johndoes\"}\n"}`},
+		{Name: "Empty", Document: ``},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, names(json.RawMessage(tt.Document), "johndoe"))
+		})
+	}
+}
@@ -1,11 +1,215 @@
 package repository
 
-import "go-manage-mysql/internal/models"
+import (
+	"context"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type UserRepository interface {
-	Save(user models.User) error
-	Search(username string) (models.User, error)
-	Update(username string, update models.User) error
-	Delete(username string) error
-	ChangePwd(username string, newPwd string) error
+	Save(ctx context.Context, user models.User) error
+	Search(ctx context.Context, username string) (models.User, error)
+	// SearchFresh is Search bypassing any cache, with the password hash. Logins
+	// use it.
+	SearchFresh(ctx context.Context, username string) (models.User, error)
+	SearchByID(ctx context.Context, id string) (models.User, error)
+	Update(ctx context.Context, username string, update models.User) error
+	Delete(ctx context.Context, username string) error
+	ChangePwd(ctx context.Context, username string, newPwd string) error
+	// RehashPwd replaces the password hash of username, only while it still
+	// is current. Unlike ChangePwd it keeps a pending password change.
+	RehashPwd(ctx context.Context, username, current, rehashed string) error
+	List(ctx context.Context, offset, limit int) ([]models.User, error)
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	// FindTaken returns the users holding any of the usernames, emails or phones.
+	FindTaken(ctx context.Context, usernames, emails, phones []string) ([]models.User, error)
+	// SaveBatch inserts users in a single statement.
+	SaveBatch(ctx context.Context, users []models.User) error
+	// Replace overwrites every importable field of the user named user.Username.
+	Replace(ctx context.Context, user models.User) error
+	// Export calls fn with every user matching filter, batchSize at a time.
+	Export(ctx context.Context, filter UserFilter, batchSize int, fn func(users []models.User) error) error
+	// Count returns how many users match filter.
+	Count(ctx context.Context, filter UserFilter) (int64, error)
+	// DisableMany disables the enabled users among usernames and returns how many changed.
+	DisableMany(ctx context.Context, usernames []string) (int64, error)
+	// ExpirePasswords forces the users among usernames to change their password
+	// on the next login and returns how many changed.
+	ExpirePasswords(ctx context.Context, usernames []string) (int64, error)
+	// Transaction runs fn atomically, tx must not be used after fn returns.
+	Transaction(ctx context.Context, fn func(tx UserRepository) error) error
+	// RotateDataKey makes a new data key encrypt the personal data written
+	// from now on.
+	RotateDataKey(ctx context.Context) error
+	// Reencrypt encrypts with the current data key up to limit users after
+	// afterID, in id order, that are in plaintext or use an older key.
+	Reencrypt(ctx context.Context, afterID string, limit int) (ReencryptBatch, error)
+}
+
+// FieldCipher encrypts personal data before it is written and decrypts it
+// once read. Blind indexes stand in for encrypted values in lookups.
+type FieldCipher interface {
+	Encrypt(ctx context.Context, field, value string) (string, error)
+	// Decrypt returns values stored before encryption was enabled as they are.
+	Decrypt(ctx context.Context, field, value string) (string, error)
+	BlindIndex(field, value string) string
+	// Stale reports whether value is in plaintext or encrypted with another
+	// key than the current one.
+	Stale(ctx context.Context, value string) bool
+	// Rotate makes a new data key the current one.
+	Rotate(ctx context.Context) error
+}
+
+// ReencryptBatch tells how a Reencrypt call went, LastID is where the next
+// one starts.
+type ReencryptBatch struct {
+	Read    int
+	Changed int
+	LastID  string
+}
+
+// DBRouter picks the connection a statement about the given users runs on.
+type DBRouter interface {
+	Reader(ctx context.Context, users ...string) *gorm.DB
+	Writer(ctx context.Context, users ...string) *gorm.DB
+}
+
+// UserFilter narrows an export, zero values match everything.
+type UserFilter struct {
+	Role           string
+	Disabled       *bool
+	UsernamePrefix string
+	Usernames      []string
+	// AfterID skips the users up to this id, in export order
+	AfterID string
+}
+
+// JobRepository persists jobs. Once claimed, a job is only written by the
+// worker owning it, any other write is refused with config.ErrJobLost.
+type JobRepository interface {
+	Create(ctx context.Context, job models.Job) error
+	Get(ctx context.Context, id string) (models.Job, error)
+	// Claim hands the oldest queued job, or a running one whose owner stopped
+	// heartbeating before stale, to owner. gorm.ErrRecordNotFound means
+	// there is nothing to run.
+	Claim(ctx context.Context, owner string, stale time.Time) (models.Job, error)
+	// Heartbeat keeps the claim alive and reports whether a cancel was requested.
+	Heartbeat(ctx context.Context, job models.Job) (cancelRequested bool, err error)
+	// SaveProgress stores the counters, cursor and partial result of job.
+	SaveProgress(ctx context.Context, job models.Job) error
+	// Finish stores the final state of job.
+	Finish(ctx context.Context, job models.Job) error
+	// Release queues job again so any worker resumes it.
+	Release(ctx context.Context, job models.Job) error
+	// Cancel cancels a queued job and asks the owner of a running one to stop.
+	Cancel(ctx context.Context, id string) (models.Job, error)
+}
+
+// OAuthRepository persists the clients, codes and tokens of the openid
+// connect provider. Codes and tokens are looked up by their hash only.
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client models.OAuthClient) error
+	GetClient(ctx context.Context, id string) (models.OAuthClient, error)
+	ListClients(ctx context.Context) ([]models.OAuthClient, error)
+	// DeleteClient removes the client and revokes every token issued to it.
+	DeleteClient(ctx context.Context, id string) error
+	SaveCode(ctx context.Context, code models.OAuthCode) error
+	// RedeemCode marks the code as used and returns it. A code used before is
+	// returned along with config.ErrCodeUsed.
+	RedeemCode(ctx context.Context, hash string) (models.OAuthCode, error)
+	SaveTokens(ctx context.Context, tokens ...models.OAuthToken) error
+	GetToken(ctx context.Context, hash string) (models.OAuthToken, error)
+	// UseRefreshToken revokes the refresh token and returns it, so it can be
+	// exchanged once. A revoked one is returned along with config.ErrTokenRevoked.
+	UseRefreshToken(ctx context.Context, hash string) (models.OAuthToken, error)
+	// RevokeGrant revokes every token issued from the same authorization.
+	RevokeGrant(ctx context.Context, grantID string) error
+}
+
+type IdentityRepository interface {
+	FindIdentity(ctx context.Context, issuer, subject string) (models.FederatedIdentity, error)
+	CreateIdentity(ctx context.Context, identity models.FederatedIdentity) error
+	// TouchIdentity records a login through the identity.
+	TouchIdentity(ctx context.Context, id string, at time.Time) error
+	DeleteIdentity(ctx context.Context, id string) error
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	// ListAPIKeys returns the keys of username, or every key when it is empty.
+	ListAPIKeys(ctx context.Context, username string) ([]models.APIKey, error)
+	// RevokeAPIKey revokes the key with id, only among the keys of username
+	// unless it is empty.
+	RevokeAPIKey(ctx context.Context, id, username string) error
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// DataKeyRepository persists the data keys, wrapped by a master key.
+type DataKeyRepository interface {
+	CreateDataKey(ctx context.Context, key models.DataKey) error
+	// ListDataKeys returns every data key, the newest last.
+	ListDataKeys(ctx context.Context) ([]models.DataKey, error)
+	// RewrapDataKey stores key wrapped by another master key.
+	RewrapDataKey(ctx context.Context, key models.DataKey) error
+	// RecordIndexCheck sets check on the data keys stored without one.
+	RecordIndexCheck(ctx context.Context, check string) error
+}
+
+// SubjectData is what the tables other than users keep about a user.
+type SubjectData struct {
+	Sessions   []models.Session
+	APIKeys    []models.APIKey
+	Identities []models.FederatedIdentity
+	// Tokens are the oauth tokens issued to clients the user signed in to,
+	// Clients those clients
+	Tokens  []models.OAuthToken
+	Clients []models.OAuthClient
+	// rows recording what the user did
+	CreatedJobs    []models.Job
+	CreatedClients []models.OAuthClient
+	CreatedKeys    []models.APIKey
+}
+
+// PrivacyRepository reads and erases what is kept about a user, and persists
+// the requests to erase it.
+type PrivacyRepository interface {
+	SubjectData(ctx context.Context, userID, username string) (SubjectData, error)
+	CreateErasure(ctx context.Context, request models.ErasureRequest) error
+	GetErasure(ctx context.Context, id string) (models.ErasureRequest, error)
+	// PendingErasure returns the pending request to erase the user with userID.
+	PendingErasure(ctx context.Context, userID string) (models.ErasureRequest, error)
+	// ListErasures returns the requests in state, or every request when it is
+	// empty, the newest first.
+	ListErasures(ctx context.Context, state string) ([]models.ErasureRequest, error)
+	// CancelErasure cancels the request with id while it is pending.
+	CancelErasure(ctx context.Context, id string, at time.Time) error
+	// DueErasures returns up to limit pending requests scheduled at or before
+	// now, the oldest first.
+	DueErasures(ctx context.Context, now time.Time, limit int) ([]models.ErasureRequest, error)
+	// Erase deletes the user of request and its rows, redacts its name from
+	// the rest, and completes the request with receipt, filled with the rows
+	// changed. A request no longer pending is left alone with
+	// config.ErrNoRowsAffected.
+	Erase(ctx context.Context, request models.ErasureRequest, receipt models.ErasureReceipt) (models.ErasureReceipt, error)
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session models.Session) error
+	GetSession(ctx context.Context, id string) (models.Session, error)
+	// ListSessions returns the sessions still active at now, of username or
+	// of every user when it is empty.
+	ListSessions(ctx context.Context, username string, now time.Time) ([]models.Session, error)
+	// EndSession ends the session with id, only among the sessions of
+	// username unless it is empty.
+	EndSession(ctx context.Context, id, username string) error
+	// EndOtherSessions ends every session of username but keep and returns
+	// how many were ended.
+	EndOtherSessions(ctx context.Context, username, keep string) (int64, error)
+	TouchSession(ctx context.Context, id string, at time.Time) error
+	// EndUserSessions ends every session of usernames and returns how many
+	// ended.
+	EndUserSessions(ctx context.Context, usernames []string) (int64, error)
 }
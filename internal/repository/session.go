@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SessionStore struct {
+	DB *gorm.DB
+}
+
+var _ SessionRepository = (*SessionStore)(nil)
+
+func NewSessionRepository(db *gorm.DB) *SessionStore {
+	return &SessionStore{DB: db}
+}
+
+func (s *SessionStore) CreateSession(ctx context.Context, session models.Session) error {
+	return s.DB.WithContext(ctx).Create(&session).Error
+}
+
+func (s *SessionStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	if err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&session).Error; err != nil {
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+func (s *SessionStore) ListSessions(ctx context.Context, username string, now time.Time) ([]models.Session, error) {
+	query := s.DB.WithContext(ctx).Where("revoked_at IS NULL").Where("expires_at > ?", now)
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	var sessions []models.Session
+	if err := query.Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *SessionStore) EndSession(ctx context.Context, id, username string) error {
+	query := s.DB.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Where("revoked_at IS NULL")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	result := query.Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (s *SessionStore) EndOtherSessions(ctx context.Context, username, keep string) (int64, error) {
+	result := s.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("username = ?", username).Where("revoked_at IS NULL").Where("id <> ?", keep).
+		Update("revoked_at", time.Now().UTC())
+	return result.RowsAffected, result.Error
+}
+
+func (s *SessionStore) EndUserSessions(ctx context.Context, usernames []string) (int64, error) {
+	result := s.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("username IN ?", usernames).Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now().UTC())
+	return result.RowsAffected, result.Error
+}
+
+func (s *SessionStore) TouchSession(ctx context.Context, id string, at time.Time) error {
+	return s.DB.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func sessionRepo(t *testing.T) (*SessionStore, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	return NewSessionRepository(gormDB), mock
+}
+
+func TestListSessions(t *testing.T) {
+	repo, mock := sessionRepo(t)
+
+	mock.ExpectQuery(config.ListSessionsTestQuery+" AND username = \\? ORDER BY last_seen_at DESC").WithArgs(sqlmock.AnyArg(), "johndoe").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("session-1", "johndoe"))
+
+	sessions, err := repo.ListSessions(context.Background(), "johndoe", time.Now())
+
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEndSession(t *testing.T) {
+	repo, mock := sessionRepo(t)
+
+	test := []struct {
+		Name        string
+		Username    string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Any Owner",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndSessionTestQuery+"$").WithArgs(sqlmock.AnyArg(), "session-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Not Found",
+			Username:    "johndoe",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndSessionTestQuery+" AND username = \\?").WithArgs(sqlmock.AnyArg(), "session-1", "johndoe").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			assert.ErrorIs(t, repo.EndSession(context.Background(), "session-1", tt.Username), tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestEndOtherSessions(t *testing.T) {
+	repo, mock := sessionRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(config.EndOtherSessionsTestQuery).WithArgs(sqlmock.AnyArg(), "johndoe", "session-1").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	ended, err := repo.EndOtherSessions(context.Background(), "johndoe", "session-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), ended)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,69 +1,453 @@
 package repository
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
 	"go-manage-mysql/internal/models"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Router DBRouter
+	// Cipher, when set, encrypts personal data at rest
+	Cipher FieldCipher
+	// inside a transaction the rows read stay locked until it ends
+	lock bool
 }
 
 func NewUserRepository(db *gorm.DB) *Repository {
 	return &Repository{DB: db}
 }
-func (r *Repository) Save(user models.User) error {
-	result := r.DB.Create(user)
+
+// NewRoutedUserRepository reads from replicas and writes to the primary.
+func NewRoutedUserRepository(router DBRouter) *Repository {
+	return &Repository{Router: router}
+}
+
+func (r *Repository) reader(ctx context.Context, users ...string) *gorm.DB {
+	if r.Router == nil {
+		return r.DB.WithContext(ctx)
+	}
+	return r.Router.Reader(ctx, users...)
+}
+
+func (r *Repository) writer(ctx context.Context, users ...string) *gorm.DB {
+	if r.Router == nil {
+		return r.DB.WithContext(ctx)
+	}
+	return r.Router.Writer(ctx, users...)
+}
+
+// Transaction runs fn on the primary, fn gets a repository bound to the
+// transaction. It commits when fn returns nil and rolls back otherwise.
+func (r *Repository) Transaction(ctx context.Context, fn func(tx UserRepository) error) error {
+	return r.writer(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{DB: tx, Router: txRouter{tx: tx, parent: r.Router}, Cipher: r.Cipher, lock: true})
+	})
+}
+
+// txRouter keeps every statement on the transaction, writes still count for
+// read-your-writes on the parent router.
+type txRouter struct {
+	tx     *gorm.DB
+	parent DBRouter
+}
+
+func (t txRouter) Reader(ctx context.Context, users ...string) *gorm.DB {
+	return t.tx.WithContext(ctx)
+}
+
+func (t txRouter) Writer(ctx context.Context, users ...string) *gorm.DB {
+	if t.parent != nil {
+		t.parent.Writer(ctx, users...)
+	}
+	return t.tx.WithContext(ctx)
+}
+
+func (r *Repository) Save(ctx context.Context, user models.User) error {
+	if err := r.plaintextTaken(ctx, user); err != nil {
+		return err
+	}
+	if err := Seal(ctx, r.Cipher, &user); err != nil {
+		return err
+	}
+	result := r.writer(ctx, user.Username).Create(&user)
 	if result.Error != nil {
-		return result.Error
+		return translate(result.Error)
 	}
 	return nil
 }
 
-func (r *Repository) Search(username string) (models.User, error) {
+func (r *Repository) Search(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	db := r.reader(ctx, username)
+	if r.lock {
+		db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	result := db.Where("username=?", username).First(&user)
+	if result.Error != nil {
+		return models.User{}, result.Error
+	}
+	if err := open(ctx, r.Cipher, &user); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// SearchFresh is Search, the repository caches nothing.
+func (r *Repository) SearchFresh(ctx context.Context, username string) (models.User, error) {
+	return r.Search(ctx, username)
+}
+
+func (r *Repository) SearchByID(ctx context.Context, id string) (models.User, error) {
 	var user models.User
-	result := r.DB.Where("username=?", username).First(&user)
+	db := r.reader(ctx)
+	if r.lock {
+		db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	result := db.Where("id = ?", id).First(&user)
 	if result.Error != nil {
 		return models.User{}, result.Error
 	}
+	if err := open(ctx, r.Cipher, &user); err != nil {
+		return models.User{}, err
+	}
 	return user, nil
 }
 
-func (r *Repository) Update(username string, update models.User) error {
-	result := r.DB.Where("username=?", username).Select("name", "surname", "phone", "email").Updates(&update)
+func (r *Repository) Update(ctx context.Context, username string, update models.User) error {
+	if r.Cipher != nil {
+		// a new ciphertext always differs, unchanged values are told apart
+		// before sealing
+		current, err := r.Search(ctx, username)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return config.ErrNoRowsAffected
+		}
+		if err != nil {
+			return err
+		}
+		if current.Name == update.Name && current.Surname == update.Surname && current.Phone == update.Phone && current.Email == update.Email {
+			return config.ErrNoRowsAffected
+		}
+		check := update
+		check.Username = username
+		if err := r.plaintextTaken(ctx, check); err != nil {
+			return err
+		}
+		if err := Seal(ctx, r.Cipher, &update); err != nil {
+			return err
+		}
+	}
+	result := r.writer(ctx, username).Where("username=?", username).Select(r.sealed("name", "surname", "phone", "email")).Updates(&update)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, username string) error {
+	result := r.writer(ctx, username).Model(&models.User{}).Where("username=?", username).Delete(&models.User{})
 	if result.Error != nil {
 		return result.Error
 	}
+
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("no rows affected")
+		return config.ErrNoRowsAffected
 	}
+
 	return nil
 }
 
-func (r *Repository) Delete(username string) error {
-	result := r.DB.Model(&models.User{}).Where("username=?", username).Delete(&models.User{})
+func (r *Repository) ChangePwd(ctx context.Context, username string, newPwd string) error {
+	result := r.writer(ctx, username).Model(&models.User{}).Where("username = ?", username).
+		Updates(map[string]interface{}{"password": newPwd, "must_change_password": false})
+
 	if result.Error != nil {
 		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("no rows affected")
+		return config.ErrNoRowsAffected
+	}
+	return nil
+}
+
+func (r *Repository) RehashPwd(ctx context.Context, username, current, rehashed string) error {
+	result := r.writer(ctx, username).Model(&models.User{}).Where("username = ?", username).Where("password = ?", current).
+		Update("password", rehashed)
+
+	if result.Error != nil {
+		return result.Error
 	}
 
+	if result.RowsAffected == 0 {
+		return config.ErrNoRowsAffected
+	}
 	return nil
 }
 
-func (r *Repository) ChangePwd(username string, newPwd string) error {
-	result := r.DB.Model(&models.User{}).Where("username = ?", username).Update("password", newPwd)
+func (r *Repository) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	var users []models.User
+	result := r.reader(ctx).Order("username").Offset(offset).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if err := r.openAll(ctx, users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetDisabled is idempotent, only a missing user is reported as
+// config.ErrNoRowsAffected.
+func (r *Repository) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	db := r.writer(ctx, username)
+	result := db.Model(&models.User{}).Where("username = ?", username).Update("disabled", disabled)
 
 	if result.Error != nil {
 		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("no rows affected")
+		// mysql counts changed rows, the user may already be in that state
+		var count int64
+		if err := db.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return config.ErrNoRowsAffected
+		}
+	}
+	return nil
+}
+
+func (r *Repository) FindTaken(ctx context.Context, usernames, emails, phones []string) ([]models.User, error) {
+	var users []models.User
+	db := r.reader(ctx).Where("username IN ?", usernames).Or("email IN ?", emails).Or("phone IN ?", phones)
+	if r.Cipher != nil {
+		// users still in plaintext match the clauses above
+		db = db.Or("email_index IN ?", indexes(r.Cipher, "email", emails)).Or("phone_index IN ?", indexes(r.Cipher, "phone", phones))
+	}
+	result := db.Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if err := r.openAll(ctx, users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// plaintextTaken reports the email or phone of users held by another user
+// not encrypted yet. The unique constraints only compare blind indexes with
+// blind indexes, so until the backfill is over these are looked up apart.
+func (r *Repository) plaintextTaken(ctx context.Context, users ...models.User) error {
+	if r.Cipher == nil {
+		return nil
+	}
+	usernames := make([]string, 0, len(users))
+	emails := make([]string, 0, len(users))
+	phones := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames, emails, phones = append(usernames, user.Username), append(emails, user.Email), append(phones, user.Phone)
+	}
+
+	var taken []models.User
+	result := r.writer(ctx, usernames...).Select("username", "email", "phone").
+		Where("email IN ? OR phone IN ?", emails, phones).Find(&taken)
+	if result.Error != nil {
+		return result.Error
+	}
+	for _, held := range taken {
+		for _, user := range users {
+			if held.Username == user.Username {
+				continue
+			}
+			if strings.EqualFold(held.Email, user.Email) {
+				return &DuplicateError{Field: "email", Err: config.ErrUserAlreadyExists}
+			}
+			if held.Phone == user.Phone {
+				return &DuplicateError{Field: "phone", Err: config.ErrUserAlreadyExists}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) SaveBatch(ctx context.Context, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	if r.Cipher != nil {
+		if err := r.plaintextTaken(ctx, users...); err != nil {
+			return err
+		}
+		// the caller keeps its plaintext copies
+		users = append([]models.User(nil), users...)
+		for i := range users {
+			if err := Seal(ctx, r.Cipher, &users[i]); err != nil {
+				return err
+			}
+		}
+	}
+	result := r.writer(ctx, usernames...).CreateInBatches(&users, len(users))
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	return nil
+}
+
+func (r *Repository) Replace(ctx context.Context, user models.User) error {
+	if err := r.plaintextTaken(ctx, user); err != nil {
+		return err
+	}
+	if err := Seal(ctx, r.Cipher, &user); err != nil {
+		return err
+	}
+	// unchanged rows report no affected rows, that is not an error here
+	result := r.writer(ctx, user.Username).Model(&models.User{}).Where("username = ?", user.Username).
+		Select(r.sealed("name", "surname", "phone", "email", "password", "role", "disabled", "must_change_password")).Updates(&user)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	return nil
+}
+
+func (r *Repository) Export(ctx context.Context, filter UserFilter, batchSize int, fn func(users []models.User) error) error {
+	var users []models.User
+	result := filtered(r.reader(ctx), filter).FindInBatches(&users, batchSize, func(tx *gorm.DB, batch int) error {
+		if err := r.openAll(ctx, users); err != nil {
+			return err
+		}
+		return fn(users)
+	})
+	return result.Error
+}
+
+func (r *Repository) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	var count int64
+	result := filtered(r.reader(ctx).Model(&models.User{}), filter).Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+func (r *Repository) DisableMany(ctx context.Context, usernames []string) (int64, error) {
+	return r.setFlag(ctx, usernames, "disabled")
+}
+
+func (r *Repository) ExpirePasswords(ctx context.Context, usernames []string) (int64, error) {
+	return r.setFlag(ctx, usernames, "must_change_password")
+}
+
+// setFlag turns column on for usernames, users that already have it are not counted.
+func (r *Repository) setFlag(ctx context.Context, usernames []string, column string) (int64, error) {
+	if len(usernames) == 0 {
+		return 0, nil
+	}
+	result := r.writer(ctx, usernames...).Model(&models.User{}).
+		Where("username IN ? AND "+column+" = ?", usernames, false).Update(column, true)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *Repository) RotateDataKey(ctx context.Context) error {
+	if r.Cipher == nil {
+		return config.ErrEncryptionOff
+	}
+	return r.Cipher.Rotate(ctx)
+}
+
+func (r *Repository) Reencrypt(ctx context.Context, afterID string, limit int) (ReencryptBatch, error) {
+	if r.Cipher == nil {
+		return ReencryptBatch{}, config.ErrEncryptionOff
+	}
+	var batch ReencryptBatch
+	// the rows stay locked, so a concurrent write is not overwritten with
+	// the values read here
+	err := r.writer(ctx).Transaction(func(tx *gorm.DB) error {
+		var users []models.User
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id > ?", afterID).Order("id").Limit(limit).Find(&users)
+		if result.Error != nil {
+			return result.Error
+		}
+		batch = ReencryptBatch{Read: len(users)}
+		for _, user := range users {
+			batch.LastID = user.ID
+			if !stale(ctx, r.Cipher, user) {
+				continue
+			}
+			if err := open(ctx, r.Cipher, &user); err != nil {
+				return err
+			}
+			if err := Seal(ctx, r.Cipher, &user); err != nil {
+				return err
+			}
+			if err := tx.Where("id = ?", user.ID).Select(r.sealed("name", "surname", "phone", "email")).Updates(&user).Error; err != nil {
+				return translate(err)
+			}
+			batch.Changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return ReencryptBatch{}, err
+	}
+	return batch, nil
+}
+
+// sealed adds the blind index columns to columns when they are encrypted.
+func (r *Repository) sealed(columns ...string) []string {
+	if r.Cipher == nil {
+		return columns
+	}
+	return append(columns, "email_index", "phone_index")
+}
+
+func (r *Repository) openAll(ctx context.Context, users []models.User) error {
+	for i := range users {
+		if err := open(ctx, r.Cipher, &users[i]); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+func filtered(db *gorm.DB, filter UserFilter) *gorm.DB {
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	if filter.Disabled != nil {
+		db = db.Where("disabled = ?", *filter.Disabled)
+	}
+	if filter.UsernamePrefix != "" {
+		db = db.Where("username LIKE ?", likePrefix(filter.UsernamePrefix))
+	}
+	if len(filter.Usernames) > 0 {
+		db = db.Where("username IN ?", filter.Usernames)
+	}
+	if filter.AfterID != "" {
+		db = db.Where("id > ?", filter.AfterID)
+	}
+	return db
+}
+
+// likePrefix escapes the LIKE wildcards of prefix.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
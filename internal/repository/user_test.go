@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"go-manage-mysql/cmd/config"
 	"go-manage-mysql/internal/models"
@@ -59,7 +60,7 @@ func TestSearch(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			tt.MockAct()
 
-			search, searchErr := repo.Search(tt.Username)
+			search, searchErr := repo.Search(context.Background(), tt.Username)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, searchErr.Error())
@@ -104,12 +105,13 @@ func TestSave(t *testing.T) {
 				Phone:    "123456789",
 				Email:    "johndoe@example.com",
 				Password: "Password1234",
+				Role:     models.RoleUser,
 			},
 			ExpectedErr: nil,
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.SaveTestQuery).
-					WithArgs("1", "John", "Doe", "johndoe", "123456789", "johndoe@example.com", "Password1234").
+					WithArgs("1", "John", "Doe", "johndoe", "123456789", "johndoe@example.com", "Password1234", models.RoleUser, false, false, nil, nil).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 			},
@@ -124,12 +126,13 @@ func TestSave(t *testing.T) {
 				Phone:    "123456789",
 				Email:    "johndoe@example.com",
 				Password: "Password1234",
+				Role:     models.RoleUser,
 			},
 			ExpectedErr: fmt.Errorf("db error"),
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.SaveTestQuery).
-					WithArgs("1", "John", "Doe", "johndoe", "123456789", "johndoe@example.com", "Password1234").
+					WithArgs("1", "John", "Doe", "johndoe", "123456789", "johndoe@example.com", "Password1234", models.RoleUser, false, false, nil, nil).
 					WillReturnError(fmt.Errorf("db error"))
 				mock.ExpectRollback()
 			},
@@ -140,7 +143,7 @@ func TestSave(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			tt.MockAct()
 
-			save := repo.Save(tt.User)
+			save := repo.Save(context.Background(), tt.User)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, save.Error())
@@ -233,7 +236,7 @@ func TestUpdate(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			tt.MockAct()
 
-			update := repo.Update(tt.Username, tt.Update)
+			update := repo.Update(context.Background(), tt.Username, tt.Update)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, update.Error())
@@ -308,7 +311,7 @@ func TestDelete(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			tt.MockAct()
 
-			delete := repo.Delete(tt.Username)
+			delete := repo.Delete(context.Background(), tt.Username)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, delete.Error())
@@ -350,7 +353,7 @@ func TestChangePwd(t *testing.T) {
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
-					WithArgs("NewPassword", "johndoe").
+					WithArgs(false, "NewPassword", "johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 			},
@@ -363,7 +366,7 @@ func TestChangePwd(t *testing.T) {
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
-					WithArgs("NewPassword", "johndoe").
+					WithArgs(false, "NewPassword", "johndoe").
 					WillReturnError(fmt.Errorf("db error"))
 				mock.ExpectRollback()
 			},
@@ -376,7 +379,7 @@ func TestChangePwd(t *testing.T) {
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
-					WithArgs("NewPassword", "johndoe").
+					WithArgs(false, "NewPassword", "johndoe").
 					WillReturnResult(sqlmock.NewResult(0, 0))
 				mock.ExpectCommit()
 			},
@@ -387,7 +390,7 @@ func TestChangePwd(t *testing.T) {
 		t.Run(tt.Name, func(t *testing.T) {
 			tt.MockAct()
 
-			update := repo.ChangePwd(tt.Username, tt.NewPassword)
+			update := repo.ChangePwd(context.Background(), tt.Username, tt.NewPassword)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, update.Error())
@@ -398,3 +401,419 @@ func TestChangePwd(t *testing.T) {
 		})
 	}
 }
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+
+	test := []struct {
+		Name        string
+		ExpectedLen int
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name:        "Success",
+			ExpectedLen: 2,
+			MockAct: func() {
+				mock.ExpectQuery(config.ListTestQuery).
+					WithArgs(2, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "admin").AddRow("2", "johndoe"))
+			},
+		},
+		{
+			Name:        "Error",
+			ExpectedErr: fmt.Errorf("db error"),
+			MockAct: func() {
+				mock.ExpectQuery(config.ListTestQuery).
+					WithArgs(2, 5).
+					WillReturnError(fmt.Errorf("db error"))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			users, listErr := repo.List(context.Background(), 5, 2)
+
+			if tt.ExpectedErr != nil {
+				assert.EqualError(t, tt.ExpectedErr, listErr.Error())
+			} else {
+				assert.NoError(t, listErr)
+				assert.Len(t, users, tt.ExpectedLen)
+			}
+		})
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Success",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name: "Already Disabled",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				mock.ExpectQuery(config.CountTestQuery).
+					WithArgs("johndoe").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+		},
+		{
+			Name:        "User Not Found",
+			ExpectedErr: fmt.Errorf("no rows affected"),
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				mock.ExpectQuery(config.CountTestQuery).
+					WithArgs("johndoe").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			disableErr := repo.SetDisabled(context.Background(), "johndoe", true)
+
+			if tt.ExpectedErr != nil {
+				assert.EqualError(t, tt.ExpectedErr, disableErr.Error())
+			} else {
+				assert.NoError(t, disableErr)
+			}
+		})
+	}
+}
+
+func TestRehashPwd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+
+	test := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name: "Success",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RehashPwdTestQuery).
+					WithArgs("new-hash", "johndoe", "old-hash").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:        "Password Changed Meanwhile",
+			ExpectedErr: config.ErrNoRowsAffected,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RehashPwdTestQuery).
+					WithArgs("new-hash", "johndoe", "old-hash").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			rehashErr := repo.RehashPwd(context.Background(), "johndoe", "old-hash", "new-hash")
+
+			assert.ErrorIs(t, rehashErr, tt.ExpectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+type testRouter struct {
+	reader, writer *gorm.DB
+	written        []string
+}
+
+func (r *testRouter) Reader(ctx context.Context, users ...string) *gorm.DB {
+	return r.reader.WithContext(ctx)
+}
+
+func (r *testRouter) Writer(ctx context.Context, users ...string) *gorm.DB {
+	r.written = append(r.written, users...)
+	return r.writer.WithContext(ctx)
+}
+
+func TestRouting(t *testing.T) {
+	readerDB, readerMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readerDB.Close()
+
+	writerDB, writerMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writerDB.Close()
+
+	reader, _ := gorm.Open(mysql.New(mysql.Config{Conn: readerDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+	writer, _ := gorm.Open(mysql.New(mysql.Config{Conn: writerDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+	router := &testRouter{reader: reader, writer: writer}
+	repo := NewRoutedUserRepository(router)
+
+	readerMock.ExpectQuery(config.SearchTestQuery).
+		WithArgs("johndoe", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "johndoe"))
+	readerMock.ExpectQuery(config.ListTestQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}))
+	writerMock.ExpectBegin()
+	writerMock.ExpectExec(config.DisableTestQuery).
+		WithArgs(true, "johndoe").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	writerMock.ExpectCommit()
+
+	_, searchErr := repo.Search(context.Background(), "johndoe")
+	assert.NoError(t, searchErr)
+	_, listErr := repo.List(context.Background(), 0, 10)
+	assert.NoError(t, listErr)
+	assert.NoError(t, repo.SetDisabled(context.Background(), "johndoe", true))
+
+	assert.Equal(t, []string{"johndoe"}, router.written)
+	assert.NoError(t, readerMock.ExpectationsWereMet())
+	assert.NoError(t, writerMock.ExpectationsWereMet())
+}
+
+func TestTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+
+	t.Run("Commit Locks Rows", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(config.LockTestQuery).
+			WithArgs("johndoe", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("johndoe"))
+		mock.ExpectExec(config.DisableTestQuery).
+			WithArgs(true, "johndoe").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		txErr := repo.Transaction(context.Background(), func(tx UserRepository) error {
+			if _, err := tx.Search(context.Background(), "johndoe"); err != nil {
+				return err
+			}
+			return tx.SetDisabled(context.Background(), "johndoe", true)
+		})
+
+		assert.NoError(t, txErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rollback On Error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(config.DisableTestQuery).
+			WithArgs(true, "johndoe").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(config.CountTestQuery).
+			WithArgs("johndoe").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectRollback()
+
+		txErr := repo.Transaction(context.Background(), func(tx UserRepository) error {
+			return tx.SetDisabled(context.Background(), "johndoe", true)
+		})
+
+		assert.ErrorIs(t, txErr, config.ErrNoRowsAffected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestBulkFlags(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+	usernames := []string{"johndoe", "janedoe"}
+
+	test := []struct {
+		Name            string
+		Apply           func() (int64, error)
+		ExpectedChanged int64
+		MockAct         func()
+	}{
+		{
+			Name:            "Disable Many",
+			Apply:           func() (int64, error) { return repo.DisableMany(context.Background(), usernames) },
+			ExpectedChanged: 1,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableManyTestQuery).
+					WithArgs(true, "johndoe", "janedoe", false).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Expire Passwords",
+			Apply:           func() (int64, error) { return repo.ExpirePasswords(context.Background(), usernames) },
+			ExpectedChanged: 2,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.ExpirePasswordsTestQuery).
+					WithArgs(true, "johndoe", "janedoe", false).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:    "Nobody",
+			Apply:   func() (int64, error) { return repo.DisableMany(context.Background(), nil) },
+			MockAct: func() {},
+		},
+		{
+			Name: "Count",
+			Apply: func() (int64, error) {
+				return repo.Count(context.Background(), UserFilter{Role: models.RoleUser, AfterID: "1"})
+			},
+			ExpectedChanged: 7,
+			MockAct: func() {
+				mock.ExpectQuery(config.CountTestQuery).
+					WithArgs(models.RoleUser, "1").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			changed, applyErr := tt.Apply()
+
+			assert.NoError(t, applyErr)
+			assert.Equal(t, tt.ExpectedChanged, changed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSearchByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	repo := NewUserRepository(gormDB)
+
+	t.Run("Found", func(t *testing.T) {
+		mock.ExpectQuery(config.SearchByIDTestQuery).
+			WithArgs("1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "johndoe"))
+
+		user, searchErr := repo.SearchByID(context.Background(), "1")
+
+		assert.NoError(t, searchErr)
+		assert.Equal(t, "johndoe", user.Username)
+	})
+
+	t.Run("Locks Inside Transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(config.LockTestQuery).
+			WithArgs("1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		txErr := repo.Transaction(context.Background(), func(tx UserRepository) error {
+			_, searchErr := tx.SearchByID(context.Background(), "1")
+			return searchErr
+		})
+
+		assert.ErrorIs(t, txErr, gorm.ErrRecordNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,14 +1,82 @@
 package router
 
 import (
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/cache"
+	"go-manage-mysql/internal/federation"
+	"go-manage-mysql/internal/health"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/privacy"
+	"go-manage-mysql/internal/ratelimit"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRouter(conn *gorm.DB) *gin.Engine {
-	router := gin.Default()
+// Dependencies are the shared components the routes are built from.
+type Dependencies struct {
+	DB     *gorm.DB
+	Health *health.Registry
+	// DBRouter, when set, spreads reads over replicas instead of using DB
+	DBRouter repository.DBRouter
+	// Cache, when set, keeps user lookups
+	Cache cache.Cache
+	// Jobs, when set, is the manager whose workers run the submitted jobs
+	Jobs *jobs.Manager
+	// OIDC, when set, serves the openid connect provider
+	OIDC *oidc.Provider
+	// Federation, when set, logs users in through external identity providers
+	Federation *federation.Service
+	// Passwords, when set, is the hasher every user service shares
+	Passwords *password.Hasher
+	// Cipher, when set, encrypts the personal data of users at rest
+	Cipher repository.FieldCipher
+	// Privacy, when set, is the service whose sweeper carries out erasures
+	Privacy *privacy.Service
+	// RateLimit, when set, enforces the rate limit policies
+	RateLimit *ratelimit.Limiter
+}
+
+func SetupRouter(deps Dependencies) *gin.Engine {
+	router := gin.New()
+	router.ContextWithFallback = true
+	// X-Forwarded-For is ignored unless the peer is a trusted proxy
+	if err := router.SetTrustedProxies(config.Current().Server.TrustedProxies); err != nil {
+		slog.Error("invalid trusted proxies, none are trusted", "error", err)
+		router.SetTrustedProxies(nil)
+	}
+	router.Use(middleware.RequestID(), tracing.GinMiddleware(), middleware.AccessLog(), middleware.Recovery())
+	router.Use(metrics.GinMiddleware())
+
+	if deps.Health == nil {
+		deps.Health = health.NewRegistry(config.Current().Health.CheckTimeout)
+	}
 
-	UrlMapping(router, conn)
+	if deps.RateLimit == nil {
+		deps.RateLimit = defaultLimiter()
+	}
+	router.Use(deps.RateLimit.ByIP())
+
+	UrlMapping(router, deps)
 
 	return router
 }
+
+// defaultLimiter keeps the buckets in memory, policies that fail to parse
+// leave requests unlimited.
+func defaultLimiter() *ratelimit.Limiter {
+	cfg := config.Current()
+	limiter, err := ratelimit.New(cfg.RateLimit, cfg.Server.BasePath, ratelimit.NewMemory())
+	if err != nil {
+		slog.Error("invalid rate limit policies, requests are not limited", "error", err)
+		limiter, _ = ratelimit.New(config.RateLimitConfig{}, cfg.Server.BasePath, ratelimit.NewMemory())
+	}
+	return limiter
+}
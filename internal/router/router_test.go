@@ -0,0 +1,722 @@
+package router
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/docs"
+	"go-manage-mysql/internal/mocks"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt"
+	"github.com/gustyaguero21/go-core/pkg/encrypter"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func testRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	key, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	if keyErr != nil {
+		t.Fatal(keyErr)
+	}
+	deps := Dependencies{DB: gormDB}
+	oidcCfg := config.Current().OIDC
+	oidcCfg.Issuer = "http://localhost:8080" + config.Current().Server.BasePath
+	deps.OIDC = oidc.NewProvider(repository.NewOAuthRepository(gormDB), UserServices(deps), key, oidcCfg)
+
+	return SetupRouter(deps), mock
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	r, _ := testRouter(t)
+	spec := docs.Spec(config.Current().Server.BasePath)
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		path := docs.GinPath(route.Path)
+		registered[route.Method+" "+path] = true
+
+		_, ok := spec.Operation(route.Method, path)
+		assert.True(t, ok, "route %s %s is not documented in the OpenAPI spec", route.Method, path)
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			assert.True(t, registered[method+" "+path], "spec documents %s %s but no route is registered", method, path)
+		}
+	}
+}
+
+func TestSpecServed(t *testing.T) {
+	r, _ := testRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, docs.SpecPath, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, docs.OpenAPIVersion, doc["openapi"])
+
+	ops := 0
+	for _, item := range doc["paths"].(map[string]interface{}) {
+		ops += len(item.(map[string]interface{}))
+	}
+	assert.Equal(t, len(r.Routes()), ops)
+}
+
+func TestSpecMatchesHandlers(t *testing.T) {
+	r, mock := testRouter(t)
+	basePath := config.Current().Server.BasePath
+	spec := docs.Spec(basePath)
+
+	// Auth requests carry the token of the active session "session-auth"
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "1", "username": "johndoe", "role": models.RoleUser, "sid": "session-auth"}).
+		SignedString([]byte(config.GetToken()))
+	hash, _ := encrypter.PasswordEncrypter("Password1234")
+
+	cfg := config.Current()
+	cfg.SCIM.Token = "scim-token-used-by-the-identity-provider"
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+
+	userRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "surname", "username", "phone", "email", "password"}).
+			AddRow("1", "John", "Doe", "johndoe", "123456789", "johndoe@example.com", string(hash))
+	}
+
+	// gmk_0123456789ab_secret, the hash is the sha256 of "secret"
+	apiKey := "gmk_0123456789ab_secret"
+	keyRows := func(scopes string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "prefix", "secret_hash", "user_id", "username", "scopes"}).
+			AddRow("key-1", "gmk_0123456789ab", "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", "1", "johndoe", []byte(scopes))
+	}
+	authenticateKey := func(scopes string) {
+		mock.ExpectQuery(config.GetAPIKeyTestQuery).WithArgs("gmk_0123456789ab", 1).WillReturnRows(keyRows(scopes))
+		mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("1", 1).WillReturnRows(userRows())
+		mock.ExpectBegin()
+		mock.ExpectExec(config.TouchAPIKeyTestQuery).WithArgs(sqlmock.AnyArg(), "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	// tokens issued at login carry their session
+	sessionToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "1", "username": "johndoe", "role": models.RoleUser, "sid": "session-1"}).
+		SignedString([]byte(config.GetToken()))
+	sessionRows := func(revokedAt interface{}) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "username", "user_agent", "ip", "created_at", "last_seen_at", "expires_at", "revoked_at"}).
+			AddRow("session-1", "1", "johndoe", "curl/8.0", "10.0.0.1", time.Now(), time.Now(), time.Now().Add(time.Hour), revokedAt)
+	}
+
+	test := []struct {
+		Name   string
+		Method string
+		Path   string
+		// Route is the documented path when Path has parameters
+		Route        string
+		Body         string
+		Auth         bool
+		Session      bool
+		SCIM         bool
+		APIKey       string
+		ExpectedCode int
+		MockAct      func()
+	}{
+		{
+			Name:         "Login Success",
+			Method:       http.MethodPost,
+			Path:         basePath + "/login",
+			Body:         mocks.LoginUser,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateSessionTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Login Invalid Body",
+			Method:       http.MethodPost,
+			Path:         basePath + "/login",
+			Body:         mocks.InvalidBody,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Create Success",
+			Method:       http.MethodPost,
+			Path:         basePath + "/create",
+			Body:         mocks.CreateUser,
+			ExpectedCode: http.StatusCreated,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Create Conflict",
+			Method:       http.MethodPost,
+			Path:         basePath + "/create",
+			Body:         mocks.CreateUser,
+			ExpectedCode: http.StatusConflict,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe@example.com' for key 'users.email'"})
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Create Validate Error",
+			Method:       http.MethodPost,
+			Path:         basePath + "/create",
+			Body:         mocks.ValidateError,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Search Success",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search?username=johndoe",
+			Auth:         true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+			},
+		},
+		{
+			Name:         "Search With API Key",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search?username=johndoe",
+			APIKey:       apiKey,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				authenticateKey(`["users:read"]`)
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+			},
+		},
+		{
+			Name:         "Search With API Key Missing Scope",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search?username=johndoe",
+			APIKey:       apiKey,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() { authenticateKey(`["jobs"]`) },
+		},
+		{
+			Name:         "Search With Invalid API Key",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search?username=johndoe",
+			APIKey:       "not-a-key",
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Create API Key",
+			Method:       http.MethodPost,
+			Path:         basePath + "/me/api-keys",
+			Body:         `{"name":"ci","scopes":["users:read"]}`,
+			Auth:         true,
+			ExpectedCode: http.StatusCreated,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateAPIKeyTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Create API Key With API Key",
+			Method:       http.MethodPost,
+			Path:         basePath + "/me/api-keys",
+			Body:         `{"name":"ci","scopes":["users:read"]}`,
+			APIKey:       apiKey,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() { authenticateKey(`["users:read","users:write"]`) },
+		},
+		{
+			Name:         "Revoke Unknown API Key",
+			Method:       http.MethodDelete,
+			Path:         basePath + "/me/api-keys/key-2",
+			Route:        basePath + "/me/api-keys/{id}",
+			Auth:         true,
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RevokeAPIKeyTestQuery).WithArgs(sqlmock.AnyArg(), "key-2", "johndoe").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "List Own Sessions",
+			Method:       http.MethodGet,
+			Path:         basePath + "/me/sessions",
+			Session:      true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetSessionTestQuery).WithArgs("session-1", 1).WillReturnRows(sessionRows(nil))
+				mock.ExpectQuery(config.ListSessionsTestQuery).WithArgs(sqlmock.AnyArg(), "johndoe").WillReturnRows(sessionRows(nil))
+			},
+		},
+		{
+			Name:         "Ended Session",
+			Method:       http.MethodGet,
+			Path:         basePath + "/me/sessions",
+			Session:      true,
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetSessionTestQuery).WithArgs("session-1", 1).WillReturnRows(sessionRows(time.Now()))
+			},
+		},
+		{
+			Name:         "End Other Sessions",
+			Method:       http.MethodDelete,
+			Path:         basePath + "/me/sessions",
+			Session:      true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.GetSessionTestQuery).WithArgs("session-1", 1).WillReturnRows(sessionRows(nil))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndOtherSessionsTestQuery).WithArgs(sqlmock.AnyArg(), "johndoe", "session-1").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "End Unknown Session",
+			Method:       http.MethodDelete,
+			Path:         basePath + "/me/sessions/session-2",
+			Route:        basePath + "/me/sessions/{id}",
+			Auth:         true,
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndSessionTestQuery).WithArgs(sqlmock.AnyArg(), "session-2", "johndoe").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Request Own Erasure",
+			Method:       http.MethodPost,
+			Path:         basePath + "/me/erasure",
+			Auth:         true,
+			ExpectedCode: http.StatusAccepted,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+				mock.ExpectQuery(config.PendingErasureTestQuery).WithArgs("1", models.ErasurePending, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.CreateErasureTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Cancel Own Erasure Not Pending",
+			Method:       http.MethodDelete,
+			Path:         basePath + "/me/erasure",
+			Auth:         true,
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+				mock.ExpectQuery(config.PendingErasureTestQuery).WithArgs("1", models.ErasurePending, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			Name:         "Search Missing Token",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search?username=johndoe",
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Search Invalid Query Param",
+			Method:       http.MethodGet,
+			Path:         basePath + "/search",
+			Auth:         true,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Update Success",
+			Method:       http.MethodPatch,
+			Path:         basePath + "/update?username=johndoe",
+			Body:         mocks.UpdateUser,
+			Auth:         true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+				mock.ExpectExec(config.UpdateTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:         "Delete Error",
+			Method:       http.MethodDelete,
+			Path:         basePath + "/delete?username=johndoe",
+			Auth:         true,
+			ExpectedCode: http.StatusInternalServerError,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteTestQuery).WithArgs("johndoe").WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "Change Password Invalid Body",
+			Method:       http.MethodPatch,
+			Path:         basePath + "/change-password",
+			Body:         mocks.InvalidBody,
+			Auth:         true,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Import Forbidden",
+			Method:       http.MethodPost,
+			Path:         basePath + "/admin/users/import?format=csv",
+			Body:         "username\njohndoe\n",
+			Auth:         true,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Export Forbidden",
+			Method:       http.MethodGet,
+			Path:         basePath + "/admin/users/export",
+			Auth:         true,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Jobs Forbidden",
+			Method:       http.MethodPost,
+			Path:         basePath + "/jobs",
+			Body:         `{"type":"disable","params":{"role":"user"}}`,
+			Auth:         true,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "SCIM Missing Token",
+			Method:       http.MethodGet,
+			Path:         basePath + "/scim/v2/Users",
+			Auth:         true,
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "SCIM Service Provider Config",
+			Method:       http.MethodGet,
+			Path:         basePath + "/scim/v2/ServiceProviderConfig",
+			SCIM:         true,
+			ExpectedCode: http.StatusOK,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "SCIM List Filtered",
+			Method:       http.MethodGet,
+			Path:         basePath + `/scim/v2/Users?filter=userName+eq+"johndoe"`,
+			SCIM:         true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).WithArgs("johndoe", 1).WillReturnRows(userRows())
+			},
+		},
+		{
+			Name:         "SCIM Unsupported Filter",
+			Method:       http.MethodGet,
+			Path:         basePath + `/scim/v2/Users?filter=emails+co+"example"`,
+			SCIM:         true,
+			ExpectedCode: http.StatusBadRequest,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "SCIM Get User",
+			Method:       http.MethodGet,
+			Path:         basePath + "/scim/v2/Users/1",
+			Route:        basePath + "/scim/v2/Users/{id}",
+			SCIM:         true,
+			ExpectedCode: http.StatusOK,
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("1", 1).WillReturnRows(userRows())
+			},
+		},
+		{
+			Name:         "SCIM Patch Not Found",
+			Method:       http.MethodPatch,
+			Path:         basePath + "/scim/v2/Users/2",
+			Route:        basePath + "/scim/v2/Users/{id}",
+			Body:         `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","path":"active","value":false}]}`,
+			SCIM:         true,
+			ExpectedCode: http.StatusNotFound,
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchByIDTestQuery).WithArgs("2", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:         "OIDC Discovery",
+			Method:       http.MethodGet,
+			Path:         basePath + oidc.DiscoveryPath,
+			ExpectedCode: http.StatusOK,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "OIDC Key Set",
+			Method:       http.MethodGet,
+			Path:         basePath + oidc.Prefix + "/jwks",
+			ExpectedCode: http.StatusOK,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "OIDC Token Without Client",
+			Method:       http.MethodPost,
+			Path:         basePath + oidc.Prefix + "/token",
+			Body:         "grant_type=authorization_code&code=abc",
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "OIDC User Info Without Token",
+			Method:       http.MethodGet,
+			Path:         basePath + oidc.Prefix + "/userinfo",
+			ExpectedCode: http.StatusUnauthorized,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "OIDC Clients Forbidden",
+			Method:       http.MethodGet,
+			Path:         basePath + "/admin/oauth/clients",
+			Auth:         true,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Federated Providers Disabled",
+			Method:       http.MethodGet,
+			Path:         basePath + "/login/providers",
+			ExpectedCode: http.StatusNotFound,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Federated Callback Disabled",
+			Method:       http.MethodGet,
+			Path:         basePath + "/login/corp/callback?code=abc&state=xyz",
+			Route:        basePath + "/login/{provider}/callback",
+			ExpectedCode: http.StatusNotFound,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Liveness",
+			Method:       http.MethodGet,
+			Path:         docs.LivenessPath,
+			ExpectedCode: http.StatusOK,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Readiness",
+			Method:       http.MethodGet,
+			Path:         docs.ReadinessPath,
+			ExpectedCode: http.StatusOK,
+			MockAct:      func() {},
+		},
+		{
+			Name:         "Health Details Forbidden",
+			Method:       http.MethodGet,
+			Path:         docs.HealthDetailsPath,
+			Auth:         true,
+			ExpectedCode: http.StatusForbidden,
+			MockAct:      func() {},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			// scim routes only take the scim token, a user token is not checked
+			if tt.Auth && !strings.Contains(tt.Path, "/scim/") {
+				mock.ExpectQuery(config.GetSessionTestQuery).WithArgs("session-auth", 1).WillReturnRows(sessionRows(nil))
+			}
+			tt.MockAct()
+
+			req := httptest.NewRequest(tt.Method, tt.Path, bytes.NewBufferString(tt.Body))
+			if tt.Auth {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tt.Session {
+				req.Header.Set("Authorization", "Bearer "+sessionToken)
+			}
+			if tt.SCIM {
+				req.Header.Set("Authorization", "Bearer "+config.Current().SCIM.Token)
+			}
+			if tt.APIKey != "" {
+				req.Header.Set("X-API-Key", tt.APIKey)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.ExpectedCode, w.Code)
+
+			path := strings.SplitN(tt.Path, "?", 2)[0]
+			if tt.Route != "" {
+				path = tt.Route
+			}
+			op, ok := spec.Operation(tt.Method, path)
+			if !assert.True(t, ok, "operation %s %s not documented", tt.Method, path) {
+				return
+			}
+
+			response, ok := op.Responses[strconv.Itoa(w.Code)]
+			if !assert.True(t, ok, "status %d of %s is not documented", w.Code, op.OperationID) {
+				return
+			}
+
+			mediaType := strings.TrimSpace(strings.SplitN(w.Header().Get("Content-Type"), ";", 2)[0])
+			media, ok := response.Content[mediaType]
+			if !assert.True(t, ok, "%s %d does not document a %s body", op.OperationID, w.Code, mediaType) {
+				return
+			}
+
+			var body interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Empty(t, validate(spec, media.Schema, body, "body"))
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// validate reports every place where value does not match schema.
+func validate(doc *docs.Document, schema *docs.Schema, value interface{}, at string) []string {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		name := schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+		return validate(doc, doc.Components.Schemas[name], value, at)
+	}
+	if len(schema.OneOf) > 0 {
+		for _, option := range schema.OneOf {
+			if len(validate(doc, option, value, at)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: matches none of the oneOf schemas", at)}
+	}
+
+	var problems []string
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", at, value)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := schema.Properties[key]; ok {
+				if prop.WriteOnly {
+					problems = append(problems, fmt.Sprintf("%s: write only property %q returned", at, key))
+				}
+				problems = append(problems, validate(doc, prop, obj[key], at+"."+key)...)
+			} else if schema.AdditionalProperties != nil {
+				problems = append(problems, validate(doc, schema.AdditionalProperties, obj[key], at+"."+key)...)
+			} else if schema.Properties != nil {
+				problems = append(problems, fmt.Sprintf("%s: undocumented property %q", at, key))
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", at, value)}
+		}
+		for i, item := range list {
+			problems = append(problems, validate(doc, schema.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected string, got %T", at, value))
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%s: expected integer, got %v", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected number, got %T", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected boolean, got %T", at, value))
+		}
+	}
+	return problems
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.Current()
+	cfg.RateLimit.Policies = []string{"POST /login 1/1m"}
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+
+	r, _ := testRouter(t)
+	basePath := config.Current().Server.BasePath
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, basePath+"/login", strings.NewReader(mocks.InvalidBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, login().Code)
+	w := login()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	op, _ := docs.Spec(basePath).Operation(http.MethodPost, basePath+"/login")
+	assert.Contains(t, op.Responses, strconv.Itoa(http.StatusTooManyRequests))
+	assert.Contains(t, op.Responses[strconv.Itoa(http.StatusTooManyRequests)].Headers, "Retry-After")
+}
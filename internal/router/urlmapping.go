@@ -2,30 +2,203 @@ package router
 
 import (
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/apikey"
+	"go-manage-mysql/internal/docs"
 	"go-manage-mysql/internal/handlers"
+	"go-manage-mysql/internal/jobs"
+	"go-manage-mysql/internal/metrics"
 	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/oidc"
+	"go-manage-mysql/internal/privacy"
 	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/scim"
 	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/session"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func UrlMapping(r *gin.Engine, conn *gorm.DB) {
-	api := r.Group(config.BaseURL)
+func UrlMapping(r *gin.Engine, deps Dependencies) {
+	basePath := config.Current().Server.BasePath
 
-	repo := repository.NewUserRepository(conn)
-	service := services.NewUserServices(repo)
+	r.GET(docs.SpecPath, docs.SpecHandler(basePath))
+	r.GET(docs.UIPath, docs.UIHandler)
+	r.GET(docs.MetricsPath, metrics.Handler())
+
+	service := UserServices(deps)
 	handler := handlers.NewUserHandler(service)
 
+	// tokens issued at login die with their session
+	sessions := session.NewService(repository.NewSessionRepository(deps.DB), config.GetTokenValidTime())
+	sessionHandler := handlers.NewSessionHandler(sessions)
+	handler.Sessions = sessions
+
+	// integrations call the protected routes with an api key instead of a JWT
+	keys := apikey.NewService(repository.NewAPIKeyRepository(deps.DB), service, config.Current().APIKeys)
+	keyHandler := handlers.NewAPIKeyHandler(keys)
+	// policies keyed by user or api key need the request authenticated
+	authenticate := []gin.HandlerFunc{middleware.Authenticate(middleware.JWT{Sessions: sessions}, keys), deps.RateLimit.ByPrincipal()}
+
+	healthHandler := handlers.NewHealthHandler(deps.Health)
+	r.GET(docs.LivenessPath, healthHandler.LivenessHandler)
+	r.GET(docs.ReadinessPath, healthHandler.ReadinessHandler)
+	r.GET(docs.HealthDetailsPath, append(authenticate, middleware.RequirePasswordChanged(), middleware.RequireAdmin(),
+		middleware.RequireScope(apikey.ScopeHealth), healthHandler.DetailsHandler)...)
+
+	api := r.Group(basePath)
+
+	manager := deps.Jobs
+	if manager == nil {
+		manager = jobs.NewManager(repository.NewJobRepository(deps.DB), service, config.Current().Jobs)
+	}
+	jobHandler := handlers.NewJobHandler(manager)
+
+	privacyService := deps.Privacy
+	if privacyService == nil {
+		privacyService = privacy.NewService(repository.NewPrivacyRepository(deps.DB), service, config.Current().Privacy)
+	}
+	privacyHandler := handlers.NewPrivacyHandler(privacyService)
+
 	api.POST("/login", handler.LoginUserHandler)
+
+	// users coming back from an identity provider carry no JWT yet
+	federationHandler := handlers.NewFederationHandler(deps.Federation)
+	federationHandler.Sessions = sessions
+	federated := api.Group("/login")
+	federated.Use(federationHandler.RequireEnabled)
+
+	federated.GET("/providers", federationHandler.ProvidersHandler)
+	federated.GET("/:provider", federationHandler.BeginHandler)
+	federated.GET("/:provider/callback", federationHandler.CallbackHandler)
+
 	api.POST("/create", handler.CreateUserHandler)
 
 	protected := api.Group("/")
-	protected.Use(middleware.JWTMiddleware())
+	protected.Use(authenticate...)
+
+	protected.PATCH("/change-password", middleware.RequireUserToken(), handler.ChangePwdHandler)
+
+	// everything else is closed until a one-time password is replaced
+	active := protected.Group("/")
+	active.Use(middleware.RequirePasswordChanged())
+
+	active.GET("/search", middleware.RequireScope(apikey.ScopeUsersRead), handler.SearchUserHandler)
+	active.PATCH("/update", middleware.RequireScope(apikey.ScopeUsersWrite), handler.UpdateUserHandler)
+	active.DELETE("/delete", middleware.RequireScope(apikey.ScopeUsersWrite), handler.DeleteUserHandler)
+
+	// a key cannot mint or revoke keys
+	ownKeys := active.Group("/me/api-keys")
+	ownKeys.Use(middleware.RequireUserToken())
+
+	ownKeys.POST("", keyHandler.CreateOwnKeyHandler)
+	ownKeys.GET("", keyHandler.ListOwnKeysHandler)
+	ownKeys.DELETE("/:id", keyHandler.RevokeOwnKeyHandler)
+
+	ownSessions := active.Group("/me/sessions")
+	ownSessions.Use(middleware.RequireUserToken())
+
+	ownSessions.GET("", sessionHandler.ListOwnSessionsHandler)
+	ownSessions.DELETE("", sessionHandler.EndOtherSessionsHandler)
+	ownSessions.DELETE("/:id", sessionHandler.EndOwnSessionHandler)
+
+	// only the user in person can take out or erase its data
+	ownData := active.Group("/me")
+	ownData.Use(middleware.RequireUserToken())
+
+	ownData.GET("/export", privacyHandler.ExportOwnDataHandler)
+	ownData.POST("/erasure", privacyHandler.RequestOwnErasureHandler)
+	ownData.GET("/erasure", privacyHandler.FindOwnErasureHandler)
+	ownData.DELETE("/erasure", privacyHandler.CancelOwnErasureHandler)
+
+	admin := active.Group("/admin")
+	admin.Use(middleware.RequireAdmin())
+
+	admin.POST("/users/import", middleware.RequireScope(apikey.ScopeUsersWrite), handler.ImportUsersHandler)
+	admin.GET("/users/export", middleware.RequireScope(apikey.ScopeUsersRead), handler.ExportUsersHandler)
+
+	adminKeys := admin.Group("/api-keys")
+	adminKeys.Use(middleware.RequireUserToken())
+
+	adminKeys.POST("", keyHandler.CreateKeyHandler)
+	adminKeys.GET("", keyHandler.ListKeysHandler)
+	adminKeys.DELETE("/:id", keyHandler.RevokeKeyHandler)
+
+	adminSessions := admin.Group("/sessions")
+	adminSessions.Use(middleware.RequireUserToken())
+
+	adminSessions.GET("", sessionHandler.ListSessionsHandler)
+	adminSessions.DELETE("/:id", sessionHandler.EndSessionHandler)
+
+	erasures := admin.Group("/erasures")
+	erasures.Use(middleware.RequireUserToken())
+
+	erasures.POST("", privacyHandler.RequestErasureHandler)
+	erasures.GET("", privacyHandler.ListErasuresHandler)
+	erasures.GET("/:id", privacyHandler.FindErasureHandler)
+	erasures.DELETE("/:id", privacyHandler.CancelErasureHandler)
+
+	oidcHandler := handlers.NewOIDCHandler(deps.OIDC)
+	clients := admin.Group("/oauth/clients")
+	clients.Use(oidcHandler.RequireEnabled, middleware.RequireScope(apikey.ScopeClients))
+
+	clients.POST("", oidcHandler.RegisterClientHandler)
+	clients.GET("", oidcHandler.ListClientsHandler)
+	clients.DELETE("/:id", oidcHandler.DeleteClientHandler)
+
+	jobsGroup := active.Group("/jobs")
+	jobsGroup.Use(middleware.RequireAdmin(), middleware.RequireScope(apikey.ScopeJobs))
+
+	jobsGroup.POST("", jobHandler.SubmitJobHandler)
+	jobsGroup.GET("/:id", jobHandler.SearchJobHandler)
+	jobsGroup.DELETE("/:id", jobHandler.CancelJobHandler)
+
+	// identity providers authenticate with their own token, not a user JWT
+	scimHandler := handlers.NewSCIMHandler(service)
+	scimGroup := api.Group(scim.Prefix)
+	scimGroup.Use(middleware.RequireSCIMToken())
+
+	scimGroup.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfigHandler)
+	scimGroup.GET("/Users", scimHandler.ListSCIMUsersHandler)
+	scimGroup.POST("/Users", scimHandler.CreateSCIMUserHandler)
+	scimGroup.GET("/Users/:id", scimHandler.GetSCIMUserHandler)
+	scimGroup.PUT("/Users/:id", scimHandler.ReplaceSCIMUserHandler)
+	scimGroup.PATCH("/Users/:id", scimHandler.PatchSCIMUserHandler)
+	scimGroup.DELETE("/Users/:id", scimHandler.DeleteSCIMUserHandler)
+
+	// relying parties authenticate with their client credentials or tokens
+	api.GET(oidc.DiscoveryPath, oidcHandler.RequireEnabled, oidcHandler.DiscoveryHandler)
+	oauth := api.Group(oidc.Prefix)
+	oauth.Use(oidcHandler.RequireEnabled)
+
+	oauth.GET("/authorize", oidcHandler.AuthorizeHandler)
+	oauth.POST("/authorize", oidcHandler.ApproveHandler)
+	oauth.POST("/token", oidcHandler.TokenHandler)
+	oauth.GET("/userinfo", oidcHandler.UserInfoHandler)
+	oauth.POST("/userinfo", oidcHandler.UserInfoHandler)
+	oauth.GET("/jwks", oidcHandler.KeySetHandler)
+	oauth.POST("/introspect", oidcHandler.IntrospectHandler)
+	oauth.POST("/revoke", oidcHandler.RevokeHandler)
+}
 
-	protected.GET("/search", handler.SearchUserHandler)
-	protected.PATCH("/update", handler.UpdateUserHandler)
-	protected.DELETE("/delete", handler.DeleteUserHandler)
-	protected.PATCH("/change-password", handler.ChangePwdHandler)
+// UserServices builds the user services over the database, the replicas and
+// the cache present in deps.
+func UserServices(deps Dependencies) *services.Services {
+	repo := repository.NewUserRepository(deps.DB)
+	if deps.DBRouter != nil {
+		repo = repository.NewRoutedUserRepository(deps.DBRouter)
+	}
+	repo.Cipher = deps.Cipher
+	var users repository.UserRepository = repo
+	if deps.Cache != nil {
+		cacheCfg := config.Current().Cache
+		cached := repository.NewCachedRepository(repo, deps.Cache, cacheCfg.TTL, cacheCfg.NegativeTTL)
+		cached.Cipher = deps.Cipher
+		users = cached
+	}
+	s := services.NewUserServices(users)
+	if deps.Passwords != nil {
+		s.Passwords = deps.Passwords
+	}
+	s.Sessions = repository.NewSessionRepository(deps.DB)
+	return s
 }
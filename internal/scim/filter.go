@@ -0,0 +1,24 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+// attribute names and operators are case insensitive
+var filterPattern = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// ParseFilter returns the username of a `userName eq "value"` filter, the only
+// one supported.
+func ParseFilter(filter string) (string, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", NewError(http.StatusBadRequest, InvalidFilter, `only userName eq "value" filters are supported`)
+	}
+	var username string
+	if err := json.Unmarshal([]byte(match[1]), &username); err != nil {
+		return "", NewError(http.StatusBadRequest, InvalidFilter, "invalid string in filter")
+	}
+	return username, nil
+}
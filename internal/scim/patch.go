@@ -0,0 +1,212 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// attributes of the core schema the api does not keep, patching them is a
+// no-op so providers mapping them keep working
+var ignored = map[string]bool{
+	"externalid":        true,
+	"displayname":       true,
+	"nickname":          true,
+	"title":             true,
+	"usertype":          true,
+	"preferredlanguage": true,
+	"locale":            true,
+	"timezone":          true,
+}
+
+// Patch applies ops to r in order.
+func (r *User) Patch(ops []PatchOperation) error {
+	for _, op := range ops {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if len(op.Value) == 0 {
+				return NewError(http.StatusBadRequest, InvalidValue, op.Op+" requires a value")
+			}
+			if op.Path == "" {
+				if err := r.merge(op.Value); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.set(op.Path, op.Value); err != nil {
+				return err
+			}
+		case "remove":
+			if op.Path == "" {
+				return NewError(http.StatusBadRequest, NoTarget, "remove requires a path")
+			}
+			if err := r.set(op.Path, nil); err != nil {
+				return err
+			}
+		default:
+			return NewError(http.StatusBadRequest, InvalidSyntax, fmt.Sprintf("unknown op %q", op.Op))
+		}
+	}
+	return nil
+}
+
+// merge sets every attribute of value, as an operation without path does.
+func (r *User) merge(value json.RawMessage) error {
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(value, &attrs); err != nil {
+		return NewError(http.StatusBadRequest, InvalidValue, "an operation without path takes an object")
+	}
+	paths := make([]string, 0, len(attrs))
+	for path := range attrs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := r.set(path, attrs[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets the attribute at path, a nil value removes it.
+func (r *User) set(path string, value json.RawMessage) error {
+	attr, sub := splitPath(path)
+	switch {
+	case attr == "username" && sub == "":
+		return decode(value, &r.UserName, path)
+	case attr == "name" && sub == "":
+		return decode(value, &r.Name, path)
+	case attr == "name" && sub == "givenname":
+		return decode(value, &r.Name.GivenName, path)
+	case attr == "name" && sub == "familyname":
+		return decode(value, &r.Name.FamilyName, path)
+	case attr == "name" && sub == "formatted":
+		return nil
+	case attr == "emails":
+		return setMultiValue(&r.Emails, sub, value, path)
+	case attr == "phonenumbers":
+		return setMultiValue(&r.PhoneNumbers, sub, value, path)
+	case attr == "active" && sub == "":
+		return decodeActive(value, &r.Active)
+	case attr == "password" && sub == "":
+		return decode(value, &r.Password, path)
+	case ignored[attr], strings.HasPrefix(attr, "urn:"):
+		return nil
+	}
+	return NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("unsupported path %q", path))
+}
+
+// splitPath lowercases path and splits it into attribute and sub-attribute.
+// A value filter is dropped, there is a single value to pick.
+func splitPath(path string) (attr, sub string) {
+	path = strings.ToLower(path)
+	if rest, ok := strings.CutPrefix(path, strings.ToLower(UserSchema)+":"); ok {
+		path = rest
+	}
+	if strings.HasPrefix(path, "urn:") {
+		return path, ""
+	}
+	if open, end := strings.Index(path, "["), strings.Index(path, "]"); open >= 0 && end > open {
+		path = path[:open] + path[end+1:]
+	}
+	attr, sub, _ = strings.Cut(path, ".")
+	return attr, sub
+}
+
+func setMultiValue(values *[]MultiValue, sub string, value json.RawMessage, path string) error {
+	switch sub {
+	case "":
+		if value == nil {
+			*values = nil
+			return nil
+		}
+		// a single object is taken as a list of one
+		var list []MultiValue
+		if err := json.Unmarshal(value, &list); err != nil {
+			var single MultiValue
+			if json.Unmarshal(value, &single) != nil {
+				return invalidValue(path)
+			}
+			list = []MultiValue{single}
+		}
+		*values = list
+		return nil
+	case "value":
+		var v string
+		if err := decode(value, &v, path); err != nil {
+			return err
+		}
+		if v == "" {
+			*values = nil
+			return nil
+		}
+		if len(*values) == 0 {
+			*values = []MultiValue{{Value: v, Type: "work", Primary: true}}
+			return nil
+		}
+		for i := range *values {
+			if (*values)[i].Primary {
+				(*values)[i].Value = v
+				return nil
+			}
+		}
+		(*values)[0].Value = v
+		return nil
+	case "type", "primary", "display":
+		return nil
+	}
+	return NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("unsupported path %q", path))
+}
+
+func decode[T any](value json.RawMessage, target *T, path string) error {
+	if value == nil {
+		var zero T
+		*target = zero
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return invalidValue(path)
+	}
+	return nil
+}
+
+// decodeActive also takes "True" and "False" strings, as some providers send.
+func decodeActive(value json.RawMessage, active **bool) error {
+	if value == nil {
+		*active = nil
+		return nil
+	}
+	var b bool
+	if err := json.Unmarshal(value, &b); err != nil {
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			return invalidValue("active")
+		}
+		parsed, parseErr := strconv.ParseBool(s)
+		if parseErr != nil {
+			return invalidValue("active")
+		}
+		b = parsed
+	}
+	*active = &b
+	return nil
+}
+
+func invalidValue(path string) error {
+	return NewError(http.StatusBadRequest, InvalidValue, fmt.Sprintf("invalid value for %q", path))
+}
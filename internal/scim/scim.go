@@ -0,0 +1,222 @@
+// Package scim describes users as SCIM 2.0 resources (RFC 7643) and reads
+// the filters and patches of the protocol (RFC 7644) the api supports.
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go-manage-mysql/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ContentType = "application/scim+json"
+	// Prefix is where the endpoints live, under the api base path
+	Prefix = "/scim/v2"
+
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ListSchema                  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchSchema                 = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	UserResourceType = "User"
+)
+
+// scimType of an Error
+const (
+	InvalidFilter = "invalidFilter"
+	InvalidSyntax = "invalidSyntax"
+	InvalidPath   = "invalidPath"
+	InvalidValue  = "invalidValue"
+	NoTarget      = "noTarget"
+	Mutability    = "mutability"
+	Uniqueness    = "uniqueness"
+)
+
+// User is the core user resource. The api keeps a single email and phone,
+// the primary value or else the first one.
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         Name         `json:"name"`
+	DisplayName  string       `json:"displayName,omitempty"`
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	// Active defaults to true
+	Active *bool `json:"active,omitempty"`
+	// Password is write only
+	Password string `json:"password,omitempty"`
+	Meta     *Meta  `json:"meta,omitempty"`
+}
+
+type Name struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+	Formatted  string `json:"formatted,omitempty"`
+}
+
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// NewUser describes user as the resource found at location.
+func NewUser(user models.User, location string) User {
+	active := !user.Disabled
+	formatted := strings.TrimSpace(user.Name + " " + user.Surname)
+	return User{
+		Schemas:      []string{UserSchema},
+		ID:           user.ID,
+		UserName:     user.Username,
+		Name:         Name{GivenName: user.Name, FamilyName: user.Surname, Formatted: formatted},
+		DisplayName:  formatted,
+		Emails:       []MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		PhoneNumbers: []MultiValue{{Value: user.Phone, Type: "work", Primary: true}},
+		Active:       &active,
+		Meta:         &Meta{ResourceType: UserResourceType, Location: location, Version: Version(user)},
+	}
+}
+
+// Apply copies the attributes of r the api stores onto user. The password and
+// the disabled state only change when r carries them.
+func (r User) Apply(user models.User) models.User {
+	user.Username = r.UserName
+	user.Name = r.Name.GivenName
+	user.Surname = r.Name.FamilyName
+	user.Email = primary(r.Emails)
+	user.Phone = primary(r.PhoneNumbers)
+	if r.Active != nil {
+		user.Disabled = !*r.Active
+	}
+	if r.Password != "" {
+		user.Password = r.Password
+	}
+	return user
+}
+
+func primary(values []MultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// Version is the weak ETag of user, any stored change gives a new one.
+func Version(user models.User) string {
+	hash := sha256.New()
+	for _, field := range []string{
+		user.ID, user.Username, user.Name, user.Surname, user.Email, user.Phone, user.Password, user.Role,
+		strconv.FormatBool(user.Disabled), strconv.FormatBool(user.MustChangePassword),
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+}
+
+// Matches reports whether an If-Match or If-None-Match header accepts version.
+func Matches(header, version string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == version || "W/"+tag == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Error is the body of a failed request and the error behind it.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{Schemas: []string{ErrorSchema}, Status: strconv.Itoa(status), ScimType: scimType, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) StatusCode() int {
+	status, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ServiceProviderConfig tells identity providers what the api supports.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	ETag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+}
+
+func NewServiceProviderConfig(maxResults int) ServiceProviderConfig {
+	return ServiceProviderConfig{
+		Schemas:        []string{ServiceProviderConfigSchema},
+		Patch:          Supported{Supported: true},
+		Filter:         FilterSupport{Supported: true, MaxResults: maxResults},
+		ChangePassword: Supported{Supported: true},
+		ETag:           Supported{Supported: true},
+		AuthenticationSchemes: []AuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "The SCIM token of the api, distinct from user JWTs.",
+		}},
+	}
+}
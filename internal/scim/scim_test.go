@@ -0,0 +1,182 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"go-manage-mysql/internal/models"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var john = models.User{
+	ID:       "1",
+	Name:     "John",
+	Surname:  "Doe",
+	Username: "johndoe",
+	Phone:    "123456",
+	Email:    "john@example.com",
+	Password: "hash",
+	Role:     models.RoleUser,
+}
+
+func TestParseFilter(t *testing.T) {
+	test := []struct {
+		Name             string
+		Filter           string
+		ExpectedUsername string
+		ExpectedErr      bool
+	}{
+		{Name: "Equal", Filter: `userName eq "johndoe"`, ExpectedUsername: "johndoe"},
+		{Name: "Case Insensitive", Filter: `  USERNAME Eq "john.doe@example.com" `, ExpectedUsername: "john.doe@example.com"},
+		{Name: "Escaped Quote", Filter: `userName eq "jo\"hn"`, ExpectedUsername: `jo"hn`},
+		{Name: "Other Operator", Filter: `userName co "john"`, ExpectedErr: true},
+		{Name: "Other Attribute", Filter: `emails.value eq "john@example.com"`, ExpectedErr: true},
+		{Name: "Combined", Filter: `userName eq "john" and active eq true`, ExpectedErr: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			username, err := ParseFilter(tt.Filter)
+
+			if tt.ExpectedErr {
+				var scimErr *Error
+				assert.True(t, errors.As(err, &scimErr))
+				assert.Equal(t, InvalidFilter, scimErr.ScimType)
+				assert.Equal(t, http.StatusBadRequest, scimErr.StatusCode())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ExpectedUsername, username)
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	test := []struct {
+		Name             string
+		Operations       string
+		Expected         func(user models.User) models.User
+		ExpectedScimType string
+	}{
+		{
+			Name:       "Replace Active",
+			Operations: `[{"op":"replace","path":"active","value":false}]`,
+			Expected: func(user models.User) models.User {
+				user.Disabled = true
+				return user
+			},
+		},
+		{
+			Name:       "Active As String",
+			Operations: `[{"op":"Replace","path":"active","value":"False"}]`,
+			Expected: func(user models.User) models.User {
+				user.Disabled = true
+				return user
+			},
+		},
+		{
+			Name:       "Without Path",
+			Operations: `[{"op":"replace","value":{"name.givenName":"Johnny","emails":[{"value":"johnny@example.com","primary":true}],"externalId":"x1"}}]`,
+			Expected: func(user models.User) models.User {
+				user.Name = "Johnny"
+				user.Email = "johnny@example.com"
+				return user
+			},
+		},
+		{
+			Name:       "Value Filter",
+			Operations: `[{"op":"replace","path":"phoneNumbers[type eq \"work\"].value","value":"654321"}]`,
+			Expected: func(user models.User) models.User {
+				user.Phone = "654321"
+				return user
+			},
+		},
+		{
+			Name:       "Qualified Path And Extension",
+			Operations: `[{"op":"add","path":"urn:ietf:params:scim:schemas:core:2.0:User:name.familyName","value":"Smith"},{"op":"add","path":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department","value":"it"}]`,
+			Expected: func(user models.User) models.User {
+				user.Surname = "Smith"
+				return user
+			},
+		},
+		{
+			Name:       "Password",
+			Operations: `[{"op":"replace","path":"password","value":"Password9876"}]`,
+			Expected: func(user models.User) models.User {
+				user.Password = "Password9876"
+				return user
+			},
+		},
+		{
+			Name:       "Remove Email",
+			Operations: `[{"op":"remove","path":"emails"}]`,
+			Expected: func(user models.User) models.User {
+				user.Email = ""
+				return user
+			},
+		},
+		{
+			Name:             "Unknown Path",
+			Operations:       `[{"op":"replace","path":"roles","value":"admin"}]`,
+			ExpectedScimType: InvalidPath,
+		},
+		{
+			Name:             "Unknown Op",
+			Operations:       `[{"op":"move","path":"active"}]`,
+			ExpectedScimType: InvalidSyntax,
+		},
+		{
+			Name:             "Remove Without Path",
+			Operations:       `[{"op":"remove"}]`,
+			ExpectedScimType: NoTarget,
+		},
+		{
+			Name:             "Wrong Type",
+			Operations:       `[{"op":"replace","path":"name.givenName","value":7}]`,
+			ExpectedScimType: InvalidValue,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			var ops []PatchOperation
+			assert.NoError(t, json.Unmarshal([]byte(tt.Operations), &ops))
+
+			resource := NewUser(john, "")
+			err := resource.Patch(ops)
+
+			if tt.ExpectedScimType != "" {
+				var scimErr *Error
+				assert.True(t, errors.As(err, &scimErr))
+				assert.Equal(t, tt.ExpectedScimType, scimErr.ScimType)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Expected(john), resource.Apply(john))
+		})
+	}
+}
+
+func TestNewUser(t *testing.T) {
+	resource := NewUser(john, "http://example.com/scim/v2/Users/1")
+
+	assert.Equal(t, john, resource.Apply(models.User{ID: "1", Password: "hash", Role: models.RoleUser}))
+	assert.Empty(t, resource.Password)
+	assert.Equal(t, "John Doe", resource.DisplayName)
+	assert.Equal(t, Version(john), resource.Meta.Version)
+}
+
+func TestVersion(t *testing.T) {
+	version := Version(john)
+	disabled := john
+	disabled.Disabled = true
+
+	assert.NotEqual(t, version, Version(disabled))
+	assert.True(t, Matches(version, version))
+	assert.True(t, Matches(`"other", `+version, version))
+	assert.True(t, Matches(version[2:], version))
+	assert.True(t, Matches("*", version))
+	assert.False(t, Matches(Version(disabled), version))
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Worker is a background task that must return once ctx is cancelled.
+type Worker func(ctx context.Context)
+
+// Hook runs during shutdown, after in-flight requests have been drained.
+type Hook func(ctx context.Context) error
+
+type Server struct {
+	HTTP *http.Server
+
+	cfg      config.ServerConfig
+	certs    *certReloader
+	workers  []namedWorker
+	starting []func()
+	closers  []namedHook
+}
+
+type namedWorker struct {
+	name    string
+	run     Worker
+	running *atomic.Bool
+}
+
+type namedHook struct {
+	name string
+	run  Hook
+}
+
+func New(cfg config.ServerConfig, handler http.Handler) (*Server, error) {
+	srv := &Server{
+		cfg: cfg,
+		HTTP: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		},
+	}
+
+	if cfg.TLSEnabled() {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.certs = certs
+		srv.HTTP.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		srv.Go("tls-reloader", func(ctx context.Context) {
+			certs.Watch(ctx, cfg.TLSReloadInterval)
+		})
+	}
+
+	return srv, nil
+}
+
+// Go registers a background worker started with the server and stopped on shutdown.
+func (s *Server) Go(name string, worker Worker) {
+	s.workers = append(s.workers, namedWorker{name: name, run: worker, running: &atomic.Bool{}})
+}
+
+// WorkersCheck fails when any registered worker is not running.
+func (s *Server) WorkersCheck(ctx context.Context) error {
+	var stopped []string
+	for _, w := range s.workers {
+		if !w.running.Load() {
+			stopped = append(stopped, w.name)
+		}
+	}
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return fmt.Errorf("background workers not running: %s", strings.Join(stopped, ", "))
+	}
+	return nil
+}
+
+// OnShutdownStart registers a callback invoked as soon as shutdown begins,
+// before connections are drained.
+func (s *Server) OnShutdownStart(fn func()) {
+	s.starting = append(s.starting, fn)
+}
+
+// OnShutdown registers a hook run after requests are drained and workers stopped.
+// Hooks run in reverse registration order, like defers.
+func (s *Server) OnShutdown(name string, hook Hook) {
+	s.closers = append(s.closers, namedHook{name: name, run: hook})
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", s.cfg.Addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled, then shuts down gracefully.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	for _, w := range s.workers {
+		workers.Add(1)
+		w.running.Store(true)
+		go func(w namedWorker) {
+			defer workers.Done()
+			defer w.running.Store(false)
+			w.run(workerCtx)
+		}(w)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.certs != nil {
+			serveErr <- s.HTTP.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- s.HTTP.Serve(ln)
+	}()
+
+	var runErr error
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			runErr = fmt.Errorf("error serving http: %w", err)
+		}
+	case <-ctx.Done():
+		slog.Info("shutdown signal received, draining connections")
+	}
+
+	return errors.Join(runErr, s.shutdown(stopWorkers, &workers))
+}
+
+func (s *Server) shutdown(stopWorkers context.CancelFunc, workers *sync.WaitGroup) error {
+	for _, fn := range s.starting {
+		fn()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := s.HTTP.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("error draining http connections: %w", err))
+		s.HTTP.Close()
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("background workers did not stop before the shutdown deadline"))
+	}
+
+	// the drain may have used up its deadline, closing gets its own
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), s.cfg.CloseTimeout)
+	defer cancelClose()
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].run(closeCtx); err != nil {
+			errs = append(errs, fmt.Errorf("error running shutdown hook %s: %w", s.closers[i].name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
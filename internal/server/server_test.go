@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go-manage-mysql/cmd/config"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() config.ServerConfig {
+	return config.ServerConfig{
+		Addr:              "127.0.0.1:0",
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: time.Second,
+		WriteTimeout:      time.Second,
+		IdleTimeout:       time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   2 * time.Second,
+		CloseTimeout:      time.Second,
+		TLSReloadInterval: time.Minute,
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv, err := New(testConfig(), handler)
+	assert.NoError(t, err)
+
+	workerStopped := make(chan struct{})
+	srv.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	var order []string
+	srv.OnShutdownStart(func() { order = append(order, "start") })
+	srv.OnShutdown("database", func(ctx context.Context) error {
+		select {
+		case <-workerStopped:
+		default:
+			t.Error("hook ran before workers stopped")
+		}
+		order = append(order, "database")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+
+	assert.Equal(t, http.StatusOK, <-status)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"start", "database"}, order)
+
+	_, err = http.Get("http://" + ln.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	cfg := testConfig()
+	cfg.ShutdownTimeout = 50 * time.Millisecond
+
+	srv, err := New(cfg, http.NotFoundHandler())
+	assert.NoError(t, err)
+	srv.Go("stuck", func(ctx context.Context) {
+		time.Sleep(time.Second)
+	})
+	// hooks still get their own time once the drain is out of it
+	var hookErr error
+	srv.OnShutdown("database", func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorContains(t, srv.Serve(ctx, ln), "did not stop")
+	assert.NoError(t, hookErr)
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, 1)
+
+	cfg := testConfig()
+	cfg.TLSCertFile = certFile
+	cfg.TLSKeyFile = keyFile
+
+	srv, err := New(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	assert.Equal(t, int64(1), servedSerial(t, ln.Addr().String()))
+
+	writeCert(t, certFile, keyFile, 2)
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, future, future))
+	reloaded, err := srv.certs.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+
+	assert.Equal(t, int64(2), servedSerial(t, ln.Addr().String()))
+
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, future.Add(time.Minute), future.Add(time.Minute)))
+	_, err = srv.certs.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), servedSerial(t, ln.Addr().String()))
+}
+
+func servedSerial(t *testing.T, addr string) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkersCheck(t *testing.T) {
+	srv, err := New(testConfig(), http.NotFoundHandler())
+	assert.NoError(t, err)
+
+	exit := make(chan struct{})
+	srv.Go("jobs", func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+		case <-exit:
+		}
+	})
+
+	assert.ErrorContains(t, srv.WorkersCheck(context.Background()), "jobs")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	assert.Eventually(t, func() bool { return srv.WorkersCheck(context.Background()) == nil }, time.Second, 10*time.Millisecond)
+
+	close(exit)
+	assert.Eventually(t, func() bool { return srv.WorkersCheck(context.Background()) != nil }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/metrics"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/password"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+	"go-manage-mysql/internal/utils/validator"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"golang.org/x/sync/errgroup"
+)
+
+// import modes
+const (
+	ImportInsert = "insert"
+	ImportUpsert = "upsert"
+)
+
+// import row results
+const (
+	RowCreated  = "created"
+	RowUpdated  = "updated"
+	RowInvalid  = "invalid"
+	RowConflict = "conflict"
+	RowFailed   = "failed"
+)
+
+type ImportOptions struct {
+	// Mode is ImportInsert, where existing usernames conflict, or ImportUpsert,
+	// where they are overwritten
+	Mode string
+	// DryRun validates and checks conflicts without writing
+	DryRun      bool
+	BatchSize   int
+	HashWorkers int
+	// Progress, when set, gets the report after every written batch, the rows
+	// in it are final. An error stops the import and is returned.
+	Progress func(report ImportReport) error
+}
+
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Result   string `json:"result"`
+	Field    string `json:"field,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportReport has one entry per row read, in input order. In a dry run the
+// created and updated rows are the ones that would be written.
+type ImportReport struct {
+	Mode      string      `json:"mode"`
+	DryRun    bool        `json:"dry_run"`
+	Total     int         `json:"total"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Invalid   int         `json:"invalid"`
+	Conflicts int         `json:"conflicts"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// pendingRow is a valid row waiting for its batch to be written.
+type pendingRow struct {
+	index  int
+	user   models.User
+	hashed bool
+}
+
+// outcome is what writing a pending row resulted in.
+type outcome struct {
+	result string
+	field  string
+	err    error
+}
+
+// ImportUsers reads every record and writes valid rows batch by batch, each
+// batch in its own transaction. A read error stops the import, batches
+// written before it are kept.
+func (s *Services) ImportUsers(ctx context.Context, reader bulk.Reader, opts ImportOptions) (report ImportReport, err error) {
+	ctx, span := tracing.Start(ctx, "services.ImportUsers")
+	defer func() { tracing.End(span, err) }()
+
+	if opts.Mode != ImportInsert && opts.Mode != ImportUpsert {
+		return ImportReport{}, apperror.AppError(config.ErrImportingUser, fmt.Errorf("unknown mode %q", opts.Mode))
+	}
+	opts.BatchSize = max(opts.BatchSize, 1)
+	opts.HashWorkers = max(opts.HashWorkers, 1)
+
+	report = ImportReport{Mode: opts.Mode, DryRun: opts.DryRun, Rows: []ImportRow{}}
+	defer func() { report.count() }()
+
+	seen := newSeenFields()
+	var batch []pendingRow
+	for {
+		record, readErr := reader.Read()
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return report, apperror.AppError(config.ErrImportingUser, readErr)
+		}
+
+		row := ImportRow{Row: record.Row, Username: record.User.Username}
+		user, hashed, field, problem := prepareImport(record)
+		if problem == nil {
+			if field, earlier := seen.claim(record.Row, user); field != "" {
+				row.Result, row.Field, row.Error = RowConflict, field, fmt.Sprintf("%s already used in row %d", field, earlier)
+			}
+		} else {
+			row.Result, row.Field, row.Error = RowInvalid, field, problem.Error()
+		}
+		report.Rows = append(report.Rows, row)
+
+		if row.Result == "" {
+			batch = append(batch, pendingRow{index: len(report.Rows) - 1, user: user, hashed: hashed})
+		}
+		if len(batch) >= opts.BatchSize {
+			s.importBatch(ctx, &report, batch, opts)
+			batch = nil
+			if opts.Progress != nil {
+				report.count()
+				if err := opts.Progress(report); err != nil {
+					return report, err
+				}
+			}
+		}
+	}
+	s.importBatch(ctx, &report, batch, opts)
+
+	return report, nil
+}
+
+// Append adds the rows of next, read by an import resumed where r stopped.
+func (r *ImportReport) Append(next ImportReport) {
+	r.Rows = append(r.Rows, next.Rows...)
+	r.count()
+}
+
+func (r *ImportReport) count() {
+	r.Total = len(r.Rows)
+	r.Created, r.Updated, r.Invalid, r.Conflicts, r.Failed = 0, 0, 0, 0, 0
+	for _, row := range r.Rows {
+		switch row.Result {
+		case RowCreated:
+			r.Created++
+		case RowUpdated:
+			r.Updated++
+		case RowInvalid:
+			r.Invalid++
+		case RowConflict:
+			r.Conflicts++
+		default:
+			r.Failed++
+		}
+	}
+}
+
+// prepareImport validates a record with the user validator. Passwords that
+// already are hashes of a supported algorithm are kept as they are, outdated
+// ones are replaced at the next login.
+func prepareImport(record bulk.Record) (user models.User, hashed bool, field string, err error) {
+	if record.Err != nil {
+		return models.User{}, false, "", record.Err
+	}
+
+	user = record.User
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
+		return models.User{}, false, "role", config.ErrInvalidRole
+	}
+
+	fields := config.Create_ValidateFields
+	if password.IsHash(user.Password) {
+		hashed = true
+		// the validator only understands plaintext passwords
+		check := user
+		check.Password = ""
+		if err := validator.ValidateData(check, withoutField(fields, "password")); err != nil {
+			return models.User{}, false, "", err
+		}
+		return user, hashed, "", nil
+	}
+
+	if err := validator.ValidateData(user, fields); err != nil {
+		return models.User{}, false, "", err
+	}
+	return user, false, "", nil
+}
+
+func withoutField(fields []string, field string) []string {
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f != field {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// seenFields catches unique values repeated inside one import.
+type seenFields map[string]int
+
+func newSeenFields() seenFields {
+	return seenFields{}
+}
+
+// claim returns the field already used by an earlier row and that row, or ""
+// when every unique value of user is new.
+func (s seenFields) claim(row int, user models.User) (string, int) {
+	values := [][2]string{{"username", user.Username}, {"email", user.Email}, {"phone", user.Phone}}
+	for _, v := range values {
+		if earlier, taken := s[v[0]+":"+v[1]]; taken {
+			return v[0], earlier
+		}
+	}
+	for _, v := range values {
+		s[v[0]+":"+v[1]] = row
+	}
+	return "", 0
+}
+
+// importBatch writes batch in one transaction. When the transaction fails,
+// a concurrent write or a database error, every row is retried on its own so
+// the failure is reported against the rows that caused it.
+func (s *Services) importBatch(ctx context.Context, report *ImportReport, batch []pendingRow, opts ImportOptions) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, span := tracing.Start(ctx, "services.importBatch")
+	defer span.End()
+
+	if !opts.DryRun {
+		if batch = s.hashImported(ctx, report, batch, opts.HashWorkers); len(batch) == 0 {
+			return
+		}
+	}
+
+	outcomes, err := s.writeBatch(ctx, batch, opts)
+	if err != nil && len(batch) > 1 {
+		outcomes = make([]outcome, len(batch))
+		for i := range batch {
+			single, singleErr := s.writeBatch(ctx, batch[i:i+1], opts)
+			if singleErr != nil {
+				single = []outcome{failedOutcome(singleErr)}
+			}
+			outcomes[i] = single[0]
+		}
+	} else if err != nil {
+		outcomes = []outcome{failedOutcome(err)}
+	}
+
+	for i, p := range batch {
+		row := &report.Rows[p.index]
+		row.Result, row.Field = outcomes[i].result, outcomes[i].field
+		if outcomes[i].err != nil {
+			row.Error = outcomes[i].err.Error()
+		}
+		if opts.DryRun {
+			continue
+		}
+		metrics.UsersImported.WithLabelValues(row.Result).Inc()
+		if row.Result == RowCreated {
+			metrics.UsersCreated.Inc()
+		}
+	}
+}
+
+// hashImported hashes plaintext passwords in parallel, rows that cannot be
+// hashed are reported as failed and left out.
+func (s *Services) hashImported(ctx context.Context, report *ImportReport, batch []pendingRow, workers int) []pendingRow {
+	errs := make([]error, len(batch))
+	var group errgroup.Group
+	group.SetLimit(workers)
+	for i := range batch {
+		if batch[i].hashed {
+			continue
+		}
+		group.Go(func() error {
+			batch[i].user.Password, errs[i] = s.Passwords.Hash(ctx, batch[i].user.Password)
+			return nil
+		})
+	}
+	_ = group.Wait()
+
+	kept := batch[:0]
+	for i, p := range batch {
+		if errs[i] != nil {
+			row := &report.Rows[p.index]
+			row.Result, row.Error = RowFailed, errs[i].Error()
+			metrics.UsersImported.WithLabelValues(RowFailed).Inc()
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// writeBatch decides the outcome of every row against the users already
+// holding its unique fields, then writes them unless it is a dry run.
+func (s *Services) writeBatch(ctx context.Context, batch []pendingRow, opts ImportOptions) ([]outcome, error) {
+	var outcomes []outcome
+	write := func(repo repository.UserRepository) error {
+		usernames := make([]string, len(batch))
+		emails := make([]string, len(batch))
+		phones := make([]string, len(batch))
+		for i, p := range batch {
+			usernames[i], emails[i], phones[i] = p.user.Username, p.user.Email, p.user.Phone
+		}
+		taken, err := repo.FindTaken(ctx, usernames, emails, phones)
+		if err != nil {
+			return err
+		}
+
+		var inserts []models.User
+		outcomes = make([]outcome, len(batch))
+		for i, p := range batch {
+			user, out := classify(p.user, taken, opts.Mode)
+			outcomes[i] = out
+			switch {
+			case opts.DryRun:
+			case out.result == RowCreated:
+				inserts = append(inserts, user)
+			case out.result == RowUpdated:
+				if err := repo.Replace(ctx, user); err != nil {
+					return err
+				}
+			}
+		}
+		return repo.SaveBatch(ctx, inserts)
+	}
+
+	if opts.DryRun {
+		return outcomes, write(s.Repo)
+	}
+	return outcomes, s.Repo.Transaction(ctx, write)
+}
+
+// classify finds the outcome of importing user while taken hold the unique
+// fields. A created user gets a new id, an updated one keeps its own.
+func classify(user models.User, taken []models.User, mode string) (models.User, outcome) {
+	var existing *models.User
+	for i := range taken {
+		if taken[i].Username == user.Username {
+			existing = &taken[i]
+		}
+	}
+	if existing != nil && mode == ImportInsert {
+		return user, conflictOutcome("username")
+	}
+
+	for _, other := range taken {
+		if other.Username == user.Username {
+			continue
+		}
+		if other.Email == user.Email {
+			return user, conflictOutcome("email")
+		}
+		if other.Phone == user.Phone {
+			return user, conflictOutcome("phone")
+		}
+	}
+
+	if existing != nil {
+		user.ID = existing.ID
+		return user, outcome{result: RowUpdated}
+	}
+	user.ID = uuid.NewString()
+	return user, outcome{result: RowCreated}
+}
+
+func conflictOutcome(field string) outcome {
+	return outcome{result: RowConflict, field: field, err: &repository.DuplicateError{Field: field}}
+}
+
+func failedOutcome(err error) outcome {
+	var duplicate *repository.DuplicateError
+	if errors.As(err, &duplicate) {
+		return outcome{result: RowConflict, field: duplicate.Field, err: duplicate}
+	}
+	return outcome{result: RowFailed, err: err}
+}
+
+// ExportUsers calls fn with every user matching filter, batchSize at a time,
+// so the caller can stream them.
+func (s *Services) ExportUsers(ctx context.Context, filter repository.UserFilter, batchSize int, fn func(users []models.User) error) (err error) {
+	ctx, span := tracing.Start(ctx, "services.ExportUsers")
+	defer func() { tracing.End(span, err) }()
+
+	if exportErr := s.Repo.Export(ctx, filter, max(batchSize, 1), fn); exportErr != nil {
+		return apperror.AppError(config.ErrExportingUser, exportErr)
+	}
+	return nil
+}
+
+// CountUsers returns how many users match filter.
+func (s *Services) CountUsers(ctx context.Context, filter repository.UserFilter) (count int64, err error) {
+	ctx, span := tracing.Start(ctx, "services.CountUsers")
+	defer func() { tracing.End(span, err) }()
+
+	count, countErr := s.Repo.Count(ctx, filter)
+	if countErr != nil {
+		return 0, apperror.AppError(config.ErrListingUsers, countErr)
+	}
+	return count, nil
+}
+
+// DisableUsers disables usernames, users already disabled are not counted.
+func (s *Services) DisableUsers(ctx context.Context, usernames []string) (changed int64, err error) {
+	ctx, span := tracing.Start(ctx, "services.DisableUsers")
+	defer func() { tracing.End(span, err) }()
+
+	changed, disableErr := s.Repo.DisableMany(ctx, usernames)
+	if disableErr != nil {
+		return 0, apperror.AppError(config.ErrDisablingUser, disableErr)
+	}
+	if endErr := s.endSessions(ctx, usernames...); endErr != nil {
+		return 0, apperror.AppError(config.ErrDisablingUser, endErr)
+	}
+	return changed, nil
+}
+
+// ExpirePasswords makes usernames choose a new password on their next login,
+// users already required to are not counted.
+func (s *Services) ExpirePasswords(ctx context.Context, usernames []string) (changed int64, err error) {
+	ctx, span := tracing.Start(ctx, "services.ExpirePasswords")
+	defer func() { tracing.End(span, err) }()
+
+	changed, expireErr := s.Repo.ExpirePasswords(ctx, usernames)
+	if expireErr != nil {
+		return 0, apperror.AppError(config.ErrChangingPwd, expireErr)
+	}
+	// the tokens of the old password must not outlive it
+	if endErr := s.endSessions(ctx, usernames...); endErr != nil {
+		return 0, apperror.AppError(config.ErrChangingPwd, endErr)
+	}
+	return changed, nil
+}
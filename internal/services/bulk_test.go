@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/bulk"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/gustyaguero21/go-core/pkg/encrypter"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// bcryptArg matches any bcrypt hash.
+type bcryptArg struct{}
+
+func (bcryptArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read() (bulk.Record, error) {
+	return bulk.Record{}, errors.New("connection reset")
+}
+
+func TestImportUsers(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+
+	hash, _ := encrypter.PasswordEncrypter("Password1234")
+	header := "username,name,surname,email,phone,password\n"
+	john := "johndoe,John,Doe,john@example.com,111," + string(hash) + "\n"
+	jane := "janedoe,Jane,Doe,jane@example.com,222," + string(hash) + "\n"
+	existing := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "email", "phone"}).AddRow("42", "johndoe", "old@example.com", "999")
+	}
+	duplicate := &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'jane@example.com' for key 'users.email'"}
+
+	test := []struct {
+		Name            string
+		Input           string
+		Options         ImportOptions
+		ExpectedResults []string
+		ExpectedFields  []string
+		MockAct         func()
+	}{
+		{
+			Name:            "Insert",
+			Input:           header + john + "bob,Bob,Doe,not-an-email,333,Password1234\n" + "johndoe,J,D,other@example.com,444,Password1234\n",
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 10},
+			ExpectedResults: []string{RowCreated, RowInvalid, RowConflict},
+			ExpectedFields:  []string{"", "", "username"},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).
+					WithArgs("johndoe", "john@example.com", "111").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).
+					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "111", "john@example.com", string(hash), "user", false, false, nil, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Plaintext Passwords Are Hashed",
+			Input:           header + "johndoe,John,Doe,john@example.com,111,Password1234\n",
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 10},
+			ExpectedResults: []string{RowCreated},
+			ExpectedFields:  []string{""},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).
+					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "111", "john@example.com", bcryptArg{}, "user", false, false, nil, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Insert Existing Username",
+			Input:           header + john,
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 10},
+			ExpectedResults: []string{RowConflict},
+			ExpectedFields:  []string{"username"},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(existing())
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Upsert",
+			Input:           header + john + jane,
+			Options:         ImportOptions{Mode: ImportUpsert, BatchSize: 10},
+			ExpectedResults: []string{RowUpdated, RowCreated},
+			ExpectedFields:  []string{"", ""},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(existing())
+				mock.ExpectExec(config.ReplaceTestQuery).
+					WithArgs("John", "Doe", "111", "john@example.com", string(hash), "user", false, false, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Upsert Email Of Another User",
+			Input:           header + "janedoe,Jane,Doe,old@example.com,222," + string(hash) + "\n",
+			Options:         ImportOptions{Mode: ImportUpsert, BatchSize: 10},
+			ExpectedResults: []string{RowConflict},
+			ExpectedFields:  []string{"email"},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(existing())
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name:            "Dry Run",
+			Input:           header + john + jane,
+			Options:         ImportOptions{Mode: ImportUpsert, DryRun: true, BatchSize: 10},
+			ExpectedResults: []string{RowUpdated, RowCreated},
+			ExpectedFields:  []string{"", ""},
+			MockAct: func() {
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(existing())
+			},
+		},
+		{
+			Name:            "Batches",
+			Input:           header + john + jane,
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 1},
+			ExpectedResults: []string{RowCreated, RowCreated},
+			ExpectedFields:  []string{"", ""},
+			MockAct: func() {
+				for range 2 {
+					mock.ExpectBegin()
+					mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+					mock.ExpectCommit()
+				}
+			},
+		},
+		{
+			Name:            "Concurrent Write Retries Rows Alone",
+			Input:           header + john + jane,
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 10},
+			ExpectedResults: []string{RowCreated, RowConflict},
+			ExpectedFields:  []string{"", "email"},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnError(duplicate)
+				mock.ExpectRollback()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec(config.SaveTestQuery).WillReturnError(duplicate)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:            "Database Error",
+			Input:           header + john,
+			Options:         ImportOptions{Mode: ImportInsert, BatchSize: 10},
+			ExpectedResults: []string{RowFailed},
+			ExpectedFields:  []string{""},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.FindTakenTestQuery).WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			reader, readerErr := bulk.NewReader(bulk.FormatCSV, strings.NewReader(tt.Input))
+			assert.NoError(t, readerErr)
+
+			report, importErr := service.ImportUsers(ctx, reader, tt.Options)
+			assert.NoError(t, importErr)
+
+			var results, fields []string
+			for _, row := range report.Rows {
+				results = append(results, row.Result)
+				fields = append(fields, row.Field)
+			}
+			assert.Equal(t, tt.ExpectedResults, results)
+			assert.Equal(t, tt.ExpectedFields, fields)
+			assert.Equal(t, len(tt.ExpectedResults), report.Total)
+			assert.Equal(t, report.Total, report.Created+report.Updated+report.Invalid+report.Conflicts+report.Failed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("Rows Point To Their Line", func(t *testing.T) {
+		reader, _ := bulk.NewReader(bulk.FormatCSV, strings.NewReader(header+"bob,,,,,\n"))
+		report, importErr := service.ImportUsers(ctx, reader, ImportOptions{Mode: ImportInsert})
+		assert.NoError(t, importErr)
+		assert.Equal(t, []ImportRow{{Row: 2, Username: "bob", Result: RowInvalid, Error: "name is required"}}, report.Rows)
+	})
+
+	t.Run("Progress Aborts", func(t *testing.T) {
+		mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(config.FindTakenTestQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		ann := "ann,Ann,Doe,ann@example.com,222," + string(hash) + "\n"
+		reader, _ := bulk.NewReader(bulk.FormatCSV, strings.NewReader(header+john+"bob,,,,,\n"+ann+john))
+		var seen []int
+		_, importErr := service.ImportUsers(ctx, reader, ImportOptions{Mode: ImportInsert, DryRun: true, BatchSize: 1, Progress: func(report ImportReport) error {
+			seen = append(seen, report.Total)
+			if len(seen) == 2 {
+				return errors.New("stopped")
+			}
+			return nil
+		}})
+		assert.EqualError(t, importErr, "stopped")
+		assert.Equal(t, []int{1, 3}, seen)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Read Error", func(t *testing.T) {
+		_, importErr := service.ImportUsers(ctx, failingReader{}, ImportOptions{Mode: ImportInsert})
+		assert.ErrorContains(t, importErr, "connection reset")
+	})
+
+	t.Run("Unknown Mode", func(t *testing.T) {
+		_, importErr := service.ImportUsers(ctx, failingReader{}, ImportOptions{Mode: "merge"})
+		assert.ErrorContains(t, importErr, `unknown mode "merge"`)
+	})
+}
+
+func TestExportUsers(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+	disabled := true
+
+	t.Run("Batches", func(t *testing.T) {
+		mock.ExpectQuery(config.ExportTestQuery).
+			WithArgs("admin", true, "jo\\_%", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "jo_a").AddRow("2", "jo_b"))
+		mock.ExpectQuery(config.ExportTestQuery).
+			WithArgs("admin", true, "jo\\_%", "2", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("3", "jo_c"))
+
+		var batches [][]string
+		exportErr := service.ExportUsers(ctx, repository.UserFilter{Role: "admin", Disabled: &disabled, UsernamePrefix: "jo_"}, 2, func(users []models.User) error {
+			var names []string
+			for _, user := range users {
+				names = append(names, user.Username)
+			}
+			batches = append(batches, names)
+			return nil
+		})
+
+		assert.NoError(t, exportErr)
+		assert.Equal(t, [][]string{{"jo_a", "jo_b"}, {"jo_c"}}, batches)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mock.ExpectQuery(config.ExportTestQuery).WillReturnError(config.ErrDbError)
+
+		exportErr := service.ExportUsers(ctx, repository.UserFilter{}, 2, func(users []models.User) error { return nil })
+		assert.ErrorIs(t, exportErr, config.ErrDbError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
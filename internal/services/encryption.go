@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+)
+
+// RotateDataKey makes a new data key encrypt the personal data written from
+// now on, ReencryptUsers moves the stored users over to it.
+func (s *Services) RotateDataKey(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "services.RotateDataKey")
+	defer func() { tracing.End(span, err) }()
+
+	if rotateErr := s.Repo.RotateDataKey(ctx); rotateErr != nil {
+		return apperror.AppError(config.ErrRotatingKey, rotateErr)
+	}
+	return nil
+}
+
+// ReencryptUsers encrypts with the current data key the next batchSize users
+// after afterID that are in plaintext or use an older key.
+func (s *Services) ReencryptUsers(ctx context.Context, afterID string, batchSize int) (batch repository.ReencryptBatch, err error) {
+	ctx, span := tracing.Start(ctx, "services.ReencryptUsers")
+	defer func() { tracing.End(span, err) }()
+
+	batch, reencryptErr := s.Repo.Reencrypt(ctx, afterID, batchSize)
+	if reencryptErr != nil {
+		return repository.ReencryptBatch{}, apperror.AppError(config.ErrReencrypting, reencryptErr)
+	}
+	return batch, nil
+}
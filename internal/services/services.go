@@ -2,14 +2,29 @@ package services
 
 import (
 	"context"
+	"go-manage-mysql/internal/bulk"
 	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
 )
 
 type UserServices interface {
 	CreateUser(ctx context.Context, user models.User) (created models.User, err error)
 	SearchUser(ctx context.Context, username string) (user models.User, err error)
+	SearchUserByID(ctx context.Context, id string) (user models.User, err error)
+	SearchUserByEmail(ctx context.Context, email string) (user models.User, err error)
+	ModifyUser(ctx context.Context, id string, modify func(current models.User) (models.User, error)) (user models.User, err error)
 	UpdateUser(ctx context.Context, username string, update models.User) (err error)
 	DeleteUser(ctx context.Context, username string) (err error)
+	ForgetCachedUser(ctx context.Context, username string)
 	ChangeUserPwd(ctx context.Context, username string, newPwd string) (err error)
-	LoginUser(ctx context.Context, username, password string) error
+	LoginUser(ctx context.Context, username, password string) (user models.User, err error)
+	ListUsers(ctx context.Context, offset, limit int) (users []models.User, err error)
+	SetUserDisabled(ctx context.Context, username string, disabled bool) (err error)
+	ImportUsers(ctx context.Context, reader bulk.Reader, opts ImportOptions) (report ImportReport, err error)
+	ExportUsers(ctx context.Context, filter repository.UserFilter, batchSize int, fn func(users []models.User) error) (err error)
+	CountUsers(ctx context.Context, filter repository.UserFilter) (count int64, err error)
+	DisableUsers(ctx context.Context, usernames []string) (changed int64, err error)
+	ExpirePasswords(ctx context.Context, usernames []string) (changed int64, err error)
+	RotateDataKey(ctx context.Context) (err error)
+	ReencryptUsers(ctx context.Context, afterID string, batchSize int) (batch repository.ReencryptBatch, err error)
 }
@@ -2,141 +2,317 @@ package services
 
 import (
 	"context"
+	"errors"
 	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/metrics"
 	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/password"
 	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gustyaguero21/go-core/pkg/apperror"
-	"github.com/gustyaguero21/go-core/pkg/encrypter"
 	"gorm.io/gorm"
 )
 
 type Services struct {
 	Repo repository.UserRepository
+	// Passwords hashes and verifies passwords, services sharing it share its
+	// limit of concurrent hashes
+	Passwords *password.Hasher
+	// Sessions, when set, are ended once their user is disabled or changes
+	// password
+	Sessions repository.SessionRepository
 }
 
 func NewUserServices(repo repository.UserRepository) *Services {
-	return &Services{Repo: repo}
+	return &Services{Repo: repo, Passwords: password.NewHasher(config.Current().Password)}
 }
 
 func (s *Services) CreateUser(ctx context.Context, user models.User) (created models.User, err error) {
-	exist, existErr := s.exists(user.Username)
-	if existErr != nil {
-		return models.User{}, existErr
-	}
-
-	if exist {
-		return models.User{}, apperror.AppError(config.ErrCreatingUser, config.ErrUserAlreadyExists)
-	}
+	ctx, span := tracing.Start(ctx, "services.CreateUser")
+	defer func() { tracing.End(span, err) }()
 
 	user.ID = uuid.NewString()
+	user.Role = models.RoleUser
 
-	hash, hashErr := encrypter.PasswordEncrypter(user.Password)
+	hash, hashErr := s.Passwords.Hash(ctx, user.Password)
 	if hashErr != nil {
 		return models.User{}, apperror.AppError(config.ErrCreatingUser, hashErr)
 	}
-	user.Password = string(hash)
+	user.Password = hash
 
-	if err := s.Repo.Save(user); err != nil {
+	// the unique constraints decide, a duplicate comes back as a DuplicateError
+	if err := s.Repo.Save(ctx, user); err != nil {
 		return models.User{}, apperror.AppError(config.ErrCreatingUser, err)
 	}
+	metrics.UsersCreated.Inc()
 
 	return user, nil
 }
 
 func (s *Services) SearchUser(ctx context.Context, username string) (user models.User, err error) {
-	search, searchErr := s.Repo.Search(username)
+	ctx, span := tracing.Start(ctx, "services.SearchUser")
+	defer func() { tracing.End(span, err) }()
+
+	search, searchErr := s.Repo.Search(ctx, username)
 	if searchErr != nil {
-		return models.User{}, apperror.AppError(config.ErrSearchingUser, config.ErrUserNotFound)
+		return models.User{}, apperror.AppError(config.ErrSearchingUser, notFound(searchErr))
 	}
 
 	return search, nil
 }
 
-func (s *Services) UpdateUser(ctx context.Context, username string, update models.User) (err error) {
-	exist, existErr := s.exists(username)
-	if existErr != nil {
-		return existErr
+func (s *Services) SearchUserByID(ctx context.Context, id string) (user models.User, err error) {
+	ctx, span := tracing.Start(ctx, "services.SearchUserByID")
+	defer func() { tracing.End(span, err) }()
+
+	search, searchErr := s.Repo.SearchByID(ctx, id)
+	if searchErr != nil {
+		return models.User{}, apperror.AppError(config.ErrSearchingUser, notFound(searchErr))
 	}
+	return search, nil
+}
 
-	if !exist {
-		return apperror.AppError(config.ErrUpdatingUser, config.ErrUserNotFound)
+func (s *Services) SearchUserByEmail(ctx context.Context, email string) (user models.User, err error) {
+	ctx, span := tracing.Start(ctx, "services.SearchUserByEmail")
+	defer func() { tracing.End(span, err) }()
+
+	found, findErr := s.Repo.FindTaken(ctx, nil, []string{email}, nil)
+	if findErr != nil {
+		return models.User{}, apperror.AppError(config.ErrSearchingUser, findErr)
+	}
+	for _, candidate := range found {
+		if strings.EqualFold(candidate.Email, email) {
+			return candidate, nil
+		}
 	}
+	return models.User{}, apperror.AppError(config.ErrSearchingUser, config.ErrUserNotFound)
+}
+
+// ModifyUser replaces the user with id by what modify makes of it, the row
+// stays locked in between. Every field but the id and the username can
+// change, a password that differs from the stored hash is hashed first.
+func (s *Services) ModifyUser(ctx context.Context, id string, modify func(current models.User) (models.User, error)) (user models.User, err error) {
+	ctx, span := tracing.Start(ctx, "services.ModifyUser")
+	defer func() { tracing.End(span, err) }()
 
-	if updateErr := s.Repo.Update(username, update); updateErr != nil {
-		return apperror.AppError(config.ErrUpdatingUser, config.ErrNoNewData)
+	ended := false
+	err = s.Repo.Transaction(ctx, func(tx repository.UserRepository) error {
+		current, searchErr := tx.SearchByID(ctx, id)
+		if searchErr != nil {
+			return apperror.AppError(config.ErrUpdatingUser, notFound(searchErr))
+		}
+
+		next, modifyErr := modify(current)
+		if modifyErr != nil {
+			return apperror.AppError(config.ErrUpdatingUser, modifyErr)
+		}
+		if next.Username != current.Username {
+			return apperror.AppError(config.ErrUpdatingUser, config.ErrUsernameChange)
+		}
+		next.ID = current.ID
+		if next.Password != current.Password {
+			hash, hashErr := s.Passwords.Hash(ctx, next.Password)
+			if hashErr != nil {
+				return apperror.AppError(config.ErrUpdatingUser, hashErr)
+			}
+			next.Password = hash
+		}
+		ended = next.Password != current.Password || (next.Disabled && !current.Disabled)
+
+		if replaceErr := tx.Replace(ctx, next); replaceErr != nil {
+			return apperror.AppError(config.ErrUpdatingUser, replaceErr)
+		}
+		user = next
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
 	}
 
-	return nil
+	if ended {
+		if endErr := s.endSessions(ctx, user.Username); endErr != nil {
+			return models.User{}, apperror.AppError(config.ErrUpdatingUser, endErr)
+		}
+	}
+	return user, nil
+}
+
+func (s *Services) UpdateUser(ctx context.Context, username string, update models.User) (err error) {
+	ctx, span := tracing.Start(ctx, "services.UpdateUser")
+	defer func() { tracing.End(span, err) }()
+
+	// the lookup locks the row, so "not found" and "nothing changed" can be told apart
+	return s.Repo.Transaction(ctx, func(tx repository.UserRepository) error {
+		if _, searchErr := tx.Search(ctx, username); searchErr != nil {
+			return apperror.AppError(config.ErrUpdatingUser, notFound(searchErr))
+		}
+
+		updateErr := tx.Update(ctx, username, update)
+		switch {
+		case updateErr == nil:
+			return nil
+		case errors.Is(updateErr, config.ErrNoRowsAffected):
+			return apperror.AppError(config.ErrUpdatingUser, config.ErrNoNewData)
+		default:
+			return apperror.AppError(config.ErrUpdatingUser, updateErr)
+		}
+	})
 }
 
 func (s *Services) DeleteUser(ctx context.Context, username string) (err error) {
-	exist, existErr := s.exists(username)
-	if existErr != nil {
-		return existErr
-	}
+	ctx, span := tracing.Start(ctx, "services.DeleteUser")
+	defer func() { tracing.End(span, err) }()
 
-	if !exist {
-		return apperror.AppError(config.ErrDeletingUser, config.ErrUserNotFound)
+	if deleteErr := s.Repo.Delete(ctx, username); deleteErr != nil {
+		return apperror.AppError(config.ErrDeletingUser, notFound(deleteErr))
 	}
+	metrics.UsersDeleted.Inc()
 
-	if deleteErr := s.Repo.Delete(username); deleteErr != nil {
-		return apperror.AppError(config.ErrDeletingUser, deleteErr)
+	// the tokens carry the role, they would outlive the user
+	if endErr := s.endSessions(ctx, username); endErr != nil {
+		return apperror.AppError(config.ErrDeletingUser, endErr)
 	}
 	return nil
 }
 
-func (s *Services) ChangeUserPwd(ctx context.Context, username string, newPwd string) (err error) {
-	exist, existErr := s.exists(username)
-	if existErr != nil {
-		return existErr
+// ForgetCachedUser drops username from the user cache, for users written
+// around the services, like an erasure does.
+func (s *Services) ForgetCachedUser(ctx context.Context, username string) {
+	if cached, ok := s.Repo.(*repository.CachedRepository); ok {
+		cached.Invalidate(ctx, username)
 	}
+}
 
-	if !exist {
-		return apperror.AppError(config.ErrChangingPwd, config.ErrUserNotFound)
-	}
+func (s *Services) ChangeUserPwd(ctx context.Context, username string, newPwd string) (err error) {
+	ctx, span := tracing.Start(ctx, "services.ChangeUserPwd")
+	defer func() { tracing.End(span, err) }()
 
-	hash, hashErr := encrypter.PasswordEncrypter(newPwd)
+	hash, hashErr := s.Passwords.Hash(ctx, newPwd)
 	if hashErr != nil {
 		return apperror.AppError(config.ErrChangingPwd, hashErr)
 	}
 
-	if changeErr := s.Repo.ChangePwd(username, string(hash)); changeErr != nil {
-		return apperror.AppError(config.ErrChangingPwd, changeErr)
+	// a new hash always differs, no affected rows means no such user
+	if changeErr := s.Repo.ChangePwd(ctx, username, hash); changeErr != nil {
+		return apperror.AppError(config.ErrChangingPwd, notFound(changeErr))
 	}
 
+	if endErr := s.endSessions(ctx, username); endErr != nil {
+		return apperror.AppError(config.ErrChangingPwd, endErr)
+	}
 	return nil
 }
 
-func (s *Services) LoginUser(ctx context.Context, username, password string) error {
-	exist, existErr := s.exists(username)
-	if existErr != nil {
-		return existErr
+func (s *Services) LoginUser(ctx context.Context, username, password string) (user models.User, err error) {
+	ctx, span := tracing.Start(ctx, "services.LoginUser")
+	defer func() { tracing.End(span, err) }()
+
+	defer func() {
+		if err != nil {
+			metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+			return
+		}
+		metrics.Logins.WithLabelValues(metrics.LoginSucceeded).Inc()
+	}()
+
+	// never from the cache, it lacks the password and may be outdated
+	search, searchErr := s.Repo.SearchFresh(ctx, username)
+	if searchErr != nil {
+		return models.User{}, apperror.AppError(config.ErrLoginUser, notFound(searchErr))
 	}
 
-	if !exist {
-		return apperror.AppError(config.ErrLoginUser, config.ErrUserNotFound)
+	// checked first, so the answer for a disabled user tells nothing about
+	// the password
+	if search.Disabled {
+		return models.User{}, apperror.AppError(config.ErrLoginUser, config.ErrUserDisabled)
 	}
 
-	search, searchErr := s.Repo.Search(username)
-	if searchErr != nil {
-		return apperror.AppError(config.ErrSearchingUser, searchErr)
+	matches, verifyErr := s.Passwords.Verify(ctx, search.Password, password)
+	if verifyErr != nil {
+		return models.User{}, apperror.AppError(config.ErrLoginUser, verifyErr)
+	}
+	if !matches {
+		return models.User{}, apperror.AppError(config.ErrLoginUser, config.ErrPwdMatching)
 	}
 
-	if !encrypter.PasswordDecrypter([]byte(search.Password), password) {
-		return apperror.AppError(config.ErrLoginUser, config.ErrPwdMatching)
+	if s.Passwords.NeedsRehash(search.Password) {
+		s.rehash(ctx, search, password)
 	}
-	return nil
+	return search, nil
 }
 
-func (s *Services) exists(username string) (bool, error) {
-	search, searchErr := s.Repo.Search(username)
-	if searchErr != nil {
-		if searchErr == gorm.ErrRecordNotFound {
-			return false, nil
+// rehash replaces a hash computed with outdated settings while the password
+// is at hand. A failure only postpones it to the next login.
+func (s *Services) rehash(ctx context.Context, user models.User, password string) {
+	hash, hashErr := s.Passwords.Hash(ctx, password)
+	if hashErr != nil {
+		slog.WarnContext(ctx, "error rehashing password", "username", user.Username, "error", hashErr)
+		return
+	}
+	// a password changed in the meantime is left alone
+	rehashErr := s.Repo.RehashPwd(ctx, user.Username, user.Password, hash)
+	if rehashErr != nil && !errors.Is(rehashErr, config.ErrNoRowsAffected) {
+		slog.WarnContext(ctx, "error rehashing password", "username", user.Username, "error", rehashErr)
+		return
+	}
+	if rehashErr == nil {
+		metrics.PasswordRehashes.Inc()
+	}
+}
+
+func (s *Services) ListUsers(ctx context.Context, offset, limit int) (users []models.User, err error) {
+	ctx, span := tracing.Start(ctx, "services.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	list, listErr := s.Repo.List(ctx, offset, limit)
+	if listErr != nil {
+		return nil, apperror.AppError(config.ErrListingUsers, listErr)
+	}
+	return list, nil
+}
+
+func (s *Services) SetUserDisabled(ctx context.Context, username string, disabled bool) (err error) {
+	ctx, span := tracing.Start(ctx, "services.SetUserDisabled")
+	defer func() { tracing.End(span, err) }()
+
+	txErr := s.Repo.Transaction(ctx, func(tx repository.UserRepository) error {
+		if _, searchErr := tx.Search(ctx, username); searchErr != nil {
+			return apperror.AppError(config.ErrDisablingUser, notFound(searchErr))
+		}
+
+		if disableErr := tx.SetDisabled(ctx, username, disabled); disableErr != nil {
+			return apperror.AppError(config.ErrDisablingUser, notFound(disableErr))
 		}
-		return false, searchErr
+		return nil
+	})
+	if txErr != nil || !disabled {
+		return txErr
+	}
+
+	// tokens already issued would otherwise work until they expire
+	if endErr := s.endSessions(ctx, username); endErr != nil {
+		return apperror.AppError(config.ErrDisablingUser, endErr)
+	}
+	return nil
+}
+
+// endSessions ends the login sessions of usernames, when they are recorded.
+func (s *Services) endSessions(ctx context.Context, usernames ...string) error {
+	if s.Sessions == nil || len(usernames) == 0 {
+		return nil
+	}
+	_, err := s.Sessions.EndUserSessions(ctx, usernames)
+	return err
+}
+
+// notFound reports a missing user as config.ErrUserNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, config.ErrNoRowsAffected) {
+		return config.ErrUserNotFound
 	}
-	return search.ID != "", nil
+	return err
 }
@@ -9,9 +9,11 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/gustyaguero21/go-core/pkg/apperror"
 	"github.com/gustyaguero21/go-core/pkg/encrypter"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -38,46 +40,38 @@ func TestCreateUser(t *testing.T) {
 		Name        string
 		User        models.User
 		ExpectedErr error
-		ExistsMock  func()
 		MockAct     func()
 	}{
 		{
-			Name:        "Exists Error",
+			Name:        "Username already exists",
 			User:        testutils.OpenMock("../mocks/user.json"),
-			ExpectedErr: config.ErrDbError,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnError(config.ErrDbError)
-			},
+			ExpectedErr: apperror.AppError(config.ErrCreatingUser, &repository.DuplicateError{Field: "username"}),
 			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe' for key 'users.username'"})
+				mock.ExpectRollback()
 			},
 		},
 		{
-			Name:        "User already exists",
+			Name:        "Email already exists",
 			User:        testutils.OpenMock("../mocks/user.json"),
-			ExpectedErr: apperror.AppError(config.ErrCreatingUser, config.ErrUserAlreadyExists),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
+			ExpectedErr: apperror.AppError(config.ErrCreatingUser, &repository.DuplicateError{Field: "email"}),
 			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.SaveTestQuery).
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johndoe@example.com' for key 'users.email'"})
+				mock.ExpectRollback()
 			},
 		},
 		{
 			Name:        "Error creating user",
 			User:        testutils.OpenMock("../mocks/user.json"),
 			ExpectedErr: apperror.AppError(config.ErrCreatingUser, config.ErrDbError),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.SaveTestQuery).
-					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "123456789", "johndoe@example.com", sqlmock.AnyArg()).
+					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "123456789", "johndoe@example.com", sqlmock.AnyArg(), models.RoleUser, false, false, nil, nil).
 					WillReturnError(config.ErrDbError)
 				mock.ExpectRollback()
 			},
@@ -86,15 +80,10 @@ func TestCreateUser(t *testing.T) {
 			Name:        "Success",
 			User:        testutils.OpenMock("../mocks/user.json"),
 			ExpectedErr: nil,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.SaveTestQuery).
-					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "123456789", "johndoe@example.com", sqlmock.AnyArg()).
+					WithArgs(sqlmock.AnyArg(), "John", "Doe", "johndoe", "123456789", "johndoe@example.com", sqlmock.AnyArg(), models.RoleUser, false, false, nil, nil).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 			},
@@ -103,7 +92,6 @@ func TestCreateUser(t *testing.T) {
 
 	for _, tt := range test {
 		t.Run(tt.Name, func(t *testing.T) {
-			tt.ExistsMock()
 			tt.MockAct()
 
 			create, createErr := service.CreateUser(ctx, tt.User)
@@ -119,6 +107,8 @@ func TestCreateUser(t *testing.T) {
 			}
 		})
 	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestSearchUser(t *testing.T) {
@@ -157,6 +147,16 @@ func TestSearchUser(t *testing.T) {
 					WillReturnRows(sqlmock.NewRows([]string{"id"}))
 			},
 		},
+		{
+			Name:        "Database error",
+			Username:    "johndoe",
+			ExpectedErr: apperror.AppError(config.ErrSearchingUser, config.ErrDbError),
+			MockAct: func() {
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnError(config.ErrDbError)
+			},
+		},
 		{
 			Name:         "Success",
 			Username:     "johndoe",
@@ -191,6 +191,64 @@ func TestSearchUser(t *testing.T) {
 	}
 }
 
+func TestSearchUserByEmail(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+
+	test := []struct {
+		Name             string
+		Email            string
+		ExpectedUsername string
+		ExpectedErr      error
+		MockAct          func()
+	}{
+		{
+			Name:             "Success Ignoring Case",
+			Email:            "JohnDoe@Example.com",
+			ExpectedUsername: "johndoe",
+			MockAct: func() {
+				mock.ExpectQuery(config.FindTakenTestQuery).
+					WithArgs("JohnDoe@Example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow("1", "johndoe", "johndoe@example.com"))
+			},
+		},
+		{
+			Name:        "Not Found",
+			Email:       "nobody@example.com",
+			ExpectedErr: config.ErrUserNotFound,
+			MockAct: func() {
+				mock.ExpectQuery(config.FindTakenTestQuery).
+					WithArgs("nobody@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			user, searchErr := service.SearchUserByEmail(ctx, tt.Email)
+
+			assert.ErrorIs(t, searchErr, tt.ExpectedErr)
+			assert.Equal(t, tt.ExpectedUsername, user.Username)
+		})
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	ctx := context.Background()
 
@@ -214,20 +272,19 @@ func TestUpdate(t *testing.T) {
 		Username    string
 		Update      models.User
 		ExpectedErr error
-		ExistsMock  func()
 		MockAct     func()
 	}{
 		{
-			Name:        "Exists Error",
+			Name:        "Search Error",
 			Username:    "johndoe",
 			Update:      testutils.OpenMock("../mocks/update_user.json"),
 			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, config.ErrDbError),
-			ExistsMock: func() {
+			MockAct: func() {
+				mock.ExpectBegin()
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnError(apperror.AppError(config.ErrUpdatingUser, config.ErrDbError))
-			},
-			MockAct: func() {
+					WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
 			},
 		},
 		{
@@ -235,29 +292,42 @@ func TestUpdate(t *testing.T) {
 			Username:    "johndoe",
 			Update:      testutils.OpenMock("../mocks/update_user.json"),
 			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, config.ErrUserNotFound),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
 					WithArgs("johndoe", 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
-			MockAct: func() {
+				mock.ExpectRollback()
 			},
 		},
 		{
-			Name:        "Error updating user",
+			Name:        "No new data",
 			Username:    "johndoe",
 			Update:      testutils.OpenMock("../mocks/update_user.json"),
 			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, config.ErrNoNewData),
-			ExistsMock: func() {
+			MockAct: func() {
+				mock.ExpectBegin()
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(config.UpdateTestQuery).
+					WithArgs("Johncito", "Doecito", "23456789", "johncitodoecito@example.com", "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
 			},
+		},
+		{
+			Name:        "Email already exists",
+			Username:    "johndoe",
+			Update:      testutils.OpenMock("../mocks/update_user.json"),
+			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, &repository.DuplicateError{Field: "email"}),
 			MockAct: func() {
 				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 				mock.ExpectExec(config.UpdateTestQuery).
-					WithArgs("Johncito", "Doecito", "23456789", "johncitodoecito@example.com", "johndoe").
-					WillReturnError(apperror.AppError(config.ErrUpdatingUser, config.ErrNoNewData))
+					WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'johncitodoecito@example.com' for key 'email'"})
 				mock.ExpectRollback()
 			},
 		},
@@ -266,13 +336,11 @@ func TestUpdate(t *testing.T) {
 			Username:    "johndoe",
 			Update:      testutils.OpenMock("../mocks/update_user.json"),
 			ExpectedErr: nil,
-			ExistsMock: func() {
+			MockAct: func() {
+				mock.ExpectBegin()
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
-			MockAct: func() {
-				mock.ExpectBegin()
 				mock.ExpectExec(config.UpdateTestQuery).
 					WithArgs("Johncito", "Doecito", "23456789", "johncitodoecito@example.com", "johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
@@ -283,7 +351,6 @@ func TestUpdate(t *testing.T) {
 
 	for _, tt := range test {
 		t.Run(tt.Name, func(t *testing.T) {
-			tt.ExistsMock()
 			tt.MockAct()
 
 			update := service.UpdateUser(ctx, tt.Username, tt.Update)
@@ -295,6 +362,8 @@ func TestUpdate(t *testing.T) {
 			}
 		})
 	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDelete(t *testing.T) {
@@ -314,47 +383,30 @@ func TestDelete(t *testing.T) {
 
 	repo := repository.NewUserRepository(gormDB)
 	service := NewUserServices(repo)
+	service.Sessions = repository.NewSessionRepository(gormDB)
 
 	test := []struct {
 		Name        string
 		Username    string
 		ExpectedErr error
-		ExistsMock  func()
 		MockAct     func()
 	}{
-		{
-			Name:        "Exists Error",
-			Username:    "johndoe",
-			ExpectedErr: apperror.AppError(config.ErrDeletingUser, config.ErrDbError),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnError(apperror.AppError(config.ErrDeletingUser, config.ErrDbError))
-			},
-			MockAct: func() {
-			},
-		},
 		{
 			Name:        "User not found",
 			Username:    "johndoe",
 			ExpectedErr: apperror.AppError(config.ErrDeletingUser, config.ErrUserNotFound),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
 			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteTestQuery).
+					WithArgs("johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
 			},
 		},
 		{
 			Name:        "Error deleting user",
 			Username:    "johndoe",
 			ExpectedErr: apperror.AppError(config.ErrDeletingUser, config.ErrDbError),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.DeleteTestQuery).
@@ -367,24 +419,23 @@ func TestDelete(t *testing.T) {
 			Name:        "Success",
 			Username:    "johndoe",
 			ExpectedErr: nil,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.DeleteTestQuery).
 					WithArgs("johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndUserSessionsTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
 		},
 	}
 
 	for _, tt := range test {
 		t.Run(tt.Name, func(t *testing.T) {
-			tt.ExistsMock()
 			tt.MockAct()
 
 			delete := service.DeleteUser(ctx, tt.Username)
@@ -396,6 +447,8 @@ func TestDelete(t *testing.T) {
 			}
 		})
 	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestChangePwd(t *testing.T) {
@@ -415,53 +468,54 @@ func TestChangePwd(t *testing.T) {
 
 	repo := repository.NewUserRepository(gormDB)
 	service := NewUserServices(repo)
+	service.Sessions = repository.NewSessionRepository(gormDB)
 
 	test := []struct {
 		Name        string
 		Username    string
 		NewPwd      string
 		ExpectedErr error
-		ExistsMock  func()
 		MockAct     func()
 	}{
 		{
-			Name:        "Exists Error",
+			Name:        "User not found",
 			Username:    "johndoe",
-			ExpectedErr: apperror.AppError(config.ErrChangingPwd, config.ErrDbError),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnError(apperror.AppError(config.ErrChangingPwd, config.ErrDbError))
-			},
+			NewPwd:      "NewPassword1234",
+			ExpectedErr: apperror.AppError(config.ErrChangingPwd, config.ErrUserNotFound),
 			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.ChangePwdTestQuery).
+					WithArgs(false, sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
 			},
 		},
 		{
-			Name:        "User not found",
+			Name:        "Error changing user password",
 			Username:    "johndoe",
 			NewPwd:      "NewPassword1234",
-			ExpectedErr: apperror.AppError(config.ErrChangingPwd, config.ErrUserNotFound),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
-			},
+			ExpectedErr: apperror.AppError(config.ErrChangingPwd, config.ErrDbError),
 			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.ChangePwdTestQuery).
+					WithArgs(false, sqlmock.AnyArg(), "johndoe").
+					WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
 			},
 		},
 		{
-			Name:        "Error changing user password",
+			Name:        "Error ending sessions",
 			Username:    "johndoe",
 			NewPwd:      "NewPassword1234",
 			ExpectedErr: apperror.AppError(config.ErrChangingPwd, config.ErrDbError),
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
+					WithArgs(false, sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndUserSessionsTestQuery).
 					WithArgs(sqlmock.AnyArg(), "johndoe").
 					WillReturnError(config.ErrDbError)
 				mock.ExpectRollback()
@@ -472,24 +526,23 @@ func TestChangePwd(t *testing.T) {
 			Username:    "johndoe",
 			NewPwd:      "NewPassword1234",
 			ExpectedErr: nil,
-			ExistsMock: func() {
-				mock.ExpectQuery(config.SearchTestQuery).
-					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-			},
 			MockAct: func() {
 				mock.ExpectBegin()
 				mock.ExpectExec(config.ChangePwdTestQuery).
-					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WithArgs(false, sqlmock.AnyArg(), "johndoe").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndUserSessionsTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
 			},
 		},
 	}
 
 	for _, tt := range test {
 		t.Run(tt.Name, func(t *testing.T) {
-			tt.ExistsMock()
 			tt.MockAct()
 
 			change := service.ChangeUserPwd(ctx, tt.Username, tt.NewPwd)
@@ -501,6 +554,8 @@ func TestChangePwd(t *testing.T) {
 			}
 		})
 	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestLogin(t *testing.T) {
@@ -525,45 +580,77 @@ func TestLogin(t *testing.T) {
 		Username    string
 		Password    string
 		ExpectedErr error
-		ExistsMock  func()
 		MockAct     func()
 	}{
 		{
-			Name:        "Exists Error",
+			Name:        "User not found",
 			Username:    "johndoe",
 			Password:    "Password1234",
-			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrDbError),
-			ExistsMock: func() {
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrUserNotFound),
+			MockAct: func() {
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnError(apperror.AppError(config.ErrLoginUser, config.ErrDbError))
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
 			},
+		},
+		{
+			Name:        "Passwords doesn't match",
+			Username:    "johndoe",
+			Password:    "Password12",
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrPwdMatching),
 			MockAct: func() {
+				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
+
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).
+						AddRow(1, hashedPwd))
 			},
 		},
 		{
-			Name:        "User not found",
+			Name:        "Error login user",
 			Username:    "johndoe",
 			Password:    "Password1234",
-			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrUserNotFound),
-			ExistsMock: func() {
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrDbError),
+			MockAct: func() {
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					WillReturnError(config.ErrDbError)
 			},
+		},
+		{
+			Name:        "User disabled",
+			Username:    "johndoe",
+			Password:    "Password1234",
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrUserDisabled),
 			MockAct: func() {
+				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
+
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "password", "disabled"}).
+						AddRow(1, hashedPwd, true))
 			},
 		},
 		{
-			Name:        "Passwords doesn't match",
+			Name:        "User disabled wrong password",
 			Username:    "johndoe",
-			Password:    "Password12",
-			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrPwdMatching),
-			ExistsMock: func() {
+			Password:    "WrongPassword",
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrUserDisabled),
+			MockAct: func() {
+				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
+
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "password", "disabled"}).
+						AddRow(1, hashedPwd, true))
 			},
+		},
+		{
+			Name:        "Success",
+			Username:    "johndoe",
+			Password:    "Password1234",
+			ExpectedErr: nil,
 			MockAct: func() {
 				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
 
@@ -574,49 +661,224 @@ func TestLogin(t *testing.T) {
 			},
 		},
 		{
-			Name:        "Error login user",
+			Name:        "Outdated hash is replaced",
 			Username:    "johndoe",
 			Password:    "Password1234",
-			ExpectedErr: apperror.AppError(config.ErrSearchingUser, config.ErrDbError),
-			ExistsMock: func() {
+			ExpectedErr: nil,
+			MockAct: func() {
+				hashedPwd, _ := bcrypt.GenerateFromPassword([]byte("Password1234"), bcrypt.MinCost)
+
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "johndoe", hashedPwd))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RehashPwdTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe", string(hashedPwd)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
+		},
+		{
+			Name:        "Rehash failure does not fail the login",
+			Username:    "johndoe",
+			Password:    "Password1234",
+			ExpectedErr: nil,
 			MockAct: func() {
+				hashedPwd, _ := bcrypt.GenerateFromPassword([]byte("Password1234"), bcrypt.MinCost)
+
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).
+						AddRow(1, "johndoe", hashedPwd))
+				mock.ExpectBegin()
+				mock.ExpectExec(config.RehashPwdTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe", string(hashedPwd)).
 					WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
 			},
 		},
-
 		{
-			Name:        "Success",
+			Name:        "Unknown hash format",
 			Username:    "johndoe",
 			Password:    "Password1234",
-			ExpectedErr: nil,
-			ExistsMock: func() {
+			ExpectedErr: apperror.AppError(config.ErrLoginUser, config.ErrUnknownHash),
+			MockAct: func() {
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).
+						AddRow(1, "Password1234"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			_, err := service.LoginUser(ctx, tt.Username, tt.Password)
+
+			if tt.ExpectedErr != nil {
+				assert.EqualError(t, tt.ExpectedErr, err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+
+	tests := []struct {
+		Name        string
+		ExpectedLen int
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name:        "Success",
+			ExpectedLen: 2,
+			MockAct: func() {
+				mock.ExpectQuery(config.ListTestQuery).
+					WithArgs(10).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "admin").AddRow("2", "johndoe"))
 			},
+		},
+		{
+			Name:        "Error",
+			ExpectedErr: apperror.AppError(config.ErrListingUsers, config.ErrDbError),
 			MockAct: func() {
-				hashedPwd, _ := encrypter.PasswordEncrypter("Password1234")
+				mock.ExpectQuery(config.ListTestQuery).
+					WithArgs(10).
+					WillReturnError(config.ErrDbError)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			users, err := service.ListUsers(ctx, 0, 10)
 
+			if tt.ExpectedErr != nil {
+				assert.EqualError(t, tt.ExpectedErr, err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, users, tt.ExpectedLen)
+			}
+		})
+	}
+}
+
+func TestSetUserDisabled(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+	service.Sessions = repository.NewSessionRepository(gormDB)
+
+	tests := []struct {
+		Name        string
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name:        "User not found",
+			ExpectedErr: apperror.AppError(config.ErrDisablingUser, config.ErrUserNotFound),
+			MockAct: func() {
+				mock.ExpectBegin()
 				mock.ExpectQuery(config.SearchTestQuery).
 					WithArgs("johndoe", 1).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).
-						AddRow(1, hashedPwd))
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name:        "Error",
+			ExpectedErr: apperror.AppError(config.ErrDisablingUser, config.ErrDbError),
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnError(config.ErrDbError)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Already Disabled",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(config.CountTestQuery).
+					WithArgs("johndoe").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndUserSessionsTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name: "Success",
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.SearchTestQuery).
+					WithArgs("johndoe", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(config.DisableTestQuery).
+					WithArgs(true, "johndoe").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(config.EndUserSessionsTestQuery).
+					WithArgs(sqlmock.AnyArg(), "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.Name, func(t *testing.T) {
-			tt.ExistsMock()
 			tt.MockAct()
 
-			err := service.LoginUser(ctx, tt.Username, tt.Password)
+			err := service.SetUserDisabled(ctx, "johndoe", true)
 
 			if tt.ExpectedErr != nil {
 				assert.EqualError(t, tt.ExpectedErr, err.Error())
@@ -625,4 +887,113 @@ func TestLogin(t *testing.T) {
 			}
 		})
 	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestModifyUser(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+
+	service := NewUserServices(repository.NewUserRepository(gormDB))
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "password"}).AddRow("1", "johndoe", "hash")
+	}
+
+	tests := []struct {
+		Name        string
+		Modify      func(current models.User) (models.User, error)
+		ExpectedErr error
+		MockAct     func()
+	}{
+		{
+			Name:        "User not found",
+			Modify:      func(current models.User) (models.User, error) { return current, nil },
+			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, config.ErrUserNotFound),
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
+					WithArgs("1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Username change",
+			Modify: func(current models.User) (models.User, error) {
+				current.Username = "johnny"
+				return current, nil
+			},
+			ExpectedErr: apperror.AppError(config.ErrUpdatingUser, config.ErrUsernameChange),
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
+					WithArgs("1", 1).
+					WillReturnRows(rows())
+				mock.ExpectRollback()
+			},
+		},
+		{
+			Name: "Keeps stored hash",
+			Modify: func(current models.User) (models.User, error) {
+				current.Name = "John"
+				return current, nil
+			},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
+					WithArgs("1", 1).
+					WillReturnRows(rows())
+				mock.ExpectExec(config.ReplaceTestQuery).
+					WithArgs("John", "", "", "", "hash", "", false, false, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			Name: "Hashes new password",
+			Modify: func(current models.User) (models.User, error) {
+				current.Password = "Password9876"
+				return current, nil
+			},
+			MockAct: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).
+					WithArgs("1", 1).
+					WillReturnRows(rows())
+				mock.ExpectExec(config.ReplaceTestQuery).
+					WithArgs("", "", "", "", sqlmock.AnyArg(), "", false, false, "johndoe").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.MockAct()
+
+			user, err := service.ModifyUser(ctx, "1", tt.Modify)
+
+			if tt.ExpectedErr != nil {
+				assert.EqualError(t, tt.ExpectedErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "1", user.ID)
+			assert.NotEqual(t, "Password9876", user.Password)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gustyaguero21/go-core/pkg/apperror"
+	"gorm.io/gorm"
+)
+
+// touchInterval limits how often a session in use records when it was last
+// seen
+const touchInterval = time.Minute
+
+// maxUserAgent is the size of the user agent column
+const maxUserAgent = 255
+
+// Service records the login sessions of users and ends them on demand.
+type Service struct {
+	repo repository.SessionRepository
+	// ttl matches the lifetime of the tokens issued at login
+	ttl time.Duration
+	now func() time.Time
+}
+
+var _ middleware.SessionChecker = (*Service)(nil)
+
+func NewService(repo repository.SessionRepository, ttl time.Duration) *Service {
+	return &Service{repo: repo, ttl: ttl, now: time.Now}
+}
+
+// Start records a login of user from the device behind userAgent and ip.
+func (s *Service) Start(ctx context.Context, user models.User, userAgent, ip string) (session models.Session, err error) {
+	ctx, span := tracing.Start(ctx, "session.Start")
+	defer func() { tracing.End(span, err) }()
+
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	now := s.now().UTC()
+	session = models.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		Username:   user.Username,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+	if createErr := s.repo.CreateSession(ctx, session); createErr != nil {
+		return models.Session{}, apperror.AppError(config.ErrStartingSession, createErr)
+	}
+	return session, nil
+}
+
+// List returns the active sessions of username, or of every user when it is
+// empty.
+func (s *Service) List(ctx context.Context, username string) (sessions []models.Session, err error) {
+	ctx, span := tracing.Start(ctx, "session.List")
+	defer func() { tracing.End(span, err) }()
+
+	sessions, listErr := s.repo.ListSessions(ctx, username, s.now().UTC())
+	if listErr != nil {
+		return nil, apperror.AppError(config.ErrListingSessions, listErr)
+	}
+	return sessions, nil
+}
+
+// End ends the session with id among the sessions of username, or among
+// every session when it is empty.
+func (s *Service) End(ctx context.Context, id, username string) (err error) {
+	ctx, span := tracing.Start(ctx, "session.End")
+	defer func() { tracing.End(span, err) }()
+
+	if endErr := s.repo.EndSession(ctx, id, username); endErr != nil {
+		if errors.Is(endErr, config.ErrNoRowsAffected) {
+			return apperror.AppError(config.ErrEndingSession, config.ErrSessionNotFound)
+		}
+		return apperror.AppError(config.ErrEndingSession, endErr)
+	}
+	return nil
+}
+
+// EndOthers ends every session of username but keep, the one the request
+// comes from, and returns how many were ended.
+func (s *Service) EndOthers(ctx context.Context, username, keep string) (ended int64, err error) {
+	ctx, span := tracing.Start(ctx, "session.EndOthers")
+	defer func() { tracing.End(span, err) }()
+
+	ended, endErr := s.repo.EndOtherSessions(ctx, username, keep)
+	if endErr != nil {
+		return 0, apperror.AppError(config.ErrEndingSession, endErr)
+	}
+	return ended, nil
+}
+
+// CheckSession refuses sessions that ended, expired or belong to another user
+// than userID, and records when the others were last seen. A user deleted and
+// created again under the same username does not get the old sessions back.
+func (s *Service) CheckSession(ctx context.Context, id, userID string) (err error) {
+	spanCtx, span := tracing.Start(ctx, "session.CheckSession")
+	defer func() { tracing.End(span, err) }()
+
+	session, getErr := s.repo.GetSession(spanCtx, id)
+	if getErr != nil {
+		if errors.Is(getErr, gorm.ErrRecordNotFound) {
+			return config.ErrSessionEnded
+		}
+		return getErr
+	}
+	now := s.now().UTC()
+	if session.RevokedAt != nil || session.UserID != userID || !now.Before(session.ExpiresAt) {
+		return config.ErrSessionEnded
+	}
+
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		// a failed write only loses the last sighting, the request goes on
+		if touchErr := s.repo.TouchSession(spanCtx, id, now); touchErr != nil {
+			slog.WarnContext(ctx, "error recording session activity", "session", id, "error", touchErr)
+		}
+	}
+	return nil
+}
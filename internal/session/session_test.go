@@ -0,0 +1,307 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/middleware"
+	"go-manage-mysql/internal/models"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type fakeRepo struct {
+	sessions map[string]models.Session
+	touched  int
+}
+
+func (r *fakeRepo) CreateSession(ctx context.Context, session models.Session) error {
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *fakeRepo) GetSession(ctx context.Context, id string) (models.Session, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return models.Session{}, gorm.ErrRecordNotFound
+	}
+	return session, nil
+}
+
+func (r *fakeRepo) ListSessions(ctx context.Context, username string, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range r.sessions {
+		if session.RevokedAt == nil && session.ExpiresAt.After(now) && (username == "" || session.Username == username) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeRepo) EndSession(ctx context.Context, id, username string) error {
+	session, ok := r.sessions[id]
+	if !ok || session.RevokedAt != nil || (username != "" && session.Username != username) {
+		return config.ErrNoRowsAffected
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *fakeRepo) EndOtherSessions(ctx context.Context, username, keep string) (int64, error) {
+	var ended int64
+	for id, session := range r.sessions {
+		if session.Username == username && session.RevokedAt == nil && id != keep {
+			now := time.Now()
+			session.RevokedAt = &now
+			r.sessions[id] = session
+			ended++
+		}
+	}
+	return ended, nil
+}
+
+func (r *fakeRepo) EndUserSessions(ctx context.Context, usernames []string) (int64, error) {
+	var ended int64
+	for _, username := range usernames {
+		n, _ := r.EndOtherSessions(ctx, username, "")
+		ended += n
+	}
+	return ended, nil
+}
+
+func (r *fakeRepo) TouchSession(ctx context.Context, id string, at time.Time) error {
+	session := r.sessions[id]
+	session.LastSeenAt = at
+	r.sessions[id] = session
+	r.touched++
+	return nil
+}
+
+var johndoe = models.User{ID: "1", Username: "johndoe"}
+
+func TestStart(t *testing.T) {
+	repo := &fakeRepo{sessions: map[string]models.Session{}}
+	s := NewService(repo, time.Hour)
+
+	session, err := s.Start(context.Background(), johndoe, strings.Repeat("a", 300), "10.0.0.1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "johndoe", session.Username)
+	assert.Len(t, session.UserAgent, maxUserAgent)
+	assert.Equal(t, session.CreatedAt.Add(time.Hour), session.ExpiresAt)
+	assert.Contains(t, repo.sessions, session.ID)
+}
+
+func TestCheckSession(t *testing.T) {
+	repo := &fakeRepo{sessions: map[string]models.Session{}}
+	s := NewService(repo, time.Hour)
+	session, err := s.Start(context.Background(), johndoe, "curl/8.0", "10.0.0.1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.CheckSession(context.Background(), session.ID, "1"))
+	// the last sighting is only written once a minute
+	assert.Equal(t, 0, repo.touched)
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.NoError(t, s.CheckSession(context.Background(), session.ID, "1"))
+	assert.Equal(t, 1, repo.touched)
+
+	test := []struct {
+		Name        string
+		ID          string
+		UserID      string
+		Act         func()
+		ExpectedErr error
+	}{
+		{Name: "Unknown Session", ID: "other", UserID: "1", ExpectedErr: config.ErrSessionEnded},
+		{Name: "Other User", ID: session.ID, UserID: "2", ExpectedErr: config.ErrSessionEnded},
+		{
+			Name:        "Expired",
+			ID:          session.ID,
+			UserID:      "1",
+			Act:         func() { s.now = func() time.Time { return time.Now().Add(2 * time.Hour) } },
+			ExpectedErr: config.ErrSessionEnded,
+		},
+		{
+			Name:   "Ended",
+			ID:     session.ID,
+			UserID: "1",
+			Act: func() {
+				s.now = time.Now
+				assert.NoError(t, s.End(context.Background(), session.ID, "johndoe"))
+			},
+			ExpectedErr: config.ErrSessionEnded,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			if tt.Act != nil {
+				tt.Act()
+			}
+
+			assert.ErrorIs(t, s.CheckSession(context.Background(), tt.ID, tt.UserID), tt.ExpectedErr)
+		})
+	}
+}
+
+func TestEndOthers(t *testing.T) {
+	repo := &fakeRepo{sessions: map[string]models.Session{}}
+	s := NewService(repo, time.Hour)
+	var ids []string
+	for range 3 {
+		session, err := s.Start(context.Background(), johndoe, "curl/8.0", "10.0.0.1")
+		assert.NoError(t, err)
+		ids = append(ids, session.ID)
+	}
+
+	ended, err := s.EndOthers(context.Background(), "johndoe", ids[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), ended)
+
+	sessions, err := s.List(context.Background(), "johndoe")
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, ids[0], sessions[0].ID)
+
+	// other users cannot see the session
+	assert.True(t, errors.Is(s.End(context.Background(), ids[0], "janedoe"), config.ErrSessionNotFound))
+}
+
+func TestUserChangesEndSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "password"}).AddRow("1", "johndoe", "hash")
+	}
+
+	test := []struct {
+		Name    string
+		MockAct func(mock sqlmock.Sqlmock)
+		Act     func(users *services.Services) error
+	}{
+		{
+			Name: "Delete",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DeleteTestQuery).WithArgs("johndoe").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Act: func(users *services.Services) error {
+				return users.DeleteUser(context.Background(), "johndoe")
+			},
+		},
+		{
+			// scim active:false
+			Name: "Modify Disabled",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(userRows())
+				mock.ExpectExec(config.ReplaceTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Act: func(users *services.Services) error {
+				_, err := users.ModifyUser(context.Background(), "1", func(current models.User) (models.User, error) {
+					current.Disabled = true
+					return current, nil
+				})
+				return err
+			},
+		},
+		{
+			// scim password
+			Name: "Modify Password",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(config.LockTestQuery).WithArgs("1", 1).WillReturnRows(userRows())
+				mock.ExpectExec(config.ReplaceTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Act: func(users *services.Services) error {
+				_, err := users.ModifyUser(context.Background(), "1", func(current models.User) (models.User, error) {
+					current.Password = "Password9876"
+					return current, nil
+				})
+				return err
+			},
+		},
+		{
+			Name: "Disable Users",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.DisableManyTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Act: func(users *services.Services) error {
+				_, err := users.DisableUsers(context.Background(), []string{"johndoe"})
+				return err
+			},
+		},
+		{
+			Name: "Expire Passwords",
+			MockAct: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(config.ExpirePasswordsTestQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			Act: func(users *services.Services) error {
+				_, err := users.ExpirePasswords(context.Background(), []string{"johndoe"})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo := &fakeRepo{sessions: map[string]models.Session{}}
+			sessions := NewService(repo, time.Hour)
+			users := services.NewUserServices(repository.NewUserRepository(gormDB))
+			users.Sessions = repo
+
+			router := gin.New()
+			router.GET("/me", middleware.Authenticate(middleware.JWT{Sessions: sessions}), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			session, err := sessions.Start(context.Background(), johndoe, "curl/8.0", "10.0.0.1")
+			assert.NoError(t, err)
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				middleware.UserIDKey: "1", "username": "johndoe", "role": models.RoleAdmin, middleware.SessionIDKey: session.ID,
+			}).SignedString([]byte(config.GetToken()))
+			request := func() int {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			assert.Equal(t, http.StatusOK, request())
+			tt.MockAct(mock)
+			assert.NoError(t, tt.Act(users))
+			assert.Equal(t, http.StatusUnauthorized, request())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
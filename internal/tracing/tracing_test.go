@@ -0,0 +1,145 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"go-manage-mysql/cmd/config"
+	"go-manage-mysql/internal/handlers"
+	"go-manage-mysql/internal/repository"
+	"go-manage-mysql/internal/services"
+	"go-manage-mysql/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestRequestSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gormDB, gormErr := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if gormErr != nil {
+		t.Fatal(gormErr)
+	}
+	assert.NoError(t, gormDB.Use(tracing.GormPlugin{}))
+
+	handler := handlers.NewUserHandler(services.NewUserServices(repository.NewUserRepository(gormDB)))
+
+	r := gin.New()
+	r.ContextWithFallback = true
+	r.Use(tracing.GinMiddleware())
+	r.GET("/search", handler.SearchUserHandler)
+
+	mock.ExpectQuery(config.SearchTestQuery).
+		WithArgs("johndoe", 1).
+		WillReturnError(config.ErrDbError)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?username=johndoe", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get(tracing.TraceIDHeader))
+	assert.True(t, strings.HasPrefix(w.Header().Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", body["trace_id"])
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	}
+
+	server, ok := spans["GET /search"]
+	assert.True(t, ok)
+	service, ok := spans["services.SearchUser"]
+	assert.True(t, ok)
+	query, ok := spans["gorm.query"]
+	assert.True(t, ok)
+
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), service.Parent().SpanID())
+	assert.Equal(t, service.SpanContext().SpanID(), query.Parent().SpanID())
+
+	for _, attr := range query.Attributes() {
+		if attr.Key == "db.query.text" {
+			assert.Contains(t, attr.Value.AsString(), "username=?")
+			assert.NotContains(t, attr.Value.AsString(), "johndoe")
+		}
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransportPropagates(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := tracing.Start(context.Background(), "caller")
+	client := &http.Client{Transport: tracing.Transport{}}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	assert.True(t, strings.HasPrefix(received, "00-"+tracing.TraceID(ctx)+"-"))
+	assert.Len(t, recorder.Ended(), 2)
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{
+		Exporter:    "file",
+		FilePath:    path,
+		SampleRatio: 1,
+		ServiceName: "test",
+	})
+	assert.NoError(t, err)
+
+	_, span := tracing.Start(context.Background(), "offline-span")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "offline-span")
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"fmt"
+	"go-manage-mysql/internal/logging"
+	"go-manage-mysql/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error mirrors go-core's web.Error and adds the trace and request ids.
+type Error struct {
+	Status    int    `json:"status"`
+	Err       string `json:"error"`
+	TraceID   string `json:"trace_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (er *Error) Error() string {
+	return fmt.Sprintf("Status: %d, Error: %s", er.Status, er.Err)
+}
+
+func NewError(ctx *gin.Context, status int, err string) {
+	errorStruct := &Error{
+		Status:  status,
+		Err:     err,
+		TraceID: ctx.GetString(tracing.TraceIDKey),
+	}
+	if ctx.Request != nil {
+		errorStruct.RequestID = logging.RequestID(ctx.Request.Context())
+	}
+	ctx.JSON(status, errorStruct)
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"encoding/json"
+	"go-manage-mysql/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	test := []struct {
+		Name    string
+		TraceID string
+	}{
+		{Name: "Without Trace", TraceID: ""},
+		{Name: "With Trace", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/error", func(c *gin.Context) {
+				if tt.TraceID != "" {
+					c.Set(tracing.TraceIDKey, tt.TraceID)
+				}
+				NewError(c, http.StatusBadRequest, "bad request")
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/error", nil))
+
+			var body map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "bad request", body["error"])
+			if tt.TraceID == "" {
+				assert.NotContains(t, body, "trace_id")
+			} else {
+				assert.Equal(t, tt.TraceID, body["trace_id"])
+			}
+		})
+	}
+}